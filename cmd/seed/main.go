@@ -0,0 +1,119 @@
+// Command seed creates a demo merchant with some content for local development,
+// using the configuration of the server. It goes through the service layer, so
+// the seed data is validated like API input. Running it again creates nothing
+// new; it prints the existing merchant and its API key instead.
+//
+// Never seed a production database: the printed API key gives access to the
+// demo merchant.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/database"
+	"github.com/mh74hf/micro-payments/internal/events"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"github.com/mh74hf/micro-payments/internal/validation"
+	"go.uber.org/zap"
+)
+
+var demoMerchant = services.MerchantImportRow{
+	Name:   "Demo Merchant",
+	Email:  "demo@example.com",
+	Domain: "demo.example.com",
+	IBAN:   "DE89370400440532013000",
+	Status: string(models.MerchantStatusActive),
+}
+
+var demoContent = []struct {
+	path, title     string
+	priceCents      int
+	durationSeconds int
+}{
+	{"/premium/article", "Premium Article", 250, 3600},
+	{"/premium/video", "Premium Video", 500, 7200},
+	{"/archive/*", "Article Archive", 1000, 30 * 24 * 3600},
+}
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.Server.Environment == config.EnvironmentProduction {
+		log.Fatal("Refusing to seed demo data in production")
+	}
+	db, err := database.NewConnection(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	logger := zap.NewNop()
+	bus := events.NewBus(logger)
+	merchantService := services.NewMerchantService(db, cfg, bus, logger)
+	contentService := services.NewContentService(db, cfg, bus, logger)
+
+	ctx := context.Background()
+	merchant, created, err := seedMerchant(ctx, merchantService)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if created {
+		fmt.Printf("created merchant %s (%s)\n", merchant.MerchantID, merchant.Domain)
+	} else {
+		fmt.Printf("merchant %s (%s) exists\n", merchant.MerchantID, merchant.Domain)
+	}
+
+	for _, demo := range demoContent {
+		title := demo.title
+		stored, err := contentService.CreateContent(ctx, &models.Content{
+			MerchantID:            merchant.MerchantID,
+			Path:                  demo.path,
+			Title:                 &title,
+			PriceCents:            demo.priceCents,
+			Currency:              cfg.Payment.DefaultCurrency,
+			AccessDurationSeconds: demo.durationSeconds,
+		})
+		switch {
+		case errors.Is(err, services.ErrContentExists):
+			fmt.Printf("content %s exists\n", demo.path)
+		case err != nil:
+			log.Fatalf("Failed to seed content %s: %v", demo.path, err)
+		default:
+			fmt.Printf("created content %s %s (%d %s)\n", stored.ContentID, stored.Path, stored.PriceCents, stored.Currency)
+		}
+	}
+
+	fmt.Printf("api key: %s\n", merchant.APIKey)
+}
+
+// seedMerchant returns the demo merchant, creating it unless it exists
+func seedMerchant(ctx context.Context, merchantService *services.MerchantService) (*models.Merchant, bool, error) {
+	domain := validation.NormalizeDomain(demoMerchant.Domain)
+	merchant, err := merchantService.GetMerchantByDomain(domain)
+	if err == nil {
+		return merchant, false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("failed to look up merchant %s: %w", domain, err)
+	}
+
+	merchant, err = merchantService.CreateMerchant(ctx, demoMerchant)
+	if errors.Is(err, services.ErrDomainTaken) {
+		return nil, false, fmt.Errorf("merchant %s exists but is not active, reactivate it with PUT /api/v1/merchants/{id}: %w", domain, err)
+	}
+	if errors.Is(err, services.ErrEmailTaken) {
+		return nil, false, fmt.Errorf("another merchant uses %s: %w", demoMerchant.Email, err)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to seed merchant: %w", err)
+	}
+	return merchant, true, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,11 +12,19 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/bank"
+	"github.com/mh74hf/micro-payments/internal/cache"
+	"github.com/mh74hf/micro-payments/internal/cachesync"
 	"github.com/mh74hf/micro-payments/internal/config"
 	"github.com/mh74hf/micro-payments/internal/database"
+	"github.com/mh74hf/micro-payments/internal/events"
 	"github.com/mh74hf/micro-payments/internal/handlers"
+	"github.com/mh74hf/micro-payments/internal/lifecycle"
+	"github.com/mh74hf/micro-payments/internal/methods"
 	"github.com/mh74hf/micro-payments/internal/middleware"
+	"github.com/mh74hf/micro-payments/internal/qr"
 	"github.com/mh74hf/micro-payments/internal/services"
+	"github.com/mh74hf/micro-payments/internal/webhooks"
 	"go.uber.org/zap"
 )
 
@@ -25,7 +34,6 @@ func main() {
 	if err != nil {
 		log.Fatal("Failed to initialize logger:", err)
 	}
-	defer logger.Sync()
 
 	// Load configuration
 	cfg, err := config.Load()
@@ -38,22 +46,128 @@ func main() {
 	if err != nil {
 		logger.Fatal("Failed to connect to database", zap.Error(err))
 	}
-	defer db.Close()
+	if cfg.Database.AutoMigrate {
+		applied, err := database.MigrateUp(context.Background(), db)
+		for _, m := range applied {
+			logger.Info("Applied migration", zap.Int64("version", m.Version), zap.String("name", m.Name))
+		}
+		if err != nil {
+			logger.Fatal("Failed to migrate database", zap.Error(err))
+		}
+	}
+
+	// Redis holds the rate limit counters shared by all instances. While it is
+	// down requests are not limited, so an unreachable server only warrants a
+	// warning.
+	redisCtx, cancelRedis := context.WithTimeout(context.Background(), 5*time.Second)
+	redisClient, err := cache.NewClient(redisCtx, cfg.Redis)
+	cancelRedis()
+	if err != nil {
+		logger.Warn("Redis unavailable, continuing without it", zap.Error(err))
+	}
+
+	// Initialize the event bus; side effects subscribe here instead of being
+	// called directly from the payment flow
+	bus := events.NewBus(logger)
+	bus.SubscribeAll(func(ctx context.Context, event events.Event) error {
+		logger.Info("Domain event", zap.String("event", event.EventName()), zap.Any("data", event))
+		return nil
+	})
+
+	// Status streams and long-polls wake on payment events instead of waiting
+	// for their next poll
+	sessionWatch := events.NewSessionWatch(bus)
 
 	// Initialize services
-	paymentService := services.NewPaymentService(db, cfg, logger)
-	merchantService := services.NewMerchantService(db, logger)
-	contentService := services.NewContentService(db, logger)
+	paymentService := services.NewPaymentService(db, cfg, bus, logger)
+	merchantService := services.NewMerchantService(db, cfg, bus, logger)
+	contentService := services.NewContentService(db, cfg, bus, logger)
+	transactionService := services.NewTransactionService(db, cfg, logger)
+	reconciliationService := services.NewReconciliationService(db, cfg, logger)
+	disputeService := services.NewDisputeService(db, cfg, bus, logger)
+	bandwidthService := services.NewBandwidthService(db, cfg, logger)
+	auditService := services.NewAuditService(db, cfg, logger)
+
+	// Incoming transfers are polled from the bank and matched to sessions. No
+	// account information API is integrated yet, so the mock bank stands in.
+	bankSyncService := services.NewBankSyncService(db, cfg, bank.NewMock(), reconciliationService, bus, logger)
+
+	// Merchant and content changes invalidate the caches of every instance
+	syncer, err := cachesync.NewSyncer(db, database.DSN(cfg.Database), logger, merchantService, contentService)
+	if err != nil {
+		logger.Fatal("Failed to start cache sync", zap.Error(err))
+	}
+	bus.Subscribe(events.NameMerchantChanged, func(ctx context.Context, event events.Event) error {
+		return syncer.Broadcast(ctx, event.(events.MerchantChanged).MerchantID)
+	})
+	bus.Subscribe(events.NameContentChanged, func(ctx context.Context, event events.Event) error {
+		return syncer.Broadcast(ctx, event.(events.ContentChanged).MerchantID)
+	})
+
+	// Merchant webhooks go through per-merchant ordered queues and fan out to
+	// every endpoint of the merchant. Events that do not fit in the queues are
+	// parked in the database until there is room. Events reach the queues in
+	// the order they were published.
+	dispatcher := webhooks.NewDispatcher(webhooks.NewHTTPDeliverer(merchantService), webhooks.NewSQLStore(db), cfg.Webhook, logger)
+	expvar.Publish("webhook_dispatcher", expvar.Func(func() interface{} {
+		return dispatcher.Stats()
+	}))
+	dispatcher.Subscribe(bus)
+
+	// Payment methods offered at checkout; merchants pick from these via the
+	// "payment_methods" setting
+	paymentMethods := methods.NewRegistry(
+		methods.SEPAQR{Config: cfg.Payment},
+	)
+
+	// Rendered QR images are cached per session; new sessions are pre-rendered
+	// at the default size so the first checkout page load is a cache hit
+	qrCache := qr.NewCache(cfg.Cache.QRMaxBytes)
+	bus.Subscribe(events.NamePaymentCreated, func(ctx context.Context, event events.Event) error {
+		created := event.(events.PaymentCreated)
+		return qrCache.Warm(created.SessionID, created.QRCodeData, qr.FormatPNG, cfg.Payment.QRCodeSize)
+	})
+
+	// Background workers share one context and are waited for on shutdown.
+	// Access counts and proxied bytes are buffered in memory and written in
+	// batches. Periodic jobs: bank transactions are synced, stale sessions are
+	// expired, paid sessions are checked against settled bank transactions and
+	// parked webhooks are retried.
+	workers := lifecycle.NewWorkers(logger)
+	workers.Go("access counts", contentService.RunAccessCounts)
+	workers.Go("bandwidth usage", bandwidthService.Run)
+	workers.Go("bank sync", bankSyncService.Run)
+	workers.Go("session expiry", paymentService.RunSessionExpiry)
+	workers.Go("balance checks", reconciliationService.RunBalanceChecks)
+	workers.Go("webhook retries", dispatcher.RunRetries)
+
+	// Readiness follows the background workers: ready once they run, not ready
+	// as soon as shutdown begins
+	readiness := &lifecycle.Readiness{}
+	readiness.Started()
+
+	// Dependencies reported by /health. Redis is only checked while rate
+	// limiting, its only user, is enabled.
+	healthChecks := []handlers.HealthCheck{{Name: "database", Ping: db.PingContext}}
+	if cfg.RateLimit.Enabled {
+		healthChecks = append(healthChecks, handlers.HealthCheck{Name: "redis", Ping: redisClient.Ping})
+	}
 
 	// Initialize handlers
-	handlers := handlers.NewHandlers(paymentService, merchantService, contentService, logger)
+	handlers := handlers.NewHandlers(paymentService, merchantService, contentService, transactionService, reconciliationService, disputeService, bandwidthService, auditService, paymentMethods, qrCache, sessionWatch, dispatcher, cfg, logger)
 
 	// Set up Gin router
-	if cfg.Server.Environment == "production" {
+	if cfg.Server.Environment == config.EnvironmentProduction {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
 	router := gin.New()
+	router.LoadHTMLGlob("web/templates/*.html")
+	// gin trusts every proxy by default, which would let clients choose the IP
+	// that free trials and IP-based access are granted to
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		logger.Fatal("Invalid trusted proxies", zap.Error(err))
+	}
 
 	// Add middleware
 	router.Use(gin.Logger())
@@ -62,47 +176,100 @@ func main() {
 	router.Use(middleware.RequestID())
 	router.Use(middleware.Logger(logger))
 
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":    "healthy",
-			"timestamp": time.Now().UTC(),
-		})
-	})
+	// Health check endpoints: /health for load balancers, /healthz and
+	// /readyz as Kubernetes liveness and readiness probes
+	router.GET("/health", handlers.Health(healthChecks...))
+	router.GET("/healthz", handlers.Live)
+	router.GET("/readyz", handlers.Ready(readiness, healthChecks...))
 
 	// API routes
 	v1 := router.Group("/api/v1")
+	v1.Use(middleware.NoStore())
+	activity := middleware.NewActivityTracker(redisClient, merchantService, logger)
+	auth := middleware.AuthRequired(merchantService, activity, cfg.Admin.APIKey, logger)
 	{
 		// Payment routes
 		payments := v1.Group("/payments")
+		payments.Use(middleware.BodyLimit(cfg.Server.MaxBodyBytes))
 		{
-			payments.POST("/", handlers.CreatePayment)
+			payments.POST("/", middleware.RateLimit(redisClient, cfg.RateLimit, logger), handlers.CreatePayment)
+			payments.GET("", auth, handlers.ListPayments)
+			payments.GET("/methods", handlers.GetPaymentMethods)
+			payments.GET("/quote", handlers.GetPaymentQuote)
 			payments.GET("/:sessionId", handlers.GetPaymentStatus)
+			payments.GET("/:sessionId/events", handlers.StreamPaymentStatus)
 			payments.POST("/:sessionId/verify", handlers.VerifyPayment)
+			payments.POST("/:sessionId/heartbeat", handlers.HeartbeatPayment)
+			payments.POST("/:sessionId/renew", handlers.RenewPayment)
+			payments.POST("/:sessionId/cancel", handlers.CancelPayment)
+			payments.POST("/:sessionId/refund", auth, middleware.AdminOnly(), handlers.RefundPayment)
+			payments.GET("/:sessionId/qr", handlers.GetPaymentQR)
+			payments.GET("/:sessionId/qr.png", handlers.GetPaymentQR)
 		}
 
-		// Content access routes
+		// Content access routes, and managing the content of the merchant
+		// whose API key is sent
 		content := v1.Group("/content")
 		{
-			content.GET("/*path", handlers.ServeContent)
+			content.GET("", auth, handlers.ListOwnContent)
+			content.POST("", auth, handlers.CreateOwnContent)
+			content.Any("/*path", handlers.ContentRoute(auth))
 		}
 
-		// Merchant routes (authenticated)
+		// Public content metadata, cacheable by CDNs
+		v1.GET("/content-info/*path", handlers.GetContentInfo)
+		v1.GET("/catalog", handlers.GetCatalog)
+
+		// Merchant routes, authenticated by API key. Merchants only reach their
+		// own :id routes; listing and creating merchants is for admins.
 		merchants := v1.Group("/merchants")
-		merchants.Use(middleware.AuthRequired())
+		merchants.Use(middleware.BodyLimit(cfg.Server.MaxBodyBytes), auth, middleware.MerchantScope())
 		{
-			merchants.GET("/", handlers.GetMerchants)
-			merchants.POST("/", handlers.CreateMerchant)
+			merchants.GET("/", middleware.AdminOnly(), handlers.GetMerchants)
+			merchants.POST("/", middleware.AdminOnly(), handlers.CreateMerchant)
+			merchants.GET("/:id", handlers.GetMerchant)
 			merchants.PUT("/:id", handlers.UpdateMerchant)
 			merchants.DELETE("/:id", handlers.DeleteMerchant)
+			merchants.POST("/:id/webhook-secret/rotate", handlers.RotateWebhookSecret)
+			merchants.POST("/:id/rotate-key", handlers.RotateAPIKey)
+			merchants.GET("/:id/webhooks", handlers.ListWebhooks)
+			merchants.POST("/:id/webhooks", handlers.AddWebhook)
+			merchants.DELETE("/:id/webhooks/:webhookId", handlers.RemoveWebhook)
+			merchants.POST("/:id/webhooks/:webhookId/secret/rotate", handlers.RotateEndpointSecret)
+			merchants.GET("/:id/content", handlers.ListContent)
+			merchants.POST("/:id/content", handlers.CreateContent)
+			merchants.PUT("/:id/content/:contentId", handlers.UpdateContent)
+			merchants.DELETE("/:id/content/:contentId", handlers.DeleteContent)
+			merchants.DELETE("/:id/content/:contentId/access/:userId", handlers.RevokeContentAccess)
+			merchants.POST("/:id/content/:contentId/access/:userId/renew", handlers.RenewContentAccess)
 		}
 
-		// Admin routes (authenticated)
+		// Admin routes, authenticated by the admin API key
 		admin := v1.Group("/admin")
-		admin.Use(middleware.AuthRequired())
+		admin.Use(auth, middleware.AdminOnly())
 		{
 			admin.GET("/stats", handlers.GetStats)
+			admin.GET("/audit-log", handlers.ListAuditLog)
+			admin.GET("/revenue", handlers.GetRevenueReport)
 			admin.GET("/transactions", handlers.GetTransactions)
+			admin.GET("/transactions/export", handlers.ExportTransactions)
+			admin.GET("/transactions/:id", handlers.GetTransaction)
+			admin.POST("/transactions/:id/return", handlers.ReturnTransaction)
+			admin.POST("/payments/:sessionId/decline", handlers.DeclinePayment)
+			admin.GET("/reconciliation/dry-run", handlers.ReconcileDryRun)
+			admin.GET("/reconciliation/balances", handlers.GetBalanceReport)
+			admin.GET("/metrics", gin.WrapH(expvar.Handler()))
+			admin.POST("/reconciliation/backfill", handlers.ReconcileBackfill)
+			admin.POST("/reconciliation/partial-payments", handlers.FailPartialPayments)
+			admin.GET("/qr-cache", handlers.GetQRCacheStats)
+			admin.GET("/webhooks/failures", handlers.ListWebhookFailures)
+			admin.POST("/webhooks/failures/:eventId/replay", handlers.ReplayWebhook)
+			admin.POST("/merchants/import", handlers.ImportMerchants)
+			admin.GET("/disputes", handlers.ListDisputes)
+			admin.POST("/disputes", handlers.OpenDispute)
+			admin.GET("/disputes/:id", handlers.GetDispute)
+			admin.POST("/disputes/:id/transition", handlers.AdvanceDispute)
+			admin.POST("/disputes/:id/notes", handlers.AddDisputeNote)
 		}
 	}
 
@@ -135,13 +302,47 @@ func main() {
 	<-quit
 	logger.Info("Shutting down server...")
 
-	// Graceful shutdown with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Graceful shutdown with timeout. Steps run in this order: report not
+	// ready and give load balancers time to notice, stop taking requests, let
+	// in-flight events finish, stop the background workers and wait for them,
+	// flush buffered access counts, bandwidth and webhooks, then close the
+	// connections those flushes used and sync logs.
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
-	if err := srv.Shutdown(ctx); err != nil {
-		logger.Fatal("Server forced to shutdown", zap.Error(err))
-	}
+	shutdown := lifecycle.NewRegistry(logger)
+	shutdown.Register("readiness", false, readiness.Drain(cfg.Server.DrainDelay))
+	shutdown.Register("http server", false, srv.Shutdown)
+	shutdown.Register("event subscribers", false, bus.Wait)
+	shutdown.Register("merchant activity", false, activity.Wait)
+	shutdown.Register("background workers", false, workers.Stop)
+	shutdown.Register("access counts", true, contentService.FlushAccessCounts)
+	shutdown.Register("bandwidth usage", true, bandwidthService.Flush)
+	shutdown.Register("webhook queue", true, func(ctx context.Context) error {
+		drainCtx, cancel := context.WithTimeout(ctx, cfg.Webhook.DrainTimeout)
+		defer cancel()
+		return dispatcher.Close(drainCtx)
+	})
+	shutdown.Register("cache sync", false, func(context.Context) error {
+		return syncer.Close()
+	})
+	shutdown.Register("redis", false, func(context.Context) error {
+		return redisClient.Close()
+	})
+	shutdown.Register("database", false, func(context.Context) error {
+		return db.Close()
+	})
 
-	logger.Info("Server exited")
+	err = shutdown.Stop(ctx)
+	if err != nil {
+		logger.Error("Server exited with unflushed data", zap.Error(err))
+	} else {
+		logger.Info("Server exited")
+	}
+	// Logs are synced last so the shutdown itself is on record; stdout and
+	// stderr may not support syncing, which is not worth reporting
+	logger.Sync()
+	if err != nil {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,72 @@
+package access
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// Cache holds compiled rules per content. Entries are keyed on the content's
+// UpdatedAt, so an updated row is recompiled even if an invalidation was missed.
+type Cache struct {
+	mu         sync.RWMutex
+	entries    map[uuid.UUID]cacheEntry
+	maxEntries int
+}
+
+type cacheEntry struct {
+	updatedAt time.Time
+	rules     *Rules
+}
+
+// NewCache creates a cache holding at most maxEntries compiled rule sets
+func NewCache(maxEntries int) *Cache {
+	return &Cache{
+		entries:    make(map[uuid.UUID]cacheEntry),
+		maxEntries: maxEntries,
+	}
+}
+
+// Rules returns the compiled rules of content, compiling them on first use
+func (c *Cache) Rules(content *models.Content) (*Rules, error) {
+	c.mu.RLock()
+	entry, ok := c.entries[content.ContentID]
+	c.mu.RUnlock()
+	if ok && entry.updatedAt.Equal(content.UpdatedAt) {
+		return entry.rules, nil
+	}
+
+	rules, err := Compile(content.AccessRules)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= c.maxEntries {
+		// Drop an arbitrary entry; recompiling is cheap compared to serving
+		for id := range c.entries {
+			delete(c.entries, id)
+			break
+		}
+	}
+	c.entries[content.ContentID] = cacheEntry{updatedAt: content.UpdatedAt, rules: rules}
+	c.mu.Unlock()
+
+	return rules, nil
+}
+
+// Invalidate drops the compiled rules of a content
+func (c *Cache) Invalidate(contentID uuid.UUID) {
+	c.mu.Lock()
+	delete(c.entries, contentID)
+	c.mu.Unlock()
+}
+
+// Reset drops all compiled rules
+func (c *Cache) Reset() {
+	c.mu.Lock()
+	c.entries = make(map[uuid.UUID]cacheEntry)
+	c.mu.Unlock()
+}
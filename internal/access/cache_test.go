@@ -0,0 +1,76 @@
+package access
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+func TestCacheRules(t *testing.T) {
+	updated := time.Date(2024, 3, 12, 10, 0, 0, 0, time.UTC)
+	content := &models.Content{
+		ContentID:   uuid.New(),
+		AccessRules: models.JSONMap{"free_methods": []interface{}{"GET"}},
+		UpdatedAt:   updated,
+	}
+	get := Request{Method: "GET"}
+	tests := []struct {
+		name        string
+		change      func(c *Cache, content *models.Content)
+		want        Policy
+		wantCompile bool
+	}{
+		{"cached", func(*Cache, *models.Content) {}, PolicyFree, false},
+		{"row changed without invalidation", func(_ *Cache, content *models.Content) {
+			content.AccessRules = models.JSONMap{}
+			content.UpdatedAt = updated.Add(time.Second)
+		}, PolicyPaid, true},
+		{"stale rules kept until the row changes", func(_ *Cache, content *models.Content) {
+			content.AccessRules = models.JSONMap{}
+		}, PolicyFree, false},
+		{"invalidated", func(c *Cache, content *models.Content) {
+			content.AccessRules = models.JSONMap{}
+			c.Invalidate(content.ContentID)
+		}, PolicyPaid, true},
+		{"reset", func(c *Cache, content *models.Content) {
+			content.AccessRules = models.JSONMap{}
+			c.Reset()
+		}, PolicyPaid, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewCache(10)
+			content := *content
+			first, err := cache.Rules(&content)
+			if err != nil {
+				t.Fatalf("Rules() error = %v", err)
+			}
+
+			tt.change(cache, &content)
+			rules, err := cache.Rules(&content)
+			if err != nil {
+				t.Fatalf("Rules() error = %v", err)
+			}
+			if got := rules.Evaluate(get).Policy; got != tt.want {
+				t.Errorf("Evaluate() policy = %s, want %s", got, tt.want)
+			}
+			if compiled := rules != first; compiled != tt.wantCompile {
+				t.Errorf("recompiled = %v, want %v", compiled, tt.wantCompile)
+			}
+		})
+	}
+}
+
+func TestCacheBounded(t *testing.T) {
+	cache := NewCache(3)
+	for i := 0; i < 10; i++ {
+		if _, err := cache.Rules(&models.Content{ContentID: uuid.New()}); err != nil {
+			t.Fatalf("Rules() error = %v", err)
+		}
+	}
+	if n := len(cache.entries); n != 3 {
+		t.Errorf("cache holds %d entries, want 3", n)
+	}
+}
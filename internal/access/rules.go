@@ -0,0 +1,286 @@
+// Package access evaluates the per-content access rules stored in the
+// content.access_rules JSONB column. Rules are compiled once into a Rules value
+// so the per-request check never parses JSON, CIDRs or lists.
+package access
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Policy says how a request is treated for a piece of content
+type Policy string
+
+const (
+	// PolicyPaid requires a valid access grant; this is the default
+	PolicyPaid Policy = "paid"
+	// PolicyFree passes the request through without an access check
+	PolicyFree Policy = "free"
+	// PolicyDenied rejects the request whether or not the user paid
+	PolicyDenied Policy = "denied"
+)
+
+// Reasons a request is denied
+const (
+	ReasonMethodDenied      = "method_denied"
+	ReasonIPBlocked         = "ip_blocked"
+	ReasonIPNotAllowed      = "ip_not_allowed"
+	ReasonCountryNotAllowed = "country_not_allowed"
+	ReasonRefererNotAllowed = "referer_not_allowed"
+	ReasonLegallyRestricted = "legally_restricted"
+)
+
+// Access rule keys
+const (
+	freeMethodsRule      = "free_methods"
+	deniedMethodsRule    = "denied_methods"
+	allowedCIDRsRule     = "allowed_cidrs"
+	blockedCIDRsRule     = "blocked_cidrs"
+	allowedCountriesRule = "allowed_countries"
+	allowedReferersRule  = "allowed_referers"
+	freeTrialRule        = "free_first_access_seconds"
+	// LegalBlockedCountriesRule lists countries the content may not be offered
+	// in; merchants can set the same key in their settings to cover all content
+	LegalBlockedCountriesRule = "legal_blocked_countries"
+)
+
+// knownMethods are the methods that may appear in method rules
+var knownMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true,
+	"PATCH": true, "DELETE": true, "OPTIONS": true,
+}
+
+// Request holds the request attributes rules are evaluated against
+type Request struct {
+	Method  string
+	IP      net.IP
+	Country string // ISO 3166-1 alpha-2, empty when unknown
+	Referer string
+}
+
+// Decision is the outcome of evaluating rules for a request
+type Decision struct {
+	Policy Policy
+	Reason string // set when Policy is PolicyDenied
+}
+
+// Rules is the compiled form of a content's access rules
+type Rules struct {
+	freeMethods   map[string]bool
+	deniedMethods map[string]bool
+	allowedNets   []*net.IPNet
+	blockedNets   []*net.IPNet
+	countries     map[string]bool
+	legalBlocked  map[string]bool
+	referers      map[string]bool
+	freeTrial     time.Duration
+}
+
+// Compile parses access rules:
+//
+//   - "free_methods", "denied_methods": HTTP methods passed without payment or
+//     always rejected; other methods require payment
+//   - "allowed_cidrs", "blocked_cidrs": client networks, e.g. "10.0.0.0/8"
+//   - "allowed_countries": ISO country codes of the client
+//   - "legal_blocked_countries": ISO country codes the content is legally
+//     unavailable in, see LegallyBlocked
+//   - "allowed_referers": host names the Referer must point to
+//   - "free_first_access_seconds": length of the one-time free access each
+//     user gets before paying; absent or 0 disables it
+//
+// Keys it does not know are ignored, since access rules also carry settings like
+// "disposition" or "preview_bytes".
+func Compile(raw map[string]interface{}) (*Rules, error) {
+	r := &Rules{}
+	var err error
+
+	if r.freeMethods, err = methodSet(raw, freeMethodsRule); err != nil {
+		return nil, err
+	}
+	if r.deniedMethods, err = methodSet(raw, deniedMethodsRule); err != nil {
+		return nil, err
+	}
+	for method := range r.freeMethods {
+		if r.deniedMethods[method] {
+			return nil, fmt.Errorf("%s is listed in both %s and %s", method, freeMethodsRule, deniedMethodsRule)
+		}
+	}
+	if r.allowedNets, err = networks(raw, allowedCIDRsRule); err != nil {
+		return nil, err
+	}
+	if r.blockedNets, err = networks(raw, blockedCIDRsRule); err != nil {
+		return nil, err
+	}
+
+	if r.countries, err = countrySet(raw, allowedCountriesRule); err != nil {
+		return nil, err
+	}
+	if r.legalBlocked, err = countrySet(raw, LegalBlockedCountriesRule); err != nil {
+		return nil, err
+	}
+
+	referers, err := stringList(raw, allowedReferersRule)
+	if err != nil {
+		return nil, err
+	}
+	for _, host := range referers {
+		if r.referers == nil {
+			r.referers = make(map[string]bool)
+		}
+		r.referers[strings.ToLower(host)] = true
+	}
+
+	if v, ok := raw[freeTrialRule]; ok {
+		seconds, ok := v.(float64)
+		if !ok || seconds < 0 || seconds != float64(int64(seconds)) {
+			return nil, fmt.Errorf("%s must be a whole number of seconds", freeTrialRule)
+		}
+		r.freeTrial = time.Duration(seconds) * time.Second
+	}
+
+	return r, nil
+}
+
+// FreeTrial returns how long the free first access lasts, 0 when disabled
+func (r *Rules) FreeTrial() time.Duration {
+	return r.freeTrial
+}
+
+// LegallyBlocked reports whether the content may not be offered to clients in
+// country. It is checked apart from Evaluate because it also applies before a
+// payment session is created, and answered with 451 rather than 403.
+func (r *Rules) LegallyBlocked(country string) bool {
+	return r.legalBlocked[strings.ToUpper(country)]
+}
+
+// ValidateRules checks access rules before they are stored
+func ValidateRules(raw map[string]interface{}) error {
+	_, err := Compile(raw)
+	return err
+}
+
+// Evaluate decides how req is treated. Denied methods and network, country and
+// referer restrictions are checked first; then free methods pass and everything
+// else requires payment. Empty lists impose no restriction.
+func (r *Rules) Evaluate(req Request) Decision {
+	method := strings.ToUpper(req.Method)
+	if r.deniedMethods[method] {
+		return Decision{Policy: PolicyDenied, Reason: ReasonMethodDenied}
+	}
+	if containsIP(r.blockedNets, req.IP) {
+		return Decision{Policy: PolicyDenied, Reason: ReasonIPBlocked}
+	}
+	if len(r.allowedNets) > 0 && !containsIP(r.allowedNets, req.IP) {
+		return Decision{Policy: PolicyDenied, Reason: ReasonIPNotAllowed}
+	}
+	if r.countries != nil && !r.countries[strings.ToUpper(req.Country)] {
+		return Decision{Policy: PolicyDenied, Reason: ReasonCountryNotAllowed}
+	}
+	if r.referers != nil && !r.referers[refererHost(req.Referer)] {
+		return Decision{Policy: PolicyDenied, Reason: ReasonRefererNotAllowed}
+	}
+	if r.freeMethods[method] {
+		return Decision{Policy: PolicyFree}
+	}
+	return Decision{Policy: PolicyPaid}
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func refererHost(referer string) string {
+	u, err := url.Parse(referer)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func stringList(raw map[string]interface{}, key string) ([]string, error) {
+	v, ok := raw[key]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be a list", key)
+	}
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		s, ok := item.(string)
+		if !ok || s == "" {
+			return nil, fmt.Errorf("%s contains invalid entry %v", key, item)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// countrySet returns the upper-cased ISO country codes listed under key, or nil
+// when the list is absent or empty
+func countrySet(raw map[string]interface{}, key string) (map[string]bool, error) {
+	list, err := stringList(raw, key)
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	set := make(map[string]bool, len(list))
+	for _, country := range list {
+		if len(country) != 2 {
+			return nil, fmt.Errorf("%s contains invalid country code %q", key, country)
+		}
+		set[strings.ToUpper(country)] = true
+	}
+	return set, nil
+}
+
+func methodSet(raw map[string]interface{}, key string) (map[string]bool, error) {
+	list, err := stringList(raw, key)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool, len(list))
+	for _, method := range list {
+		method = strings.ToUpper(method)
+		if !knownMethods[method] {
+			return nil, fmt.Errorf("%s contains unknown HTTP method %s", key, method)
+		}
+		set[method] = true
+	}
+	return set, nil
+}
+
+func networks(raw map[string]interface{}, key string) ([]*net.IPNet, error) {
+	list, err := stringList(raw, key)
+	if err != nil {
+		return nil, err
+	}
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, cidr := range list {
+		if !strings.Contains(cidr, "/") {
+			// A bare address is a single-host network
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%s contains invalid network %q", key, cidr)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
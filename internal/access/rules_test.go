@@ -0,0 +1,146 @@
+package access
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// complexRules returns access rules with lists of the given length, decoded
+// from JSON like the content.access_rules column
+func complexRules(tb testing.TB, n int) models.JSONMap {
+	tb.Helper()
+	var allowed, blocked, countries, referers []string
+	for i := 0; i < n; i++ {
+		allowed = append(allowed, fmt.Sprintf("10.%d.0.0/16", i))
+		blocked = append(blocked, fmt.Sprintf("10.%d.255.%d", i, i%256))
+		countries = append(countries, fmt.Sprintf("%c%c", 'A'+i/26%26, 'A'+i%26))
+		referers = append(referers, fmt.Sprintf("site%d.example.com", i))
+	}
+	raw, err := json.Marshal(map[string]interface{}{
+		"free_methods":            []string{"HEAD", "OPTIONS"},
+		"denied_methods":          []string{"DELETE"},
+		"allowed_cidrs":           allowed,
+		"blocked_cidrs":           blocked,
+		"allowed_countries":       countries,
+		"legal_blocked_countries": []string{"KP"},
+		"allowed_referers":        referers,
+		"disposition":             "inline",
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var rules models.JSONMap
+	if err := rules.Scan(raw); err != nil {
+		tb.Fatal(err)
+	}
+	return rules
+}
+
+func TestEvaluate(t *testing.T) {
+	rules, err := Compile(complexRules(t, 30))
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	allowed := Request{Method: "GET", IP: net.ParseIP("10.3.1.1"), Country: "ab", Referer: "https://Site3.example.com/article"}
+	tests := []struct {
+		name   string
+		change func(*Request)
+		want   Decision
+	}{
+		{"allowed request pays", func(*Request) {}, Decision{Policy: PolicyPaid}},
+		{"free method", func(r *Request) { r.Method = "head" }, Decision{Policy: PolicyFree}},
+		{"denied method", func(r *Request) { r.Method = "DELETE" }, Decision{Policy: PolicyDenied, Reason: ReasonMethodDenied}},
+		{"blocked address", func(r *Request) { r.IP = net.ParseIP("10.3.255.3") }, Decision{Policy: PolicyDenied, Reason: ReasonIPBlocked}},
+		{"address outside the allowed networks", func(r *Request) { r.IP = net.ParseIP("192.0.2.1") }, Decision{Policy: PolicyDenied, Reason: ReasonIPNotAllowed}},
+		{"unknown address", func(r *Request) { r.IP = nil }, Decision{Policy: PolicyDenied, Reason: ReasonIPNotAllowed}},
+		{"country not allowed", func(r *Request) { r.Country = "ZZ" }, Decision{Policy: PolicyDenied, Reason: ReasonCountryNotAllowed}},
+		{"unknown country", func(r *Request) { r.Country = "" }, Decision{Policy: PolicyDenied, Reason: ReasonCountryNotAllowed}},
+		{"referer not allowed", func(r *Request) { r.Referer = "https://evil.example.com/" }, Decision{Policy: PolicyDenied, Reason: ReasonRefererNotAllowed}},
+		{"no referer", func(r *Request) { r.Referer = "" }, Decision{Policy: PolicyDenied, Reason: ReasonRefererNotAllowed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := allowed
+			tt.change(&req)
+			if got := rules.Evaluate(req); got != tt.want {
+				t.Errorf("Evaluate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if !rules.LegallyBlocked("kp") || rules.LegallyBlocked("NL") {
+		t.Errorf("LegallyBlocked() does not follow %s", LegalBlockedCountriesRule)
+	}
+}
+
+func TestCompileRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules map[string]interface{}
+	}{
+		{"method both free and denied", map[string]interface{}{"free_methods": []interface{}{"GET"}, "denied_methods": []interface{}{"get"}}},
+		{"unknown method", map[string]interface{}{"free_methods": []interface{}{"FETCH"}}},
+		{"list is a string", map[string]interface{}{"allowed_cidrs": "10.0.0.0/8"}},
+		{"malformed network", map[string]interface{}{"blocked_cidrs": []interface{}{"10.0.0.0/33"}}},
+		{"empty entry", map[string]interface{}{"allowed_referers": []interface{}{""}}},
+		{"country code too long", map[string]interface{}{"allowed_countries": []interface{}{"NLD"}}},
+		{"fractional free trial", map[string]interface{}{"free_first_access_seconds": 1.5}},
+		{"negative free trial", map[string]interface{}{"free_first_access_seconds": -60.0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Compile(tt.rules); err == nil {
+				t.Errorf("Compile(%v) succeeded", tt.rules)
+			}
+		})
+	}
+}
+
+// BenchmarkServeRules measures the access rule check of a serve request for
+// content with complex rules: compiling the stored rules on every request, as
+// before rules were cached, against looking them up in the Cache.
+func BenchmarkServeRules(b *testing.B) {
+	req := Request{Method: "GET", IP: net.ParseIP("10.49.1.1"), Country: "AX", Referer: "https://site49.example.com/"}
+	for _, size := range []int{5, 50} {
+		content := &models.Content{ContentID: uuid.New(), AccessRules: complexRules(b, size)}
+
+		b.Run(fmt.Sprintf("uncached/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				rules, err := Compile(content.AccessRules)
+				if err != nil {
+					b.Fatal(err)
+				}
+				rules.Evaluate(req)
+			}
+		})
+		b.Run(fmt.Sprintf("cached/%d", size), func(b *testing.B) {
+			cache := NewCache(100)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				rules, err := cache.Rules(content)
+				if err != nil {
+					b.Fatal(err)
+				}
+				rules.Evaluate(req)
+			}
+		})
+		b.Run(fmt.Sprintf("cached-parallel/%d", size), func(b *testing.B) {
+			cache := NewCache(100)
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					rules, err := cache.Rules(content)
+					if err != nil {
+						b.Fatal(err)
+					}
+					rules.Evaluate(req)
+				}
+			})
+		})
+	}
+}
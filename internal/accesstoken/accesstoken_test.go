@@ -0,0 +1,90 @@
+package accesstoken
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const secret = "test-secret"
+
+func testToken(now time.Time) Token {
+	return Token{
+		SessionID: uuid.MustParse("6f1c2d3e-0000-4000-8000-000000000001"),
+		ContentID: uuid.MustParse("6f1c2d3e-0000-4000-8000-000000000002"),
+		User:      "user-42",
+		IssuedAt:  now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	want := testToken(now)
+	signed, err := Sign(want, secret)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	got, err := Verify(signed, secret, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if got.SessionID != want.SessionID || got.ContentID != want.ContentID || got.User != want.User ||
+		!got.IssuedAt.Equal(want.IssuedAt) || !got.ExpiresAt.Equal(want.ExpiresAt) {
+		t.Errorf("Verify() = %+v, want %+v", *got, want)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signed, err := Sign(testToken(now), secret)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	parts := strings.Split(signed, ".")
+
+	// A payload signed for another user, spliced onto this token's signature
+	other := testToken(now)
+	other.User = "someone-else"
+	otherSigned, err := Sign(other, secret)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	otherPayload := strings.Split(otherSigned, ".")[1]
+	noneHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+
+	tests := []struct {
+		name  string
+		token string
+		key   string
+		at    time.Time
+		want  error
+	}{
+		{"expired", signed, secret, now.Add(time.Hour), ErrExpired},
+		{"long expired", signed, secret, now.Add(48 * time.Hour), ErrExpired},
+		{"wrong secret", signed, "other-secret", now, ErrInvalidSignature},
+		{"empty secret", signed, "", now, ErrInvalidSignature},
+		{"tampered payload", parts[0] + "." + otherPayload + "." + parts[2], secret, now, ErrInvalidSignature},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString([]byte("forged")), secret, now, ErrInvalidSignature},
+		{"unsigned", parts[0] + "." + parts[1] + ".", secret, now, ErrInvalidSignature},
+		{"alg none", noneHeader + "." + parts[1] + ".", secret, now, ErrMalformed},
+		{"signature not base64", parts[0] + "." + parts[1] + ".!!", secret, now, ErrMalformed},
+		{"two parts", parts[0] + "." + parts[1], secret, now, ErrMalformed},
+		{"empty", "", secret, now, ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Verify(tt.token, tt.key, tt.at)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+			if got != nil {
+				t.Errorf("Verify() = %+v, want nil", *got)
+			}
+		})
+	}
+}
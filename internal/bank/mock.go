@@ -0,0 +1,43 @@
+// Package bank holds clients for the bank accounts merchants are paid into.
+package bank
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// Mock is an in-memory bank that reports the transactions added to it. It
+// stands in for a real account information API in development and demos.
+type Mock struct {
+	mu           sync.Mutex
+	transactions []models.BankTransaction
+}
+
+// NewMock creates a mock bank without transactions
+func NewMock() *Mock {
+	return &Mock{}
+}
+
+// Add books a transaction on the mock bank
+func (m *Mock) Add(tx models.BankTransaction) {
+	m.mu.Lock()
+	m.transactions = append(m.transactions, tx)
+	m.mu.Unlock()
+}
+
+// Transactions returns the transactions booked at or after since
+func (m *Mock) Transactions(ctx context.Context, since time.Time) ([]models.BankTransaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out []models.BankTransaction
+	for _, tx := range m.transactions {
+		if !tx.BookingDate.Before(since) {
+			out = append(out, tx)
+		}
+	}
+	return out, nil
+}
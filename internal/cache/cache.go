@@ -0,0 +1,90 @@
+// Package cache connects to the Redis server shared by all instances.
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Client is the part of Redis the server depends on. NewClient returns one
+// backed by go-redis; tests can pass a fake instead.
+type Client interface {
+	// Do sends a command and returns its reply: a string for simple and bulk
+	// strings, int64 for integers, []interface{} for arrays and nil for null
+	// replies. Error replies are returned as errors.
+	Do(ctx context.Context, args ...string) (interface{}, error)
+	// Eval runs a Lua script with the given keys and arguments, replying like
+	// Do
+	Eval(ctx context.Context, script string, keys []string, args ...string) (interface{}, error)
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// NewClient creates the client for cfg and pings the server. The client is
+// returned even when the ping fails: it reconnects on use, and everything
+// built on it tolerates Redis being down, so callers decide whether an
+// unreachable server at startup is fatal.
+func NewClient(ctx context.Context, cfg config.RedisConfig) (Client, error) {
+	client := &redisClient{rdb: redis.NewClient(options(cfg))}
+	if err := client.Ping(ctx); err != nil {
+		return client, fmt.Errorf("failed to ping redis at %s: %w", cfg.Addr, err)
+	}
+	return client, nil
+}
+
+// options maps cfg onto the go-redis options
+func options(cfg config.RedisConfig) *redis.Options {
+	return &redis.Options{
+		Addr:         cfg.Addr,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		PoolSize:     cfg.PoolSize,
+		MinIdleConns: cfg.MinIdleConns,
+		// Do promises RESP2 reply types; RESP3 would turn some replies into
+		// maps and sets
+		Protocol:        2,
+		DisableIdentity: true,
+	}
+}
+
+// redisClient adapts *redis.Client to Client
+type redisClient struct {
+	rdb *redis.Client
+}
+
+func (c *redisClient) Do(ctx context.Context, args ...string) (interface{}, error) {
+	return reply(c.rdb.Do(ctx, interfaces(args)...).Result())
+}
+
+func (c *redisClient) Eval(ctx context.Context, script string, keys []string, args ...string) (interface{}, error) {
+	return reply(c.rdb.Eval(ctx, script, keys, interfaces(args)...).Result())
+}
+
+func (c *redisClient) Ping(ctx context.Context) error {
+	return c.rdb.Ping(ctx).Err()
+}
+
+func (c *redisClient) Close() error {
+	return c.rdb.Close()
+}
+
+// reply turns the null reply, which go-redis reports as redis.Nil, into a nil
+// value
+func reply(value interface{}, err error) (interface{}, error) {
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return value, err
+}
+
+func interfaces(args []string) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	return values
+}
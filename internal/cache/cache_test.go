@@ -0,0 +1,220 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mh74hf/micro-payments/internal/config"
+)
+
+// fakeServer speaks just enough RESP2 to answer the commands in replies, keyed
+// by command name. HELLO is refused like an old server does, so clients fall
+// back to RESP2.
+type fakeServer struct {
+	listener net.Listener
+	replies  map[string]string
+
+	mu       sync.Mutex
+	commands [][]string
+}
+
+func newFakeServer(t *testing.T, replies map[string]string) *fakeServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{listener: listener, replies: replies}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, args)
+		s.mu.Unlock()
+
+		reply, ok := s.replies[strings.ToUpper(args[0])]
+		if !ok {
+			reply = "-ERR unknown command '" + args[0] + "'\r\n"
+		}
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+// sent returns the commands received with the given name
+func (s *fakeServer) sent(name string) [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var commands [][]string
+	for _, args := range s.commands {
+		if strings.EqualFold(args[0], name) {
+			commands = append(commands, args)
+		}
+	}
+	return commands
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	n, err := readLength(r, '*')
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		size, err := readLength(r, '$')
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func readLength(r *bufio.Reader, kind byte) (int, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	if len(line) < 3 || line[0] != kind {
+		return 0, fmt.Errorf("unexpected line %q", line)
+	}
+	return strconv.Atoi(strings.TrimSuffix(line[1:], "\r\n"))
+}
+
+func TestOptions(t *testing.T) {
+	cfg := config.RedisConfig{Addr: "redis:6380", Password: "secret", DB: 3, PoolSize: 20, MinIdleConns: 4}
+	opt := options(cfg)
+	got := config.RedisConfig{Addr: opt.Addr, Password: opt.Password, DB: opt.DB, PoolSize: opt.PoolSize, MinIdleConns: opt.MinIdleConns}
+	if got != cfg {
+		t.Errorf("options() = %+v, want %+v", got, cfg)
+	}
+	if opt.Protocol != 2 {
+		t.Errorf("Protocol = %d, want 2", opt.Protocol)
+	}
+}
+
+func TestClient(t *testing.T) {
+	server := newFakeServer(t, map[string]string{
+		"PING":   "+PONG\r\n",
+		"AUTH":   "+OK\r\n",
+		"SELECT": "+OK\r\n",
+		"SET":    "$-1\r\n",
+		"GET":    "$5\r\nvalue\r\n",
+		"INCR":   ":7\r\n",
+		"EVAL":   "*2\r\n:0\r\n:1500\r\n",
+		"DEL":    "-WRONGTYPE wrong kind of value\r\n",
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := NewClient(ctx, config.RedisConfig{
+		Addr: server.listener.Addr().String(), Password: "secret", DB: 2, PoolSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	if got := server.sent("AUTH"); len(got) != 1 || !reflect.DeepEqual(got[0], []string{"auth", "secret"}) {
+		t.Errorf("AUTH commands = %v, want one with the password", got)
+	}
+	if got := server.sent("SELECT"); len(got) != 1 || !reflect.DeepEqual(got[0], []string{"select", "2"}) {
+		t.Errorf("SELECT commands = %v, want one of database 2", got)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    interface{}
+		wantErr string
+	}{
+		{"null reply", []string{"SET", "key", "1", "NX"}, nil, ""},
+		{"bulk string", []string{"GET", "key"}, "value", ""},
+		{"integer", []string{"INCR", "key"}, int64(7), ""},
+		{"error reply", []string{"DEL", "key"}, nil, "WRONGTYPE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := client.Do(ctx, tt.args...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Do() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Do() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("eval", func(t *testing.T) {
+		got, err := client.Eval(ctx, "return 1", []string{"k1"}, "a1", "a2")
+		if err != nil {
+			t.Fatalf("Eval() error = %v", err)
+		}
+		if want := []interface{}{int64(0), int64(1500)}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Eval() = %#v, want %#v", got, want)
+		}
+		sent := server.sent("EVAL")
+		if want := []string{"eval", "return 1", "1", "k1", "a1", "a2"}; len(sent) != 1 || !reflect.DeepEqual(sent[0], want) {
+			t.Errorf("EVAL commands = %v, want %v", sent, want)
+		}
+	})
+}
+
+func TestNewClientUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := NewClient(ctx, config.RedisConfig{Addr: addr, PoolSize: 1})
+	if err == nil {
+		t.Fatal("NewClient() error = nil for an unreachable server")
+	}
+	if client == nil {
+		t.Fatal("NewClient() client = nil, want a client that reconnects on use")
+	}
+	client.Close()
+}
@@ -0,0 +1,115 @@
+// Package cachesync keeps the per-instance merchant and content caches coherent
+// across the fleet. Changes are broadcast with PostgreSQL NOTIFY and every
+// instance LISTENs, so no extra infrastructure is needed.
+package cachesync
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// Channel is the NOTIFY channel carrying invalidated merchant IDs
+const Channel = "cache_invalidation"
+
+// Listener reconnect backoff bounds
+const (
+	minReconnect = 1 * time.Second
+	maxReconnect = 30 * time.Second
+)
+
+// Invalidator is a cache that can drop entries per merchant or entirely
+type Invalidator interface {
+	InvalidateMerchant(merchantID uuid.UUID)
+	InvalidateAll()
+}
+
+// Syncer broadcasts local changes and applies those of other instances
+type Syncer struct {
+	db           *sql.DB
+	listener     *pq.Listener
+	invalidators []Invalidator
+	logger       *zap.Logger
+	done         chan struct{}
+}
+
+// NewSyncer starts listening on Channel using a dedicated connection to dsn.
+// Notifications are applied to every invalidator. While the listener is
+// disconnected notifications are lost, so caches are flushed on reconnect;
+// their TTLs bound the staleness in the meantime.
+func NewSyncer(db *sql.DB, dsn string, logger *zap.Logger, invalidators ...Invalidator) (*Syncer, error) {
+	s := &Syncer{
+		db:           db,
+		invalidators: invalidators,
+		logger:       logger,
+		done:         make(chan struct{}),
+	}
+
+	s.listener = pq.NewListener(dsn, minReconnect, maxReconnect, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Warn("Cache sync listener error", zap.Error(err))
+		}
+	})
+	if err := s.listener.Listen(Channel); err != nil {
+		s.listener.Close()
+		return nil, fmt.Errorf("failed to listen for cache invalidations: %w", err)
+	}
+
+	go s.run()
+	return s, nil
+}
+
+// Broadcast tells all instances, this one included, to drop cached entries of
+// the merchant
+func (s *Syncer) Broadcast(ctx context.Context, merchantID uuid.UUID) error {
+	if _, err := s.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, Channel, merchantID.String()); err != nil {
+		return fmt.Errorf("failed to broadcast cache invalidation: %w", err)
+	}
+	return nil
+}
+
+// Close stops listening
+func (s *Syncer) Close() error {
+	close(s.done)
+	return s.listener.Close()
+}
+
+func (s *Syncer) run() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case n, ok := <-s.listener.Notify:
+			if !ok {
+				return
+			}
+			s.apply(n)
+		}
+	}
+}
+
+// apply invalidates the caches a notification is about
+func (s *Syncer) apply(n *pq.Notification) {
+	// A nil notification means the connection was re-established and
+	// notifications may have been missed
+	if n == nil {
+		s.logger.Info("Cache sync listener reconnected, flushing caches")
+		for _, inv := range s.invalidators {
+			inv.InvalidateAll()
+		}
+		return
+	}
+	merchantID, err := uuid.Parse(n.Extra)
+	if err != nil {
+		s.logger.Warn("Ignoring malformed cache invalidation", zap.String("payload", n.Extra))
+		return
+	}
+	for _, inv := range s.invalidators {
+		inv.InvalidateMerchant(merchantID)
+	}
+}
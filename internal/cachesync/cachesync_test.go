@@ -0,0 +1,322 @@
+package cachesync
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/events"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+// recordingCache records the invalidations it receives
+type recordingCache struct {
+	merchants []uuid.UUID
+	flushes   int
+}
+
+func (c *recordingCache) InvalidateMerchant(merchantID uuid.UUID) {
+	c.merchants = append(c.merchants, merchantID)
+}
+
+func (c *recordingCache) InvalidateAll() { c.flushes++ }
+
+func TestSyncerApply(t *testing.T) {
+	merchantID := uuid.New()
+	tests := []struct {
+		name          string
+		notification  *pq.Notification
+		wantMerchants []uuid.UUID
+		wantFlushes   int
+	}{
+		{"merchant changed", &pq.Notification{Channel: Channel, Extra: merchantID.String()}, []uuid.UUID{merchantID}, 0},
+		{"reconnected", nil, nil, 1},
+		{"malformed payload", &pq.Notification{Channel: Channel, Extra: "not-a-uuid"}, nil, 0},
+		{"empty payload", &pq.Notification{Channel: Channel}, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merchants, content := &recordingCache{}, &recordingCache{}
+			s := &Syncer{invalidators: []Invalidator{merchants, content}, logger: zap.NewNop()}
+
+			s.apply(tt.notification)
+
+			for _, cache := range []*recordingCache{merchants, content} {
+				if len(cache.merchants) != len(tt.wantMerchants) || (len(tt.wantMerchants) > 0 && cache.merchants[0] != tt.wantMerchants[0]) {
+					t.Errorf("invalidated merchants %v, want %v", cache.merchants, tt.wantMerchants)
+				}
+				if cache.flushes != tt.wantFlushes {
+					t.Errorf("flushed %d times, want %d", cache.flushes, tt.wantFlushes)
+				}
+			}
+		})
+	}
+}
+
+// fakeTables is a database/sql driver holding one merchant and one content
+// pattern entry, for the queries the merchant and content caches are filled
+// and changed with. It counts the lookups that reach it.
+type fakeTables struct {
+	mu              sync.Mutex
+	merchantID      uuid.UUID
+	merchantName    string
+	merchantActive  bool
+	contentID       uuid.UUID
+	contentTitle    string
+	contentActive   bool
+	merchantLookups int
+	patternLookups  int
+}
+
+func (f *fakeTables) Open(string) (driver.Conn, error) { return fakeConn{f}, nil }
+
+type fakeConn struct{ tables *fakeTables }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{tables: c.tables, query: query}, nil
+}
+func (fakeConn) Close() error              { return nil }
+func (fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("transactions not supported") }
+
+type fakeStmt struct {
+	tables *fakeTables
+	query  string
+}
+
+func (fakeStmt) Close() error  { return nil }
+func (fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	f := s.tables
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !strings.Contains(s.query, "UPDATE merchants") {
+		return nil, fmt.Errorf("unexpected statement %q", s.query)
+	}
+	f.merchantActive = false
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	f := s.tables
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case strings.Contains(s.query, "UPDATE merchants"):
+		if name, ok := args[0].(string); ok {
+			f.merchantName = name
+		}
+		return &fakeRows{rows: [][]driver.Value{f.merchantRow()}}, nil
+	case strings.Contains(s.query, "FROM merchants") && strings.Contains(s.query, "domain = $1"):
+		f.merchantLookups++
+		if !f.merchantActive || args[0] != "shop.example.com" {
+			return &fakeRows{}, nil
+		}
+		return &fakeRows{rows: [][]driver.Value{f.merchantRow()}}, nil
+	case strings.Contains(s.query, "UPDATE content") && strings.Contains(s.query, "is_active = false"):
+		f.contentActive = false
+		return &fakeRows{rows: [][]driver.Value{f.contentRow()}}, nil
+	case strings.Contains(s.query, "UPDATE content"):
+		if title, ok := args[0].(string); ok {
+			f.contentTitle = title
+		}
+		return &fakeRows{rows: [][]driver.Value{f.contentRow()}}, nil
+	case strings.Contains(s.query, "path ~"):
+		f.patternLookups++
+		if !f.contentActive {
+			return &fakeRows{}, nil
+		}
+		return &fakeRows{rows: [][]driver.Value{f.contentRow()}}, nil
+	case strings.Contains(s.query, "FROM content"):
+		// No exact path matches, so lookups fall through to the patterns
+		return &fakeRows{}, nil
+	}
+	return nil, fmt.Errorf("unexpected query %q", s.query)
+}
+
+// merchantRow returns the merchant in the column order of MerchantService
+func (f *fakeTables) merchantRow() []driver.Value {
+	status := string(models.MerchantStatusActive)
+	if !f.merchantActive {
+		status = string(models.MerchantStatusDeactivated)
+	}
+	created := time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC)
+	return []driver.Value{
+		f.merchantID.String(), f.merchantName, "shop@example.com", "shop.example.com", "NL91ABNA0417164300", nil,
+		nil, nil, nil, nil, nil,
+		"mk_test", nil, status, "basic", created, created, nil,
+		[]byte("{}"), []byte("{}"),
+	}
+}
+
+// contentRow returns the pattern entry in the column order of ContentService
+func (f *fakeTables) contentRow() []driver.Value {
+	created := time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC)
+	return []driver.Value{
+		f.contentID.String(), f.merchantID.String(), "/articles/*", f.contentTitle, nil,
+		int64(50), "EUR", int64(3600), "webpage", []byte("{}"), f.contentActive,
+		created, created,
+	}
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+func (*fakeRows) Close() error { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func (f *fakeTables) lookups() (merchants, patterns int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.merchantLookups, f.patternLookups
+}
+
+// instance is the merchant and content service of one server sharing the
+// database, with the Syncer it would have
+type instance struct {
+	merchants *services.MerchantService
+	content   *services.ContentService
+	syncer    *Syncer
+	// notifications collects the NOTIFY payloads the instance broadcasts
+	notifications chan *pq.Notification
+}
+
+func newInstance(db *sql.DB, cfg *config.Config) *instance {
+	bus := events.NewBus(zap.NewNop())
+	i := &instance{
+		merchants:     services.NewMerchantService(db, cfg, bus, zap.NewNop()),
+		content:       services.NewContentService(db, cfg, bus, zap.NewNop()),
+		notifications: make(chan *pq.Notification, 10),
+	}
+	i.syncer = &Syncer{invalidators: []Invalidator{i.merchants, i.content}, logger: zap.NewNop()}
+	// What Broadcast sends for these events, as the server wires them up
+	bus.Subscribe(events.NameMerchantChanged, func(ctx context.Context, event events.Event) error {
+		i.notifications <- &pq.Notification{Channel: Channel, Extra: event.(events.MerchantChanged).MerchantID.String()}
+		return nil
+	})
+	bus.Subscribe(events.NameContentChanged, func(ctx context.Context, event events.Event) error {
+		i.notifications <- &pq.Notification{Channel: Channel, Extra: event.(events.ContentChanged).MerchantID.String()}
+		return nil
+	})
+	return i
+}
+
+func TestUpdatesInvalidateCachesBeforeTTL(t *testing.T) {
+	tests := []struct {
+		name string
+		// change is made on the first instance
+		change func(ctx context.Context, i *instance, f *fakeTables) error
+		// The caches the change drops on the instance that made it; a
+		// notification drops both on every instance
+		wantMerchantMiss bool
+		wantPatternMiss  bool
+	}{
+		{"merchant updated", func(ctx context.Context, i *instance, f *fakeTables) error {
+			name := "Renamed"
+			_, err := i.merchants.UpdateMerchant(ctx, f.merchantID, services.MerchantUpdate{Name: &name})
+			return err
+		}, true, false},
+		{"merchant deactivated", func(ctx context.Context, i *instance, f *fakeTables) error {
+			return i.merchants.DeactivateMerchant(ctx, f.merchantID)
+		}, true, false},
+		{"content updated", func(ctx context.Context, i *instance, f *fakeTables) error {
+			title := "Renamed"
+			_, err := i.content.UpdateContent(ctx, f.merchantID, f.contentID, services.ContentUpdate{Title: &title})
+			return err
+		}, false, true},
+		{"content deleted", func(ctx context.Context, i *instance, f *fakeTables) error {
+			return i.content.DeleteContent(ctx, f.merchantID, f.contentID)
+		}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeTables{
+				merchantID: uuid.New(), merchantName: "Shop", merchantActive: true,
+				contentID: uuid.New(), contentTitle: "Articles", contentActive: true,
+			}
+			driverName := "cachesync-test-" + uuid.NewString()
+			sql.Register(driverName, f)
+			db, err := sql.Open(driverName, "")
+			if err != nil {
+				t.Fatalf("sql.Open() error = %v", err)
+			}
+			defer db.Close()
+			// Entries would live for a day; only invalidation can refresh them
+			cfg := &config.Config{Cache: config.CacheConfig{MerchantTTL: 24 * time.Hour, ContentPatternsTTL: 24 * time.Hour}}
+			first, second := newInstance(db, cfg), newInstance(db, cfg)
+
+			// Fill the caches of both instances, and check the second lookup
+			// is served from them
+			for _, i := range []*instance{first, second, first, second} {
+				if _, err := i.merchants.GetMerchantByDomain("shop.example.com"); err != nil {
+					t.Fatalf("GetMerchantByDomain() error = %v", err)
+				}
+				if _, err := i.content.GetContentByPath(f.merchantID, "/articles/one"); err != nil {
+					t.Fatalf("GetContentByPath() error = %v", err)
+				}
+			}
+			if merchants, patterns := f.lookups(); merchants != 2 || patterns != 2 {
+				t.Fatalf("filling the caches took %d merchant and %d pattern lookups, want 2 each", merchants, patterns)
+			}
+
+			ctx := context.Background()
+			if err := tt.change(ctx, first, f); err != nil {
+				t.Fatalf("change error = %v", err)
+			}
+
+			// The instance that made the change reloads at once; the other one
+			// keeps its stale entries until the notification arrives
+			lookup := func(i *instance) (merchantMissed, patternMissed bool) {
+				merchantsBefore, patternsBefore := f.lookups()
+				i.merchants.GetMerchantByDomain("shop.example.com")
+				i.content.GetContentByPath(f.merchantID, "/articles/one")
+				merchantsAfter, patternsAfter := f.lookups()
+				return merchantsAfter > merchantsBefore, patternsAfter > patternsBefore
+			}
+			merchantMissed, patternMissed := lookup(first)
+			if merchantMissed != tt.wantMerchantMiss || patternMissed != tt.wantPatternMiss {
+				t.Errorf("changing instance missed merchant %v, patterns %v; want %v, %v",
+					merchantMissed, patternMissed, tt.wantMerchantMiss, tt.wantPatternMiss)
+			}
+			if merchantMissed, patternMissed := lookup(second); merchantMissed || patternMissed {
+				t.Errorf("other instance missed its cache before being notified")
+			}
+
+			select {
+			case n := <-first.notifications:
+				second.syncer.apply(n)
+			case <-time.After(5 * time.Second):
+				t.Fatal("change was not broadcast")
+			}
+			if merchantMissed, patternMissed := lookup(second); !merchantMissed || !patternMissed {
+				t.Errorf("notified instance missed merchant %v, patterns %v; want both", merchantMissed, patternMissed)
+			}
+		})
+	}
+}
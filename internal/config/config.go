@@ -1,19 +1,34 @@
 package config
 
 import (
+	"strings"
 	"time"
 
+	"github.com/mh74hf/micro-payments/internal/validation"
 	"github.com/spf13/viper"
 )
 
 // Config holds all configuration values
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	Auth     AuthConfig     `mapstructure:"auth"`
-	Payment  PaymentConfig  `mapstructure:"payment"`
-	Logging  LoggingConfig  `mapstructure:"logging"`
+	Server       ServerConfig       `mapstructure:"server"`
+	Database     DatabaseConfig     `mapstructure:"database"`
+	Redis        RedisConfig        `mapstructure:"redis"`
+	Auth         AuthConfig         `mapstructure:"auth"`
+	Payment      PaymentConfig      `mapstructure:"payment"`
+	Logging      LoggingConfig      `mapstructure:"logging"`
+	Admin        AdminConfig        `mapstructure:"admin"`
+	Webhook      WebhookConfig      `mapstructure:"webhook"`
+	Crawler      CrawlerConfig      `mapstructure:"crawler"`
+	Cache        CacheConfig        `mapstructure:"cache"`
+	Fees         FeesConfig         `mapstructure:"fees"`
+	Access       AccessConfig       `mapstructure:"access"`
+	Proxy        ProxyConfig        `mapstructure:"proxy"`
+	Stream       StreamConfig       `mapstructure:"stream"`
+	Bandwidth    BandwidthConfig    `mapstructure:"bandwidth"`
+	Receipt      ReceiptConfig      `mapstructure:"receipt"`
+	BalanceCheck BalanceCheckConfig `mapstructure:"balance_check"`
+	RateLimit    RateLimitConfig    `mapstructure:"rate_limit"`
+	Currency     CurrencyConfig     `mapstructure:"currency"`
 }
 
 // ServerConfig holds server-specific configuration
@@ -24,6 +39,17 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
 	WriteTimeout time.Duration `mapstructure:"write_timeout"`
 	IdleTimeout  time.Duration `mapstructure:"idle_timeout"`
+	// ShutdownTimeout bounds the whole graceful shutdown, flushes included
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// DrainDelay is how long shutdown reports not ready before it stops
+	// accepting requests, so traffic is routed elsewhere first
+	DrainDelay time.Duration `mapstructure:"drain_delay"`
+	// MaxBodyBytes caps the request bodies of the payment and merchant
+	// endpoints
+	MaxBodyBytes int64 `mapstructure:"max_body_bytes"`
+	// TrustedProxies are the addresses and CIDR ranges whose X-Forwarded-For
+	// and X-Real-IP headers are believed when determining the client IP
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 // DatabaseConfig holds database configuration
@@ -37,6 +63,8 @@ type DatabaseConfig struct {
 	MaxOpenConns    int           `mapstructure:"max_open_conns"`
 	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
 	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	// AutoMigrate applies pending migrations when the server starts
+	AutoMigrate bool `mapstructure:"auto_migrate"`
 }
 
 // RedisConfig holds Redis configuration
@@ -52,17 +80,36 @@ type RedisConfig struct {
 type AuthConfig struct {
 	JWTSecret string        `mapstructure:"jwt_secret"`
 	TokenTTL  time.Duration `mapstructure:"token_ttl"`
+	// RequireAccessToken stops trusting the X-User-ID header and client IP to
+	// identify content users; only bearer access tokens and receipts count.
+	// On by default: anyone can send any X-User-ID.
+	RequireAccessToken bool `mapstructure:"require_access_token"`
+	// APIKeyOverlap is how long a merchant's API key keeps working after it
+	// was rotated
+	APIKeyOverlap time.Duration `mapstructure:"api_key_overlap"`
 }
 
 // PaymentConfig holds payment-specific configuration
 type PaymentConfig struct {
 	DefaultCurrency        string        `mapstructure:"default_currency"`
 	SessionTimeout         time.Duration `mapstructure:"session_timeout"`
+	MaxSessionLifetime     time.Duration `mapstructure:"max_session_lifetime"`
+	DecimalAmounts         bool          `mapstructure:"decimal_amounts"`
 	QRCodeSize             int           `mapstructure:"qr_code_size"`
 	MinAmountCents         int           `mapstructure:"min_amount_cents"`
 	MaxAmountCents         int           `mapstructure:"max_amount_cents"`
 	BankSyncIntervalMins   int           `mapstructure:"bank_sync_interval_mins"`
 	PaymentCheckTimeoutSec int           `mapstructure:"payment_check_timeout_sec"`
+	// ExpiryInterval is how often pending sessions past expires_at are marked expired
+	ExpiryInterval time.Duration `mapstructure:"expiry_interval"`
+	// ExpiryGracePeriod is how long after expiry a session can still be
+	// settled by a matching bank transaction
+	ExpiryGracePeriod time.Duration `mapstructure:"expiry_grace_period"`
+	// A bank transaction may fall short of the session amount by the larger of
+	// AmountToleranceCents and AmountToleranceBasisPoints (1/100 %) of the
+	// amount and still settle it, for bank fees and rounding
+	AmountToleranceCents       int `mapstructure:"amount_tolerance_cents"`
+	AmountToleranceBasisPoints int `mapstructure:"amount_tolerance_bps"`
 }
 
 // LoggingConfig holds logging configuration
@@ -71,6 +118,154 @@ type LoggingConfig struct {
 	Format string `mapstructure:"format"`
 }
 
+// AdminConfig holds configuration for admin and reporting endpoints
+type AdminConfig struct {
+	// APIKey authenticates admin requests; empty disables admin access
+	APIKey           string `mapstructure:"api_key"`
+	DefaultPageSize  int    `mapstructure:"default_page_size"`
+	MaxPageSize      int    `mapstructure:"max_page_size"`
+	MaxScanLimit     int    `mapstructure:"max_scan_limit"`
+	MaxBackfillBatch int    `mapstructure:"max_backfill_batch"`
+	MaxImportRows    int    `mapstructure:"max_import_rows"`
+}
+
+// WebhookConfig holds webhook delivery configuration
+type WebhookConfig struct {
+	// Concurrency is the number of workers delivering webhooks
+	Concurrency int `mapstructure:"concurrency"`
+	// QueueSize bounds the queued events per merchant and MaxPending those of
+	// all merchants; events over either bound are parked in the database
+	QueueSize  int `mapstructure:"queue_size"`
+	MaxPending int `mapstructure:"max_pending"`
+	// RetryInterval is how often parked events are moved back into the queues
+	RetryInterval time.Duration `mapstructure:"retry_interval"`
+	// MaxAttempts is how often a delivery is tried; the wait between attempts
+	// starts at AttemptBackoff and doubles every time
+	MaxAttempts    int           `mapstructure:"max_attempts"`
+	AttemptBackoff time.Duration `mapstructure:"attempt_backoff"`
+	// An event whose attempts all failed is delivered again after
+	// RedeliveryBackoff, doubling after every failed round, for up to
+	// MaxRedeliveries rounds; then it is kept as dead until replayed
+	RedeliveryBackoff time.Duration `mapstructure:"redelivery_backoff"`
+	MaxRedeliveries   int           `mapstructure:"max_redeliveries"`
+	DeliveryTimeout   time.Duration `mapstructure:"delivery_timeout"`
+	SecretOverlap     time.Duration `mapstructure:"secret_overlap"`
+	// DrainTimeout is how long shutdown waits for queued webhooks
+	DrainTimeout time.Duration `mapstructure:"drain_timeout"`
+}
+
+// CrawlerConfig holds configuration for search engine and social preview crawlers
+type CrawlerConfig struct {
+	UserAgents []string `mapstructure:"user_agents"`
+}
+
+// CacheConfig holds HTTP caching configuration for public read endpoints
+type CacheConfig struct {
+	ContentInfoTTL     time.Duration `mapstructure:"content_info_ttl"`
+	CatalogTTL         time.Duration `mapstructure:"catalog_ttl"`
+	QRTTL              time.Duration `mapstructure:"qr_ttl"`
+	ContentPatternsTTL time.Duration `mapstructure:"content_patterns_ttl"`
+	MerchantTTL        time.Duration `mapstructure:"merchant_ttl"`
+	AccessRulesEntries int           `mapstructure:"access_rules_entries"`
+	QRMaxBytes         int64         `mapstructure:"qr_max_bytes"`
+}
+
+// AccessConfig holds configuration for evaluating per-content access rules
+type AccessConfig struct {
+	// CountryHeader is the header a CDN or load balancer puts the client's
+	// country code in, used by "allowed_countries" rules
+	CountryHeader string `mapstructure:"country_header"`
+	// FreeTrialsPerIP caps free first accesses to one content from a single
+	// IP address within FreeTrialWindow
+	FreeTrialsPerIP int           `mapstructure:"free_trials_per_ip"`
+	FreeTrialWindow time.Duration `mapstructure:"free_trial_window"`
+	// CountFlushInterval is how often buffered access counts are written
+	CountFlushInterval time.Duration `mapstructure:"count_flush_interval"`
+}
+
+// ProxyConfig holds configuration for forwarding requests to merchant backends
+type ProxyConfig struct {
+	DialTimeout           time.Duration `mapstructure:"dial_timeout"`
+	ResponseHeaderTimeout time.Duration `mapstructure:"response_header_timeout"`
+	MaxIdleConnsPerHost   int           `mapstructure:"max_idle_conns_per_host"`
+	// SniffContentType detects the Content-Type of backend responses without one
+	SniffContentType bool `mapstructure:"sniff_content_type"`
+}
+
+// BandwidthConfig holds configuration for metering proxied traffic
+type BandwidthConfig struct {
+	// FlushInterval is how often buffered byte counts are written
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// UsageTTL is how long stored monthly totals are cached for cap checks
+	UsageTTL time.Duration `mapstructure:"usage_ttl"`
+}
+
+// StreamConfig holds configuration for server-sent payment status streams
+type StreamConfig struct {
+	// PollInterval is how often a stream checks the session for a new status
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// KeepAliveInterval is how long a stream may stay silent before a comment
+	// is sent, keeping proxies and load balancers from closing it as idle
+	KeepAliveInterval time.Duration `mapstructure:"keepalive_interval"`
+	// MaxWait caps the ?wait= of long-polled payment status requests
+	MaxWait time.Duration `mapstructure:"max_wait"`
+}
+
+// ReceiptConfig holds configuration for signed access receipts, which clients
+// can present instead of being looked up by user identifier
+type ReceiptConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// TTL caps how long a receipt is valid; it never outlives the access itself
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// BalanceCheckConfig holds configuration for the periodic comparison of paid
+// sessions against the bank transactions that settled them
+type BalanceCheckConfig struct {
+	Interval time.Duration `mapstructure:"interval"`
+	// ThresholdCents is the largest difference per merchant and currency that
+	// is reported without raising an alert
+	ThresholdCents int64 `mapstructure:"threshold_cents"`
+	// AlertWebhookURL receives the report as JSON when an alert is raised
+	AlertWebhookURL string `mapstructure:"alert_webhook_url"`
+}
+
+// RateLimitConfig holds the sliding-window limits on payment creation, counted
+// in Redis
+type RateLimitConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// IPLimit and DomainLimit are the requests allowed per Window from one
+	// client IP and for one merchant domain; 0 disables a limit
+	IPLimit     int           `mapstructure:"ip_limit"`
+	DomainLimit int           `mapstructure:"domain_limit"`
+	Window      time.Duration `mapstructure:"window"`
+	// Timeout bounds the Redis round trip; slower requests are let through
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// CurrencyConfig holds the exchange rates content priced in another currency
+// than the merchant's account is converted at
+type CurrencyConfig struct {
+	// Rates maps a pair like "usd_eur" to how much of the second currency one
+	// unit of the first buys; the reverse pair is derived
+	Rates map[string]float64 `mapstructure:"rates"`
+	// RateTTL is how long a looked-up rate is reused
+	RateTTL time.Duration `mapstructure:"rate_ttl"`
+}
+
+// FeesConfig holds the platform fee schedule per merchant pricing tier
+type FeesConfig struct {
+	DefaultTier string             `mapstructure:"default_tier"`
+	VATRateBps  int                `mapstructure:"vat_rate_bps"`
+	Tiers       map[string]FeeTier `mapstructure:"tiers"`
+}
+
+// FeeTier is the fee charged per payment: a percentage in basis points plus a fixed amount
+type FeeTier struct {
+	PercentBps int `mapstructure:"percent_bps"`
+	FixedCents int `mapstructure:"fixed_cents"`
+}
+
 // Load loads configuration from config.yaml
 func Load() (*Config, error) {
 	viper.SetConfigName("config")
@@ -81,7 +276,9 @@ func Load() (*Config, error) {
 	// Set defaults
 	setDefaults()
 
-	// Enable environment variable overrides
+	// Enable environment variable overrides, like DATABASE_HOST for
+	// database.host
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 
 	if err := viper.ReadInConfig(); err != nil {
@@ -93,6 +290,13 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
+	if currency, ok := validation.NormalizeCurrency(cfg.Payment.DefaultCurrency); ok {
+		cfg.Payment.DefaultCurrency = currency
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
 
@@ -104,6 +308,10 @@ func setDefaults() {
 	viper.SetDefault("server.read_timeout", "30s")
 	viper.SetDefault("server.write_timeout", "30s")
 	viper.SetDefault("server.idle_timeout", "120s")
+	viper.SetDefault("server.shutdown_timeout", "30s")
+	viper.SetDefault("server.drain_delay", "5s")
+	viper.SetDefault("server.max_body_bytes", 64<<10)
+	viper.SetDefault("server.trusted_proxies", []string{"127.0.0.1", "::1"})
 
 	// Database defaults
 	viper.SetDefault("database.host", "localhost")
@@ -115,6 +323,7 @@ func setDefaults() {
 	viper.SetDefault("database.max_open_conns", 25)
 	viper.SetDefault("database.max_idle_conns", 10)
 	viper.SetDefault("database.conn_max_lifetime", "300s")
+	viper.SetDefault("database.auto_migrate", false)
 
 	// Redis defaults
 	viper.SetDefault("redis.addr", "localhost:6379")
@@ -125,18 +334,95 @@ func setDefaults() {
 
 	// Auth defaults
 	viper.SetDefault("auth.jwt_secret", "change-this-secret-in-production")
+	viper.SetDefault("auth.require_access_token", true)
 	viper.SetDefault("auth.token_ttl", "24h")
+	viper.SetDefault("auth.api_key_overlap", "1h")
 
 	// Payment defaults
 	viper.SetDefault("payment.default_currency", "EUR")
 	viper.SetDefault("payment.session_timeout", "15m")
+	viper.SetDefault("payment.max_session_lifetime", "60m")
+	viper.SetDefault("payment.decimal_amounts", false)
 	viper.SetDefault("payment.qr_code_size", 256)
 	viper.SetDefault("payment.min_amount_cents", 1)
 	viper.SetDefault("payment.max_amount_cents", 999999)
 	viper.SetDefault("payment.bank_sync_interval_mins", 1)
 	viper.SetDefault("payment.payment_check_timeout_sec", 300)
+	viper.SetDefault("payment.expiry_interval", "1m")
+	viper.SetDefault("payment.expiry_grace_period", "15m")
+	viper.SetDefault("payment.amount_tolerance_cents", 0)
+	viper.SetDefault("payment.amount_tolerance_bps", 0)
 
 	// Logging defaults
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.format", "json")
+
+	// Admin defaults
+	viper.SetDefault("admin.api_key", "")
+	viper.SetDefault("admin.default_page_size", 50)
+	viper.SetDefault("admin.max_page_size", 500)
+	viper.SetDefault("admin.max_scan_limit", 100000)
+	viper.SetDefault("admin.max_backfill_batch", 10000)
+	viper.SetDefault("admin.max_import_rows", 1000)
+
+	// Webhook defaults
+	viper.SetDefault("webhook.concurrency", 16)
+	viper.SetDefault("webhook.queue_size", 100)
+	viper.SetDefault("webhook.max_pending", 10000)
+	viper.SetDefault("webhook.retry_interval", "30s")
+	viper.SetDefault("webhook.delivery_timeout", "10s")
+	viper.SetDefault("webhook.max_attempts", 3)
+	viper.SetDefault("webhook.attempt_backoff", "1s")
+	viper.SetDefault("webhook.redelivery_backoff", "1m")
+	viper.SetDefault("webhook.max_redeliveries", 8)
+	viper.SetDefault("webhook.secret_overlap", "24h")
+	viper.SetDefault("webhook.drain_timeout", "10s")
+
+	// Cache defaults
+	viper.SetDefault("cache.content_info_ttl", "60s")
+	viper.SetDefault("cache.catalog_ttl", "300s")
+	viper.SetDefault("cache.qr_ttl", "15m")
+	viper.SetDefault("cache.content_patterns_ttl", "60s")
+	viper.SetDefault("cache.merchant_ttl", "30s")
+	viper.SetDefault("cache.access_rules_entries", 10000)
+	viper.SetDefault("cache.qr_max_bytes", 16<<20)
+
+	// Access rule defaults
+	viper.SetDefault("access.country_header", "CF-IPCountry")
+	viper.SetDefault("access.free_trials_per_ip", 3)
+	viper.SetDefault("access.free_trial_window", "24h")
+	viper.SetDefault("access.count_flush_interval", "10s")
+	viper.SetDefault("proxy.dial_timeout", "5s")
+	viper.SetDefault("proxy.response_header_timeout", "30s")
+	viper.SetDefault("proxy.max_idle_conns_per_host", 32)
+	viper.SetDefault("proxy.sniff_content_type", true)
+	viper.SetDefault("stream.poll_interval", "2s")
+	viper.SetDefault("stream.keepalive_interval", "15s")
+	viper.SetDefault("stream.max_wait", "60s")
+	viper.SetDefault("bandwidth.flush_interval", "10s")
+	viper.SetDefault("bandwidth.usage_ttl", "30s")
+	viper.SetDefault("receipt.enabled", true)
+	viper.SetDefault("receipt.ttl", "1h")
+	viper.SetDefault("balance_check.interval", "1h")
+	viper.SetDefault("balance_check.threshold_cents", 0)
+	viper.SetDefault("balance_check.alert_webhook_url", "")
+	viper.SetDefault("rate_limit.enabled", true)
+	viper.SetDefault("rate_limit.ip_limit", 20)
+	viper.SetDefault("rate_limit.domain_limit", 1000)
+	viper.SetDefault("rate_limit.window", "1m")
+	viper.SetDefault("rate_limit.timeout", "100ms")
+
+	// Fee defaults
+	viper.SetDefault("currency.rate_ttl", "1h")
+	viper.SetDefault("fees.default_tier", "basic")
+	viper.SetDefault("fees.vat_rate_bps", 0)
+	viper.SetDefault("fees.tiers", map[string]interface{}{
+		"basic": map[string]interface{}{"percent_bps": 150, "fixed_cents": 1},
+	})
+
+	// Crawler defaults
+	viper.SetDefault("crawler.user_agents", []string{
+		"Googlebot", "Bingbot", "DuckDuckBot", "Applebot",
+		"facebookexternalhit", "Twitterbot", "LinkedInBot", "Slackbot",
+	})
 }
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mh74hf/micro-payments/internal/validation"
+)
+
+// EnvironmentProduction is the server.environment of production deployments,
+// where placeholder secrets are refused
+const EnvironmentProduction = "production"
+
+// insecureSecrets are the placeholder secrets shipped in the defaults and the
+// example config.yaml
+var insecureSecrets = []string{
+	"change-this-secret-in-production",
+	"your-super-secret-jwt-key-change-in-production",
+	"your-admin-api-key-change-in-production",
+}
+
+// Validate checks the configuration for values the server cannot run with and,
+// in production, for placeholder secrets. The returned error lists every
+// problem found, so a deployment can be fixed in one go.
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	positive := func(name string, d time.Duration) {
+		check(d > 0, "%s must be positive, got %s", name, d)
+	}
+	production := c.Server.Environment == EnvironmentProduction
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port %d is not a valid port", c.Server.Port)
+	positive("server.read_timeout", c.Server.ReadTimeout)
+	positive("server.write_timeout", c.Server.WriteTimeout)
+	positive("server.idle_timeout", c.Server.IdleTimeout)
+	positive("server.shutdown_timeout", c.Server.ShutdownTimeout)
+	check(c.Server.MaxBodyBytes > 0, "server.max_body_bytes must be positive, got %d", c.Server.MaxBodyBytes)
+	check(c.Server.DrainDelay >= 0 && c.Server.DrainDelay < c.Server.ShutdownTimeout,
+		"server.drain_delay %s must not be negative and must be shorter than server.shutdown_timeout", c.Server.DrainDelay)
+	// Client IPs gate free trials and IP-based access, so a proxy that is
+	// trusted but not ours lets any client pick its IP via X-Forwarded-For
+	for _, proxy := range c.Server.TrustedProxies {
+		ok, everyone := trustedProxy(proxy)
+		check(ok, "server.trusted_proxies entry %q is not an IP address or CIDR range", proxy)
+		check(!production || !everyone,
+			"server.trusted_proxies entry %q trusts every address, so clients could spoof their IP via X-Forwarded-For; list the load balancers instead", proxy)
+	}
+
+	check(c.Database.Host != "", "database.host is empty")
+	check(c.Database.Name != "", "database.name is empty")
+	check(c.Database.User != "", "database.user is empty")
+	check(c.Database.Password != "" || !production, "database.password is empty")
+
+	check(c.Auth.JWTSecret != "", "auth.jwt_secret is empty")
+	check(!production || !isInsecureSecret(c.Auth.JWTSecret), "auth.jwt_secret is a placeholder, set a random secret in production")
+	check(!production || !isInsecureSecret(c.Admin.APIKey), "admin.api_key is a placeholder, set a random key or leave it empty in production")
+	positive("auth.token_ttl", c.Auth.TokenTTL)
+	check(c.Auth.APIKeyOverlap >= 0, "auth.api_key_overlap must not be negative, got %s", c.Auth.APIKeyOverlap)
+
+	_, ok := validation.NormalizeCurrency(c.Payment.DefaultCurrency)
+	check(ok, "payment.default_currency %q is not an ISO 4217 currency code", c.Payment.DefaultCurrency)
+	check(c.Payment.MinAmountCents >= 1, "payment.min_amount_cents must be at least 1, got %d", c.Payment.MinAmountCents)
+	check(c.Payment.MaxAmountCents >= c.Payment.MinAmountCents,
+		"payment.max_amount_cents %d is below payment.min_amount_cents %d", c.Payment.MaxAmountCents, c.Payment.MinAmountCents)
+	positive("payment.session_timeout", c.Payment.SessionTimeout)
+	positive("payment.max_session_lifetime", c.Payment.MaxSessionLifetime)
+	positive("payment.expiry_interval", c.Payment.ExpiryInterval)
+	check(c.Payment.ExpiryGracePeriod >= 0, "payment.expiry_grace_period must not be negative, got %s", c.Payment.ExpiryGracePeriod)
+	check(c.Payment.AmountToleranceCents >= 0, "payment.amount_tolerance_cents must not be negative, got %d", c.Payment.AmountToleranceCents)
+	check(c.Payment.AmountToleranceBasisPoints >= 0 && c.Payment.AmountToleranceBasisPoints <= 10000,
+		"payment.amount_tolerance_bps must be between 0 and 10000, got %d", c.Payment.AmountToleranceBasisPoints)
+	check(c.Payment.BankSyncIntervalMins > 0, "payment.bank_sync_interval_mins must be positive, got %d", c.Payment.BankSyncIntervalMins)
+
+	check(c.Webhook.Concurrency > 0, "webhook.concurrency must be positive, got %d", c.Webhook.Concurrency)
+	check(c.Webhook.QueueSize > 0, "webhook.queue_size must be positive, got %d", c.Webhook.QueueSize)
+	check(c.Webhook.MaxPending > 0, "webhook.max_pending must be positive, got %d", c.Webhook.MaxPending)
+	check(c.Webhook.MaxAttempts > 0, "webhook.max_attempts must be positive, got %d", c.Webhook.MaxAttempts)
+	positive("webhook.retry_interval", c.Webhook.RetryInterval)
+	positive("webhook.redelivery_backoff", c.Webhook.RedeliveryBackoff)
+	check(c.Webhook.MaxRedeliveries >= 0, "webhook.max_redeliveries must not be negative, got %d", c.Webhook.MaxRedeliveries)
+	positive("webhook.delivery_timeout", c.Webhook.DeliveryTimeout)
+	positive("webhook.drain_timeout", c.Webhook.DrainTimeout)
+
+	positive("access.count_flush_interval", c.Access.CountFlushInterval)
+	positive("proxy.dial_timeout", c.Proxy.DialTimeout)
+	positive("proxy.response_header_timeout", c.Proxy.ResponseHeaderTimeout)
+	positive("stream.poll_interval", c.Stream.PollInterval)
+	positive("stream.keepalive_interval", c.Stream.KeepAliveInterval)
+	positive("stream.max_wait", c.Stream.MaxWait)
+	positive("bandwidth.flush_interval", c.Bandwidth.FlushInterval)
+	positive("balance_check.interval", c.BalanceCheck.Interval)
+	if c.Receipt.Enabled {
+		positive("receipt.ttl", c.Receipt.TTL)
+	}
+	if c.RateLimit.Enabled {
+		positive("rate_limit.window", c.RateLimit.Window)
+		positive("rate_limit.timeout", c.RateLimit.Timeout)
+	}
+	positive("currency.rate_ttl", c.Currency.RateTTL)
+	pairs := make([]string, 0, len(c.Currency.Rates))
+	for pair := range c.Currency.Rates {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	for _, pair := range pairs {
+		from, to, ok := strings.Cut(pair, "_")
+		if ok {
+			_, okFrom := validation.NormalizeCurrency(from)
+			_, okTo := validation.NormalizeCurrency(to)
+			ok = okFrom && okTo
+		}
+		check(ok, "currency.rates key %q is not a pair of ISO 4217 codes like usd_eur", pair)
+		check(c.Currency.Rates[pair] > 0, "currency.rates.%s must be positive, got %g", pair, c.Currency.Rates[pair])
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// trustedProxy reports whether proxy is an IP address or CIDR range and whether
+// it covers every address
+func trustedProxy(proxy string) (ok, everyone bool) {
+	if net.ParseIP(proxy) != nil {
+		return true, false
+	}
+	_, network, err := net.ParseCIDR(proxy)
+	if err != nil {
+		return false, false
+	}
+	ones, _ := network.Mask.Size()
+	return true, ones == 0
+}
+
+func isInsecureSecret(secret string) bool {
+	for _, insecure := range insecureSecrets {
+		if secret == insecure {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultConfig returns the built-in defaults, as Load would without a config file
+func defaultConfig(t *testing.T) *Config {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	setDefaults()
+	var cfg Config
+	if err := viper.Unmarshal(&cfg); err != nil {
+		t.Fatalf("viper.Unmarshal() error = %v", err)
+	}
+	return &cfg
+}
+
+func TestValidateDefaults(t *testing.T) {
+	if err := defaultConfig(t).Validate(); err != nil {
+		t.Fatalf("Validate() of the defaults error = %v", err)
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	production := func(c *Config) {
+		c.Server.Environment = EnvironmentProduction
+		c.Database.Password = "database-password"
+		c.Auth.JWTSecret = "a-random-production-secret"
+		c.Admin.APIKey = ""
+	}
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   string
+	}{
+		{"port out of range", func(c *Config) { c.Server.Port = 70000 }, "server.port 70000"},
+		{"zero read timeout", func(c *Config) { c.Server.ReadTimeout = 0 }, "server.read_timeout must be positive"},
+		{"drain longer than shutdown", func(c *Config) { c.Server.DrainDelay = c.Server.ShutdownTimeout }, "server.drain_delay"},
+		{"malformed trusted proxy", func(c *Config) { c.Server.TrustedProxies = []string{"lb.internal"} }, `"lb.internal" is not an IP address`},
+		{"trusting everyone in production", func(c *Config) {
+			production(c)
+			c.Server.TrustedProxies = []string{"0.0.0.0/0"}
+		}, "trusts every address"},
+		{"no database host", func(c *Config) { c.Database.Host = "" }, "database.host is empty"},
+		{"no database password in production", func(c *Config) {
+			production(c)
+			c.Database.Password = ""
+		}, "database.password is empty"},
+		{"no JWT secret", func(c *Config) { c.Auth.JWTSecret = "" }, "auth.jwt_secret is empty"},
+		{"placeholder JWT secret in production", func(c *Config) {
+			production(c)
+			c.Auth.JWTSecret = "your-super-secret-jwt-key-change-in-production"
+		}, "auth.jwt_secret is a placeholder"},
+		{"placeholder admin key in production", func(c *Config) {
+			production(c)
+			c.Admin.APIKey = "your-admin-api-key-change-in-production"
+		}, "admin.api_key is a placeholder"},
+		{"negative API key overlap", func(c *Config) { c.Auth.APIKeyOverlap = -time.Hour }, "auth.api_key_overlap must not be negative"},
+		{"unknown currency", func(c *Config) { c.Payment.DefaultCurrency = "EURO" }, `"EURO" is not an ISO 4217`},
+		{"zero minimum amount", func(c *Config) { c.Payment.MinAmountCents = 0 }, "payment.min_amount_cents must be at least 1"},
+		{"maximum below minimum", func(c *Config) {
+			c.Payment.MinAmountCents = 500
+			c.Payment.MaxAmountCents = 499
+		}, "payment.max_amount_cents 499 is below payment.min_amount_cents 500"},
+		{"negative grace period", func(c *Config) { c.Payment.ExpiryGracePeriod = -time.Minute }, "payment.expiry_grace_period must not be negative"},
+		{"negative tolerance", func(c *Config) { c.Payment.AmountToleranceCents = -1 }, "payment.amount_tolerance_cents must not be negative"},
+		{"tolerance above 100%", func(c *Config) { c.Payment.AmountToleranceBasisPoints = 10001 }, "payment.amount_tolerance_bps must be between 0 and 10000"},
+		{"no webhook workers", func(c *Config) { c.Webhook.Concurrency = 0 }, "webhook.concurrency must be positive"},
+		{"negative redeliveries", func(c *Config) { c.Webhook.MaxRedeliveries = -1 }, "webhook.max_redeliveries must not be negative"},
+		{"zero receipt TTL when enabled", func(c *Config) {
+			c.Receipt.Enabled = true
+			c.Receipt.TTL = 0
+		}, "receipt.ttl must be positive"},
+		{"malformed currency pair", func(c *Config) { c.Currency.Rates = map[string]float64{"usdeur": 0.9} }, `currency.rates key "usdeur"`},
+		{"non-positive rate", func(c *Config) { c.Currency.Rates = map[string]float64{"usd_eur": 0} }, "currency.rates.usd_eur must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig(t)
+			tt.change(cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateListsEveryProblem(t *testing.T) {
+	cfg := defaultConfig(t)
+	cfg.Server.Port = 0
+	cfg.Database.Name = ""
+	cfg.Payment.MinAmountCents = 0
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() succeeded")
+	}
+	for _, want := range []string{"server.port", "database.name", "payment.min_amount_cents"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error = %v, want it to mention %s", err, want)
+		}
+	}
+}
+
+func TestValidateAllowsDisabledFeatures(t *testing.T) {
+	cfg := defaultConfig(t)
+	cfg.Receipt.Enabled = false
+	cfg.Receipt.TTL = 0
+	cfg.RateLimit.Enabled = false
+	cfg.RateLimit.Window = 0
+	// Placeholder secrets are only refused in production
+	cfg.Auth.JWTSecret = "your-super-secret-jwt-key-change-in-production"
+	cfg.Server.TrustedProxies = []string{"0.0.0.0/0", "10.0.0.1"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
@@ -8,14 +8,17 @@ import (
 	"github.com/mh74hf/micro-payments/internal/config"
 )
 
-// NewConnection creates a new database connection
-func NewConnection(cfg config.DatabaseConfig) (*sql.DB, error) {
-	dsn := fmt.Sprintf(
+// DSN returns the lib/pq connection string for cfg
+func DSN(cfg config.DatabaseConfig) string {
+	return fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name, cfg.SSLMode,
 	)
+}
 
-	db, err := sql.Open("postgres", dsn)
+// NewConnection creates a new database connection
+func NewConnection(cfg config.DatabaseConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", DSN(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
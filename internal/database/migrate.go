@@ -0,0 +1,215 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mh74hf/micro-payments/migrations"
+)
+
+// migrationLockID is the advisory lock serializing migration runs, so
+// instances starting together with auto-migrate do not race each other
+const migrationLockID = 7245310912
+
+// Migration is one version of the schema
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationState is a migration and when it was applied, nil while pending
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// LoadMigrations reads the embedded migrations ordered by version. Every
+// version needs both an up and a down file.
+func LoadMigrations() ([]Migration, error) {
+	return loadMigrations(migrations.FS)
+}
+
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, file := range files {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		number, name, named := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(number, 10, 64)
+		if !ok || !named || err != nil || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s is not named NNNN_name.up.sql or NNNN_name.down.sql", file)
+		}
+		body, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", file, err)
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// MigrateUp applies the pending migrations in order, each in its own
+// transaction, and returns the ones it applied
+func MigrateUp(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	var applied []Migration
+	err := withMigrationLock(ctx, db, func(conn *sql.Conn, states []MigrationState) error {
+		for _, state := range states {
+			if state.AppliedAt != nil {
+				continue
+			}
+			err := runMigration(ctx, conn, state.Migration, state.up,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, state.Version, state.Name)
+			if err != nil {
+				return err
+			}
+			applied = append(applied, state.Migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown reverts the last steps applied migrations, newest first, and
+// returns the ones it reverted
+func MigrateDown(ctx context.Context, db *sql.DB, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := withMigrationLock(ctx, db, func(conn *sql.Conn, states []MigrationState) error {
+		for i := len(states) - 1; i >= 0 && len(reverted) < steps; i-- {
+			state := states[i]
+			if state.AppliedAt == nil {
+				continue
+			}
+			err := runMigration(ctx, conn, state.Migration, state.down,
+				`DELETE FROM schema_migrations WHERE version = $1`, state.Version)
+			if err != nil {
+				return err
+			}
+			reverted = append(reverted, state.Migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// MigrationStatus lists every migration with when it was applied
+func MigrationStatus(ctx context.Context, db *sql.DB) ([]MigrationState, error) {
+	var states []MigrationState
+	err := withMigrationLock(ctx, db, func(conn *sql.Conn, s []MigrationState) error {
+		states = s
+		return nil
+	})
+	return states, err
+}
+
+// withMigrationLock runs fn on a single connection holding the migration
+// lock, with the state of every migration
+func withMigrationLock(ctx context.Context, db *sql.DB, fn func(conn *sql.Conn, states []MigrationState) error) error {
+	list, err := LoadMigrations()
+	if err != nil {
+		return err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	appliedAt := make(map[int64]time.Time)
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		appliedAt[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	rows.Close()
+
+	states := make([]MigrationState, len(list))
+	for i, m := range list {
+		states[i].Migration = m
+		if at, ok := appliedAt[m.Version]; ok {
+			states[i].AppliedAt = &at
+		}
+	}
+	return fn(conn, states)
+}
+
+// runMigration executes body and records it with the bookkeeping statement in
+// one transaction, so a failing migration leaves nothing behind
+func runMigration(ctx context.Context, conn *sql.Conn, m Migration, body, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return fmt.Errorf("failed to run migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("failed to record migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
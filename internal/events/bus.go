@@ -0,0 +1,162 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Event is a domain event published on the bus
+type Event interface {
+	EventName() string
+}
+
+// Handler reacts to a published event. Returned errors are logged and never
+// propagate back to the publisher.
+type Handler func(ctx context.Context, event Event) error
+
+// Bus is a lightweight in-process publish/subscribe bus. Publishing never blocks
+// on subscribers: each handler runs in its own goroutine, so side effects like
+// webhooks or audit logging cannot slow down or break the core payment flow.
+type Bus struct {
+	logger *zap.Logger
+
+	mu          sync.RWMutex
+	subscribers map[string][]Handler
+	wildcard    []Handler
+	ordered     map[string][]*serialQueue
+	wg          sync.WaitGroup
+}
+
+// serialQueue holds the events of an ordered subscriber that it has not
+// handled yet, in publish order
+type serialQueue struct {
+	handler Handler
+
+	mu      sync.Mutex
+	pending []Event
+	running bool
+}
+
+// NewBus creates a new event bus
+func NewBus(logger *zap.Logger) *Bus {
+	return &Bus{
+		logger:      logger,
+		subscribers: make(map[string][]Handler),
+		ordered:     make(map[string][]*serialQueue),
+	}
+}
+
+// Subscribe registers a handler for events with the given name
+func (b *Bus) Subscribe(name string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[name] = append(b.subscribers[name], handler)
+}
+
+// SubscribeAll registers a handler for every event
+func (b *Bus) SubscribeAll(handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.wildcard = append(b.wildcard, handler)
+}
+
+// SubscribeOrdered registers a handler for events with any of the given names
+// that sees them one at a time, in the order they were published. It still
+// runs apart from the publisher, so a slow handler only holds up its own
+// later events.
+func (b *Bus) SubscribeOrdered(handler Handler, names ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q := &serialQueue{handler: handler}
+	for _, name := range names {
+		b.ordered[name] = append(b.ordered[name], q)
+	}
+}
+
+// Publish dispatches the event to all matching subscribers asynchronously
+func (b *Bus) Publish(event Event) {
+	b.mu.RLock()
+	handlers := make([]Handler, 0, len(b.subscribers[event.EventName()])+len(b.wildcard))
+	handlers = append(handlers, b.subscribers[event.EventName()]...)
+	handlers = append(handlers, b.wildcard...)
+	queues := b.ordered[event.EventName()]
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		b.wg.Add(1)
+		go b.run(handler, event)
+	}
+	for _, q := range queues {
+		b.wg.Add(1)
+		b.push(q, event)
+	}
+}
+
+// push appends the event to an ordered subscriber's queue, starting a
+// goroutine to work through the queue unless one is at it already
+func (b *Bus) push(q *serialQueue, event Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, event)
+	if !q.running {
+		q.running = true
+		go b.drain(q)
+	}
+}
+
+// drain runs the ordered subscriber on its queued events until the queue is
+// empty
+func (b *Bus) drain(q *serialQueue) {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.pending = nil
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		event := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+
+		b.run(q.handler, event)
+	}
+}
+
+func (b *Bus) run(handler Handler, event Event) {
+	defer b.wg.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			b.logger.Error("Event subscriber panicked",
+				zap.String("event", event.EventName()),
+				zap.String("panic", fmt.Sprint(r)),
+			)
+		}
+	}()
+
+	if err := handler(context.Background(), event); err != nil {
+		b.logger.Error("Event subscriber failed",
+			zap.String("event", event.EventName()),
+			zap.Error(err),
+		)
+	}
+}
+
+// Wait blocks until all in-flight subscribers have finished or ctx is done
+func (b *Bus) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// seqEvent is an event carrying its publish sequence number
+type seqEvent struct {
+	name string
+	seq  int
+}
+
+func (e seqEvent) EventName() string { return e.name }
+
+func TestSubscribeOrdered(t *testing.T) {
+	const n = 200
+	bus := NewBus(zap.NewNop())
+	var mu sync.Mutex
+	var ordered, unordered []int
+	bus.SubscribeOrdered(func(ctx context.Context, event Event) error {
+		// Vary the handling time so later events would overtake earlier ones
+		seq := event.(seqEvent).seq
+		time.Sleep(time.Duration(seq%3) * 50 * time.Microsecond)
+		mu.Lock()
+		ordered = append(ordered, seq)
+		mu.Unlock()
+		return nil
+	}, "first", "second")
+	bus.Subscribe("first", func(ctx context.Context, event Event) error {
+		mu.Lock()
+		unordered = append(unordered, event.(seqEvent).seq)
+		mu.Unlock()
+		return nil
+	})
+
+	for seq := 0; seq < n; seq++ {
+		name := "first"
+		if seq%2 == 1 {
+			name = "second"
+		}
+		bus.Publish(seqEvent{name: name, seq: seq})
+	}
+	bus.Publish(seqEvent{name: "other", seq: n})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := bus.Wait(ctx); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	if len(ordered) != n {
+		t.Fatalf("ordered subscriber got %d events, want %d", len(ordered), n)
+	}
+	for i, seq := range ordered {
+		if seq != i {
+			t.Fatalf("ordered subscriber got events out of order: %v", ordered)
+		}
+	}
+	if len(unordered) != n/2 {
+		t.Errorf("subscriber got %d events, want %d", len(unordered), n/2)
+	}
+}
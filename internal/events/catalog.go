@@ -0,0 +1,32 @@
+package events
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event names
+const (
+	NameMerchantChanged = "merchant.changed"
+	NameContentChanged  = "content.changed"
+)
+
+// MerchantChanged is published when a merchant is updated or deactivated
+type MerchantChanged struct {
+	MerchantID uuid.UUID
+	ChangedAt  time.Time
+}
+
+// EventName implements Event
+func (MerchantChanged) EventName() string { return NameMerchantChanged }
+
+// ContentChanged is published when content is updated or deactivated
+type ContentChanged struct {
+	ContentID  uuid.UUID
+	MerchantID uuid.UUID
+	ChangedAt  time.Time
+}
+
+// EventName implements Event
+func (ContentChanged) EventName() string { return NameContentChanged }
@@ -0,0 +1,25 @@
+package events
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// NameDisputeStatusChanged is published when a dispute is opened or advanced
+const NameDisputeStatusChanged = "dispute.status_changed"
+
+// DisputeStatusChanged is published on every dispute transition. FromStatus is
+// empty when the dispute was just opened.
+type DisputeStatusChanged struct {
+	DisputeID  uuid.UUID
+	MerchantID uuid.UUID
+	SessionID  uuid.UUID
+	FromStatus models.DisputeStatus
+	ToStatus   models.DisputeStatus
+	ChangedAt  time.Time
+}
+
+// EventName implements Event
+func (DisputeStatusChanged) EventName() string { return NameDisputeStatusChanged }
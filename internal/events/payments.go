@@ -0,0 +1,86 @@
+package events
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event names
+const (
+	NamePaymentCreated = "payment.created"
+	NamePaymentPaid    = "payment.paid"
+	// NamePaymentPaidAfterExpiry is published alongside payment.paid when the
+	// session had already expired
+	NamePaymentPaidAfterExpiry = "payment.paid_after_expiry"
+	NamePaymentRefunded        = "payment.refunded"
+	NamePaymentCancelled       = "payment.cancelled"
+)
+
+// PaymentCreated is published when a new payment session is created
+type PaymentCreated struct {
+	SessionID        uuid.UUID
+	MerchantID       uuid.UUID
+	ContentID        uuid.UUID
+	PaymentReference string
+	QRCodeData       string
+	AmountCents      int
+	Currency         string
+	ExpiresAt        time.Time
+}
+
+// EventName implements Event
+func (PaymentCreated) EventName() string { return NamePaymentCreated }
+
+// PaymentPaid is published when a payment session transitions to paid
+type PaymentPaid struct {
+	SessionID        uuid.UUID
+	MerchantID       uuid.UUID
+	PaymentReference string
+	AmountCents      int
+	Currency         string
+	PaidAt           time.Time
+	AccessExpiresAt  time.Time
+}
+
+// EventName implements Event
+func (PaymentPaid) EventName() string { return NamePaymentPaid }
+
+// PaymentPaidAfterExpiry is published when a bank transaction settles a session
+// that expired less than the grace period ago, reactivating it
+type PaymentPaidAfterExpiry struct {
+	SessionID     uuid.UUID
+	MerchantID    uuid.UUID
+	TransactionID uuid.UUID
+	ExpiredAt     time.Time
+	PaidAt        time.Time
+}
+
+// EventName implements Event
+func (PaymentPaidAfterExpiry) EventName() string { return NamePaymentPaidAfterExpiry }
+
+// PaymentRefunded is published when a paid session is refunded and the access
+// it granted revoked
+type PaymentRefunded struct {
+	SessionID        uuid.UUID
+	MerchantID       uuid.UUID
+	PaymentReference string
+	AmountCents      int
+	Currency         string
+	Reason           string
+	RefundedAt       time.Time
+}
+
+// EventName implements Event
+func (PaymentRefunded) EventName() string { return NamePaymentRefunded }
+
+// PaymentCancelled is published when the customer abandons a pending session
+type PaymentCancelled struct {
+	SessionID        uuid.UUID
+	MerchantID       uuid.UUID
+	PaymentReference string
+	CancelledAt      time.Time
+}
+
+// EventName implements Event
+func (PaymentCancelled) EventName() string { return NamePaymentCancelled }
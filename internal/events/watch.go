@@ -0,0 +1,68 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// SessionWatch notifies waiters on a payment session when this instance
+// publishes a status change of that session. Changes made by other instances
+// or by the database alone are not seen, so waiters still poll as a fallback.
+type SessionWatch struct {
+	mu      sync.Mutex
+	waiters map[uuid.UUID]map[chan struct{}]struct{}
+}
+
+// NewSessionWatch creates a watch fed by the payment events on bus
+func NewSessionWatch(bus *Bus) *SessionWatch {
+	w := &SessionWatch{waiters: make(map[uuid.UUID]map[chan struct{}]struct{})}
+	bus.Subscribe(NamePaymentPaid, func(ctx context.Context, event Event) error {
+		w.notify(event.(PaymentPaid).SessionID)
+		return nil
+	})
+	bus.Subscribe(NamePaymentRefunded, func(ctx context.Context, event Event) error {
+		w.notify(event.(PaymentRefunded).SessionID)
+		return nil
+	})
+	bus.Subscribe(NamePaymentCancelled, func(ctx context.Context, event Event) error {
+		w.notify(event.(PaymentCancelled).SessionID)
+		return nil
+	})
+	return w
+}
+
+// Watch returns a channel that receives after each status change of the
+// session, coalescing changes the waiter has not picked up yet. Call stop once
+// done waiting.
+func (w *SessionWatch) Watch(sessionID uuid.UUID) (changed <-chan struct{}, stop func()) {
+	ch := make(chan struct{}, 1)
+
+	w.mu.Lock()
+	if w.waiters[sessionID] == nil {
+		w.waiters[sessionID] = make(map[chan struct{}]struct{})
+	}
+	w.waiters[sessionID][ch] = struct{}{}
+	w.mu.Unlock()
+
+	return ch, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.waiters[sessionID], ch)
+		if len(w.waiters[sessionID]) == 0 {
+			delete(w.waiters, sessionID)
+		}
+	}
+}
+
+func (w *SessionWatch) notify(sessionID uuid.UUID) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.waiters[sessionID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
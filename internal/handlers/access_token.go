@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/accesstoken"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+// accessToken signs a JWT for a paid session that expires together with the
+// access it bought. Anonymous sessions get the session ID as subject. It
+// returns an empty token when the session grants no access right now.
+func (h *Handlers) accessToken(session *models.PaymentSession) (string, time.Time) {
+	now := time.Now()
+	if session.Status != models.PaymentStatusPaid || session.AccessExpiresAt == nil || !now.Before(*session.AccessExpiresAt) {
+		return "", time.Time{}
+	}
+
+	t := accesstoken.Token{
+		SessionID: session.SessionID,
+		ContentID: session.ContentID,
+		User:      session.SessionID.String(),
+		IssuedAt:  now,
+		ExpiresAt: *session.AccessExpiresAt,
+	}
+	if session.UserIdentifier != nil && *session.UserIdentifier != "" {
+		t.User = *session.UserIdentifier
+	}
+	token, err := accesstoken.Sign(t, h.config.Auth.JWTSecret)
+	if err != nil {
+		h.logger.Error("Failed to sign access token", zap.Error(err))
+		return "", time.Time{}
+	}
+	return token, t.ExpiresAt
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header, or ""
+func bearerToken(c *gin.Context) string {
+	scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// tokenAccess identifies the user by the bearer token on the request. user is
+// empty when there is no token. grant is set when the token is for this content
+// and its session still grants access; a token for other content only proves
+// who the user is. When the token is invalid or expired a 401 is written and ok
+// is false.
+func (h *Handlers) tokenAccess(c *gin.Context, content *models.Content) (user string, grant *models.ContentAccess, ok bool) {
+	token := bearerToken(c)
+	if token == "" {
+		return "", nil, true
+	}
+
+	t, err := accesstoken.Verify(token, h.config.Auth.JWTSecret, time.Now())
+	if err != nil {
+		if !errors.Is(err, accesstoken.ErrExpired) {
+			h.logger.Debug("Rejected access token", zap.Error(err))
+		}
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired access token"})
+		return "", nil, false
+	}
+	if t.ContentID != content.ContentID {
+		return t.User, nil, true
+	}
+
+	active, err := h.contentService.SessionAccessActive(c.Request.Context(), t.SessionID)
+	if err != nil {
+		h.logger.Error("Failed to check access token", zap.Error(err))
+		return t.User, nil, true
+	}
+	if !active {
+		return t.User, nil, true
+	}
+
+	sessionID := t.SessionID
+	return t.User, &models.ContentAccess{
+		SessionID:      &sessionID,
+		MerchantID:     content.MerchantID,
+		ContentID:      content.ContentID,
+		UserIdentifier: t.User,
+		ExpiresAt:      t.ExpiresAt,
+		IsActive:       true,
+	}, true
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/middleware"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+// audit records an action the authenticated caller took in the audit log. The
+// action has happened by then, so failing to record it is logged rather than
+// failing the request.
+func (h *Handlers) audit(c *gin.Context, action, targetType, targetID string, metadata map[string]interface{}) {
+	actor := services.AuditActor{
+		Name:      "admin",
+		RequestID: c.GetString("request_id"),
+		IP:        c.ClientIP(),
+	}
+	if merchant := middleware.CurrentMerchant(c); merchant != nil {
+		actor.Name = "merchant:" + merchant.MerchantID.String()
+	}
+
+	err := h.auditService.Record(c.Request.Context(), actor, action, targetType, targetID, metadata)
+	if err != nil {
+		h.logger.Error("Failed to record audit entry", zap.Error(err),
+			zap.String("action", action), zap.String("target_id", targetID), zap.String("request_id", actor.RequestID))
+	}
+}
+
+// ListAuditLog lists the audit log newest first a page at a time, see
+// parsePage, optionally filtered by ?actor=, ?action=, ?target_type= and
+// ?target_id=
+func (h *Handlers) ListAuditLog(c *gin.Context) {
+	limit, offset, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	filter := services.AuditFilter{
+		Actor:      c.Query("actor"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+	}
+
+	page, err := h.auditService.ListAuditLog(c.Request.Context(), filter, limit, offset)
+	if err != nil {
+		h.logger.Error("Failed to list audit log", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":   page.Entries,
+		"total":  page.Total,
+		"limit":  page.Limit,
+		"offset": page.Offset,
+	})
+}
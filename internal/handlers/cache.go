@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cachePublic allows browsers and CDNs to cache a response for ttl. Only call it
+// for responses that are identical for every visitor of the merchant domain.
+func cachePublic(c *gin.Context, ttl time.Duration) {
+	if ttl <= 0 {
+		c.Header("Cache-Control", "no-store")
+		return
+	}
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(ttl.Seconds())))
+	// The merchant is resolved from these headers, so caches must key on them
+	c.Header("Vary", "Host, X-Merchant-Domain")
+}
+
+// cachePrivate allows only the visitor's own browser to cache a response for ttl
+func cachePrivate(c *gin.Context, ttl time.Duration) {
+	if ttl <= 0 {
+		c.Header("Cache-Control", "no-store")
+		return
+	}
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(ttl.Seconds())))
+}
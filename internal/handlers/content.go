@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+// CreateContentRequest represents the request to register protected content
+type CreateContentRequest struct {
+	Path                  string                 `json:"path" binding:"required"`
+	Title                 *string                `json:"title"`
+	Description           *string                `json:"description"`
+	PriceCents            int                    `json:"price_cents" binding:"required,min=1"`
+	Currency              string                 `json:"currency"`
+	AccessDurationSeconds *int                   `json:"access_duration_seconds"`
+	ContentType           models.ContentType     `json:"content_type"`
+	AccessRules           map[string]interface{} `json:"access_rules"`
+}
+
+// ListContent lists the active content of the merchant in the route a page at a
+// time, see parsePage
+func (h *Handlers) ListContent(c *gin.Context) {
+	merchantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+		return
+	}
+	h.listContent(c, merchantID)
+}
+
+func (h *Handlers) listContent(c *gin.Context, merchantID uuid.UUID) {
+	limit, offset, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.contentService.ListContent(c.Request.Context(), merchantID, limit, offset)
+	if err != nil {
+		h.logger.Error("Failed to list content", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list content"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":   page.Content,
+		"total":  page.Total,
+		"limit":  page.Limit,
+		"offset": page.Offset,
+	})
+}
+
+// CreateContent registers protected content for the merchant in the route.
+// Access rules may list "free_methods" and "denied_methods"; any other method
+// requires payment.
+func (h *Handlers) CreateContent(c *gin.Context) {
+	merchantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+		return
+	}
+	h.createContent(c, merchantID)
+}
+
+func (h *Handlers) createContent(c *gin.Context, merchantID uuid.UUID) {
+	var req CreateContentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		bindError(c, err)
+		return
+	}
+	path, ok := contentPath(c, req.Path, http.StatusBadRequest)
+	if !ok {
+		return
+	}
+	if req.Currency == "" {
+		req.Currency = h.config.Payment.DefaultCurrency
+	}
+	// Content is sold for an hour unless the merchant says otherwise; 0 sells
+	// permanent access
+	duration := 3600
+	if req.AccessDurationSeconds != nil {
+		duration = *req.AccessDurationSeconds
+	}
+
+	content, err := h.contentService.CreateContent(c.Request.Context(), &models.Content{
+		MerchantID:            merchantID,
+		Path:                  path,
+		Title:                 req.Title,
+		Description:           req.Description,
+		PriceCents:            req.PriceCents,
+		Currency:              req.Currency,
+		AccessDurationSeconds: duration,
+		ContentType:           req.ContentType,
+		AccessRules:           req.AccessRules,
+	})
+	switch {
+	case errors.Is(err, services.ErrInvalidCurrency), errors.Is(err, services.ErrInvalidPrice),
+		errors.Is(err, services.ErrInvalidAccessDuration):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrInvalidAccessRules):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrContentTypeNotAllowed), errors.Is(err, services.ErrTierLimitReached):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	case errors.Is(err, services.ErrContentExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "Content already exists for this path"})
+		return
+	case err != nil:
+		h.logger.Error("Failed to create content", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create content"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, content)
+}
+
+// parseContentIDs reads the merchant and content IDs from the route
+func parseContentIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	merchantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	contentID, err := uuid.Parse(c.Param("contentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid content ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return merchantID, contentID, true
+}
+
+// UpdateContent changes content fields; omitted fields are kept. A new price
+// applies to sessions created afterwards.
+func (h *Handlers) UpdateContent(c *gin.Context) {
+	merchantID, contentID, ok := parseContentIDs(c)
+	if !ok {
+		return
+	}
+	h.updateContent(c, merchantID, contentID)
+}
+
+func (h *Handlers) updateContent(c *gin.Context, merchantID, contentID uuid.UUID) {
+	var update services.ContentUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		bindError(c, err)
+		return
+	}
+	if update.PriceCents != nil && *update.PriceCents < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price_cents must be positive"})
+		return
+	}
+
+	content, err := h.contentService.UpdateContent(c.Request.Context(), merchantID, contentID, update)
+	switch {
+	case errors.Is(err, services.ErrInvalidCurrency), errors.Is(err, services.ErrInvalidPrice),
+		errors.Is(err, services.ErrInvalidAccessDuration):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrInvalidAccessRules):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrContentTypeNotAllowed), errors.Is(err, services.ErrTierLimitReached):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Content not found"})
+		return
+	case err != nil:
+		h.logger.Error("Failed to update content", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update content"})
+		return
+	}
+
+	c.JSON(http.StatusOK, content)
+}
+
+// DeleteContent deactivates content
+func (h *Handlers) DeleteContent(c *gin.Context) {
+	merchantID, contentID, ok := parseContentIDs(c)
+	if !ok {
+		return
+	}
+	h.deleteContent(c, merchantID, contentID)
+}
+
+func (h *Handlers) deleteContent(c *gin.Context, merchantID, contentID uuid.UUID) {
+	err := h.contentService.DeleteContent(c.Request.Context(), merchantID, contentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Content not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to delete content", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete content"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeContentAccess revokes the access a user bought to content
+func (h *Handlers) RevokeContentAccess(c *gin.Context) {
+	merchantID, contentID, ok := parseContentIDs(c)
+	if !ok {
+		return
+	}
+	h.revokeAccess(c, merchantID, contentID, c.Param("userId"))
+}
+
+func (h *Handlers) revokeAccess(c *gin.Context, merchantID, contentID uuid.UUID, userID string) {
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user identifier"})
+		return
+	}
+
+	err := h.contentService.RevokeAccess(c.Request.Context(), merchantID, contentID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No active access found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to revoke access", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke access"})
+		return
+	}
+
+	h.audit(c, services.AuditAccessRevoke, services.AuditTargetContent, contentID.String(),
+		map[string]interface{}{"user_identifier": userID})
+	c.Status(http.StatusNoContent)
+}
+
+// RenewContentAccess extends a user's access to subscription content by one
+// access period, for renewals the merchant billed itself
+func (h *Handlers) RenewContentAccess(c *gin.Context) {
+	merchantID, contentID, ok := parseContentIDs(c)
+	if !ok {
+		return
+	}
+	userID := c.Param("userId")
+
+	grant, err := h.contentService.RenewSubscription(c.Request.Context(), merchantID, contentID, userID)
+	switch {
+	case errors.Is(err, services.ErrNotSubscription):
+		c.JSON(http.StatusConflict, gin.H{"error": "Content is not a renewable subscription"})
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No paid access found"})
+		return
+	case err != nil:
+		h.logger.Error("Failed to renew subscription", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to renew subscription"})
+		return
+	}
+
+	h.audit(c, services.AuditAccessRenew, services.AuditTargetContent, contentID.String(),
+		map[string]interface{}{"user_identifier": userID, "expires_at": grant.ExpiresAt})
+	c.JSON(http.StatusOK, grant)
+}
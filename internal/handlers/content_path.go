@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/services"
+)
+
+// contentPath normalizes a content path taken from the request. When the path is
+// unusable it writes the response and returns false: tooLongStatus for an
+// over-long path (414 when the path is part of the URL, 400 for query or body
+// values) and 400 for malformed ones.
+func contentPath(c *gin.Context, raw string, tooLongStatus int) (string, bool) {
+	path, err := services.NormalizeContentPath(raw)
+	switch {
+	case errors.Is(err, services.ErrContentPathTooLong):
+		c.JSON(tooLongStatus, gin.H{
+			"error":      "Content path too long",
+			"max_length": services.MaxContentPathLength,
+		})
+		return "", false
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid content path"})
+		return "", false
+	}
+	return path, true
+}
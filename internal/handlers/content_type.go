@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// sniffLen is the most http.DetectContentType looks at
+const sniffLen = 512
+
+// fixContentType corrects the Content-Type of a backend response. The
+// "content_type" access rule of the content replaces whatever the backend
+// sent; otherwise, with proxy.sniff_content_type, a missing type is detected
+// from the start of the body. The content is nil for paths that are not
+// paywalled.
+func (h *Handlers) fixContentType(resp *http.Response, content *models.Content) error {
+	if content != nil {
+		if value := contentTypeOverride(content); value != "" {
+			resp.Header.Set("Content-Type", value)
+			return nil
+		}
+	}
+	if !h.config.Proxy.SniffContentType || resp.Header.Get("Content-Type") != "" || !hasBody(resp) {
+		return nil
+	}
+	// A range starts anywhere in the file, so its first bytes say nothing
+	// about the type
+	if resp.StatusCode == http.StatusPartialContent {
+		return nil
+	}
+	return sniffContentType(resp)
+}
+
+// contentTypeOverride returns the "content_type" access rule of the content, or
+// "" when it is unset or not a valid media type
+func contentTypeOverride(content *models.Content) string {
+	value := content.StringRule("content_type")
+	if value == "" {
+		return ""
+	}
+	mediaType, params, err := mime.ParseMediaType(value)
+	if err != nil {
+		return ""
+	}
+	return mime.FormatMediaType(mediaType, params)
+}
+
+func hasBody(resp *http.Response) bool {
+	if resp.Body == nil || resp.Body == http.NoBody || resp.Request.Method == http.MethodHead {
+		return false
+	}
+	return resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotModified
+}
+
+// sniffContentType sets the Content-Type detected from the first bytes of the
+// body. Only a single read is done, so a streamed response is sniffed on what
+// has arrived rather than held back until sniffLen bytes are in; the bytes read
+// are put back in front of the body.
+func sniffContentType(resp *http.Response) error {
+	prefix := make([]byte, sniffLen)
+	n, err := resp.Body.Read(prefix)
+	if n == 0 {
+		if err != nil && err != io.EOF {
+			return err
+		}
+		return nil
+	}
+	prefix = prefix[:n]
+	resp.Header.Set("Content-Type", http.DetectContentType(prefix))
+	resp.Body = &prefixedBody{
+		Reader: io.MultiReader(bytes.NewReader(prefix), resp.Body),
+		Closer: resp.Body,
+	}
+	return nil
+}
+
+// prefixedBody is a response body with bytes already read put back in front
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// crawlerPreviewSetting is the merchant setting that opts into crawler previews
+const crawlerPreviewSetting = "crawler_previews"
+
+// isCrawler reports whether the user agent matches one of the configured crawlers
+func (h *Handlers) isCrawler(userAgent string) bool {
+	ua := strings.ToLower(userAgent)
+	for _, crawler := range h.config.Crawler.UserAgents {
+		if crawler != "" && strings.Contains(ua, strings.ToLower(crawler)) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveCrawlerPreview renders the Open Graph metadata for paywalled content.
+// It only exposes what the 402 response already reveals (title, description and
+// an optional preview image), so spoofing a crawler user agent bypasses nothing.
+// path is the requested path, which differs from content.Path for pattern entries.
+func (h *Handlers) serveCrawlerPreview(c *gin.Context, content *models.Content, path string) {
+	title := path
+	if content.Title != nil {
+		title = *content.Title
+	}
+	description := ""
+	if content.Description != nil {
+		description = *content.Description
+	}
+
+	c.HTML(http.StatusOK, "preview.html", gin.H{
+		"Title":        title,
+		"Description":  description,
+		"PreviewImage": content.StringRule("preview_image_url"),
+		"URL":          "https://" + c.Request.Host + path,
+	})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// setContentDisposition applies the "disposition" ("inline" or "attachment") and
+// optional "filename" access rules of file_download content. Without a rule the
+// header is left alone so the upstream's own disposition passes through.
+func setContentDisposition(c *gin.Context, content *models.Content) {
+	if value := contentDisposition(content); value != "" {
+		c.Header("Content-Disposition", value)
+	}
+}
+
+// contentDisposition returns the Content-Disposition value configured for the
+// content, or "" when it has none
+func contentDisposition(content *models.Content) string {
+	if content.ContentType != models.ContentTypeFileDownload {
+		return ""
+	}
+	disposition := strings.ToLower(content.StringRule("disposition"))
+	if disposition != "inline" && disposition != "attachment" {
+		return ""
+	}
+
+	var params map[string]string
+	if filename := sanitizeFilename(content.StringRule("filename")); filename != "" {
+		params = map[string]string{"filename": filename}
+	}
+	// FormatMediaType quotes the filename and switches to RFC 2231 encoding for
+	// non-ASCII names; it returns "" if it cannot produce a safe value
+	if value := mime.FormatMediaType(disposition, params); value != "" {
+		return value
+	}
+	return disposition
+}
+
+// sanitizeFilename reduces a configured filename to a bare file name: any
+// directory part is dropped, and control characters, quotes and backslashes are
+// removed so the value can never break out of the header
+func sanitizeFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "." || name == "/" || name == ".." {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType models.ContentType
+		rules       models.JSONMap
+		want        string
+	}{
+		{"no rule", models.ContentTypeFileDownload, nil, ""},
+		{"inline", models.ContentTypeFileDownload, models.JSONMap{"disposition": "inline"}, "inline"},
+		{"attachment is case insensitive", models.ContentTypeFileDownload, models.JSONMap{"disposition": "Attachment"}, "attachment"},
+		{"unknown disposition", models.ContentTypeFileDownload, models.JSONMap{"disposition": "download"}, ""},
+		{"not a string", models.ContentTypeFileDownload, models.JSONMap{"disposition": true}, ""},
+		{"other content type", models.ContentTypeWebpage, models.JSONMap{"disposition": "attachment"}, ""},
+		{"filename", models.ContentTypeFileDownload, models.JSONMap{"disposition": "attachment", "filename": "report.pdf"}, "attachment; filename=report.pdf"},
+		{"filename with spaces is quoted", models.ContentTypeFileDownload, models.JSONMap{"disposition": "attachment", "filename": "annual report.pdf"}, `attachment; filename="annual report.pdf"`},
+		{"non-ASCII filename", models.ContentTypeFileDownload, models.JSONMap{"disposition": "attachment", "filename": "résumé.pdf"}, "attachment; filename*=utf-8''r%C3%A9sum%C3%A9.pdf"},
+		{"directory is dropped", models.ContentTypeFileDownload, models.JSONMap{"disposition": "attachment", "filename": "../../etc/passwd"}, "attachment; filename=passwd"},
+		{"header injection is stripped", models.ContentTypeFileDownload, models.JSONMap{"disposition": "attachment", "filename": "a\"\r\nSet-Cookie: x.pdf"}, `attachment; filename="aSet-Cookie: x.pdf"`},
+		{"empty filename", models.ContentTypeFileDownload, models.JSONMap{"disposition": "inline", "filename": ".."}, "inline"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := &models.Content{ContentType: tt.contentType, AccessRules: tt.rules}
+			if got := contentDisposition(content); got != tt.want {
+				t.Errorf("contentDisposition() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"reports/2024/report.pdf", "report.pdf"},
+		{`C:\Users\me\report.pdf`, "report.pdf"},
+		{"  report.pdf  ", "report.pdf"},
+		{"re\x00po\x7frt.pdf", "report.pdf"},
+		{`"quoted".pdf`, "quoted.pdf"},
+		{"", ""},
+		{".", ""},
+		{"..", ""},
+		{"/", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeFilename(tt.name); got != tt.want {
+				t.Errorf("sanitizeFilename(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+// ListDisputes lists disputes, optionally filtered by merchant_id and status
+func (h *Handlers) ListDisputes(c *gin.Context) {
+	var filter services.DisputeFilter
+
+	if merchantIDStr := c.Query("merchant_id"); merchantIDStr != "" {
+		merchantID, err := uuid.Parse(merchantIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+			return
+		}
+		filter.MerchantID = &merchantID
+	}
+	if statusStr := c.Query("status"); statusStr != "" {
+		status := models.DisputeStatus(statusStr)
+		filter.Status = &status
+	}
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	disputes, err := h.disputeService.List(c.Request.Context(), filter)
+	if err != nil {
+		h.logger.Error("Failed to list disputes", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list disputes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": disputes})
+}
+
+// OpenDispute opens a dispute on a paid session
+func (h *Handlers) OpenDispute(c *gin.Context) {
+	var req services.OpenDisputeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		bindError(c, err)
+		return
+	}
+
+	dispute, err := h.disputeService.Open(c.Request.Context(), req)
+	switch {
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment session not found"})
+		return
+	case errors.Is(err, services.ErrSessionNotDisputable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment session is not paid"})
+		return
+	case errors.Is(err, services.ErrDisputeExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment session already has an open dispute"})
+		return
+	case err != nil:
+		h.logger.Error("Failed to open dispute", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open dispute"})
+		return
+	}
+	h.audit(c, services.AuditDisputeOpen, services.AuditTargetDispute, dispute.DisputeID.String(), map[string]interface{}{
+		"session_id":    req.SessionID,
+		"reason":        req.Reason,
+		"freeze_access": req.FreezeAccess,
+	})
+
+	c.JSON(http.StatusCreated, dispute)
+}
+
+// GetDispute returns a dispute with its notes and evidence
+func (h *Handlers) GetDispute(c *gin.Context) {
+	disputeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dispute ID"})
+		return
+	}
+
+	dispute, err := h.disputeService.Get(c.Request.Context(), disputeID)
+	if errors.Is(err, services.ErrDisputeNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dispute not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get dispute", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get dispute"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dispute)
+}
+
+// AdvanceDispute moves a dispute to its next status
+func (h *Handlers) AdvanceDispute(c *gin.Context) {
+	disputeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dispute ID"})
+		return
+	}
+
+	var req services.DisputeTransition
+	if err := c.ShouldBindJSON(&req); err != nil {
+		bindError(c, err)
+		return
+	}
+
+	dispute, err := h.disputeService.Advance(c.Request.Context(), disputeID, req)
+	switch {
+	case errors.Is(err, services.ErrDisputeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dispute not found"})
+		return
+	case errors.Is(err, services.ErrInvalidDisputeTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		h.logger.Error("Failed to advance dispute", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to advance dispute"})
+		return
+	}
+	h.audit(c, services.AuditDisputeTransition, services.AuditTargetDispute, disputeID.String(), map[string]interface{}{
+		"status": req.Status,
+	})
+
+	c.JSON(http.StatusOK, dispute)
+}
+
+// AddDisputeNote records a note or piece of evidence on a dispute
+func (h *Handlers) AddDisputeNote(c *gin.Context) {
+	disputeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dispute ID"})
+		return
+	}
+
+	var req struct {
+		Note        string  `json:"note" binding:"required"`
+		EvidenceURL *string `json:"evidence_url"`
+		Author      *string `json:"author"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		bindError(c, err)
+		return
+	}
+
+	err = h.disputeService.AddNote(c.Request.Context(), disputeID, req.Author, req.Note, req.EvidenceURL)
+	if errors.Is(err, services.ErrDisputeNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dispute not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to add dispute note", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add dispute note"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Note added"})
+}
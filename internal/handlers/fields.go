@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+// Fields that can be selected with ?fields= per resource
+var (
+	sessionFields = []string{
+		"session_id", "status", "amount_cents", "amount", "currency",
+		"currency_minor_units", "display_amount_cents", "display_currency", "exchange_rate", "expires_at", "paid_at", "access_granted_at",
+		"access_expires_at", "renews_at", "refunded_at", "failure_reason", "access_receipt",
+	}
+	contentInfoFields = []string{
+		"content_path", "title", "description", "price_cents", "price_display",
+		"currency", "currency_minor_units", "access_duration_seconds", "content_type",
+	}
+	transactionFields = modelFields(models.BankTransaction{})
+	merchantFields    = modelFields(models.Merchant{})
+)
+
+// fieldSet is the set of top-level JSON fields a client selected with ?fields=.
+// A nil set selects everything.
+type fieldSet map[string]bool
+
+// parseFields reads the comma-separated fields query parameter. Every name must
+// be in allowed; otherwise a 400 listing the allowed names is written and false
+// returned. idField is always included so results stay addressable.
+func parseFields(c *gin.Context, allowed []string, idField string) (fieldSet, bool) {
+	raw := c.Query("fields")
+	if raw == "" {
+		return nil, true
+	}
+
+	known := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		known[name] = true
+	}
+
+	fields := fieldSet{idField: true}
+	var unknown []string
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !known[name] {
+			unknown = append(unknown, name)
+			continue
+		}
+		fields[name] = true
+	}
+	if len(unknown) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":          "Unknown fields requested",
+			"unknown_fields": unknown,
+			"allowed_fields": allowed,
+		})
+		return nil, false
+	}
+	return fields, true
+}
+
+// apply returns v restricted to the selected fields. v must encode to a JSON
+// object; with a nil set it is returned unchanged.
+func (f fieldSet) apply(v interface{}) (interface{}, error) {
+	if f == nil {
+		return v, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, err
+	}
+	return f.filter(object), nil
+}
+
+// applyList is apply for a slice of objects
+func (f fieldSet) applyList(v interface{}) (interface{}, error) {
+	if f == nil {
+		return v, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &objects); err != nil {
+		return nil, err
+	}
+	for i, object := range objects {
+		objects[i] = f.filter(object)
+	}
+	return objects, nil
+}
+
+func (f fieldSet) filter(object map[string]json.RawMessage) map[string]json.RawMessage {
+	for name := range object {
+		if !f[name] {
+			delete(object, name)
+		}
+	}
+	return object
+}
+
+// writeFields writes v as JSON restricted to the selected fields
+func (h *Handlers) writeFields(c *gin.Context, status int, fields fieldSet, v interface{}) {
+	out, err := fields.apply(v)
+	if err != nil {
+		h.logger.Error("Failed to select response fields", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode response"})
+		return
+	}
+	c.JSON(status, out)
+}
+
+// modelFields lists the JSON field names of a model struct, skipping fields
+// that are never encoded
+func modelFields(model interface{}) []string {
+	t := reflect.TypeOf(model)
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,21 +1,42 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/access"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/events"
+	"github.com/mh74hf/micro-payments/internal/methods"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/money"
+	"github.com/mh74hf/micro-payments/internal/qr"
 	"github.com/mh74hf/micro-payments/internal/services"
+	"github.com/mh74hf/micro-payments/internal/webhooks"
 	"go.uber.org/zap"
 )
 
 // Handlers holds all HTTP handlers
 type Handlers struct {
-	paymentService  *services.PaymentService
-	merchantService *services.MerchantService
-	contentService  *services.ContentService
-	logger          *zap.Logger
+	paymentService        *services.PaymentService
+	merchantService       *services.MerchantService
+	contentService        *services.ContentService
+	transactionService    *services.TransactionService
+	reconciliationService *services.ReconciliationService
+	disputeService        *services.DisputeService
+	bandwidthService      *services.BandwidthService
+	auditService          *services.AuditService
+	paymentMethods        *methods.Registry
+	qrCache               *qr.Cache
+	sessionWatch          *events.SessionWatch
+	webhookDispatcher     *webhooks.Dispatcher
+	proxyTransport        http.RoundTripper
+	config                *config.Config
+	logger                *zap.Logger
 }
 
 // NewHandlers creates a new handlers instance
@@ -23,16 +44,50 @@ func NewHandlers(
 	paymentService *services.PaymentService,
 	merchantService *services.MerchantService,
 	contentService *services.ContentService,
+	transactionService *services.TransactionService,
+	reconciliationService *services.ReconciliationService,
+	disputeService *services.DisputeService,
+	bandwidthService *services.BandwidthService,
+	auditService *services.AuditService,
+	paymentMethods *methods.Registry,
+	qrCache *qr.Cache,
+	sessionWatch *events.SessionWatch,
+	webhookDispatcher *webhooks.Dispatcher,
+	cfg *config.Config,
 	logger *zap.Logger,
 ) *Handlers {
 	return &Handlers{
-		paymentService:  paymentService,
-		merchantService: merchantService,
-		contentService:  contentService,
-		logger:          logger,
+		paymentService:        paymentService,
+		merchantService:       merchantService,
+		contentService:        contentService,
+		transactionService:    transactionService,
+		reconciliationService: reconciliationService,
+		disputeService:        disputeService,
+		bandwidthService:      bandwidthService,
+		auditService:          auditService,
+		paymentMethods:        paymentMethods,
+		qrCache:               qrCache,
+		sessionWatch:          sessionWatch,
+		webhookDispatcher:     webhookDispatcher,
+		proxyTransport:        newProxyTransport(cfg.Proxy),
+		config:                cfg,
+		logger:                logger,
 	}
 }
 
+// bindError writes the response for a request body that failed to bind: 413
+// when it was cut off by middleware.BodyLimit, 400 otherwise
+func bindError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit),
+		})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
 // CreatePayment creates a new payment session
 func (h *Handlers) CreatePayment(c *gin.Context) {
 	var req struct {
@@ -41,55 +96,99 @@ func (h *Handlers) CreatePayment(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		bindError(c, err)
 		return
 	}
 
-	// Get merchant from domain or API key
-	domain := c.GetHeader("X-Merchant-Domain")
-	if domain == "" {
-		// Extract domain from Host header
-		host := c.GetHeader("Host")
-		if host != "" {
-			domain = strings.Split(host, ":")[0]
-		}
+	path, ok := contentPath(c, req.ContentPath, http.StatusBadRequest)
+	if !ok {
+		return
 	}
 
-	merchant, err := h.merchantService.GetMerchantByDomain(domain)
-	if err != nil {
-		h.logger.Error("Failed to get merchant", zap.Error(err), zap.String("domain", domain))
-		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+	// Get merchant from domain
+	merchant, ok := h.resolveMerchant(c)
+	if !ok {
 		return
 	}
 
 	// Get content
-	content, err := h.contentService.GetContentByPath(merchant.MerchantID, req.ContentPath)
+	content, err := h.contentService.GetContentByPath(merchant.MerchantID, path)
 	if err != nil {
 		h.logger.Error("Failed to get content", zap.Error(err))
 		c.JSON(http.StatusNotFound, gin.H{"error": "Content not found"})
 		return
 	}
 
+	// Never charge for content the user may not be shown
+	rules, err := h.contentService.AccessRules(content)
+	if err != nil {
+		h.logger.Error("Invalid content access rules", zap.Error(err), zap.String("content_id", content.ContentID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate access rules"})
+		return
+	}
+	if h.legallyRestricted(c, merchant, rules) {
+		return
+	}
+
 	// Create payment session
-	session, err := h.paymentService.CreatePaymentSession(merchant.MerchantID, content.ContentID, req.UserIdentifier)
+	session, err := h.paymentService.CreatePaymentSession(merchant.MerchantID, content.ContentID, req.UserIdentifier,
+		c.Request.UserAgent(), c.ClientIP())
+	if errors.Is(err, services.ErrCurrencyMismatch) {
+		h.logger.Warn("Content currency cannot settle to merchant account", zap.Error(err))
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrTierLimitReached) {
+		h.logger.Warn("Merchant reached its session limit", zap.Error(err), zap.String("merchant_id", content.MerchantID.String()))
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrAmountOutOfRange) {
+		h.logger.Warn("Content price outside payment amount limits", zap.Error(err), zap.String("content_id", content.ContentID.String()))
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		h.logger.Error("Failed to create payment session", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment session"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"session_id":        session.SessionID,
-		"payment_reference": session.PaymentReference,
-		"qr_code_data":      session.QRCodeData,
-		"amount_cents":      session.AmountCents,
-		"currency":          session.Currency,
-		"expires_at":        session.ExpiresAt,
-		"status":            session.Status,
-	})
+	h.writeSessionCreated(c, merchant, session)
+}
+
+// writeSessionCreated writes the 201 response for a new payment session
+func (h *Handlers) writeSessionCreated(c *gin.Context, merchant *models.Merchant, session *models.PaymentSession) {
+	resp := gin.H{
+		"session_id":           session.SessionID,
+		"payment_reference":    session.PaymentReference,
+		"qr_code_data":         session.QRCodeData,
+		"amount_cents":         session.AmountCents,
+		"amount_display":       h.moneyFormat(merchant).Format(session.AmountCents, session.Currency),
+		"currency":             session.Currency,
+		"currency_minor_units": money.Lookup(session.Currency).Exponent,
+		"expires_at":           session.ExpiresAt,
+		"status":               session.Status,
+	}
+	addDisplayAmount(resp, session)
+	h.addDecimalAmount(c, resp, "amount", session.AmountCents, session.Currency)
+	c.JSON(http.StatusCreated, resp)
+}
+
+// addDisplayAmount adds the content price a session's amount was converted
+// from, if it was
+func addDisplayAmount(resp gin.H, session *models.PaymentSession) {
+	if session.DisplayAmountCents == nil {
+		return
+	}
+	resp["display_amount_cents"] = *session.DisplayAmountCents
+	resp["display_currency"] = session.DisplayCurrency
+	resp["exchange_rate"] = session.ExchangeRate
 }
 
-// GetPaymentStatus retrieves payment session status
+// GetPaymentStatus retrieves payment session status. With ?wait= (e.g. 30s) a
+// pending session is long-polled: the response is held until the status
+// changes or the wait is over, see waitForStatusChange.
 func (h *Handlers) GetPaymentStatus(c *gin.Context) {
 	sessionIDStr := c.Param("sessionId")
 	sessionID, err := uuid.Parse(sessionIDStr)
@@ -97,6 +196,15 @@ func (h *Handlers) GetPaymentStatus(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
 		return
 	}
+	fields, ok := parseFields(c, sessionFields, "session_id")
+	if !ok {
+		return
+	}
+
+	wait, ok := h.parseStatusWait(c)
+	if !ok {
+		return
+	}
 
 	session, err := h.paymentService.GetPaymentSession(sessionID)
 	if err != nil {
@@ -104,17 +212,36 @@ func (h *Handlers) GetPaymentStatus(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Payment session not found"})
 		return
 	}
+	if wait > 0 && session.Status == models.PaymentStatusPending {
+		session = h.waitForStatusChange(c, session, wait)
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"session_id":        session.SessionID,
-		"status":            session.Status,
-		"amount_cents":      session.AmountCents,
-		"currency":          session.Currency,
-		"expires_at":        session.ExpiresAt,
-		"paid_at":           session.PaidAt,
-		"access_granted_at": session.AccessGrantedAt,
-		"access_expires_at": session.AccessExpiresAt,
-	})
+	resp := gin.H{
+		"session_id":           session.SessionID,
+		"status":               session.Status,
+		"amount_cents":         session.AmountCents,
+		"currency":             session.Currency,
+		"currency_minor_units": money.Lookup(session.Currency).Exponent,
+		"expires_at":           session.ExpiresAt,
+		"paid_at":              session.PaidAt,
+		"access_granted_at":    session.AccessGrantedAt,
+		"access_expires_at":    session.AccessExpiresAt,
+	}
+	addDisplayAmount(resp, session)
+	if session.RenewsAt != nil {
+		resp["renews_at"] = session.RenewsAt
+	}
+	if session.RefundedAt != nil {
+		resp["refunded_at"] = session.RefundedAt
+	}
+	if session.Status == models.PaymentStatusFailed {
+		resp["failure_reason"] = session.Metadata["failure_reason"]
+	}
+	if token := h.accessReceipt(session); token != "" {
+		resp["access_receipt"] = token
+	}
+	h.addDecimalAmount(c, resp, "amount", session.AmountCents, session.Currency)
+	h.writeFields(c, http.StatusOK, fields, resp)
 }
 
 // VerifyPayment verifies a payment (simulated for demo)
@@ -126,35 +253,104 @@ func (h *Handlers) VerifyPayment(c *gin.Context) {
 		return
 	}
 
-	err = h.paymentService.VerifyPayment(sessionID)
-	if err != nil {
+	err = h.paymentService.VerifyPayment(c.Request.Context(), sessionID)
+	switch {
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment session not found"})
+		return
+	case errors.Is(err, services.ErrSessionNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
 		h.logger.Error("Failed to verify payment", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify payment"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Payment verified successfully"})
+	resp := gin.H{"message": "Payment verified successfully"}
+	if session, err := h.paymentService.GetPaymentSession(sessionID); err == nil {
+		if token := h.accessReceipt(session); token != "" {
+			resp["access_receipt"] = token
+		}
+		if token, expiresAt := h.accessToken(session); token != "" {
+			resp["access_token"] = token
+			resp["token_type"] = "Bearer"
+			resp["access_expires_at"] = expiresAt
+		}
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
-// ServeContent serves protected content if payment is verified
-func (h *Handlers) ServeContent(c *gin.Context) {
-	path := c.Param("path")
-	if !strings.HasPrefix(path, "/") {
-		path = "/" + path
+// HeartbeatPayment keeps a pending session alive while the user is on the checkout page
+func (h *Handlers) HeartbeatPayment(c *gin.Context) {
+	sessionIDStr := c.Param("sessionId")
+	sessionID, err := uuid.Parse(sessionIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
 	}
 
-	// Get merchant from domain
-	domain := c.GetHeader("X-Merchant-Domain")
-	if domain == "" {
-		host := c.GetHeader("Host")
-		if host != "" {
-			domain = strings.Split(host, ":")[0]
-		}
+	expiresAt, err := h.paymentService.ExtendSession(sessionID)
+	switch {
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment session not found"})
+		return
+	case errors.Is(err, services.ErrSessionNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment session is not pending"})
+		return
+	case errors.Is(err, services.ErrSessionExpired):
+		c.JSON(http.StatusGone, gin.H{"error": "Payment session has expired"})
+		return
+	case err != nil:
+		h.logger.Error("Failed to extend payment session", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to extend payment session"})
+		return
 	}
 
-	merchant, err := h.merchantService.GetMerchantByDomain(domain)
+	c.JSON(http.StatusOK, gin.H{
+		"session_id": sessionID,
+		"expires_at": expiresAt,
+	})
+}
+
+// CancelPayment cancels a pending session the customer abandoned
+func (h *Handlers) CancelPayment(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("sessionId"))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	session, err := h.paymentService.CancelPayment(c.Request.Context(), sessionID)
+	switch {
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment session not found"})
+		return
+	case errors.Is(err, services.ErrSessionNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending sessions can be cancelled"})
+		return
+	case err != nil:
+		h.logger.Error("Failed to cancel payment session", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel payment session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session_id": session.SessionID,
+		"status":     session.Status,
+	})
+}
+
+// ServeContent serves protected content if payment is verified
+func (h *Handlers) ServeContent(c *gin.Context) {
+	path, ok := contentPath(c, c.Param("path"), http.StatusRequestURITooLong)
+	if !ok {
+		return
+	}
+
+	// Get merchant from domain
+	merchant, ok := h.resolveMerchant(c)
+	if !ok {
 		return
 	}
 
@@ -165,65 +361,218 @@ func (h *Handlers) ServeContent(c *gin.Context) {
 		return
 	}
 
-	// Check if user has access (simplified - in real implementation, use session/JWT)
-	userID := c.GetHeader("X-User-ID")
-	if userID == "" {
-		userID = c.ClientIP() // Fallback to IP
+	grant, pw, ok := h.checkContentAccess(c, merchant, content, path)
+	if !ok {
+		return
 	}
-
-	access, err := h.contentService.CheckAccess(content.ContentID, userID)
-	if err != nil || access == nil {
-		// No access - return payment required response
-		c.JSON(http.StatusPaymentRequired, gin.H{
-			"error":        "Payment required",
-			"content_path": path,
-			"price_cents":  content.PriceCents,
-			"currency":     content.Currency,
-		})
+	if pw != nil {
+		h.servePreview(c, merchant, content, path, pw)
 		return
 	}
 
 	// User has access - serve content
-	c.JSON(http.StatusOK, gin.H{
-		"message":     "Content access granted",
-		"content":     content,
-		"access_info": access,
-	})
+	setContentDisposition(c, content)
+	response := gin.H{
+		"message": "Content access granted",
+		"content": content,
+	}
+	if grant != nil {
+		response["access_info"] = grant
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-// Placeholder handlers for merchant management
-func (h *Handlers) GetMerchants(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "Get merchants - not implemented"})
-}
+// checkContentAccess applies the content's access rules and the user's grants
+// to the request. When the request may not see the content the response is
+// written and ok is false. grant is nil when the content is free for this
+// request. A user who has not paid for content with a metered preview is let
+// in with a paywall, which cuts the response short.
+func (h *Handlers) checkContentAccess(c *gin.Context, merchant *models.Merchant, content *models.Content, path string) (*models.ContentAccess, *paywall, bool) {
+	// Access rules decide whether this request needs payment at all
+	rules, err := h.contentService.AccessRules(content)
+	if err != nil {
+		h.logger.Error("Invalid content access rules", zap.Error(err), zap.String("content_id", content.ContentID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate access rules"})
+		return nil, nil, false
+	}
+	if h.legallyRestricted(c, merchant, rules) {
+		return nil, nil, false
+	}
+	decision := rules.Evaluate(access.Request{
+		Method:  c.Request.Method,
+		IP:      net.ParseIP(c.ClientIP()),
+		Country: c.GetHeader(h.config.Access.CountryHeader),
+		Referer: c.Request.Referer(),
+	})
+	switch {
+	case decision.Reason == access.ReasonMethodDenied:
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Method not allowed for this content"})
+		return nil, nil, false
+	case decision.Policy == access.PolicyDenied:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access to this content is restricted", "reason": decision.Reason})
+		return nil, nil, false
+	case decision.Policy == access.PolicyFree:
+		return nil, nil, true
+	}
 
-func (h *Handlers) CreateMerchant(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "Create merchant - not implemented"})
-}
+	// A bearer token identifies the user and, for this content, proves the
+	// payment. Without one the X-User-ID header or the client IP is only
+	// trusted when auth.require_access_token is turned off.
+	userID, grant, ok := h.tokenAccess(c, content)
+	if !ok {
+		return nil, nil, false
+	}
+	if grant != nil {
+		h.recordAccess(c, grant)
+		return grant, nil, true
+	}
+	identified := userID != "" || !h.config.Auth.RequireAccessToken
+	if userID == "" && identified {
+		userID = c.GetHeader("X-User-ID")
+	}
+	if userID == "" {
+		userID = c.ClientIP()
+	}
+
+	// A signed receipt saves the lookup by user identifier
+	if grant := h.receiptGrant(c, content, userID); grant != nil {
+		h.recordAccess(c, grant)
+		return grant, nil, true
+	}
 
-func (h *Handlers) UpdateMerchant(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "Update merchant - not implemented"})
+	// Unidentified users can only get a free trial, which is tied to their IP
+	if identified {
+		grant, err = h.contentService.CheckAccess(content.ContentID, userID)
+	}
+	if (err != nil || grant == nil) && rules.FreeTrial() > 0 {
+		grant, err = h.contentService.GrantFreeTrial(c.Request.Context(), content, userID, c.ClientIP(), c.Request.UserAgent(), rules.FreeTrial())
+		if err != nil && !errors.Is(err, services.ErrFreeTrialUsed) && !errors.Is(err, services.ErrFreeTrialLimited) {
+			h.logger.Error("Failed to grant free trial", zap.Error(err))
+		}
+	}
+	if err == nil && grant != nil {
+		h.recordAccess(c, grant)
+		return grant, nil, true
+	}
+
+	// Crawlers get title/description only, never the content itself
+	if merchant.BoolSetting(crawlerPreviewSetting) && h.isCrawler(c.Request.UserAgent()) {
+		h.serveCrawlerPreview(c, content, path)
+		return nil, nil, false
+	}
+
+	if pw := h.newPaywall(merchant, content, path); pw != nil {
+		return nil, pw, true
+	}
+
+	// No access - return payment required response
+	c.JSON(http.StatusPaymentRequired, h.paymentRequired(merchant, content, path))
+	return nil, nil, false
 }
 
-func (h *Handlers) DeleteMerchant(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "Delete merchant - not implemented"})
+// paymentRequired returns the body of the 402 response for content the user
+// has not paid for
+func (h *Handlers) paymentRequired(merchant *models.Merchant, content *models.Content, path string) gin.H {
+	return gin.H{
+		"error":                "Payment required",
+		"content_path":         path,
+		"price_cents":          content.PriceCents,
+		"price_display":        h.moneyFormat(merchant).Format(content.PriceCents, content.Currency),
+		"currency":             content.Currency,
+		"currency_minor_units": money.Lookup(content.Currency).Exponent,
+	}
 }
 
-// Placeholder handlers for admin
-func (h *Handlers) GetStats(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "Get stats - not implemented"})
+// recordAccess counts a granted request towards the grant's usage, together
+// with the client it came from
+func (h *Handlers) recordAccess(c *gin.Context, grant *models.ContentAccess) {
+	h.contentService.RecordAccess(grant, c.ClientIP(), c.Request.UserAgent())
 }
 
-func (h *Handlers) GetTransactions(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "Get transactions - not implemented"})
+// GetContentInfo returns the public price and description of content. It holds
+// no access or session data, so it is safe for CDNs to cache briefly.
+func (h *Handlers) GetContentInfo(c *gin.Context) {
+	path, ok := contentPath(c, c.Param("path"), http.StatusRequestURITooLong)
+	if !ok {
+		return
+	}
+	fields, ok := parseFields(c, contentInfoFields, "content_path")
+	if !ok {
+		return
+	}
+
+	merchant, ok := h.resolveMerchant(c)
+	if !ok {
+		return
+	}
+
+	content, err := h.contentService.GetContentByPath(merchant.MerchantID, path)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Content not found"})
+		return
+	}
+
+	cachePublic(c, h.config.Cache.ContentInfoTTL)
+	h.writeFields(c, http.StatusOK, fields, h.contentInfo(merchant, content, path))
 }
 
-// ReverseProxy handles the main reverse proxy functionality
-func (h *Handlers) ReverseProxy(c *gin.Context) {
-	// This is a simplified reverse proxy implementation
-	// In a real implementation, this would forward requests to the actual backend
+// GetCatalog lists the public price and description of the active content of
+// the merchant domain a page at a time, see parsePage. Like GetContentInfo it
+// holds no access or session data, so CDNs may cache it for
+// cfg.Cache.CatalogTTL.
+func (h *Handlers) GetCatalog(c *gin.Context) {
+	limit, offset, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	fields, ok := parseFields(c, contentInfoFields, "content_path")
+	if !ok {
+		return
+	}
+
+	merchant, ok := h.resolveMerchant(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.contentService.ListContent(c.Request.Context(), merchant.MerchantID, limit, offset)
+	if err != nil {
+		h.logger.Error("Failed to list content", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list content"})
+		return
+	}
+
+	items := make([]gin.H, len(page.Content))
+	for i := range page.Content {
+		items[i] = h.contentInfo(merchant, &page.Content[i], page.Content[i].Path)
+	}
+	data, err := fields.applyList(items)
+	if err != nil {
+		h.logger.Error("Failed to select response fields", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode response"})
+		return
+	}
+
+	cachePublic(c, h.config.Cache.CatalogTTL)
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Reverse proxy - content would be served from backend",
-		"path":    c.Request.URL.Path,
-		"method":  c.Request.Method,
+		"data":   data,
+		"total":  page.Total,
+		"limit":  page.Limit,
+		"offset": page.Offset,
 	})
 }
+
+// contentInfo returns the public details of content served at path
+func (h *Handlers) contentInfo(merchant *models.Merchant, content *models.Content, path string) gin.H {
+	return gin.H{
+		"content_path":            path,
+		"title":                   content.Title,
+		"description":             content.Description,
+		"price_cents":             content.PriceCents,
+		"price_display":           h.moneyFormat(merchant).Format(content.PriceCents, content.Currency),
+		"currency":                content.Currency,
+		"currency_minor_units":    money.Lookup(content.Currency).Exponent,
+		"access_duration_seconds": content.AccessDurationSeconds,
+		"content_type":            content.ContentType,
+	}
+}
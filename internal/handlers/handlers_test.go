@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+// stubDriver answers every query with no rows and every statement with no
+// affected rows, or with err when it is set
+type stubDriver struct{ err error }
+
+func (d stubDriver) Open(string) (driver.Conn, error) { return stubConn(d), nil }
+
+type stubConn struct{ err error }
+
+func (c stubConn) Prepare(string) (driver.Stmt, error) { return stubStmt(c), nil }
+func (c stubConn) Close() error                        { return nil }
+func (c stubConn) Begin() (driver.Tx, error)           { return nil, errors.New("transactions not supported") }
+
+type stubStmt struct{ err error }
+
+func (s stubStmt) Close() error  { return nil }
+func (s stubStmt) NumInput() int { return -1 }
+func (s stubStmt) Exec([]driver.Value) (driver.Result, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return driver.RowsAffected(0), nil
+}
+func (s stubStmt) Query([]driver.Value) (driver.Rows, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string         { return nil }
+func (emptyRows) Close() error              { return nil }
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
+
+func init() {
+	sql.Register("handlers-test-empty", stubDriver{})
+	sql.Register("handlers-test-down", stubDriver{err: errors.New("connection refused")})
+}
+
+// catalogTables is a database/sql connector serving one active merchant and
+// its content rows
+type catalogTables struct {
+	merchantID uuid.UUID
+	paths      []string
+}
+
+func (t catalogTables) Connect(context.Context) (driver.Conn, error) { return catalogConn(t), nil }
+func (t catalogTables) Driver() driver.Driver                        { return nil }
+
+type catalogConn catalogTables
+
+func (c catalogConn) Prepare(query string) (driver.Stmt, error) {
+	return catalogStmt{tables: catalogTables(c), query: query}, nil
+}
+func (catalogConn) Close() error              { return nil }
+func (catalogConn) Begin() (driver.Tx, error) { return nil, errors.New("transactions not supported") }
+
+type catalogStmt struct {
+	tables catalogTables
+	query  string
+}
+
+func (catalogStmt) Close() error  { return nil }
+func (catalogStmt) NumInput() int { return -1 }
+func (catalogStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("exec not supported")
+}
+
+func (s catalogStmt) Query([]driver.Value) (driver.Rows, error) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	id := []byte(s.tables.merchantID.String())
+	switch {
+	case strings.Contains(s.query, "FROM merchants"):
+		return &valueRows{rows: [][]driver.Value{{
+			id, "Example Shop", "shop@example.com", "example.com", "NL91ABNA0417164300", nil,
+			nil, nil, "secret", nil, nil,
+			"key", nil, "active", "free", created, created, nil,
+			[]byte(`{"locale": "nl"}`), []byte("{}"),
+		}}}, nil
+	case strings.HasPrefix(s.query, "SELECT COUNT(*) FROM content"):
+		return &valueRows{rows: [][]driver.Value{{int64(len(s.tables.paths))}}}, nil
+	case strings.Contains(s.query, "FROM content"):
+		rows := &valueRows{}
+		for _, path := range s.tables.paths {
+			rows.rows = append(rows.rows, []driver.Value{
+				[]byte(uuid.New().String()), id, path, "Title of " + path, nil,
+				int64(250), "EUR", int64(86400), "article", []byte("{}"), true,
+				created, created,
+			})
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("unexpected query %q", s.query)
+}
+
+// valueRows serves rows of values
+type valueRows struct {
+	rows [][]driver.Value
+}
+
+func (r *valueRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+func (*valueRows) Close() error { return nil }
+func (r *valueRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestGetCatalog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name             string
+		ttl              time.Duration
+		query            string
+		wantCacheControl string
+		wantFields       int
+	}{
+		{"cached", 5 * time.Minute, "", "public, max-age=300", 9},
+		{"fields", 5 * time.Minute, "?fields=price_display", "public, max-age=300", 2},
+		{"caching off", 0, "", "no-store", 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := sql.OpenDB(catalogTables{merchantID: uuid.New(), paths: []string{"/news/a", "/premium/*"}})
+			defer db.Close()
+			cfg := &config.Config{Cache: config.CacheConfig{CatalogTTL: tt.ttl}}
+			h := &Handlers{
+				merchantService: services.NewMerchantService(db, cfg, nil, zap.NewNop()),
+				contentService:  services.NewContentService(db, cfg, nil, zap.NewNop()),
+				config:          cfg,
+				logger:          zap.NewNop(),
+			}
+			router := gin.New()
+			router.GET("/api/v1/catalog", h.GetCatalog)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/catalog"+tt.query, nil)
+			req.Host = "example.com"
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			if got := w.Header().Get("Cache-Control"); got != tt.wantCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantCacheControl)
+			}
+			var body struct {
+				Data  []map[string]interface{} `json:"data"`
+				Total int                      `json:"total"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q is not JSON: %v", w.Body.String(), err)
+			}
+			if body.Total != 2 || len(body.Data) != 2 {
+				t.Fatalf("total %d with %d items, want 2 of each", body.Total, len(body.Data))
+			}
+			first := body.Data[0]
+			if first["content_path"] != "/news/a" || first["price_display"] != "€\u00a02,50" || len(first) != tt.wantFields {
+				t.Errorf("first item = %v, want %d fields of /news/a priced in the merchant locale", first, tt.wantFields)
+			}
+		})
+	}
+}
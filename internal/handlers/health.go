@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/lifecycle"
+	"go.uber.org/zap"
+)
+
+// healthCheckTimeout bounds each dependency check, so a hanging dependency
+// fails the check well before a load balancer's own health check times out
+const healthCheckTimeout = 2 * time.Second
+
+// HealthCheck is a dependency GET /health reports on. Ping returns nil while
+// the dependency is reachable.
+type HealthCheck struct {
+	Name string
+	Ping func(ctx context.Context) error
+}
+
+// Health reports whether the server can serve requests. All checks run in
+// parallel; when any fails the response is a 503, so load balancers take the
+// instance out of rotation. Only "up" or "down" is shown per check, the errors
+// themselves are logged.
+func (h *Handlers) Health(checks ...HealthCheck) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		states, healthy := h.runHealthChecks(c.Request.Context(), checks)
+
+		status, code := "healthy", http.StatusOK
+		if !healthy {
+			status, code = "unhealthy", http.StatusServiceUnavailable
+		}
+		c.JSON(code, gin.H{
+			"status":    status,
+			"timestamp": time.Now().UTC(),
+			"checks":    states,
+		})
+	}
+}
+
+// Live is the liveness probe: it answers as long as the process serves HTTP
+// and never looks at dependencies, so an outage elsewhere does not get the
+// process restarted
+func (h *Handlers) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "alive",
+		"timestamp": time.Now().UTC(),
+	})
+}
+
+// Ready is the readiness probe. The server is ready once the background
+// workers have started and every check passes, and not ready any more once
+// shutdown begins, so traffic drains away before the server stops. Not ready
+// is a 503 with the reason in "status".
+func (h *Handlers) Ready(readiness *lifecycle.Readiness, checks ...HealthCheck) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if readiness.IsDraining() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status":    "shutting_down",
+				"timestamp": time.Now().UTC(),
+			})
+			return
+		}
+
+		states, healthy := h.runHealthChecks(c.Request.Context(), checks)
+		states["workers"] = "started"
+		if !readiness.IsStarted() {
+			states["workers"] = "starting"
+			healthy = false
+		}
+
+		status, code := "ready", http.StatusOK
+		if !healthy {
+			status, code = "not_ready", http.StatusServiceUnavailable
+		}
+		c.JSON(code, gin.H{
+			"status":    status,
+			"timestamp": time.Now().UTC(),
+			"checks":    states,
+		})
+	}
+}
+
+// runHealthChecks runs checks in parallel and returns "up" or "down" per check
+// and whether all are up
+func (h *Handlers) runHealthChecks(ctx context.Context, checks []HealthCheck) (map[string]string, bool) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	states := make(map[string]string, len(checks)+1)
+	healthy := true
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+			err := check.Ping(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				h.logger.Warn("Health check failed", zap.String("check", check.Name), zap.Error(err))
+				states[check.Name] = "down"
+				healthy = false
+				return
+			}
+			states[check.Name] = "up"
+		}(check)
+	}
+	wg.Wait()
+	return states, healthy
+}
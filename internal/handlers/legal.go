@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/access"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// legallyRestricted writes a 451 response when the merchant or the content's
+// rules block the client's country, read from the access.country_header request
+// header. Requests from an unknown country are not restricted.
+func (h *Handlers) legallyRestricted(c *gin.Context, merchant *models.Merchant, rules *access.Rules) bool {
+	country := strings.ToUpper(strings.TrimSpace(c.GetHeader(h.config.Access.CountryHeader)))
+	if country == "" {
+		return false
+	}
+	if !merchant.LegallyBlocks(country) && !rules.LegallyBlocked(country) {
+		return false
+	}
+
+	c.JSON(http.StatusUnavailableForLegalReasons, gin.H{
+		"error":   "This content is not available in your country for legal reasons",
+		"reason":  access.ReasonLegallyRestricted,
+		"country": country,
+	})
+	return true
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/middleware"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/validation"
+	"go.uber.org/zap"
+)
+
+// Error codes returned for merchant domain and registration problems
+const (
+	errCodeDomainRequired = "domain_required"
+	errCodeUnknownDomain  = "unknown_domain"
+	errCodeDomainTaken    = "domain_taken"
+	errCodeEmailTaken     = "email_taken"
+)
+
+// domainTaken writes the 409 returned when a domain belongs to another merchant
+func domainTaken(c *gin.Context, domain string) {
+	c.JSON(http.StatusConflict, gin.H{
+		"error":  "Domain already registered to another merchant",
+		"code":   errCodeDomainTaken,
+		"domain": validation.NormalizeDomain(domain),
+	})
+}
+
+// resolveMerchant looks up the merchant a request is for. When that fails it
+// writes a response with a machine-readable code and returns false: 400
+// domain_required when no domain was sent, 404 unknown_domain otherwise. A bare
+// IP address only resolves when a merchant is registered with that exact IP.
+func (h *Handlers) resolveMerchant(c *gin.Context) (*models.Merchant, bool) {
+	domain := middleware.MerchantDomain(c)
+	if domain == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Merchant domain required",
+			"code":  errCodeDomainRequired,
+			"hint":  "Send the merchant site's host name in the Host or X-Merchant-Domain header",
+		})
+		return nil, false
+	}
+
+	merchant, err := h.merchantService.GetMerchantByDomain(domain)
+	if err == nil {
+		return merchant, true
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		h.logger.Error("Failed to get merchant", zap.Error(err), zap.String("domain", domain))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get merchant"})
+		return nil, false
+	}
+
+	hint := "No active merchant is registered for this domain"
+	if net.ParseIP(domain) != nil {
+		hint = "Requests addressed to an IP address need an X-Merchant-Domain header unless a merchant is registered for that IP"
+	}
+	c.JSON(http.StatusNotFound, gin.H{
+		"error":  "Unknown merchant domain",
+		"code":   errCodeUnknownDomain,
+		"domain": domain,
+		"hint":   hint,
+	})
+	return nil, false
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+func TestResolveMerchant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		driver     string
+		host       string
+		header     string
+		wantStatus int
+		wantCode   string
+		wantDomain string
+	}{
+		{"no domain", "handlers-test-empty", "", "", http.StatusBadRequest, errCodeDomainRequired, ""},
+		{"unknown host", "handlers-test-empty", "Shop.Example.com:8080", "", http.StatusNotFound, errCodeUnknownDomain, "shop.example.com"},
+		{"unknown header domain", "handlers-test-empty", "10.0.0.1", " Shop.Example.com. ", http.StatusNotFound, errCodeUnknownDomain, "shop.example.com"},
+		{"unknown IP address", "handlers-test-empty", "10.0.0.1:8080", "", http.StatusNotFound, errCodeUnknownDomain, "10.0.0.1"},
+		{"unknown IPv6 address", "handlers-test-empty", "[::1]:8080", "", http.StatusNotFound, errCodeUnknownDomain, "::1"},
+		{"database down", "handlers-test-down", "shop.example.com", "", http.StatusInternalServerError, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := sql.Open(tt.driver, "")
+			if err != nil {
+				t.Fatalf("sql.Open() error = %v", err)
+			}
+			defer db.Close()
+			h := &Handlers{
+				merchantService: services.NewMerchantService(db, &config.Config{}, nil, zap.NewNop()),
+				logger:          zap.NewNop(),
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/payments/quote", nil)
+			c.Request.Host = tt.host
+			if tt.header != "" {
+				c.Request.Header.Set("X-Merchant-Domain", tt.header)
+			}
+
+			if merchant, ok := h.resolveMerchant(c); ok || merchant != nil {
+				t.Fatalf("resolveMerchant() = %v, %v, want no merchant", merchant, ok)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var body struct {
+				Code   string `json:"code"`
+				Domain string `json:"domain"`
+				Hint   string `json:"hint"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("response %q is not JSON: %v", w.Body.String(), err)
+			}
+			if body.Code != tt.wantCode || body.Domain != tt.wantDomain {
+				t.Errorf("code, domain = %q, %q, want %q, %q", body.Code, body.Domain, tt.wantCode, tt.wantDomain)
+			}
+			if tt.wantCode != "" && body.Hint == "" {
+				t.Errorf("response has no hint")
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+// ListWebhooks returns the additional webhook endpoints of a merchant. The
+// merchant's own webhook_url is not part of the list.
+func (h *Handlers) ListWebhooks(c *gin.Context) {
+	merchantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+		return
+	}
+
+	hooks, err := h.merchantService.ListWebhooks(c.Request.Context(), merchantID)
+	if err != nil {
+		h.logger.Error("Failed to list webhooks", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": hooks})
+}
+
+// AddWebhook registers a webhook endpoint. The response is the only time its
+// secret is shown.
+func (h *Handlers) AddWebhook(c *gin.Context) {
+	merchantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+		return
+	}
+
+	var input services.WebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		bindError(c, err)
+		return
+	}
+
+	hook, err := h.merchantService.AddWebhook(c.Request.Context(), merchantID, input)
+	switch {
+	case errors.Is(err, services.ErrInvalidWebhook):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrTierLimitReached):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	case err != nil:
+		h.logger.Error("Failed to add webhook", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add webhook"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook": hook,
+		"secret":  hook.Secret,
+	})
+}
+
+// RemoveWebhook deletes a webhook endpoint
+func (h *Handlers) RemoveWebhook(c *gin.Context) {
+	merchantID, webhookID, ok := parseWebhookIDs(c)
+	if !ok {
+		return
+	}
+
+	err := h.merchantService.RemoveWebhook(c.Request.Context(), merchantID, webhookID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to remove webhook", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove webhook"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RotateEndpointSecret issues a new secret for a webhook endpoint; the old one
+// keeps verifying until previous_secret_expires_at
+func (h *Handlers) RotateEndpointSecret(c *gin.Context) {
+	merchantID, webhookID, ok := parseWebhookIDs(c)
+	if !ok {
+		return
+	}
+
+	secret, previousExpiresAt, err := h.merchantService.RotateEndpointSecret(c.Request.Context(), merchantID, webhookID, h.config.Webhook.SecretOverlap)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to rotate webhook secret", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate webhook secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhook_id":                 webhookID,
+		"secret":                     secret,
+		"previous_secret_expires_at": previousExpiresAt,
+	})
+}
+
+// parseWebhookIDs reads the merchant and webhook IDs from the route
+func parseWebhookIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	merchantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	webhookID, err := uuid.Parse(c.Param("webhookId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return merchantID, webhookID, true
+}
@@ -0,0 +1,428 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/middleware"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+// parsePage reads the ?limit= and ?offset= query parameters of a listing. Both
+// default to 0, which lets the service pick its default page size. An invalid
+// value writes a 400 and returns false.
+func parsePage(c *gin.Context) (limit, offset int, ok bool) {
+	var err error
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return 0, 0, false
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		offset, err = strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return 0, 0, false
+		}
+	}
+	return limit, offset, true
+}
+
+// GetMerchants lists merchants a page at a time, optionally filtered by
+// ?status= and by ?inactive_since=, a UTC date, to find dormant accounts. API
+// keys are never part of the response.
+func (h *Handlers) GetMerchants(c *gin.Context) {
+	limit, offset, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	var status *models.MerchantStatus
+	if statusStr := c.Query("status"); statusStr != "" {
+		s := models.MerchantStatus(statusStr)
+		switch s {
+		case models.MerchantStatusPending, models.MerchantStatusActive, models.MerchantStatusSuspended, models.MerchantStatusDeactivated:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+			return
+		}
+		status = &s
+	}
+	var inactiveSince *time.Time
+	if sinceStr := c.Query("inactive_since"); sinceStr != "" {
+		since, err := time.Parse(time.DateOnly, sinceStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid inactive_since date, expected YYYY-MM-DD"})
+			return
+		}
+		inactiveSince = &since
+	}
+
+	page, err := h.merchantService.ListMerchants(c.Request.Context(), limit, offset, status, inactiveSince)
+	if err != nil {
+		h.logger.Error("Failed to list merchants", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list merchants"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":   page.Merchants,
+		"total":  page.Total,
+		"limit":  page.Limit,
+		"offset": page.Offset,
+	})
+}
+
+// GetMerchant returns a merchant by ID, optionally restricted with ?fields=
+func (h *Handlers) GetMerchant(c *gin.Context) {
+	merchantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+		return
+	}
+	fields, ok := parseFields(c, merchantFields, "merchant_id")
+	if !ok {
+		return
+	}
+
+	merchant, err := h.merchantService.GetMerchant(c.Request.Context(), merchantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get merchant", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get merchant"})
+		return
+	}
+
+	h.writeFields(c, http.StatusOK, fields, merchant)
+}
+
+// RotateWebhookSecret issues a new webhook secret for a merchant. The response
+// is the only time the new secret is shown; the old one keeps verifying until
+// previous_secret_expires_at.
+func (h *Handlers) RotateWebhookSecret(c *gin.Context) {
+	merchantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+		return
+	}
+
+	secret, previousExpiresAt, err := h.merchantService.RotateWebhookSecret(merchantID, h.config.Webhook.SecretOverlap)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to rotate webhook secret", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate webhook secret"})
+		return
+	}
+	h.audit(c, services.AuditWebhookSecretRotate, services.AuditTargetMerchant, merchantID.String(), nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"merchant_id":                merchantID,
+		"webhook_secret":             secret,
+		"previous_secret_expires_at": previousExpiresAt,
+	})
+}
+
+// RotateAPIKey issues a new API key for a merchant. The response is the only
+// time the new key is shown. The old key keeps working until
+// previous_key_expires_at (auth.api_key_overlap), unless the body asks to
+// {"revoke_previous": true}, e.g. because it leaked.
+func (h *Handlers) RotateAPIKey(c *gin.Context) {
+	merchantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+		return
+	}
+
+	var req struct {
+		RevokePrevious bool `json:"revoke_previous"`
+	}
+	// The body is optional
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		bindError(c, err)
+		return
+	}
+	overlap := h.config.Auth.APIKeyOverlap
+	if req.RevokePrevious {
+		overlap = 0
+	}
+
+	apiKey, previousExpiresAt, err := h.merchantService.RotateAPIKey(c.Request.Context(), merchantID, overlap)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to rotate API key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate API key"})
+		return
+	}
+	h.audit(c, services.AuditAPIKeyRotate, services.AuditTargetMerchant, merchantID.String(), map[string]interface{}{
+		"revoke_previous": req.RevokePrevious,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"merchant_id":             merchantID,
+		"api_key":                 apiKey,
+		"previous_key_expires_at": previousExpiresAt,
+	})
+}
+
+// ImportMerchants creates merchants in bulk from a JSON body ({"merchants": [...]})
+// or a CSV upload with a header row. With dry_run=true rows are only validated.
+func (h *Handlers) ImportMerchants(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	var rows []services.MerchantImportRow
+	if strings.HasPrefix(c.ContentType(), "text/csv") {
+		var err error
+		rows, err = parseMerchantCSV(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		var req struct {
+			Merchants []services.MerchantImportRow `json:"merchants" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindError(c, err)
+			return
+		}
+		rows = req.Merchants
+	}
+
+	report, err := h.merchantService.ImportMerchants(c.Request.Context(), rows, h.config.Admin.MaxImportRows, dryRun)
+	if errors.Is(err, services.ErrImportTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "Merchant import too large",
+			"max_rows": h.config.Admin.MaxImportRows,
+		})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to import merchants", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import merchants"})
+		return
+	}
+
+	status := http.StatusOK
+	if report.Invalid > 0 {
+		status = http.StatusUnprocessableEntity
+	} else if report.Created > 0 {
+		status = http.StatusCreated
+	}
+	c.JSON(status, report)
+}
+
+// parseMerchantCSV reads import rows from CSV. The header row names the columns
+// (name, email, domain, iban, bic, webhook_url, pricing_tier, status) in any order.
+func parseMerchantCSV(r io.Reader) ([]services.MerchantImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"name", "email", "domain", "iban"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV is missing the %q column", required)
+		}
+	}
+
+	var rows []services.MerchantImportRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+
+		row := services.MerchantImportRow{
+			Name:        field("name"),
+			Email:       field("email"),
+			Domain:      field("domain"),
+			IBAN:        field("iban"),
+			PricingTier: field("pricing_tier"),
+			Status:      field("status"),
+		}
+		if bic := field("bic"); bic != "" {
+			row.BIC = &bic
+		}
+		if webhookURL := field("webhook_url"); webhookURL != "" {
+			row.WebhookURL = &webhookURL
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// CreateMerchantRequest is the body of a merchant registration
+type CreateMerchantRequest struct {
+	Name            string         `json:"name" binding:"required"`
+	Email           string         `json:"email" binding:"required"`
+	Domain          string         `json:"domain" binding:"required"`
+	BankAccountIBAN string         `json:"bank_account_iban" binding:"required"`
+	BIC             *string        `json:"bic"`
+	WebhookURL      *string        `json:"webhook_url"`
+	PricingTier     string         `json:"pricing_tier"`
+	Settings        models.JSONMap `json:"settings"`
+	Metadata        models.JSONMap `json:"metadata"`
+}
+
+// CreateMerchant registers a single merchant. The response holds the API key,
+// which is not shown again.
+func (h *Handlers) CreateMerchant(c *gin.Context) {
+	var req CreateMerchantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		bindError(c, err)
+		return
+	}
+
+	merchant, err := h.merchantService.CreateMerchant(c.Request.Context(), services.MerchantImportRow{
+		Name:        req.Name,
+		Email:       req.Email,
+		Domain:      req.Domain,
+		IBAN:        req.BankAccountIBAN,
+		BIC:         req.BIC,
+		WebhookURL:  req.WebhookURL,
+		PricingTier: req.PricingTier,
+		Settings:    req.Settings,
+		Metadata:    req.Metadata,
+	})
+	switch {
+	case errors.Is(err, services.ErrInvalidIBAN):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrInvalidMerchant):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrDomainTaken):
+		domainTaken(c, req.Domain)
+		return
+	case errors.Is(err, services.ErrEmailTaken):
+		emailTaken(c)
+		return
+	case err != nil:
+		h.logger.Error("Failed to create merchant", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create merchant"})
+		return
+	}
+	h.audit(c, services.AuditMerchantCreate, services.AuditTargetMerchant, merchant.MerchantID.String(), map[string]interface{}{
+		"domain": merchant.Domain,
+	})
+
+	c.JSON(http.StatusCreated, struct {
+		*models.Merchant
+		APIKey string `json:"api_key"`
+	}{merchant, merchant.APIKey})
+}
+
+// emailTaken writes the 409 response for an email used by another merchant
+func emailTaken(c *gin.Context) {
+	c.JSON(http.StatusConflict, gin.H{
+		"error": "Email already registered to another merchant",
+		"code":  errCodeEmailTaken,
+	})
+}
+
+// UpdateMerchant changes merchant fields; omitted fields are kept. Setting the
+// status to suspended takes effect on all instances right away.
+func (h *Handlers) UpdateMerchant(c *gin.Context) {
+	merchantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+		return
+	}
+
+	var update services.MerchantUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		bindError(c, err)
+		return
+	}
+	// Merchants manage their own details, but only admins change their standing
+	if !middleware.IsAdmin(c) && (update.Status != nil || update.PricingTier != nil) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change status or pricing tier"})
+		return
+	}
+
+	merchant, err := h.merchantService.UpdateMerchant(c.Request.Context(), merchantID, update)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	}
+	if errors.Is(err, services.ErrDomainTaken) {
+		domainTaken(c, *update.Domain)
+		return
+	}
+	if errors.Is(err, services.ErrEmailTaken) {
+		emailTaken(c)
+		return
+	}
+	if errors.Is(err, services.ErrInvalidIBAN) || errors.Is(err, services.ErrInvalidMerchant) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to update merchant", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update merchant"})
+		return
+	}
+	h.audit(c, services.AuditMerchantUpdate, services.AuditTargetMerchant, merchantID.String(), update.AuditMetadata())
+
+	c.JSON(http.StatusOK, merchant)
+}
+
+// DeleteMerchant soft deletes a merchant; see MerchantService.DeactivateMerchant
+func (h *Handlers) DeleteMerchant(c *gin.Context) {
+	merchantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+		return
+	}
+
+	err = h.merchantService.DeactivateMerchant(c.Request.Context(), merchantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to deactivate merchant", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate merchant"})
+		return
+	}
+	h.audit(c, services.AuditMerchantDeactivate, services.AuditTargetMerchant, merchantID.String(), nil)
+
+	c.Status(http.StatusNoContent)
+}
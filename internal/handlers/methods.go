@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/money"
+)
+
+// GetPaymentMethods lists the payment methods the checkout page should offer for
+// the content at the content_path query parameter
+func (h *Handlers) GetPaymentMethods(c *gin.Context) {
+	if c.Query("content_path") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "content_path is required"})
+		return
+	}
+	path, ok := contentPath(c, c.Query("content_path"), http.StatusBadRequest)
+	if !ok {
+		return
+	}
+
+	merchant, ok := h.resolveMerchant(c)
+	if !ok {
+		return
+	}
+
+	content, err := h.contentService.GetContentByPath(merchant.MerchantID, path)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Content not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"content_path":         path,
+		"price_cents":          content.PriceCents,
+		"price_display":        h.moneyFormat(merchant).Format(content.PriceCents, content.Currency),
+		"currency":             content.Currency,
+		"currency_minor_units": money.Lookup(content.Currency).Exponent,
+		"methods":              h.paymentMethods.Available(merchant, content),
+	})
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"mime"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/money"
+)
+
+// moneyFormat returns the display format for a merchant, driven by the "locale"
+// and "currency_display" ("symbol" or "code") merchant settings. The separators
+// and symbol placement of the locale can be overridden per merchant, see
+// money.Format.WithSettings. Only the rendered string varies; amounts stay
+// integer minor units everywhere else.
+func (h *Handlers) moneyFormat(merchant *models.Merchant) money.Format {
+	locale, _ := merchant.Settings["locale"].(string)
+	format, _ := money.ForLocale(locale).WithSettings(merchant.Settings)
+	if display, _ := merchant.Settings["currency_display"].(string); display == "code" {
+		format.UseCode = true
+	}
+	return format
+}
+
+// decimalAmountsProfile is the Accept profile that asks for decimal amount strings
+const decimalAmountsProfile = "decimal-amounts"
+
+// wantsDecimalAmounts reports whether amount responses should include a decimal
+// string next to the integer minor units, either because it is enabled globally
+// or because the client sent "Accept: application/json; profile=decimal-amounts"
+func (h *Handlers) wantsDecimalAmounts(c *gin.Context) bool {
+	if h.config.Payment.DecimalAmounts {
+		return true
+	}
+	for _, accept := range strings.Split(c.GetHeader("Accept"), ",") {
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && params["profile"] == decimalAmountsProfile {
+			return true
+		}
+	}
+	return false
+}
+
+// addDecimalAmount sets field to the amount as a plain decimal string such as
+// "12.50" when the client asked for it. The string is display-only; the
+// integer minor-unit field next to it stays authoritative.
+func (h *Handlers) addDecimalAmount(c *gin.Context, resp gin.H, field string, amountMinor int, currency string) {
+	if h.wantsDecimalAmounts(c) {
+		resp[field] = money.Decimal(amountMinor, currency)
+	}
+}
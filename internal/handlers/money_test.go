@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/events"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/money"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+func TestMoneyFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings models.JSONMap
+		want     string
+	}{
+		{"default locale", nil, "€1,234.50"},
+		{"locale", models.JSONMap{"locale": "nl"}, "€\u00a01.234,50"},
+		{"currency code", models.JSONMap{"locale": "de", "currency_display": "code"}, "1.234,50\u00a0EUR"},
+		{"separators", models.JSONMap{"locale": "en", money.DecimalSeparatorSetting: ",", money.ThousandsSeparatorSetting: " "}, "€1 234,50"},
+		{"symbol placement", models.JSONMap{"locale": "de", money.SymbolPositionSetting: "before", money.SymbolSpaceSetting: false}, "€1.234,50"},
+		{"invalid override is ignored", models.JSONMap{"locale": "nl", money.SymbolPositionSetting: "left"}, "€\u00a01.234,50"},
+	}
+	h := &Handlers{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merchant := &models.Merchant{Settings: tt.settings}
+			if got := h.moneyFormat(merchant).Format(123450, "EUR"); got != tt.want {
+				t.Errorf("moneyFormat().Format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecimalAmounts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const profile = "application/json; profile=decimal-amounts"
+	tests := []struct {
+		name        string
+		global      bool
+		accept      string
+		amountCents int64
+		currency    string
+		wantAmount  string
+	}{
+		{"minor units only by default", false, "application/json", 1250, "EUR", ""},
+		{"profile", false, profile, 1250, "EUR", "12.50"},
+		{"profile among other types", false, "text/html, " + profile + ";q=0.9", 1250, "EUR", "12.50"},
+		{"other profile", false, "application/json; profile=compact", 1250, "EUR", ""},
+		{"global switch", true, "", 1250, "EUR", "12.50"},
+		{"zero-decimal currency", false, profile, 1250, "JPY", "1250"},
+		{"three-decimal currency", true, "", 1250, "KWD", "1.250"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := &sessionTable{id: uuid.New(), amountCents: tt.amountCents, currency: tt.currency, status: models.PaymentStatusPending}
+			db := sql.OpenDB(table)
+			defer db.Close()
+			cfg := &config.Config{Payment: config.PaymentConfig{DecimalAmounts: tt.global}}
+			h := &Handlers{
+				paymentService: services.NewPaymentService(db, cfg, events.NewBus(zap.NewNop()), zap.NewNop()),
+				config:         cfg,
+				logger:         zap.NewNop(),
+			}
+			router := gin.New()
+			router.GET("/api/v1/payments/:sessionId/status", h.GetPaymentStatus)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/payments/"+table.id.String()+"/status", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q is not JSON: %v", w.Body.String(), err)
+			}
+			if got := body["amount_cents"]; got != float64(tt.amountCents) {
+				t.Errorf("amount_cents = %v, want %d", got, tt.amountCents)
+			}
+			amount, ok := body["amount"]
+			if tt.wantAmount == "" {
+				if ok {
+					t.Errorf("amount = %v, want it left out", amount)
+				}
+				return
+			}
+			if amount != tt.wantAmount {
+				t.Errorf("amount = %#v, want %q", amount, tt.wantAmount)
+			}
+		})
+	}
+}
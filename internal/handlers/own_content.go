@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/middleware"
+)
+
+// ownMerchantID returns the merchant of the API key. /api/v1/content manages
+// the caller's own content, so the admin key, which belongs to no merchant,
+// gets a 403.
+func ownMerchantID(c *gin.Context) (uuid.UUID, bool) {
+	merchant := middleware.CurrentMerchant(c)
+	if merchant == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Content routes require a merchant API key"})
+		return uuid.Nil, false
+	}
+	return merchant.MerchantID, true
+}
+
+// ListOwnContent lists the content of the authenticated merchant
+func (h *Handlers) ListOwnContent(c *gin.Context) {
+	if merchantID, ok := ownMerchantID(c); ok {
+		h.listContent(c, merchantID)
+	}
+}
+
+// CreateOwnContent registers content for the authenticated merchant, see
+// CreateContent
+func (h *Handlers) CreateOwnContent(c *gin.Context) {
+	if merchantID, ok := ownMerchantID(c); ok {
+		h.createContent(c, merchantID)
+	}
+}
+
+// ContentRoute handles /api/v1/content/*path. gin cannot register
+// /api/v1/content/:id next to that catch-all, so PUT and DELETE of a content ID
+// made with an API key update and delete the caller's content here, after auth
+// has authenticated the key, and DELETE of <id>/access/<userId> revokes the
+// access of that user. Every other request is served as content.
+func (h *Handlers) ContentRoute(auth gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		if method != http.MethodPut && method != http.MethodDelete || !middleware.HasAPIKey(c) {
+			h.ServeContent(c)
+			return
+		}
+		id, userID, revoke := strings.Cut(strings.TrimPrefix(c.Param("path"), "/"), "/access/")
+		contentID, err := uuid.Parse(id)
+		if err != nil || revoke && (method != http.MethodDelete || userID == "") {
+			h.ServeContent(c)
+			return
+		}
+
+		if auth(c); c.IsAborted() {
+			return
+		}
+		merchantID, ok := ownMerchantID(c)
+		if !ok {
+			return
+		}
+		switch {
+		case revoke:
+			h.revokeAccess(c, merchantID, contentID, userID)
+		case method == http.MethodPut:
+			h.updateContent(c, merchantID, contentID)
+		default:
+			h.deleteContent(c, merchantID, contentID)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/middleware"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+func TestContentRouteRevokesAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := sql.Open("handlers-test-empty", "")
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	defer db.Close()
+	cfg := &config.Config{}
+	h := &Handlers{
+		merchantService: services.NewMerchantService(db, cfg, nil, zap.NewNop()),
+		contentService:  services.NewContentService(db, cfg, nil, zap.NewNop()),
+		config:          cfg,
+		logger:          zap.NewNop(),
+	}
+	contentID := uuid.New().String()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		apiKey     bool
+		admin      bool
+		wantAuth   bool
+		wantStatus int
+		wantError  string
+	}{
+		{"revoke", http.MethodDelete, contentID + "/access/user-1", true, false, true, http.StatusNotFound, "No active access found"},
+		{"revoke with the admin key", http.MethodDelete, contentID + "/access/user-1", true, true, true, http.StatusForbidden, "require a merchant API key"},
+		{"revoke without an API key is served", http.MethodDelete, contentID + "/access/user-1", false, false, false, http.StatusNotFound, "Unknown merchant domain"},
+		{"other methods are served", http.MethodPut, contentID + "/access/user-1", true, false, false, http.StatusNotFound, "Unknown merchant domain"},
+		{"no user is served", http.MethodDelete, contentID + "/access/", true, false, false, http.StatusNotFound, "Unknown merchant domain"},
+		{"not a content ID is served", http.MethodDelete, "articles/access/user-1", true, false, false, http.StatusNotFound, "Unknown merchant domain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authCalled := false
+			auth := func(c *gin.Context) {
+				authCalled = true
+				if !tt.admin {
+					c.Set(middleware.MerchantKey, &models.Merchant{MerchantID: uuid.New()})
+				}
+			}
+			router := gin.New()
+			router.Any("/api/v1/content/*path", h.ContentRoute(auth))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, "/api/v1/content/"+tt.path, nil)
+			if tt.apiKey {
+				req.Header.Set("X-API-Key", "merchant-key")
+			}
+			router.ServeHTTP(w, req)
+
+			if authCalled != tt.wantAuth {
+				t.Errorf("auth called = %v, want %v", authCalled, tt.wantAuth)
+			}
+			if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantError) {
+				t.Errorf("response = %d %s, want %d with %q", w.Code, w.Body.String(), tt.wantStatus, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+// StreamPaymentStatus streams the status of a payment session as server-sent
+// events, so a checkout page learns about the payment without polling. A
+// "status" event is sent right away and on every change; the stream ends once
+// the session leaves pending. Changes made here arrive through the session
+// watch at once; others, like expiry, on the next cfg.Stream.PollInterval.
+//
+// Events must reach the client as soon as they are written: the response is
+// flushed after every event, marked no-transform so intermediaries do not
+// compress it, and X-Accel-Buffering disables nginx buffering. During quiet
+// periods a comment is sent every cfg.Stream.KeepAliveInterval so idle
+// timeouts of proxies in between do not cut the stream.
+func (h *Handlers) StreamPaymentStatus(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	session, err := h.paymentService.GetPaymentSession(sessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment session not found"})
+		return
+	}
+
+	// The server's write timeout is meant for regular responses, not streams
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		h.logger.Warn("Failed to clear write deadline for payment stream", zap.Error(err))
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-store, no-transform")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+	c.Status(http.StatusOK)
+
+	if !h.writeStatusEvent(c, session) {
+		return
+	}
+
+	changed, stop := h.sessionWatch.Watch(sessionID)
+	defer stop()
+	poll := time.NewTicker(h.config.Stream.PollInterval)
+	defer poll.Stop()
+	keepAlive := time.NewTimer(h.config.Stream.KeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for session.Status == models.PaymentStatusPending {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(c.Writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+			keepAlive.Reset(h.config.Stream.KeepAliveInterval)
+			continue
+		case <-changed:
+		case <-poll.C:
+		}
+
+		current, err := h.paymentService.GetPaymentSession(sessionID)
+		if err != nil {
+			h.logger.Error("Failed to get payment session", zap.Error(err))
+			continue
+		}
+		if current.Status == session.Status {
+			continue
+		}
+		session = current
+		if !h.writeStatusEvent(c, session) {
+			return
+		}
+		keepAlive.Reset(h.config.Stream.KeepAliveInterval)
+	}
+}
+
+// writeStatusEvent sends the session status as a "status" event and flushes it.
+// It returns false when the client is gone.
+func (h *Handlers) writeStatusEvent(c *gin.Context, session *models.PaymentSession) bool {
+	data := gin.H{
+		"session_id":        session.SessionID,
+		"status":            session.Status,
+		"paid_at":           session.PaidAt,
+		"access_expires_at": session.AccessExpiresAt,
+	}
+	if session.Status == models.PaymentStatusFailed {
+		data["failure_reason"] = session.Metadata["failure_reason"]
+	}
+	if token := h.accessReceipt(session); token != "" {
+		data["access_receipt"] = token
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		h.logger.Error("Failed to encode payment status event", zap.Error(err))
+		return false
+	}
+
+	if _, err := fmt.Fprintf(c.Writer, "event: status\ndata: %s\n\n", payload); err != nil {
+		return false
+	}
+	c.Writer.Flush()
+	return true
+}
+
+// parseStatusWait reads the ?wait= duration of a status request, capped at
+// cfg.Stream.MaxWait. It writes a 400 and returns false for a malformed value.
+func (h *Handlers) parseStatusWait(c *gin.Context) (time.Duration, bool) {
+	raw := c.Query("wait")
+	if raw == "" {
+		return 0, true
+	}
+	wait, err := time.ParseDuration(raw)
+	if err != nil || wait < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid wait, use a duration such as 30s"})
+		return 0, false
+	}
+	if wait > h.config.Stream.MaxWait {
+		wait = h.config.Stream.MaxWait
+	}
+	return wait, true
+}
+
+// waitForStatusChange rereads a pending session on every change published by
+// this instance and every cfg.Stream.PollInterval until its status changes, wait passes or the client goes away, and returns
+// the latest session it saw. The server's write timeout is pushed back so it
+// does not cut off the response of a long wait.
+func (h *Handlers) waitForStatusChange(c *gin.Context, session *models.PaymentSession, wait time.Duration) *models.PaymentSession {
+	deadline := time.Now().Add(wait + h.config.Server.WriteTimeout)
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(deadline); err != nil {
+		h.logger.Warn("Failed to extend write deadline for status wait", zap.Error(err))
+	}
+
+	changed, stop := h.sessionWatch.Watch(session.SessionID)
+	defer stop()
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	poll := time.NewTicker(h.config.Stream.PollInterval)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return session
+		case <-timeout.C:
+			return session
+		case <-changed:
+		case <-poll.C:
+		}
+
+		current, err := h.paymentService.GetPaymentSession(session.SessionID)
+		if err != nil {
+			h.logger.Error("Failed to get payment session", zap.Error(err))
+			continue
+		}
+		if current.Status != session.Status {
+			return current
+		}
+		session = current
+	}
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/events"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+// sessionTable is a database/sql connector serving one payment session row to
+// GetPaymentSession, with a status the test can change
+type sessionTable struct {
+	id          uuid.UUID
+	amountCents int64
+	currency    string
+
+	mu     sync.Mutex
+	status models.PaymentStatus
+}
+
+func (t *sessionTable) setStatus(status models.PaymentStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status = status
+}
+
+func (t *sessionTable) Connect(context.Context) (driver.Conn, error) { return sessionTableConn{t}, nil }
+func (t *sessionTable) Driver() driver.Driver                        { return nil }
+
+type sessionTableConn struct{ table *sessionTable }
+
+func (c sessionTableConn) Prepare(string) (driver.Stmt, error) { return sessionTableStmt(c), nil }
+func (sessionTableConn) Close() error                          { return nil }
+func (sessionTableConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+type sessionTableStmt struct{ table *sessionTable }
+
+func (sessionTableStmt) Close() error  { return nil }
+func (sessionTableStmt) NumInput() int { return -1 }
+func (sessionTableStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("exec not supported")
+}
+
+func (s sessionTableStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.table.mu.Lock()
+	defer s.table.mu.Unlock()
+	created := time.Date(2024, 3, 12, 9, 30, 0, 0, time.UTC)
+	id := []byte(s.table.id.String())
+	return &sessionTableRows{values: []driver.Value{
+		id, id, id, nil, s.table.amountCents,
+		int64(0), int64(0), s.table.amountCents,
+		s.table.currency, "PAY-1", "BCD", string(s.table.status), created.Add(time.Hour),
+		created, nil, nil, nil, nil, []byte("{}"),
+		nil, nil, nil, nil, nil,
+		nil,
+	}}, nil
+}
+
+type sessionTableRows struct {
+	values []driver.Value
+	done   bool
+}
+
+func (r *sessionTableRows) Columns() []string { return make([]string, len(r.values)) }
+func (*sessionTableRows) Close() error        { return nil }
+func (r *sessionTableRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.values)
+	return nil
+}
+
+// readEvent reads the next server-sent event or comment block from lines,
+// failing the test when none arrives within a second
+func readEvent(t *testing.T, lines <-chan string) []string {
+	t.Helper()
+	var block []string
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("stream ended after %q, want another event", block)
+			}
+			if line == "" {
+				return block
+			}
+			block = append(block, line)
+		case <-timeout:
+			t.Fatalf("no event within a second, got %q so far", block)
+		}
+	}
+}
+
+// statusOf returns the status in the data of a status event block
+func statusOf(t *testing.T, block []string) string {
+	t.Helper()
+	if len(block) != 2 || block[0] != "event: status" || !strings.HasPrefix(block[1], "data: ") {
+		t.Fatalf("event = %q, want a status event", block)
+	}
+	var data struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(block[1], "data: ")), &data); err != nil {
+		t.Fatalf("status event data %q: %v", block[1], err)
+	}
+	return data.Status
+}
+
+func TestStreamPaymentStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	table := &sessionTable{id: uuid.New(), amountCents: 250, currency: "EUR", status: models.PaymentStatusPending}
+	db := sql.OpenDB(table)
+	defer db.Close()
+	cfg := &config.Config{Stream: config.StreamConfig{
+		// Changes must arrive through the session watch, not the poll
+		PollInterval:      time.Hour,
+		KeepAliveInterval: 20 * time.Millisecond,
+	}}
+	bus := events.NewBus(zap.NewNop())
+	h := &Handlers{
+		paymentService: services.NewPaymentService(db, cfg, bus, zap.NewNop()),
+		sessionWatch:   events.NewSessionWatch(bus),
+		config:         cfg,
+		logger:         zap.NewNop(),
+	}
+
+	// The response stays open until release is closed, so whatever the client
+	// reads before then was flushed by the handler rather than by the end of
+	// the response
+	release := make(chan struct{})
+	router := gin.New()
+	router.GET("/api/v1/payments/:sessionId/events", func(c *gin.Context) {
+		c.Next()
+		<-release
+	}, h.StreamPaymentStatus)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	defer func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	}()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/payments/"+table.id.String()+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Set explicitly, the transport leaves a compressed body as it is
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET events error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	for header, want := range map[string]string{
+		"Content-Type":      "text/event-stream",
+		"X-Accel-Buffering": "no",
+		"Content-Encoding":  "",
+	} {
+		if got := resp.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	if got := statusOf(t, readEvent(t, lines)); got != string(models.PaymentStatusPending) {
+		t.Errorf("first status = %s, want pending", got)
+	}
+	if got := readEvent(t, lines); len(got) != 1 || !strings.HasPrefix(got[0], ":") {
+		t.Errorf("idle stream sent %q, want a keep-alive comment", got)
+	}
+
+	table.setStatus(models.PaymentStatusPaid)
+	bus.Publish(events.PaymentPaid{SessionID: table.id})
+	block := readEvent(t, lines)
+	for len(block) == 1 && strings.HasPrefix(block[0], ":") {
+		block = readEvent(t, lines)
+	}
+	if got := statusOf(t, block); got != string(models.PaymentStatusPaid) {
+		t.Errorf("status after payment = %s, want paid", got)
+	}
+
+	close(release)
+	select {
+	case line, ok := <-lines:
+		if ok {
+			t.Errorf("stream sent %q after the final status, want it to end", line)
+		}
+	case <-time.After(time.Second):
+		t.Error("stream still open after the session left pending")
+	}
+}
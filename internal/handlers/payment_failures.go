@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+// RenewPayment starts a new session for the content of a failed or expired one,
+// so the customer can try again without going back to the merchant's site
+func (h *Handlers) RenewPayment(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	session, err := h.paymentService.RenewSession(c.Request.Context(), sessionID, c.Request.UserAgent(), c.ClientIP())
+	switch {
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment session not found"})
+		return
+	case errors.Is(err, services.ErrSessionNotRenewable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Only failed or expired sessions can be renewed"})
+		return
+	case errors.Is(err, services.ErrCurrencyMismatch):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrTierLimitReached):
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		h.logger.Error("Failed to renew payment session", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to renew payment session"})
+		return
+	}
+
+	merchant, err := h.merchantService.GetMerchantByID(session.MerchantID)
+	if err != nil {
+		h.logger.Error("Failed to get merchant", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to renew payment session"})
+		return
+	}
+
+	h.writeSessionCreated(c, merchant, session)
+}
+
+// DeclinePayment fails a session on behalf of a payment provider that declined it
+func (h *Handlers) DeclinePayment(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	var req struct {
+		Detail string `json:"detail"`
+	}
+	// The body is optional
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		bindError(c, err)
+		return
+	}
+
+	err = h.paymentService.DeclineSession(c.Request.Context(), sessionID, req.Detail)
+	switch {
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment session not found"})
+		return
+	case errors.Is(err, services.ErrSessionNotFailable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment session can no longer fail"})
+		return
+	case err != nil:
+		h.logger.Error("Failed to decline payment session", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decline payment session"})
+		return
+	}
+	h.audit(c, services.AuditPaymentDecline, services.AuditTargetPaymentSession, sessionID.String(), map[string]interface{}{
+		"detail": req.Detail,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"session_id":     sessionID,
+		"status":         models.PaymentStatusFailed,
+		"failure_reason": services.FailureReasonProviderDeclined,
+	})
+}
+
+// ReturnTransaction records that the bank returned a transfer. The session it
+// was meant for fails with reason bank_return.
+func (h *Handlers) ReturnTransaction(c *gin.Context) {
+	transactionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return
+	}
+
+	var req struct {
+		Detail string `json:"detail"`
+	}
+	// The body is optional
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		bindError(c, err)
+		return
+	}
+
+	sessionID, err := h.reconciliationService.RecordBankReturn(c.Request.Context(), transactionID, req.Detail)
+	switch {
+	case errors.Is(err, services.ErrTransactionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	case errors.Is(err, services.ErrReturnAfterGrant):
+		c.JSON(http.StatusConflict, gin.H{"error": "Transaction already granted access; open a dispute instead"})
+		return
+	case err != nil:
+		h.logger.Error("Failed to record bank return", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record bank return"})
+		return
+	}
+	h.audit(c, services.AuditTransactionReturn, services.AuditTargetBankTransaction, transactionID.String(), map[string]interface{}{
+		"detail":            req.Detail,
+		"failed_session_id": sessionID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"transaction_id":    transactionID,
+		"failed_session_id": sessionID,
+	})
+}
+
+// FailPartialPayments fails expired sessions that only received part of their amount
+func (h *Handlers) FailPartialPayments(c *gin.Context) {
+	failed, err := h.reconciliationService.FailPartialPayments(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to fail partially paid sessions", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fail partially paid sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"failed_sessions": failed})
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/middleware"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+// ListPayments lists payment sessions newest first a page at a time, see
+// parsePage. They can be filtered by ?status=, ?content_id=, ?user_identifier=
+// and a ?from=/?to= range of inclusive UTC dates on creation. Merchants only
+// see their own sessions; admins see all of them or pick one ?merchant_id=.
+func (h *Handlers) ListPayments(c *gin.Context) {
+	limit, offset, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	filter, ok := sessionFilter(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.paymentService.ListSessions(c.Request.Context(), filter, limit, offset)
+	if err != nil {
+		h.logger.Error("Failed to list payment sessions", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list payment sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":   page.Sessions,
+		"total":  page.Total,
+		"limit":  page.Limit,
+		"offset": page.Offset,
+	})
+}
+
+// sessionFilter reads the ListPayments filters, scoped to the authenticated
+// merchant
+func sessionFilter(c *gin.Context) (services.SessionFilter, bool) {
+	var filter services.SessionFilter
+
+	if merchantIDStr := c.Query("merchant_id"); merchantIDStr != "" {
+		merchantID, err := uuid.Parse(merchantIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+			return filter, false
+		}
+		filter.MerchantID = &merchantID
+	}
+	if !middleware.IsAdmin(c) {
+		merchant := middleware.CurrentMerchant(c)
+		if merchant == nil || (filter.MerchantID != nil && *filter.MerchantID != merchant.MerchantID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed for this merchant"})
+			return filter, false
+		}
+		filter.MerchantID = &merchant.MerchantID
+	}
+
+	if statusStr := c.Query("status"); statusStr != "" {
+		status := models.PaymentStatus(statusStr)
+		switch status {
+		case models.PaymentStatusPending, models.PaymentStatusPaid, models.PaymentStatusExpired,
+			models.PaymentStatusCancelled, models.PaymentStatusFailed, models.PaymentStatusRefunded:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+			return filter, false
+		}
+		filter.Status = &status
+	}
+
+	if contentIDStr := c.Query("content_id"); contentIDStr != "" {
+		contentID, err := uuid.Parse(contentIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid content ID"})
+			return filter, false
+		}
+		filter.ContentID = &contentID
+	}
+	if userIdentifier := c.Query("user_identifier"); userIdentifier != "" {
+		filter.UserIdentifier = &userIdentifier
+	}
+
+	if fromStr := c.Query("from"); fromStr != "" {
+		from, err := time.Parse(time.DateOnly, fromStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
+			return filter, false
+		}
+		filter.From = &from
+	}
+	if toStr := c.Query("to"); toStr != "" {
+		to, err := time.Parse(time.DateOnly, toStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD"})
+			return filter, false
+		}
+		end := to.AddDate(0, 0, 1)
+		filter.To = &end
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date range, expected from <= to"})
+		return filter, false
+	}
+
+	return filter, true
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/preview"
+	"go.uber.org/zap"
+)
+
+// paywall describes how a backend response is cut short for a user who has
+// not paid for content with a metered preview, see preview.PolicyFor
+type paywall struct {
+	policy preview.Policy
+	prompt preview.Prompt
+	// required is the 402 body sent instead when the response cannot be
+	// previewed
+	required gin.H
+}
+
+// newPaywall returns the paywall of content for an unpaid request of path, or
+// nil when the content has no metered preview
+func (h *Handlers) newPaywall(merchant *models.Merchant, content *models.Content, path string) *paywall {
+	policy, ok := preview.PolicyFor(content)
+	if !ok {
+		return nil
+	}
+	title := path
+	if content.Title != nil {
+		title = *content.Title
+	}
+	return &paywall{
+		policy: policy,
+		prompt: preview.Prompt{
+			Path:  path,
+			Title: title,
+			Price: h.moneyFormat(merchant).Format(content.PriceCents, content.Currency),
+		},
+		required: h.paymentRequired(merchant, content, path),
+	}
+}
+
+// servePreview serves the metered preview of content on the /content route,
+// fetched from the merchant's backend like ReverseProxy does. Without a
+// backend there is nothing to preview and the user gets the 402.
+func (h *Handlers) servePreview(c *gin.Context, merchant *models.Merchant, content *models.Content, path string, pw *paywall) {
+	if merchant.BackendURL == nil || *merchant.BackendURL == "" {
+		c.JSON(http.StatusPaymentRequired, pw.required)
+		return
+	}
+	target, err := url.Parse(*merchant.BackendURL)
+	if err != nil {
+		h.logger.Error("Invalid merchant backend URL", zap.Error(err), zap.String("merchant_id", merchant.MerchantID.String()))
+		c.JSON(http.StatusPaymentRequired, pw.required)
+		return
+	}
+	c.Request.URL.Path = path
+	c.Request.URL.RawPath = ""
+	h.proxyContent(c, merchant, target, content, pw)
+}
+
+// stripPreviewRequest removes the request headers that would let a preview
+// reach past the free portion: ranges, conditional requests that could skip
+// the body, and compression, which the split cannot see through
+func stripPreviewRequest(req *http.Request) {
+	for _, header := range []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since", "Accept-Encoding"} {
+		req.Header.Del(header)
+	}
+}
+
+// cutPreview replaces a successful backend response with its free portion
+// followed by the paywall prompt. Responses that cannot be split safely, like
+// binary or compressed bodies, are paywalled in full with the 402; error
+// responses pass through as they are, since they reveal nothing of the
+// content.
+func cutPreview(resp *http.Response, pw *paywall) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil
+	}
+	contentType := resp.Header.Get("Content-Type")
+	encoding := resp.Header.Get("Content-Encoding")
+	if resp.StatusCode != http.StatusOK || !hasBody(resp) || encoding != "" && encoding != "identity" {
+		return replaceWithPaymentRequired(resp, pw)
+	}
+
+	free, ok, err := preview.Truncate(resp.Body, contentType, pw.policy)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return replaceWithPaymentRequired(resp, pw)
+	}
+
+	body := append(free, pw.prompt.Render(contentType)...)
+	for _, header := range []string{"Content-Encoding", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified"} {
+		resp.Header.Del(header)
+	}
+	// The response depends on whether the user has paid
+	resp.Header.Set("Cache-Control", "private, no-store")
+	setBody(resp, body)
+	return nil
+}
+
+// replaceWithPaymentRequired turns resp into the 402 of the paywall
+func replaceWithPaymentRequired(resp *http.Response, pw *paywall) error {
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+	body, err := json.Marshal(pw.required)
+	if err != nil {
+		return err
+	}
+	resp.StatusCode = http.StatusPaymentRequired
+	resp.Status = http.StatusText(http.StatusPaymentRequired)
+	resp.Header = http.Header{}
+	resp.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp.Header.Set("Cache-Control", "no-store")
+	setBody(resp, body)
+	return nil
+}
+
+func setBody(resp *http.Response, body []byte) {
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.TransferEncoding = nil
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
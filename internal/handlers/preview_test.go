@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+// articleBody has a free part before the "<!--more-->" marker
+const articleBody = `<h1>Title</h1><p>Free part.</p><!--more--><p>Paid part.</p>`
+
+// previewBackend answers every request with status, contentType and body, and
+// records the request headers it received
+func previewBackend(t *testing.T, status int, contentType, encoding, body string, received *http.Header) *url.URL {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*received = r.Header.Clone()
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("ETag", `"v1"`)
+		if encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return target
+}
+
+func TestBackendProxyPreview(t *testing.T) {
+	title := "Article"
+	const prompt = `<div class="paywall" data-content-path="/news/article"><p>Pay €0.50 to continue reading Article.</p></div>`
+	tests := []struct {
+		name        string
+		rules       models.JSONMap
+		status      int
+		contentType string
+		encoding    string
+		body        string
+		headers     map[string]string
+		wantStatus  int
+		wantBody    string
+	}{
+		{
+			name: "html split", rules: models.JSONMap{"preview_bytes": 33.0},
+			status: http.StatusOK, contentType: "text/html; charset=utf-8", body: articleBody,
+			wantStatus: http.StatusOK, wantBody: `<h1>Title</h1><p>Free part.</p>` + prompt,
+		},
+		{
+			name: "text split", rules: models.JSONMap{"preview_bytes": 10.0},
+			status: http.StatusOK, contentType: "text/plain", body: "Free part. Paid part.",
+			wantStatus: http.StatusOK, wantBody: "Free part.\n\n[Pay €0.50 to continue reading Article.]\n",
+		},
+		{
+			name: "marker", rules: models.JSONMap{"preview_marker": "<!--more-->"},
+			status: http.StatusOK, contentType: "text/html", body: articleBody,
+			wantStatus: http.StatusOK, wantBody: `<h1>Title</h1><p>Free part.</p>` + prompt,
+		},
+		{
+			name: "range cannot reach past the preview", rules: models.JSONMap{"preview_marker": "<!--more-->"},
+			status: http.StatusOK, contentType: "text/html", body: articleBody,
+			headers:    map[string]string{"Range": "bytes=42-", "If-None-Match": `"v1"`, "Accept-Encoding": "gzip"},
+			wantStatus: http.StatusOK, wantBody: `<h1>Title</h1><p>Free part.</p>` + prompt,
+		},
+		{
+			name: "binary is paywalled in full", rules: models.JSONMap{"preview_bytes": 10.0},
+			status: http.StatusOK, contentType: "application/pdf", body: "%PDF-1.4 Free part. Paid part.",
+			wantStatus: http.StatusPaymentRequired,
+		},
+		{
+			name: "compressed body is paywalled in full", rules: models.JSONMap{"preview_bytes": 10.0},
+			status: http.StatusOK, contentType: "text/plain", encoding: "br", body: "\x1b compressed",
+			wantStatus: http.StatusPaymentRequired,
+		},
+		{
+			name: "partial content is paywalled in full", rules: models.JSONMap{"preview_bytes": 10.0},
+			status: http.StatusPartialContent, contentType: "text/plain", body: "Paid part.",
+			wantStatus: http.StatusPaymentRequired,
+		},
+		{
+			name: "backend error passes through", rules: models.JSONMap{"preview_bytes": 10.0},
+			status: http.StatusNotFound, contentType: "text/plain", body: "Not found",
+			wantStatus: http.StatusNotFound, wantBody: "Not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received http.Header
+			target := previewBackend(t, tt.status, tt.contentType, tt.encoding, tt.body, &received)
+			h := &Handlers{
+				config:         &config.Config{},
+				proxyTransport: http.DefaultTransport,
+				logger:         zap.NewNop(),
+			}
+			content := &models.Content{Title: &title, PriceCents: 50, Currency: "EUR", AccessRules: tt.rules}
+			pw := h.newPaywall(&models.Merchant{}, content, "/news/article")
+			if pw == nil {
+				t.Fatal("newPaywall() = nil for content with a preview")
+			}
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/news/article", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			h.backendProxy(target, content, pw).ServeHTTP(w, req)
+
+			for _, header := range []string{"Range", "If-None-Match"} {
+				if got := received.Get(header); got != "" {
+					t.Errorf("backend got %s %q, want it stripped", header, got)
+				}
+			}
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusPaymentRequired {
+				var body map[string]interface{}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatalf("402 body %q is not JSON: %v", w.Body.String(), err)
+				}
+				if body["error"] != "Payment required" || body["content_path"] != "/news/article" {
+					t.Errorf("402 body = %v", body)
+				}
+				if strings.Contains(w.Body.String(), "part") {
+					t.Errorf("402 body %q leaks the content", w.Body.String())
+				}
+				return
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+			if tt.status == http.StatusOK {
+				if got := w.Header().Get("Cache-Control"); got != "private, no-store" {
+					t.Errorf("Cache-Control = %q, want private, no-store", got)
+				}
+				if got := w.Header().Get("ETag"); got != "" {
+					t.Errorf("ETag = %q, want it dropped", got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+// newProxyTransport returns the transport shared by all merchant backends, so
+// connections to a backend are reused across requests
+func newProxyTransport(cfg config.ProxyConfig) http.RoundTripper {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   cfg.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// ReverseProxy forwards requests for a merchant's site to the merchant's
+// backend_url. Paths registered as content are only forwarded when the user has
+// access, under the same rules as ServeContent; any other path passes through.
+// Method, query string, body, response status and headers are forwarded as
+// they are, and the response is streamed back to the client. That includes
+// Range and If-Range, and the 206, Accept-Ranges and Content-Range of the
+// answer, so media players can seek. Users who have not paid for content with
+// a metered preview get the free portion of the response, see cutPreview.
+func (h *Handlers) ReverseProxy(c *gin.Context) {
+	path, ok := contentPath(c, c.Request.URL.Path, http.StatusRequestURITooLong)
+	if !ok {
+		return
+	}
+
+	merchant, ok := h.resolveMerchant(c)
+	if !ok {
+		return
+	}
+	if merchant.BackendURL == nil || *merchant.BackendURL == "" {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "No backend configured for this merchant"})
+		return
+	}
+	target, err := url.Parse(*merchant.BackendURL)
+	if err != nil {
+		h.logger.Error("Invalid merchant backend URL", zap.Error(err), zap.String("merchant_id", merchant.MerchantID.String()))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Invalid backend configured for this merchant"})
+		return
+	}
+
+	content, err := h.contentService.GetContentByPath(merchant.MerchantID, path)
+	var pw *paywall
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		content = nil
+	case err != nil:
+		h.logger.Error("Failed to get content", zap.Error(err), zap.String("path", path))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get content"})
+		return
+	default:
+		if _, pw, ok = h.checkContentAccess(c, merchant, content, path); !ok {
+			return
+		}
+	}
+
+	h.proxyContent(c, merchant, target, content, pw)
+}
+
+// proxyContent forwards the request to the merchant backend at target and
+// meters the traffic. The content is nil for paths that are not paywalled, and
+// pw nil unless only the preview of the content may be served.
+func (h *Handlers) proxyContent(c *gin.Context, merchant *models.Merchant, target *url.URL, content *models.Content, pw *paywall) {
+	contentID := uuid.Nil
+	if content != nil {
+		contentID = content.ContentID
+	}
+
+	overCap, err := h.bandwidthService.OverCap(c.Request.Context(), merchant)
+	if err != nil {
+		// Metering problems should not take the merchant's site down
+		h.logger.Error("Failed to check bandwidth cap", zap.Error(err))
+	}
+	if overCap {
+		now := time.Now()
+		c.Header("Retry-After", strconv.Itoa(int(services.NextMonth(now).Sub(now).Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Monthly bandwidth limit reached"})
+		return
+	}
+
+	// Media plays for longer than the server's write timeout allows
+	if content != nil && content.ContentType == models.ContentTypeStreamingMedia {
+		if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+			h.logger.Warn("Failed to clear write deadline for media stream", zap.Error(err))
+		}
+	}
+
+	// Body bytes are counted as they stream through, so chunked and long-lived
+	// responses are metered exactly; a response aborted halfway counts what
+	// was sent
+	body := &countingReader{ReadCloser: c.Request.Body}
+	c.Request.Body = body
+	defer func() {
+		h.bandwidthService.Record(merchant.MerchantID, contentID, body.n, int64(max(c.Writer.Size(), 0)))
+	}()
+
+	h.backendProxy(target, content, pw).ServeHTTP(c.Writer, c.Request)
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// backendProxy builds the proxy for one request to target. The content is nil
+// for paths that are not paywalled, and pw nil unless the response is to be
+// cut short to its preview.
+func (h *Handlers) backendProxy(target *url.URL, content *models.Content, pw *paywall) *httputil.ReverseProxy {
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		originalHost := req.Host
+		director(req)
+		// The backend sees its own host name; the merchant domain the client
+		// asked for goes along as X-Forwarded-Host
+		req.Host = target.Host
+		req.Header.Set("X-Forwarded-Host", originalHost)
+		req.Header.Set("X-Forwarded-Proto", forwardedProto(req))
+		if pw != nil {
+			stripPreviewRequest(req)
+		}
+	}
+	proxy.Transport = h.proxyTransport
+	// Flush right away so streamed and long-polling responses are not held back
+	proxy.FlushInterval = -1
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if content != nil {
+			if value := contentDisposition(content); value != "" {
+				resp.Header.Set("Content-Disposition", value)
+			}
+		}
+		if err := h.fixContentType(resp, content); err != nil || pw == nil {
+			return err
+		}
+		return cutPreview(resp, pw)
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		h.logger.Warn("Backend request failed",
+			zap.Error(err),
+			zap.String("backend", target.Host),
+			zap.String("path", req.URL.Path),
+		)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`{"error":"Backend unavailable"}`))
+	}
+	return proxy
+}
+
+// forwardedProto returns the scheme the client used to reach the proxy
+func forwardedProto(req *http.Request) string {
+	if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+		return proto
+	}
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
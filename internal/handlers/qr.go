@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/qr"
+	"go.uber.org/zap"
+)
+
+// Bounds the size query parameter is clamped to, in pixels
+const (
+	minQRSize = 128
+	maxQRSize = 1024
+)
+
+// GetPaymentQR serves the QR code image of a pending payment session, at
+// cfg.Payment.QRCodeSize unless ?size= asks for another size. Expired sessions
+// get 410 since their code can no longer be paid.
+func (h *Handlers) GetPaymentQR(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	format := c.DefaultQuery("format", qr.FormatPNG)
+	size := h.config.Payment.QRCodeSize
+	if sizeStr := c.Query("size"); sizeStr != "" {
+		size, err = strconv.Atoi(sizeStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid size"})
+			return
+		}
+		size = min(max(size, minQRSize), maxQRSize)
+	}
+
+	session, err := h.paymentService.GetPaymentSession(sessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment session not found"})
+		return
+	}
+	if session.Status == models.PaymentStatusExpired ||
+		(session.Status == models.PaymentStatusPending && time.Now().After(session.ExpiresAt)) {
+		c.JSON(http.StatusGone, gin.H{"error": "Payment session has expired"})
+		return
+	}
+	if session.Status != models.PaymentStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment session is not pending"})
+		return
+	}
+
+	image, err := h.qrCache.Image(session.SessionID, session.QRCodeData, format, size)
+	if errors.Is(err, qr.ErrUnsupportedFormat) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported format"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to render QR code", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render QR code"})
+		return
+	}
+
+	cachePrivate(c, h.config.Cache.QRTTL)
+	c.Data(http.StatusOK, "image/png", image)
+}
+
+// GetQRCacheStats reports QR render and cache hit counters
+func (h *Handlers) GetQRCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.qrCache.Stats())
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+// GetPaymentQuote returns the fee breakdown a payment session for content_path
+// would get, so merchants can show it before the customer commits. The amounts
+// are computed exactly as on session creation.
+func (h *Handlers) GetPaymentQuote(c *gin.Context) {
+	if c.Query("content_path") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "content_path is required"})
+		return
+	}
+	path, ok := contentPath(c, c.Query("content_path"), http.StatusBadRequest)
+	if !ok {
+		return
+	}
+
+	merchant, ok := h.resolveMerchant(c)
+	if !ok {
+		return
+	}
+
+	content, err := h.contentService.GetContentByPath(merchant.MerchantID, path)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Content not found"})
+		return
+	}
+
+	fees, err := h.paymentService.QuoteFees(merchant.MerchantID, content.ContentID)
+	if errors.Is(err, services.ErrCurrencyMismatch) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to quote payment", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to quote payment"})
+		return
+	}
+
+	format := h.moneyFormat(merchant)
+	c.JSON(http.StatusOK, gin.H{
+		"content_path":       path,
+		"gross_cents":        fees.GrossCents,
+		"platform_fee_cents": fees.PlatformFeeCents,
+		"vat_cents":          fees.VATCents,
+		"net_cents":          fees.NetCents,
+		"currency":           fees.Currency,
+		"pricing_tier":       fees.PricingTier,
+		"gross_display":      format.Format(fees.GrossCents, fees.Currency),
+		"net_display":        format.Format(fees.NetCents, fees.Currency),
+	})
+}
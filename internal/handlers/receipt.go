@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/receipt"
+	"go.uber.org/zap"
+)
+
+// accessReceipt signs a receipt for a paid session, valid until its access
+// expires or for the configured TTL, whichever comes first. It returns an empty
+// string when receipts are disabled or the session grants no access right now.
+func (h *Handlers) accessReceipt(session *models.PaymentSession) string {
+	if !h.config.Receipt.Enabled || session.Status != models.PaymentStatusPaid || session.AccessExpiresAt == nil {
+		return ""
+	}
+	now := time.Now()
+	expiresAt := *session.AccessExpiresAt
+	if limit := now.Add(h.config.Receipt.TTL); limit.Before(expiresAt) {
+		expiresAt = limit
+	}
+	if !now.Before(expiresAt) {
+		return ""
+	}
+
+	r := receipt.Receipt{
+		SessionID: session.SessionID,
+		ContentID: session.ContentID,
+		ExpiresAt: expiresAt,
+	}
+	if session.UserIdentifier != nil {
+		r.User = *session.UserIdentifier
+	}
+	token, err := receipt.Sign(r, h.config.Auth.JWTSecret)
+	if err != nil {
+		h.logger.Error("Failed to sign access receipt", zap.Error(err))
+		return ""
+	}
+	return token
+}
+
+// receiptGrant returns the access proven by the receipt on the request, or nil
+// when there is none or it does not cover content for userID. The signature
+// replaces the lookup by user identifier, but the session is still checked so
+// disputed and refunded payments lose access immediately.
+func (h *Handlers) receiptGrant(c *gin.Context, content *models.Content, userID string) *models.ContentAccess {
+	token := c.GetHeader(receipt.Header)
+	if token == "" || !h.config.Receipt.Enabled {
+		return nil
+	}
+
+	r, err := receipt.Verify(token, h.config.Auth.JWTSecret, time.Now())
+	if err != nil {
+		if !errors.Is(err, receipt.ErrExpired) {
+			h.logger.Debug("Rejected access receipt", zap.Error(err))
+		}
+		return nil
+	}
+	if r.ContentID != content.ContentID || (r.User != "" && r.User != userID) {
+		return nil
+	}
+
+	active, err := h.contentService.SessionAccessActive(c.Request.Context(), r.SessionID)
+	if err != nil {
+		h.logger.Error("Failed to check access receipt", zap.Error(err))
+		return nil
+	}
+	if !active {
+		return nil
+	}
+
+	sessionID := r.SessionID
+	return &models.ContentAccess{
+		SessionID:      &sessionID,
+		MerchantID:     content.MerchantID,
+		ContentID:      content.ContentID,
+		UserIdentifier: userID,
+		ExpiresAt:      r.ExpiresAt,
+		IsActive:       true,
+	}
+}
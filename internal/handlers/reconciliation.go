@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+// ReconcileDryRun reports the matches reconciliation would make without applying them
+func (h *Handlers) ReconcileDryRun(c *gin.Context) {
+	report, err := h.reconciliationService.DryRun(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to run reconciliation dry run", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run reconciliation dry run"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetBalanceReport compares merchant balances against settled bank transactions
+// right now and lists every discrepancy
+func (h *Handlers) GetBalanceReport(c *gin.Context) {
+	report, err := h.reconciliationService.CheckBalances(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to check balances", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check balances"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ReconcileBackfill imports a batch of historical bank transactions for a merchant
+// and matches them against past sessions. Re-sending the same batch is safe.
+func (h *Handlers) ReconcileBackfill(c *gin.Context) {
+	var req struct {
+		MerchantID   uuid.UUID                `json:"merchant_id" binding:"required"`
+		Transactions []models.BankTransaction `json:"transactions" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		bindError(c, err)
+		return
+	}
+
+	report, err := h.reconciliationService.Backfill(c.Request.Context(), req.MerchantID, req.Transactions)
+	if errors.Is(err, services.ErrBackfillTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":     "Backfill batch too large",
+			"max_batch": h.config.Admin.MaxBackfillBatch,
+		})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to run reconciliation backfill", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run reconciliation backfill"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+// RefundPayment records the refund of a paid session and revokes its access
+func (h *Handlers) RefundPayment(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	// The body is optional
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		bindError(c, err)
+		return
+	}
+
+	session, err := h.paymentService.RefundPayment(c.Request.Context(), sessionID, req.Reason)
+	switch {
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment session not found"})
+		return
+	case errors.Is(err, services.ErrSessionNotRefundable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Only paid sessions can be refunded"})
+		return
+	case err != nil:
+		h.logger.Error("Failed to refund payment session", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refund payment session"})
+		return
+	}
+	h.audit(c, services.AuditPaymentRefund, services.AuditTargetPaymentSession, sessionID.String(), map[string]interface{}{
+		"reason":       req.Reason,
+		"amount_cents": session.AmountCents,
+		"currency":     session.Currency,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"session_id":   session.SessionID,
+		"status":       session.Status,
+		"amount_cents": session.AmountCents,
+		"currency":     session.Currency,
+		"refunded_at":  session.RefundedAt,
+	})
+}
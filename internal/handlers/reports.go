@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+// GetStats returns platform totals, optionally for one merchant (?merchant_id=)
+// and a period (?from=&to=, inclusive YYYY-MM-DD dates in UTC)
+func (h *Handlers) GetStats(c *gin.Context) {
+	var filter services.StatsFilter
+	if raw := c.Query("merchant_id"); raw != "" {
+		merchantID, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+			return
+		}
+		filter.MerchantID = &merchantID
+	}
+	if from, to := c.Query("from"), c.Query("to"); from != "" || to != "" {
+		r, err := services.NewReportRange(from, to, time.UTC, time.Now())
+		if errors.Is(err, services.ErrInvalidReportRange) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date range, expected from <= to as YYYY-MM-DD"})
+			return
+		}
+		filter.Range = &r
+	}
+
+	stats, err := h.paymentService.Stats(c.Request.Context(), filter)
+	if err != nil {
+		h.logger.Error("Failed to load stats", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetRevenueReport reports a merchant's daily revenue between the from and to dates,
+// both interpreted as whole days in the merchant's reporting time zone
+func (h *Handlers) GetRevenueReport(c *gin.Context) {
+	merchantID, err := uuid.Parse(c.Query("merchant_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+		return
+	}
+
+	merchant, err := h.merchantService.GetMerchantByID(merchantID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	}
+
+	r, err := services.NewReportRange(c.Query("from"), c.Query("to"), h.reportLocation(merchant), time.Now())
+	if errors.Is(err, services.ErrInvalidReportRange) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date range, expected from <= to as YYYY-MM-DD"})
+		return
+	}
+
+	report, err := h.paymentService.RevenueByDay(c.Request.Context(), merchant.MerchantID, r)
+	if err != nil {
+		h.logger.Error("Failed to load revenue report", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load revenue report"})
+		return
+	}
+	report.Bandwidth, err = h.bandwidthService.Usage(c.Request.Context(), merchant)
+	if err != nil {
+		h.logger.Error("Failed to load bandwidth usage", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load bandwidth usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// reportLocation returns the time zone reports are bucketed in, taken from the
+// IANA "timezone" merchant setting (e.g. "Europe/Amsterdam"). Timestamps stay
+// UTC in the database; unknown or missing zones report in UTC.
+func (h *Handlers) reportLocation(merchant *models.Merchant) *time.Location {
+	name, _ := merchant.Settings["timezone"].(string)
+	// "Local" would resolve to the server's zone, which the database does not know
+	if name == "" || name == "Local" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		h.logger.Warn("Unknown merchant timezone, reporting in UTC",
+			zap.String("merchant_id", merchant.MerchantID.String()),
+			zap.String("timezone", name),
+		)
+		return time.UTC
+	}
+	return loc
+}
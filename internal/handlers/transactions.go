@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"go.uber.org/zap"
+)
+
+// GetTransactions lists bank transactions using keyset pagination
+func (h *Handlers) GetTransactions(c *gin.Context) {
+	filter, ok := h.transactionFilter(c)
+	if !ok {
+		return
+	}
+	fields, ok := parseFields(c, transactionFields, "transaction_id")
+	if !ok {
+		return
+	}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		filter.Limit = limit
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return
+		}
+		if filter.After != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Use either offset or cursor, not both"})
+			return
+		}
+		filter.Offset = offset
+	}
+	filter.IncludeTotal = c.Query("include_total") == "true"
+
+	page, err := h.transactionService.ListTransactions(c.Request.Context(), filter)
+	if err != nil {
+		h.logger.Error("Failed to list transactions", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list transactions"})
+		return
+	}
+	if fields == nil {
+		c.JSON(http.StatusOK, page)
+		return
+	}
+
+	data, err := fields.applyList(page.Data)
+	if err != nil {
+		h.logger.Error("Failed to select response fields", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode response"})
+		return
+	}
+	resp := gin.H{
+		"data":        data,
+		"limit":       page.Limit,
+		"offset":      page.Offset,
+		"next_cursor": page.NextCursor,
+	}
+	if page.Total != nil {
+		resp["total"] = *page.Total
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetTransaction returns a single transaction with its matching audit
+func (h *Handlers) GetTransaction(c *gin.Context) {
+	transactionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return
+	}
+	fields, ok := parseFields(c, transactionFields, "transaction_id")
+	if !ok {
+		return
+	}
+
+	tx, err := h.transactionService.GetTransaction(c.Request.Context(), transactionID)
+	if errors.Is(err, services.ErrTransactionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get transaction", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get transaction"})
+		return
+	}
+
+	h.writeFields(c, http.StatusOK, fields, tx)
+}
+
+// ExportTransactions streams bank transactions as CSV without loading them all into memory
+func (h *Handlers) ExportTransactions(c *gin.Context) {
+	filter, ok := h.transactionFilter(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", `attachment; filename="transactions.csv"`)
+	c.Header("Trailer", "X-Export-Truncated")
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{
+		"transaction_id", "merchant_id", "bank_reference", "payment_reference",
+		"amount_cents", "currency", "debtor_name", "debtor_iban", "creditor_iban",
+		"transaction_date", "booking_date", "status",
+	})
+
+	truncated, err := h.transactionService.StreamTransactions(c.Request.Context(), filter, func(tx *models.BankTransaction) error {
+		merchantID := ""
+		if tx.MerchantID != nil {
+			merchantID = tx.MerchantID.String()
+		}
+		return w.Write([]string{
+			tx.TransactionID.String(),
+			merchantID,
+			stringValue(tx.BankReference),
+			stringValue(tx.PaymentReference),
+			strconv.Itoa(tx.AmountCents),
+			tx.Currency,
+			stringValue(tx.DebtorName),
+			stringValue(tx.DebtorIBAN),
+			tx.CreditorIBAN,
+			tx.TransactionDate.UTC().Format(time.RFC3339),
+			tx.BookingDate.UTC().Format(time.RFC3339),
+			string(tx.Status),
+		})
+	})
+	w.Flush()
+
+	if err != nil {
+		// Headers are already sent, so all we can do is log and stop writing
+		h.logger.Error("Failed to export transactions", zap.Error(err))
+		return
+	}
+	c.Writer.Header().Set("X-Export-Truncated", strconv.FormatBool(truncated))
+	if truncated {
+		h.logger.Warn("Transaction export hit the max scan limit",
+			zap.String("request_id", c.GetString("request_id")),
+		)
+	}
+}
+
+// transactionFilter reads the shared transaction filter query parameters,
+// writing a 400 response and returning false when one is invalid
+func (h *Handlers) transactionFilter(c *gin.Context) (services.TransactionFilter, bool) {
+	var filter services.TransactionFilter
+
+	if merchantIDStr := c.Query("merchant_id"); merchantIDStr != "" {
+		merchantID, err := uuid.Parse(merchantIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant ID"})
+			return filter, false
+		}
+		filter.MerchantID = &merchantID
+	}
+
+	if statusStr := c.Query("status"); statusStr != "" {
+		status := models.TransactionStatus(statusStr)
+		switch status {
+		case models.TransactionStatusDetected, models.TransactionStatusMatched, models.TransactionStatusProcessed,
+			models.TransactionStatusIgnored, models.TransactionStatusDisputed, models.TransactionStatusReturned:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+			return filter, false
+		}
+		filter.Status = &status
+	}
+
+	// from and to are inclusive UTC dates on transaction_date
+	if fromStr := c.Query("from"); fromStr != "" {
+		from, err := time.Parse(time.DateOnly, fromStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
+			return filter, false
+		}
+		filter.From = &from
+	}
+	if toStr := c.Query("to"); toStr != "" {
+		to, err := time.Parse(time.DateOnly, toStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD"})
+			return filter, false
+		}
+		end := to.AddDate(0, 0, 1)
+		filter.To = &end
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date range, expected from <= to"})
+		return filter, false
+	}
+
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		cursor, err := services.DecodeTransactionCursor(cursorStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return filter, false
+		}
+		filter.After = cursor
+	}
+
+	return filter, true
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/services"
+	"github.com/mh74hf/micro-payments/internal/webhooks"
+	"go.uber.org/zap"
+)
+
+// ListWebhookFailures lists webhook events whose delivery failed, most recently
+// failed first, a page at a time (see parsePage). ?status=failed lists those
+// still being retried, ?status=dead those out of retries; both by default.
+func (h *Handlers) ListWebhookFailures(c *gin.Context) {
+	limit, offset, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	if limit == 0 {
+		limit = h.config.Admin.DefaultPageSize
+	}
+	limit = min(limit, h.config.Admin.MaxPageSize)
+
+	status := c.Query("status")
+	switch status {
+	case "", webhooks.DeliveryFailed, webhooks.DeliveryDead:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	deliveries, total, err := h.webhookDispatcher.Failures(c.Request.Context(), status, limit, offset)
+	if err != nil {
+		h.logger.Error("Failed to list failed webhooks", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list failed webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":   deliveries,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// ReplayWebhook sends a failed or dead webhook event again on the next retry
+// round
+func (h *Handlers) ReplayWebhook(c *gin.Context) {
+	eventID, err := uuid.Parse(c.Param("eventId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	err = h.webhookDispatcher.Replay(c.Request.Context(), eventID)
+	if errors.Is(err, webhooks.ErrDeliveryNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed webhook delivery not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to replay webhook", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay webhook"})
+		return
+	}
+	h.audit(c, services.AuditWebhookDeliveryReplay, services.AuditTargetWebhookEvent, eventID.String(), nil)
+
+	c.JSON(http.StatusAccepted, gin.H{"event_id": eventID, "status": webhooks.DeliveryFailed})
+}
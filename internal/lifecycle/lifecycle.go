@@ -0,0 +1,57 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// StopFunc stops or flushes one component during shutdown
+type StopFunc func(ctx context.Context) error
+
+type hook struct {
+	name     string
+	critical bool
+	stop     StopFunc
+}
+
+// Registry runs shutdown hooks in the order they were registered, which makes
+// the shutdown sequence explicit: stop taking work first, then flush what is
+// buffered, then close what the flushes needed.
+type Registry struct {
+	logger *zap.Logger
+	hooks  []hook
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry(logger *zap.Logger) *Registry {
+	return &Registry{logger: logger}
+}
+
+// Register appends a hook. A failing critical hook makes Stop return an error,
+// meaning data was lost; other failures are only logged.
+func (r *Registry) Register(name string, critical bool, stop StopFunc) {
+	r.hooks = append(r.hooks, hook{name: name, critical: critical, stop: stop})
+}
+
+// Stop runs every hook in registration order. Hooks after a failing one still
+// run, so one stuck component does not keep the others from flushing. The
+// returned error joins the failures of critical hooks.
+func (r *Registry) Stop(ctx context.Context) error {
+	var errs []error
+	for _, h := range r.hooks {
+		err := h.stop(ctx)
+		if err == nil {
+			continue
+		}
+		if h.critical {
+			r.logger.Error("Shutdown step failed", zap.String("step", h.name), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+		} else {
+			r.logger.Warn("Shutdown step failed", zap.String("step", h.name), zap.Error(err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,63 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestRegistryStop(t *testing.T) {
+	errFlush := errors.New("flush failed")
+	errClose := errors.New("close failed")
+	type step struct {
+		name     string
+		critical bool
+		err      error
+	}
+	tests := []struct {
+		name     string
+		steps    []step
+		wantErrs []error
+	}{
+		{"no hooks", nil, nil},
+		{"all succeed", []step{{"http", false, nil}, {"counts", true, nil}, {"db", false, nil}}, nil},
+		{"non-critical failure is only logged", []step{{"http", false, errClose}, {"counts", true, nil}}, nil},
+		{"critical failure", []step{{"http", false, nil}, {"counts", true, errFlush}, {"db", false, nil}}, []error{errFlush}},
+		{"critical failures are joined", []step{{"counts", true, errFlush}, {"webhooks", true, errClose}}, []error{errFlush, errClose}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry(zap.NewNop())
+			var ran []string
+			for _, s := range tt.steps {
+				s := s
+				r.Register(s.name, s.critical, func(context.Context) error {
+					ran = append(ran, s.name)
+					return s.err
+				})
+			}
+
+			err := r.Stop(context.Background())
+
+			// Every hook runs, in registration order, failing or not
+			var want []string
+			for _, s := range tt.steps {
+				want = append(want, s.name)
+			}
+			if !reflect.DeepEqual(ran, want) {
+				t.Errorf("ran %v, want %v", ran, want)
+			}
+			if len(tt.wantErrs) == 0 && err != nil {
+				t.Errorf("Stop() error = %v, want nil", err)
+			}
+			for _, wantErr := range tt.wantErrs {
+				if !errors.Is(err, wantErr) {
+					t.Errorf("Stop() error = %v, want it to include %v", err, wantErr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package lifecycle
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Readiness tracks whether the server should get traffic. It is not ready
+// until Started is called, once the background workers run, and stops being
+// ready for good when Drain begins the shutdown.
+type Readiness struct {
+	started  atomic.Bool
+	draining atomic.Bool
+}
+
+// Started marks startup as complete
+func (r *Readiness) Started() {
+	r.started.Store(true)
+}
+
+// IsStarted reports whether startup completed
+func (r *Readiness) IsStarted() bool {
+	return r.started.Load()
+}
+
+// IsDraining reports whether shutdown has begun
+func (r *Readiness) IsDraining() bool {
+	return r.draining.Load()
+}
+
+// Drain returns a shutdown step that stops reporting ready and then waits for
+// delay, so load balancers and Kubernetes stop routing new requests here
+// before the HTTP server stops accepting them
+func (r *Readiness) Drain(delay time.Duration) StopFunc {
+	return func(ctx context.Context) error {
+		r.draining.Store(true)
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
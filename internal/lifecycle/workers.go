@@ -0,0 +1,100 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// drainLogInterval is how often Workers.Stop logs the workers it still waits for
+const drainLogInterval = time.Second
+
+// Workers runs background goroutines on a shared context, so shutdown can
+// cancel them all at once and wait until each has returned instead of
+// cutting a bank sync or webhook retry off halfway
+type Workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	logger *zap.Logger
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[string]int
+}
+
+// NewWorkers creates a manager without workers
+func NewWorkers(logger *zap.Logger) *Workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Workers{
+		ctx:     ctx,
+		cancel:  cancel,
+		logger:  logger,
+		running: make(map[string]int),
+	}
+}
+
+// Go starts run in a goroutine under name. run must return soon after its
+// context is cancelled.
+func (w *Workers) Go(name string, run func(ctx context.Context)) {
+	w.mu.Lock()
+	w.running[name]++
+	w.mu.Unlock()
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer w.done(name)
+		run(w.ctx)
+	}()
+}
+
+func (w *Workers) done(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running[name]--; w.running[name] == 0 {
+		delete(w.running, name)
+	}
+}
+
+// Running lists the names of the workers that have not returned yet
+func (w *Workers) Running() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	names := make([]string, 0, len(w.running))
+	for name := range w.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stop is a StopFunc that cancels the workers' context and waits for all of
+// them to return, logging the ones still draining every second. When ctx
+// ends first it gives up and names the workers left running.
+func (w *Workers) Stop(ctx context.Context) error {
+	w.cancel()
+
+	finished := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(finished)
+	}()
+
+	ticker := time.NewTicker(drainLogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-finished:
+			return nil
+		case <-ticker.C:
+			w.logger.Info("Waiting for workers to finish", zap.Strings("workers", w.Running()))
+		case <-ctx.Done():
+			return fmt.Errorf("workers still running: %s: %w", strings.Join(w.Running(), ", "), ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package methods
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// Method describes a payment method as the checkout page needs to render it
+type Method struct {
+	ID   string                 `json:"id"`
+	Name string                 `json:"name"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// Provider is a payment method implementation that can be offered at checkout
+type Provider interface {
+	// ID is the stable identifier merchants use to enable the provider
+	ID() string
+	// Applicable reports whether the provider can take a payment for the content
+	Applicable(merchant *models.Merchant, content *models.Content) bool
+	// Describe returns the method along with whatever data the client needs to render it
+	Describe(merchant *models.Merchant, content *models.Content) Method
+}
+
+// Registry holds the payment providers known to the server
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+}
+
+// NewRegistry creates a registry with the given providers
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{providers: make(map[string]Provider)}
+	for _, p := range providers {
+		r.Register(p)
+	}
+	return r
+}
+
+// Register adds a provider, replacing any provider with the same ID
+func (r *Registry) Register(p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[p.ID()] = p
+}
+
+// enabledSetting is the merchant setting listing the provider IDs to offer
+const enabledSetting = "payment_methods"
+
+// Available returns the methods the merchant has enabled that apply to the
+// content, in the order the merchant listed them. Merchants without a
+// "payment_methods" setting get every registered provider, sorted by ID.
+func (r *Registry) Available(merchant *models.Merchant, content *models.Content) []Method {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := enabledIDs(merchant)
+	if ids == nil {
+		for id := range r.providers {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+	}
+
+	available := []Method{}
+	for _, id := range ids {
+		p, ok := r.providers[id]
+		if !ok || !p.Applicable(merchant, content) {
+			continue
+		}
+		available = append(available, p.Describe(merchant, content))
+	}
+	return available
+}
+
+func enabledIDs(merchant *models.Merchant) []string {
+	raw, ok := merchant.Settings[enabledSetting].([]interface{})
+	if !ok {
+		return nil
+	}
+	ids := []string{}
+	for _, v := range raw {
+		if id, ok := v.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
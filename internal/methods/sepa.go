@@ -0,0 +1,46 @@
+package methods
+
+import (
+	"strings"
+
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/money"
+)
+
+// SEPAQRID identifies the SEPA credit transfer QR code method
+const SEPAQRID = "sepa_qr"
+
+// SEPAQR offers payment by scanning a SEPA credit transfer QR code with a banking app
+type SEPAQR struct {
+	Config config.PaymentConfig
+}
+
+// ID implements Provider
+func (SEPAQR) ID() string { return SEPAQRID }
+
+// Applicable implements Provider. SEPA transfers are EUR only, the merchant's
+// account has to be able to receive EUR, and the price has to fall within the
+// configured payment limits.
+func (p SEPAQR) Applicable(merchant *models.Merchant, content *models.Content) bool {
+	if currency, ok := money.IBANCurrency(merchant.BankAccountIBAN); ok && currency != "EUR" {
+		return false
+	}
+	return strings.EqualFold(content.Currency, "EUR") &&
+		content.PriceCents >= p.Config.MinAmountCents &&
+		content.PriceCents <= p.Config.MaxAmountCents
+}
+
+// Describe implements Provider
+func (p SEPAQR) Describe(merchant *models.Merchant, content *models.Content) Method {
+	return Method{
+		ID:   SEPAQRID,
+		Name: "SEPA QR transfer",
+		Data: map[string]interface{}{
+			"create_url":              "/api/v1/payments/",
+			"status_url":              "/api/v1/payments/{session_id}",
+			"heartbeat_url":           "/api/v1/payments/{session_id}/heartbeat",
+			"session_timeout_seconds": int(merchant.SessionTimeout(p.Config.SessionTimeout, p.Config.MaxSessionLifetime).Seconds()),
+		},
+	}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/cache"
+	"go.uber.org/zap"
+)
+
+// Merchant activity is written at most once per activityInterval per merchant,
+// within activityTimeout
+const (
+	activityInterval = time.Minute
+	activityTimeout  = 5 * time.Second
+)
+
+// ActivityStore stores when a merchant was last active
+type ActivityStore interface {
+	TouchLastActive(ctx context.Context, merchantID uuid.UUID) error
+}
+
+// ActivityTracker records the last activity of merchants that authenticate
+// with their API key. Writes happen in the background, so requests never wait
+// on them, and are debounced through a Redis key per merchant that every
+// instance shares. Without Redis nothing is recorded rather than writing on
+// every request.
+type ActivityTracker struct {
+	client cache.Client
+	store  ActivityStore
+	logger *zap.Logger
+	wg     sync.WaitGroup
+}
+
+// NewActivityTracker creates a tracker writing to store
+func NewActivityTracker(client cache.Client, store ActivityStore, logger *zap.Logger) *ActivityTracker {
+	return &ActivityTracker{
+		client: client,
+		store:  store,
+		logger: logger,
+	}
+}
+
+// Touch records that the merchant is active now
+func (t *ActivityTracker) Touch(merchantID uuid.UUID) {
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), activityTimeout)
+		defer cancel()
+
+		// SET NX only succeeds for the first request of the interval
+		reply, err := t.client.Do(ctx, "SET", "merchant:active:"+merchantID.String(), "1",
+			"NX", "PX", strconv.FormatInt(activityInterval.Milliseconds(), 10))
+		if err != nil {
+			t.logger.Debug("Merchant activity debounce unavailable", zap.Error(err))
+			return
+		}
+		if reply == nil {
+			return
+		}
+		if err := t.store.TouchLastActive(ctx, merchantID); err != nil {
+			t.logger.Warn("Failed to record merchant activity", zap.Error(err),
+				zap.String("merchant_id", merchantID.String()))
+		}
+	}()
+}
+
+// Wait waits for pending writes until ctx is done
+func (t *ActivityTracker) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
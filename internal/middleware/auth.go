@@ -1,12 +1,17 @@
 package middleware
 
 import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
 	"go.uber.org/zap"
 )
 
@@ -27,6 +32,32 @@ func CORS() gin.HandlerFunc {
 	}
 }
 
+// NoStore middleware marks every response as uncacheable unless the handler
+// explicitly opts in, so session and access specific data never ends up in a
+// shared cache by accident
+func NoStore() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+		c.Next()
+	}
+}
+
+// BodyLimit middleware caps request bodies at maxBytes. Reading past the limit
+// fails with an *http.MaxBytesError, which handlers answer with 413; bodies
+// that declare a larger Content-Length are refused up front.
+func BodyLimit(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("Request body exceeds %d bytes", maxBytes),
+			})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
+
 // RequestID middleware adds a unique request ID to each request
 func RequestID() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -73,35 +104,117 @@ func Logger(logger *zap.Logger) gin.HandlerFunc {
 	}
 }
 
-// AuthRequired middleware validates API key or JWT token
-func AuthRequired() gin.HandlerFunc {
+// Context keys set by AuthRequired
+const (
+	// MerchantKey holds the *models.Merchant an API key belongs to
+	MerchantKey = "merchant"
+	// AdminKey is set to true for requests made with the admin API key
+	AdminKey = "admin"
+)
+
+// MerchantAuthenticator resolves an API key to its active merchant
+type MerchantAuthenticator interface {
+	GetMerchantByAPIKey(apiKey string) (*models.Merchant, error)
+}
+
+// HasAPIKey reports whether the request carries an API key where AuthRequired
+// looks for one. Bearer tokens that are JWTs, i.e. content access tokens, do
+// not count.
+func HasAPIKey(c *gin.Context) bool {
+	if c.GetHeader("X-API-Key") != "" {
+		return true
+	}
+	scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	token = strings.TrimSpace(token)
+	return ok && strings.EqualFold(scheme, "Bearer") && token != "" && !strings.Contains(token, ".")
+}
+
+// AuthRequired middleware authenticates the API key sent as
+// "Authorization: Bearer <key>" or in X-API-Key. adminKey authenticates as
+// admin; an empty adminKey disables admin access. Any other key must belong to
+// an active merchant, which is stored in the context under MerchantKey and,
+// when activity is set, marked active.
+func AuthRequired(merchants MerchantAuthenticator, activity *ActivityTracker, adminKey string, logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
+		apiKey := c.GetHeader("X-API-Key")
+		if authHeader := c.GetHeader("Authorization"); apiKey == "" && authHeader != "" {
+			scheme, token, ok := strings.Cut(authHeader, " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format"})
+				return
+			}
+			apiKey = strings.TrimSpace(token)
+		}
+		if apiKey == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
 			return
 		}
 
-		// Check for API key format
-		if strings.HasPrefix(authHeader, "Bearer ") {
-			token := strings.TrimPrefix(authHeader, "Bearer ")
+		if adminKey != "" && subtle.ConstantTimeCompare([]byte(apiKey), []byte(adminKey)) == 1 {
+			c.Set(AdminKey, true)
+			c.Next()
+			return
+		}
 
-			// TODO: Validate JWT token or API key
-			// For now, just check if it's not empty
-			if token == "" {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-				c.Abort()
-				return
-			}
+		merchant, err := merchants.GetMerchantByAPIKey(apiKey)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to authenticate API key", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate"})
+			return
+		}
 
-			// Store the token/user info in context for handlers to use
-			c.Set("token", token)
+		c.Set(MerchantKey, merchant)
+		if activity != nil {
+			activity.Touch(merchant.MerchantID)
+		}
+		c.Next()
+	}
+}
+
+// AdminOnly middleware rejects requests not authenticated with the admin key.
+// It must run after AuthRequired.
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsAdmin(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// MerchantScope middleware limits merchants to routes for their own :id, so a
+// merchant API key cannot read or change another merchant. Admins may act on
+// any merchant. It must run after AuthRequired.
+func MerchantScope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if id == "" || IsAdmin(c) {
 			c.Next()
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format"})
-			c.Abort()
 			return
 		}
+		merchant := CurrentMerchant(c)
+		if merchant == nil || !strings.EqualFold(id, merchant.MerchantID.String()) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Not allowed for this merchant"})
+			return
+		}
+		c.Next()
 	}
 }
+
+// IsAdmin reports whether the request was authenticated with the admin key
+func IsAdmin(c *gin.Context) bool {
+	return c.GetBool(AdminKey)
+}
+
+// CurrentMerchant returns the merchant the request was authenticated as, or
+// nil for admin and unauthenticated requests
+func CurrentMerchant(c *gin.Context) *models.Merchant {
+	value, _ := c.Get(MerchantKey)
+	merchant, _ := value.(*models.Merchant)
+	return merchant
+}
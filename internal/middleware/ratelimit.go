@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/cache"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/validation"
+	"go.uber.org/zap"
+)
+
+// slidingWindowScript keeps the hits of one key as a sorted set scored by time
+// in milliseconds. It drops hits that left the window and records this one
+// unless the limit is reached, returning {1, 0} when allowed and {0, wait}
+// with the milliseconds until the oldest hit leaves the window otherwise.
+//
+// KEYS[1] = key, ARGV = now, window, limit, member
+const slidingWindowScript = `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+  local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+  return {0, tonumber(oldest[2]) + window - now}
+end
+redis.call('ZADD', KEYS[1], now, ARGV[4])
+redis.call('PEXPIRE', KEYS[1], window)
+return {1, 0}
+`
+
+// MerchantDomain returns the merchant domain of a request: the
+// X-Merchant-Domain header when set, otherwise the Host without port,
+// lower-cased
+func MerchantDomain(c *gin.Context) string {
+	domain := c.GetHeader("X-Merchant-Domain")
+	if domain == "" {
+		domain = c.Request.Host
+		if host, _, err := net.SplitHostPort(domain); err == nil {
+			domain = host
+		}
+	}
+	return validation.NormalizeDomain(strings.Trim(domain, "[]"))
+}
+
+// RateLimit middleware allows cfg.IPLimit requests per client IP and
+// cfg.DomainLimit per merchant domain within a sliding cfg.Window; a limit of
+// 0 is not enforced. Counts live in Redis so every instance shares them, and
+// are kept per route. Requests over a limit get a 429 with Retry-After. When
+// Redis cannot be reached in cfg.Timeout the request is let through and a
+// warning is logged, so an outage does not take payments down with it.
+func RateLimit(client cache.Client, cfg config.RateLimitConfig, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !cfg.Enabled {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), cfg.Timeout)
+		defer cancel()
+
+		prefix := "ratelimit:" + c.FullPath()
+		limits := []struct {
+			key   string
+			limit int
+		}{
+			{prefix + ":ip:" + c.ClientIP(), cfg.IPLimit},
+			{prefix + ":domain:" + MerchantDomain(c), cfg.DomainLimit},
+		}
+		for _, l := range limits {
+			if l.limit <= 0 {
+				continue
+			}
+			wait, err := hit(ctx, client, l.key, l.limit, cfg.Window)
+			if err != nil {
+				logger.Warn("Rate limit unavailable, allowing request", zap.Error(err), zap.String("key", l.key))
+				c.Next()
+				return
+			}
+			if wait > 0 {
+				seconds := int((wait + time.Second - 1) / time.Second)
+				c.Header("Retry-After", strconv.Itoa(seconds))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// hit records a request against key and returns how long to wait when the
+// limit is reached, or 0 when the request is allowed
+func hit(ctx context.Context, client cache.Client, key string, limit int, window time.Duration) (time.Duration, error) {
+	member := make([]byte, 8)
+	if _, err := rand.Read(member); err != nil {
+		return 0, err
+	}
+	now := time.Now().UnixMilli()
+
+	reply, err := client.Eval(ctx, slidingWindowScript, []string{key},
+		strconv.FormatInt(now, 10),
+		strconv.FormatInt(window.Milliseconds(), 10),
+		strconv.Itoa(limit),
+		strconv.FormatInt(now, 10)+"-"+hex.EncodeToString(member),
+	)
+	if err != nil {
+		return 0, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return 0, fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	wait, _ := values[1].(int64)
+	if allowed == 1 {
+		return 0, nil
+	}
+	return max(time.Duration(wait)*time.Millisecond, time.Millisecond), nil
+}
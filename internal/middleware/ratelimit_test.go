@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"go.uber.org/zap"
+)
+
+// fakeCache answers every Eval with reply and err, or with the context error
+// once the context is done when block is set, and records the keys it was
+// asked about
+type fakeCache struct {
+	reply interface{}
+	err   error
+	block bool
+
+	mu   sync.Mutex
+	keys []string
+}
+
+func (f *fakeCache) Do(ctx context.Context, args ...string) (interface{}, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeCache) Eval(ctx context.Context, script string, keys []string, args ...string) (interface{}, error) {
+	f.mu.Lock()
+	f.keys = append(f.keys, keys...)
+	f.mu.Unlock()
+	if f.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return f.reply, f.err
+}
+
+func (f *fakeCache) Ping(ctx context.Context) error { return nil }
+
+func (f *fakeCache) Close() error { return nil }
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	allowed := []interface{}{int64(1), int64(0)}
+	blocked := func(waitMillis int64) []interface{} {
+		return []interface{}{int64(0), waitMillis}
+	}
+	const (
+		ipKey     = "ratelimit:/api/v1/payments/:ip:192.0.2.1"
+		domainKey = "ratelimit:/api/v1/payments/:domain:shop.example.com"
+	)
+	tests := []struct {
+		name           string
+		cache          *fakeCache
+		disabled       bool
+		ipLimit        int
+		domainLimit    int
+		wantStatus     int
+		wantRetryAfter string
+		wantKeys       []string
+	}{
+		{"allowed", &fakeCache{reply: allowed}, false, 20, 1000, http.StatusCreated, "", []string{ipKey, domainKey}},
+		{"blocked", &fakeCache{reply: blocked(1500)}, false, 20, 1000, http.StatusTooManyRequests, "2", []string{ipKey}},
+		{"blocked for whole seconds", &fakeCache{reply: blocked(3000)}, false, 20, 1000, http.StatusTooManyRequests, "3", []string{ipKey}},
+		{"blocked for under a second", &fakeCache{reply: blocked(1)}, false, 20, 1000, http.StatusTooManyRequests, "1", []string{ipKey}},
+		{"zero wait is still a second", &fakeCache{reply: blocked(0)}, false, 20, 1000, http.StatusTooManyRequests, "1", []string{ipKey}},
+		{"limits of 0 are not enforced", &fakeCache{reply: blocked(1500)}, false, 0, 0, http.StatusCreated, "", nil},
+		{"only the domain limit", &fakeCache{reply: allowed}, false, 0, 1000, http.StatusCreated, "", []string{domainKey}},
+		{"disabled", &fakeCache{reply: blocked(1500)}, true, 20, 1000, http.StatusCreated, "", nil},
+		{"redis error fails open", &fakeCache{err: errors.New("connection refused")}, false, 20, 1000, http.StatusCreated, "", []string{ipKey}},
+		{"redis timeout fails open", &fakeCache{block: true}, false, 20, 1000, http.StatusCreated, "", []string{ipKey}},
+		{"unexpected reply fails open", &fakeCache{reply: "OK"}, false, 20, 1000, http.StatusCreated, "", []string{ipKey}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.RateLimitConfig{
+				Enabled:     !tt.disabled,
+				IPLimit:     tt.ipLimit,
+				DomainLimit: tt.domainLimit,
+				Window:      time.Minute,
+				Timeout:     20 * time.Millisecond,
+			}
+			router := gin.New()
+			router.POST("/api/v1/payments/", RateLimit(tt.cache, cfg, zap.NewNop()), func(c *gin.Context) {
+				c.Status(http.StatusCreated)
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/payments/", nil)
+			req.RemoteAddr = "192.0.2.1:50000"
+			req.Host = "Shop.Example.com:8080"
+			start := time.Now()
+			router.ServeHTTP(w, req)
+
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("request took %v, want it bounded by the timeout", elapsed)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			if !reflect.DeepEqual(tt.cache.keys, tt.wantKeys) {
+				t.Errorf("keys = %v, want %v", tt.cache.keys, tt.wantKeys)
+			}
+		})
+	}
+}
@@ -2,7 +2,10 @@ package models
 
 import (
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,86 +13,146 @@ import (
 
 // Merchant represents a merchant in the system
 type Merchant struct {
-	MerchantID      uuid.UUID              `json:"merchant_id" db:"merchant_id"`
-	Name            string                 `json:"name" db:"name"`
-	Email           string                 `json:"email" db:"email"`
-	Domain          string                 `json:"domain" db:"domain"`
-	BankAccountIBAN string                 `json:"bank_account_iban" db:"bank_account_iban"`
-	BankAccountBIC  *string                `json:"bank_account_bic,omitempty" db:"bank_account_bic"`
-	WebhookURL      *string                `json:"webhook_url,omitempty" db:"webhook_url"`
-	WebhookSecret   *string                `json:"webhook_secret,omitempty" db:"webhook_secret"`
-	APIKey          string                 `json:"api_key" db:"api_key"`
-	Status          MerchantStatus         `json:"status" db:"status"`
-	PricingTier     string                 `json:"pricing_tier" db:"pricing_tier"`
-	CreatedAt       time.Time              `json:"created_at" db:"created_at"`
-	UpdatedAt       time.Time              `json:"updated_at" db:"updated_at"`
-	LastActiveAt    *time.Time             `json:"last_active_at,omitempty" db:"last_active_at"`
-	Settings        map[string]interface{} `json:"settings" db:"settings"`
-	Metadata        map[string]interface{} `json:"metadata" db:"metadata"`
+	MerchantID                     uuid.UUID      `json:"merchant_id" db:"merchant_id"`
+	Name                           string         `json:"name" db:"name"`
+	Email                          string         `json:"email" db:"email"`
+	Domain                         string         `json:"domain" db:"domain"`
+	BankAccountIBAN                string         `json:"bank_account_iban" db:"bank_account_iban"`
+	BankAccountBIC                 *string        `json:"bank_account_bic,omitempty" db:"bank_account_bic"`
+	WebhookURL                     *string        `json:"webhook_url,omitempty" db:"webhook_url"`
+	BackendURL                     *string        `json:"backend_url,omitempty" db:"backend_url"`
+	WebhookSecret                  *string        `json:"webhook_secret,omitempty" db:"webhook_secret"`
+	WebhookSecretPrevious          *string        `json:"webhook_secret_previous,omitempty" db:"webhook_secret_previous"`
+	WebhookSecretPreviousExpiresAt *time.Time     `json:"webhook_secret_previous_expires_at,omitempty" db:"webhook_secret_previous_expires_at"`
+	APIKey                         string         `json:"-" db:"api_key"`
+	APIKeyPreviousExpiresAt        *time.Time     `json:"api_key_previous_expires_at,omitempty" db:"api_key_previous_expires_at"`
+	Status                         MerchantStatus `json:"status" db:"status"`
+	PricingTier                    PricingTier    `json:"pricing_tier" db:"pricing_tier"`
+	CreatedAt                      time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt                      time.Time      `json:"updated_at" db:"updated_at"`
+	LastActiveAt                   *time.Time     `json:"last_active_at,omitempty" db:"last_active_at"`
+	Settings                       JSONMap        `json:"settings" db:"settings"`
+	Metadata                       JSONMap        `json:"metadata" db:"metadata"`
+}
+
+// MerchantWebhook is an additional webhook endpoint of a merchant. Secrets are
+// only ever shown when they are issued. An empty Events list subscribes to
+// every event.
+type MerchantWebhook struct {
+	WebhookID               uuid.UUID  `json:"webhook_id" db:"webhook_id"`
+	MerchantID              uuid.UUID  `json:"merchant_id" db:"merchant_id"`
+	URL                     string     `json:"url" db:"url"`
+	Secret                  string     `json:"-" db:"secret"`
+	SecretPrevious          *string    `json:"-" db:"secret_previous"`
+	SecretPreviousExpiresAt *time.Time `json:"secret_previous_expires_at,omitempty" db:"secret_previous_expires_at"`
+	Events                  []string   `json:"events" db:"events"`
+	IsActive                bool       `json:"is_active" db:"is_active"`
+	CreatedAt               time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 // Content represents content that can be accessed via payment
 type Content struct {
-	ContentID             uuid.UUID              `json:"content_id" db:"content_id"`
-	MerchantID            uuid.UUID              `json:"merchant_id" db:"merchant_id"`
-	Path                  string                 `json:"path" db:"path"`
-	Title                 *string                `json:"title,omitempty" db:"title"`
-	Description           *string                `json:"description,omitempty" db:"description"`
-	PriceCents            int                    `json:"price_cents" db:"price_cents"`
-	Currency              string                 `json:"currency" db:"currency"`
-	AccessDurationSeconds int                    `json:"access_duration_seconds" db:"access_duration_seconds"`
-	ContentType           ContentType            `json:"content_type" db:"content_type"`
-	AccessRules           map[string]interface{} `json:"access_rules" db:"access_rules"`
-	IsActive              bool                   `json:"is_active" db:"is_active"`
-	CreatedAt             time.Time              `json:"created_at" db:"created_at"`
-	UpdatedAt             time.Time              `json:"updated_at" db:"updated_at"`
+	ContentID             uuid.UUID   `json:"content_id" db:"content_id"`
+	MerchantID            uuid.UUID   `json:"merchant_id" db:"merchant_id"`
+	Path                  string      `json:"path" db:"path"`
+	Title                 *string     `json:"title,omitempty" db:"title"`
+	Description           *string     `json:"description,omitempty" db:"description"`
+	PriceCents            int         `json:"price_cents" db:"price_cents"`
+	Currency              string      `json:"currency" db:"currency"`
+	CurrencyMinorUnits    int         `json:"currency_minor_units" db:"-"`
+	AccessDurationSeconds int         `json:"access_duration_seconds" db:"access_duration_seconds"`
+	ContentType           ContentType `json:"content_type" db:"content_type"`
+	AccessRules           JSONMap     `json:"access_rules" db:"access_rules"`
+	IsActive              bool        `json:"is_active" db:"is_active"`
+	CreatedAt             time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt             time.Time   `json:"updated_at" db:"updated_at"`
 }
 
 // PaymentSession represents a payment session for accessing content
 type PaymentSession struct {
-	SessionID        uuid.UUID              `json:"session_id" db:"session_id"`
-	MerchantID       uuid.UUID              `json:"merchant_id" db:"merchant_id"`
-	ContentID        uuid.UUID              `json:"content_id" db:"content_id"`
-	UserIdentifier   *string                `json:"user_identifier,omitempty" db:"user_identifier"`
-	AmountCents      int                    `json:"amount_cents" db:"amount_cents"`
-	Currency         string                 `json:"currency" db:"currency"`
-	PaymentReference string                 `json:"payment_reference" db:"payment_reference"`
-	QRCodeData       string                 `json:"qr_code_data" db:"qr_code_data"`
-	Status           PaymentStatus          `json:"status" db:"status"`
-	ExpiresAt        time.Time              `json:"expires_at" db:"expires_at"`
-	CreatedAt        time.Time              `json:"created_at" db:"created_at"`
-	PaidAt           *time.Time             `json:"paid_at,omitempty" db:"paid_at"`
-	AccessGrantedAt  *time.Time             `json:"access_granted_at,omitempty" db:"access_granted_at"`
-	AccessExpiresAt  *time.Time             `json:"access_expires_at,omitempty" db:"access_expires_at"`
-	UserAgent        *string                `json:"user_agent,omitempty" db:"user_agent"`
-	IPAddress        *string                `json:"ip_address,omitempty" db:"ip_address"`
-	Metadata         map[string]interface{} `json:"metadata" db:"metadata"`
+	SessionID        uuid.UUID     `json:"session_id" db:"session_id"`
+	MerchantID       uuid.UUID     `json:"merchant_id" db:"merchant_id"`
+	ContentID        uuid.UUID     `json:"content_id" db:"content_id"`
+	UserIdentifier   *string       `json:"user_identifier,omitempty" db:"user_identifier"`
+	AmountCents      int           `json:"amount_cents" db:"amount_cents"`
+	PlatformFeeCents int           `json:"platform_fee_cents" db:"platform_fee_cents"`
+	VATCents         int           `json:"vat_cents" db:"vat_cents"`
+	NetCents         int           `json:"net_cents" db:"net_cents"`
+	Currency         string        `json:"currency" db:"currency"`
+	PaymentReference string        `json:"payment_reference" db:"payment_reference"`
+	QRCodeData       string        `json:"qr_code_data" db:"qr_code_data"`
+	Status           PaymentStatus `json:"status" db:"status"`
+	ExpiresAt        time.Time     `json:"expires_at" db:"expires_at"`
+	CreatedAt        time.Time     `json:"created_at" db:"created_at"`
+	PaidAt           *time.Time    `json:"paid_at,omitempty" db:"paid_at"`
+	AccessGrantedAt  *time.Time    `json:"access_granted_at,omitempty" db:"access_granted_at"`
+	AccessExpiresAt  *time.Time    `json:"access_expires_at,omitempty" db:"access_expires_at"`
+	RefundedAt       *time.Time    `json:"refunded_at,omitempty" db:"refunded_at"`
+	UserAgent        *string       `json:"user_agent,omitempty" db:"user_agent"`
+	IPAddress        *string       `json:"ip_address,omitempty" db:"ip_address"`
+	Metadata         JSONMap       `json:"metadata" db:"metadata"`
+	// DisplayAmountCents and DisplayCurrency are the content price when it was
+	// converted at ExchangeRate into the currency the merchant's account
+	// settles in, which AmountCents and Currency are in. Nil otherwise.
+	DisplayAmountCents *int     `json:"display_amount_cents,omitempty" db:"display_amount_cents"`
+	DisplayCurrency    *string  `json:"display_currency,omitempty" db:"display_currency"`
+	ExchangeRate       *float64 `json:"exchange_rate,omitempty" db:"exchange_rate"`
+	// RenewsAt is when a paid subscription needs its next payment: the end of
+	// the user's access to the content, which later renewals may have moved
+	// past this session's own access_expires_at. Nil for other content.
+	RenewsAt *time.Time `json:"renews_at,omitempty" db:"-"`
 }
 
 // BankTransaction represents a transaction from bank API
 type BankTransaction struct {
-	TransactionID    uuid.UUID               `json:"transaction_id" db:"transaction_id"`
-	MerchantID       *uuid.UUID              `json:"merchant_id,omitempty" db:"merchant_id"`
-	BankReference    *string                 `json:"bank_reference,omitempty" db:"bank_reference"`
-	PaymentReference *string                 `json:"payment_reference,omitempty" db:"payment_reference"`
-	AmountCents      int                     `json:"amount_cents" db:"amount_cents"`
-	Currency         string                  `json:"currency" db:"currency"`
-	DebtorName       *string                 `json:"debtor_name,omitempty" db:"debtor_name"`
-	DebtorIBAN       *string                 `json:"debtor_iban,omitempty" db:"debtor_iban"`
-	CreditorIBAN     string                  `json:"creditor_iban" db:"creditor_iban"`
-	TransactionDate  time.Time               `json:"transaction_date" db:"transaction_date"`
-	BookingDate      time.Time               `json:"booking_date" db:"booking_date"`
-	ValueDate        *time.Time              `json:"value_date,omitempty" db:"value_date"`
-	Status           TransactionStatus       `json:"status" db:"status"`
-	ProcessedAt      *time.Time              `json:"processed_at,omitempty" db:"processed_at"`
-	RawData          *map[string]interface{} `json:"raw_data,omitempty" db:"raw_data"`
-	CreatedAt        time.Time               `json:"created_at" db:"created_at"`
+	TransactionID    uuid.UUID         `json:"transaction_id" db:"transaction_id"`
+	MerchantID       *uuid.UUID        `json:"merchant_id,omitempty" db:"merchant_id"`
+	BankReference    *string           `json:"bank_reference,omitempty" db:"bank_reference"`
+	PaymentReference *string           `json:"payment_reference,omitempty" db:"payment_reference"`
+	AmountCents      int               `json:"amount_cents" db:"amount_cents"`
+	Currency         string            `json:"currency" db:"currency"`
+	DebtorName       *string           `json:"debtor_name,omitempty" db:"debtor_name"`
+	DebtorIBAN       *string           `json:"debtor_iban,omitempty" db:"debtor_iban"`
+	CreditorIBAN     string            `json:"creditor_iban" db:"creditor_iban"`
+	TransactionDate  time.Time         `json:"transaction_date" db:"transaction_date"`
+	BookingDate      time.Time         `json:"booking_date" db:"booking_date"`
+	ValueDate        *time.Time        `json:"value_date,omitempty" db:"value_date"`
+	Status           TransactionStatus `json:"status" db:"status"`
+	ProcessedAt      *time.Time        `json:"processed_at,omitempty" db:"processed_at"`
+	RawData          *JSONMap          `json:"raw_data,omitempty" db:"raw_data"`
+	MatchAudit       *JSONMap          `json:"match_audit,omitempty" db:"match_audit"`
+	CreatedAt        time.Time         `json:"created_at" db:"created_at"`
+	// PayerClient is the client that created the matched session, set on
+	// single transaction lookups
+	PayerClient *SessionClient `json:"payer_client,omitempty" db:"-"`
+}
+
+// AuditEntry records an administrative action: who took it, in which request,
+// and on what
+type AuditEntry struct {
+	AuditID    uuid.UUID `json:"audit_id" db:"audit_id"`
+	Actor      string    `json:"actor" db:"actor"`
+	Action     string    `json:"action" db:"action"`
+	TargetType string    `json:"target_type" db:"target_type"`
+	TargetID   string    `json:"target_id" db:"target_id"`
+	Metadata   JSONMap   `json:"metadata" db:"metadata"`
+	RequestID  *string   `json:"request_id,omitempty" db:"request_id"`
+	IPAddress  *string   `json:"ip_address,omitempty" db:"ip_address"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// SessionClient is the client a payment session was created from
+type SessionClient struct {
+	SessionID uuid.UUID `json:"session_id"`
+	UserAgent *string   `json:"user_agent,omitempty"`
+	IPAddress *string   `json:"ip_address,omitempty"`
 }
 
 // ContentAccess represents access granted to content
 type ContentAccess struct {
 	AccessID       uuid.UUID  `json:"access_id" db:"access_id"`
-	SessionID      uuid.UUID  `json:"session_id" db:"session_id"`
+	SessionID      *uuid.UUID `json:"session_id,omitempty" db:"session_id"`
 	MerchantID     uuid.UUID  `json:"merchant_id" db:"merchant_id"`
 	ContentID      uuid.UUID  `json:"content_id" db:"content_id"`
 	UserIdentifier string     `json:"user_identifier" db:"user_identifier"`
@@ -100,6 +163,102 @@ type ContentAccess struct {
 	IPAddress      *string    `json:"ip_address,omitempty" db:"ip_address"`
 	UserAgent      *string    `json:"user_agent,omitempty" db:"user_agent"`
 	IsActive       bool       `json:"is_active" db:"is_active"`
+	IsFreeTrial    bool       `json:"is_free_trial" db:"is_free_trial"`
+}
+
+// Dispute tracks a chargeback or bank reversal against a paid session
+type Dispute struct {
+	DisputeID     uuid.UUID     `json:"dispute_id" db:"dispute_id"`
+	MerchantID    uuid.UUID     `json:"merchant_id" db:"merchant_id"`
+	SessionID     uuid.UUID     `json:"session_id" db:"session_id"`
+	TransactionID *uuid.UUID    `json:"transaction_id,omitempty" db:"transaction_id"`
+	Status        DisputeStatus `json:"status" db:"status"`
+	Reason        string        `json:"reason" db:"reason"`
+	FreezeAccess  bool          `json:"freeze_access" db:"freeze_access"`
+	CreatedAt     time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at" db:"updated_at"`
+	ClosedAt      *time.Time    `json:"closed_at,omitempty" db:"closed_at"`
+	Notes         []DisputeNote `json:"notes,omitempty" db:"-"`
+}
+
+// DisputeNote is a note or piece of evidence recorded on a dispute. Status
+// transitions are recorded as notes with FromStatus and ToStatus set.
+type DisputeNote struct {
+	NoteID      uuid.UUID      `json:"note_id" db:"note_id"`
+	DisputeID   uuid.UUID      `json:"dispute_id" db:"dispute_id"`
+	Author      *string        `json:"author,omitempty" db:"author"`
+	Note        string         `json:"note" db:"note"`
+	EvidenceURL *string        `json:"evidence_url,omitempty" db:"evidence_url"`
+	FromStatus  *DisputeStatus `json:"from_status,omitempty" db:"from_status"`
+	ToStatus    *DisputeStatus `json:"to_status,omitempty" db:"to_status"`
+	CreatedAt   time.Time      `json:"created_at" db:"created_at"`
+}
+
+// AllowsContentType reports whether the merchant may create content of type
+// ct. The "content_types" setting lists the permitted types; merchants without
+// it may use every type.
+func (m *Merchant) AllowsContentType(ct ContentType) bool {
+	allowed, ok := m.Settings["content_types"].([]interface{})
+	if !ok {
+		return true
+	}
+	for _, v := range allowed {
+		if s, ok := v.(string); ok && ContentType(s) == ct {
+			return true
+		}
+	}
+	return false
+}
+
+// LegallyBlocks reports whether the merchant's "legal_blocked_countries"
+// setting lists country, which makes all its content unavailable there
+func (m *Merchant) LegallyBlocks(country string) bool {
+	blocked, _ := m.Settings["legal_blocked_countries"].([]interface{})
+	for _, v := range blocked {
+		if s, ok := v.(string); ok && strings.EqualFold(s, country) {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionTimeoutSetting is the merchant setting that overrides
+// payment.session_timeout, in seconds
+const SessionTimeoutSetting = "session_timeout_seconds"
+
+// MinSessionTimeout is the shortest session timeout a merchant can set
+const MinSessionTimeout = time.Minute
+
+// SessionTimeoutOverride returns the session timeout set in settings when it
+// is a whole number of seconds from MinSessionTimeout up to max
+func SessionTimeoutOverride(settings JSONMap, max time.Duration) (time.Duration, bool) {
+	seconds, ok := settings[SessionTimeoutSetting].(float64)
+	if !ok || seconds < MinSessionTimeout.Seconds() || seconds > max.Seconds() || seconds != math.Trunc(seconds) {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// SessionTimeout returns how long the merchant's payment sessions stay open:
+// its session_timeout_seconds setting, or fallback when that is unset or not
+// between MinSessionTimeout and max
+func (m *Merchant) SessionTimeout(fallback, max time.Duration) time.Duration {
+	if timeout, ok := SessionTimeoutOverride(m.Settings, max); ok {
+		return timeout
+	}
+	return fallback
+}
+
+// BoolSetting returns the boolean merchant setting for key, or false when unset
+func (m *Merchant) BoolSetting(key string) bool {
+	v, _ := m.Settings[key].(bool)
+	return v
+}
+
+// StringRule returns the string access rule for key, or "" when unset
+func (c *Content) StringRule(key string) string {
+	v, _ := c.AccessRules[key].(string)
+	return v
 }
 
 // Enum types
@@ -112,6 +271,61 @@ const (
 	MerchantStatusDeactivated MerchantStatus = "deactivated"
 )
 
+// PricingTier is the plan a merchant is on. It picks the fee schedule
+// (fees.tiers) and the limits in TierLimits.
+type PricingTier string
+
+const (
+	PricingTierFree       PricingTier = "free"
+	PricingTierBasic      PricingTier = "basic"
+	PricingTierPro        PricingTier = "pro"
+	PricingTierEnterprise PricingTier = "enterprise"
+)
+
+// PricingTiers lists every pricing tier
+var PricingTiers = []PricingTier{
+	PricingTierFree,
+	PricingTierBasic,
+	PricingTierPro,
+	PricingTierEnterprise,
+}
+
+// Valid reports whether pt is one of PricingTiers
+func (pt PricingTier) Valid() bool {
+	for _, t := range PricingTiers {
+		if t == pt {
+			return true
+		}
+	}
+	return false
+}
+
+// TierLimits caps what a merchant may use on a pricing tier; 0 is unlimited
+type TierLimits struct {
+	// MaxContent is the number of active content items
+	MaxContent int `json:"max_content"`
+	// MonthlySessions is the number of payment sessions per calendar month (UTC)
+	MonthlySessions int `json:"monthly_sessions"`
+	// MaxWebhooks is the number of webhook endpoints besides webhook_url
+	MaxWebhooks int `json:"max_webhooks"`
+}
+
+var tierLimits = map[PricingTier]TierLimits{
+	PricingTierFree:       {MaxContent: 10, MonthlySessions: 1000, MaxWebhooks: 1},
+	PricingTierBasic:      {MaxContent: 100, MonthlySessions: 10000, MaxWebhooks: 3},
+	PricingTierPro:        {MaxContent: 1000, MonthlySessions: 100000, MaxWebhooks: 10},
+	PricingTierEnterprise: {},
+}
+
+// Limits returns the limits of the tier. Merchants stored with a tier this
+// version does not know get those of basic, the schema default.
+func (pt PricingTier) Limits() TierLimits {
+	if limits, ok := tierLimits[pt]; ok {
+		return limits
+	}
+	return tierLimits[PricingTierBasic]
+}
+
 type ContentType string
 
 const (
@@ -122,6 +336,25 @@ const (
 	ContentTypeSubscription   ContentType = "subscription"
 )
 
+// ContentTypes lists every content type
+var ContentTypes = []ContentType{
+	ContentTypeWebpage,
+	ContentTypeAPIEndpoint,
+	ContentTypeFileDownload,
+	ContentTypeStreamingMedia,
+	ContentTypeSubscription,
+}
+
+// Valid reports whether ct is one of ContentTypes
+func (ct ContentType) Valid() bool {
+	for _, t := range ContentTypes {
+		if t == ct {
+			return true
+		}
+	}
+	return false
+}
+
 type PaymentStatus string
 
 const (
@@ -141,8 +374,24 @@ const (
 	TransactionStatusProcessed TransactionStatus = "processed"
 	TransactionStatusIgnored   TransactionStatus = "ignored"
 	TransactionStatusDisputed  TransactionStatus = "disputed"
+	TransactionStatusReturned  TransactionStatus = "returned"
 )
 
+type DisputeStatus string
+
+const (
+	DisputeStatusOpen        DisputeStatus = "open"
+	DisputeStatusUnderReview DisputeStatus = "under_review"
+	DisputeStatusResolved    DisputeStatus = "resolved"
+	DisputeStatusLost        DisputeStatus = "lost"
+	DisputeStatusWon         DisputeStatus = "won"
+)
+
+// Closed reports whether the dispute has reached a final status
+func (ds DisputeStatus) Closed() bool {
+	return ds == DisputeStatusResolved || ds == DisputeStatusLost || ds == DisputeStatusWon
+}
+
 // Implement Valuer and Scanner interfaces for custom types to work with database/sql
 
 func (ms MerchantStatus) Value() (driver.Value, error) {
@@ -161,6 +410,26 @@ func (ms *MerchantStatus) Scan(value interface{}) error {
 	return fmt.Errorf("cannot scan %T into MerchantStatus", value)
 }
 
+func (pt PricingTier) Value() (driver.Value, error) {
+	return string(pt), nil
+}
+
+func (pt *PricingTier) Scan(value interface{}) error {
+	if value == nil {
+		*pt = ""
+		return nil
+	}
+	switch v := value.(type) {
+	case string:
+		*pt = PricingTier(v)
+		return nil
+	case []byte:
+		*pt = PricingTier(v)
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into PricingTier", value)
+}
+
 func (ct ContentType) Value() (driver.Value, error) {
 	return string(ct), nil
 }
@@ -208,3 +477,62 @@ func (ts *TransactionStatus) Scan(value interface{}) error {
 	}
 	return fmt.Errorf("cannot scan %T into TransactionStatus", value)
 }
+
+func (ds DisputeStatus) Value() (driver.Value, error) {
+	return string(ds), nil
+}
+
+func (ds *DisputeStatus) Scan(value interface{}) error {
+	if value == nil {
+		*ds = ""
+		return nil
+	}
+	switch v := value.(type) {
+	case string:
+		*ds = DisputeStatus(v)
+		return nil
+	case []byte:
+		*ds = DisputeStatus(v)
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into DisputeStatus", value)
+}
+
+// JSONMap is a JSONB object column. NULL scans as an empty map, and so does a
+// value that is not a JSON object, so one bad row cannot fail a whole listing.
+// A nil map is stored as an empty object.
+type JSONMap map[string]interface{}
+
+func (m JSONMap) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(map[string]interface{}(m))
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode JSONMap: %w", err)
+	}
+	return string(b), nil
+}
+
+func (m *JSONMap) Scan(value interface{}) error {
+	var raw []byte
+	switch v := value.(type) {
+	case nil:
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into JSONMap", value)
+	}
+
+	*m = JSONMap{}
+	if len(raw) == 0 {
+		return nil
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(raw, &decoded); err == nil && decoded != nil {
+		*m = decoded
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJSONMapValue(t *testing.T) {
+	tests := []struct {
+		name string
+		m    JSONMap
+		want string
+	}{
+		{"nil", nil, "{}"},
+		{"empty", JSONMap{}, "{}"},
+		{"flat", JSONMap{"locale": "nl-NL"}, `{"locale":"nl-NL"}`},
+		{"nested", JSONMap{"rules": map[string]interface{}{"free_methods": []interface{}{"GET"}}}, `{"rules":{"free_methods":["GET"]}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.Value()
+			if err != nil {
+				t.Fatalf("Value() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Value() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONMapScan(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  JSONMap
+	}{
+		{"NULL", nil, JSONMap{}},
+		{"empty bytes", []byte{}, JSONMap{}},
+		{"empty object", []byte("{}"), JSONMap{}},
+		{"string", `{"cap":1024}`, JSONMap{"cap": 1024.0}},
+		{"nested", []byte(`{"a":{"b":[1,"x",null]}}`), JSONMap{"a": map[string]interface{}{"b": []interface{}{1.0, "x", nil}}}},
+		{"JSON null", []byte("null"), JSONMap{}},
+		{"array", []byte(`[1,2]`), JSONMap{}},
+		{"number", []byte(`42`), JSONMap{}},
+		{"malformed", []byte(`{"a":`), JSONMap{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := JSONMap{"stale": true}
+			if err := m.Scan(tt.value); err != nil {
+				t.Fatalf("Scan() error = %v", err)
+			}
+			if !reflect.DeepEqual(m, tt.want) {
+				t.Errorf("Scan() = %#v, want %#v", m, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONMapScanUnsupportedType(t *testing.T) {
+	var m JSONMap
+	if err := m.Scan(42); err == nil {
+		t.Error("Scan(int) succeeded, want an error")
+	}
+}
+
+func TestJSONMapRoundTrip(t *testing.T) {
+	for _, m := range []JSONMap{
+		nil,
+		{},
+		{"settings": map[string]interface{}{"timezone": "Europe/Amsterdam", "enabled": true}, "count": 3.0},
+	} {
+		value, err := m.Value()
+		if err != nil {
+			t.Fatalf("Value() error = %v", err)
+		}
+		var got JSONMap
+		if err := got.Scan(value); err != nil {
+			t.Fatalf("Scan(%v) error = %v", value, err)
+		}
+		want := m
+		if want == nil {
+			want = JSONMap{}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("round trip of %#v = %#v", m, got)
+		}
+	}
+}
+
+func TestSessionTimeout(t *testing.T) {
+	fallback, max := 15*time.Minute, 24*time.Hour
+	tests := []struct {
+		name     string
+		settings JSONMap
+		want     time.Duration
+		wantOK   bool
+	}{
+		{"unset", nil, fallback, false},
+		{"other settings only", JSONMap{"locale": "nl-NL"}, fallback, false},
+		{"override", JSONMap{SessionTimeoutSetting: 1800.0}, 30 * time.Minute, true},
+		{"minimum", JSONMap{SessionTimeoutSetting: 60.0}, MinSessionTimeout, true},
+		{"below the minimum", JSONMap{SessionTimeoutSetting: 59.0}, fallback, false},
+		{"maximum", JSONMap{SessionTimeoutSetting: 86400.0}, max, true},
+		{"above the maximum", JSONMap{SessionTimeoutSetting: 86401.0}, fallback, false},
+		{"zero", JSONMap{SessionTimeoutSetting: 0.0}, fallback, false},
+		{"negative", JSONMap{SessionTimeoutSetting: -600.0}, fallback, false},
+		{"fractional seconds", JSONMap{SessionTimeoutSetting: 90.5}, fallback, false},
+		{"string", JSONMap{SessionTimeoutSetting: "1800"}, fallback, false},
+		{"null", JSONMap{SessionTimeoutSetting: nil}, fallback, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			override, ok := SessionTimeoutOverride(tt.settings, max)
+			if ok != tt.wantOK || (ok && override != tt.want) || (!ok && override != 0) {
+				t.Errorf("SessionTimeoutOverride() = %s, %v, want ok %v", override, ok, tt.wantOK)
+			}
+			merchant := &Merchant{Settings: tt.settings}
+			if got := merchant.SessionTimeout(fallback, max); got != tt.want {
+				t.Errorf("SessionTimeout() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
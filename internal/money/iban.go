@@ -0,0 +1,33 @@
+package money
+
+import "strings"
+
+// ibanCurrencies maps the country code of SEPA IBANs to the currency accounts in
+// that country are held in. Countries outside the euro area keep their own
+// currency even though they take part in SEPA.
+var ibanCurrencies = map[string]string{
+	"AT": "EUR", "BE": "EUR", "CY": "EUR", "DE": "EUR", "EE": "EUR",
+	"ES": "EUR", "FI": "EUR", "FR": "EUR", "GR": "EUR", "HR": "EUR",
+	"IE": "EUR", "IT": "EUR", "LT": "EUR", "LU": "EUR", "LV": "EUR",
+	"MC": "EUR", "MT": "EUR", "NL": "EUR", "PT": "EUR", "SI": "EUR",
+	"SK": "EUR", "SM": "EUR", "AD": "EUR", "VA": "EUR",
+	"BG": "BGN", "CH": "CHF", "CZ": "CZK", "DK": "DKK", "GB": "GBP",
+	"GI": "GBP", "HU": "HUF", "IS": "ISK", "LI": "CHF", "NO": "NOK",
+	"PL": "PLN", "RO": "RON", "SE": "SEK",
+}
+
+// IBANCurrency returns the currency an IBAN settles in, derived from its country
+// code. ok is false for countries the mapping does not cover.
+func IBANCurrency(iban string) (string, bool) {
+	iban = NormalizeIBAN(iban)
+	if len(iban) < 2 {
+		return "", false
+	}
+	currency, ok := ibanCurrencies[iban[:2]]
+	return currency, ok
+}
+
+// NormalizeIBAN strips spaces and upper-cases an IBAN as typed by a person
+func NormalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(iban), " ", ""))
+}
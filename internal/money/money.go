@@ -0,0 +1,225 @@
+package money
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Currency describes how amounts in a currency are denominated and displayed
+type Currency struct {
+	Code     string
+	Exponent int
+	Symbol   string
+}
+
+// currencies lists the currencies the formatter has a symbol for. Amounts are
+// always stored as integers in the currency's minor unit; Exponent is the number
+// of minor-unit digits (2 for EUR cents, 0 for JPY).
+var currencies = map[string]Currency{
+	"EUR": {Code: "EUR", Exponent: 2, Symbol: "€"},
+	"USD": {Code: "USD", Exponent: 2, Symbol: "$"},
+	"GBP": {Code: "GBP", Exponent: 2, Symbol: "£"},
+	"CHF": {Code: "CHF", Exponent: 2, Symbol: "CHF"},
+	"SEK": {Code: "SEK", Exponent: 2, Symbol: "kr"},
+	"NOK": {Code: "NOK", Exponent: 2, Symbol: "kr"},
+	"DKK": {Code: "DKK", Exponent: 2, Symbol: "kr."},
+	"PLN": {Code: "PLN", Exponent: 2, Symbol: "zł"},
+	"CZK": {Code: "CZK", Exponent: 2, Symbol: "Kč"},
+	"HUF": {Code: "HUF", Exponent: 2, Symbol: "Ft"},
+	"JPY": {Code: "JPY", Exponent: 0, Symbol: "¥"},
+	"KRW": {Code: "KRW", Exponent: 0, Symbol: "₩"},
+	"ISK": {Code: "ISK", Exponent: 0, Symbol: "kr"},
+	"KWD": {Code: "KWD", Exponent: 3, Symbol: "KD"},
+	"BHD": {Code: "BHD", Exponent: 3, Symbol: "BD"},
+}
+
+// Lookup returns the currency for an ISO 4217 code. Currencies without a known
+// symbol use the code itself; codes that are not in ISO 4217 at all fall back
+// to two minor-unit digits.
+func Lookup(code string) Currency {
+	code = strings.ToUpper(code)
+	if c, ok := currencies[code]; ok {
+		return c
+	}
+	exponent, ok := MinorUnits(code)
+	if !ok {
+		exponent = 2
+	}
+	return Currency{Code: code, Exponent: exponent, Symbol: code}
+}
+
+// Format controls how an amount is rendered for display
+type Format struct {
+	DecimalSeparator   string
+	ThousandsSeparator string
+	SymbolFirst        bool
+	SymbolSpace        bool
+	UseCode            bool
+}
+
+// locales maps a language or language-region tag to its display format
+var locales = map[string]Format{
+	"en":    {DecimalSeparator: ".", ThousandsSeparator: ",", SymbolFirst: true},
+	"en-ie": {DecimalSeparator: ".", ThousandsSeparator: ",", SymbolFirst: true},
+	"nl":    {DecimalSeparator: ",", ThousandsSeparator: ".", SymbolFirst: true, SymbolSpace: true},
+	"de":    {DecimalSeparator: ",", ThousandsSeparator: ".", SymbolSpace: true},
+	"de-ch": {DecimalSeparator: ".", ThousandsSeparator: "'", SymbolFirst: true, SymbolSpace: true},
+	"fr":    {DecimalSeparator: ",", ThousandsSeparator: " ", SymbolSpace: true},
+	"es":    {DecimalSeparator: ",", ThousandsSeparator: ".", SymbolSpace: true},
+	"it":    {DecimalSeparator: ",", ThousandsSeparator: ".", SymbolSpace: true},
+}
+
+// DefaultLocale is used when a merchant has not configured one
+const DefaultLocale = "en"
+
+// ForLocale returns the format for a locale tag such as "nl" or "de-CH",
+// falling back from the region to the language and then to DefaultLocale
+func ForLocale(locale string) Format {
+	tag := strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if f, ok := locales[tag]; ok {
+		return f
+	}
+	if i := strings.Index(tag, "-"); i > 0 {
+		if f, ok := locales[tag[:i]]; ok {
+			return f
+		}
+	}
+	return locales[DefaultLocale]
+}
+
+// Merchant settings that override parts of the display format of the
+// merchant's locale
+const (
+	// DecimalSeparatorSetting is a single character, e.g. ","
+	DecimalSeparatorSetting = "decimal_separator"
+	// ThousandsSeparatorSetting is a single character, or "" to not group
+	// thousands
+	ThousandsSeparatorSetting = "thousands_separator"
+	// SymbolPositionSetting is "before" or "after" the amount
+	SymbolPositionSetting = "symbol_position"
+	// SymbolSpaceSetting is a boolean, whether a space separates the symbol
+	// from the amount
+	SymbolSpaceSetting = "symbol_space"
+)
+
+// WithSettings returns f with the format settings in settings applied. Other
+// settings are ignored; format settings with an invalid value are skipped and
+// described in errs.
+func (f Format) WithSettings(settings map[string]interface{}) (Format, []string) {
+	var errs []string
+	if value, set := settings[DecimalSeparatorSetting]; set {
+		if sep, ok := separator(value); ok && sep != "" {
+			f.DecimalSeparator = sep
+		} else {
+			errs = append(errs, DecimalSeparatorSetting+" must be a single character other than a digit or sign")
+		}
+	}
+	if value, set := settings[ThousandsSeparatorSetting]; set {
+		if sep, ok := separator(value); ok {
+			f.ThousandsSeparator = sep
+		} else {
+			errs = append(errs, ThousandsSeparatorSetting+" must be empty or a single character other than a digit or sign")
+		}
+	}
+	if f.ThousandsSeparator != "" && f.ThousandsSeparator == f.DecimalSeparator {
+		errs = append(errs, ThousandsSeparatorSetting+" must differ from "+DecimalSeparatorSetting)
+		f.ThousandsSeparator = ""
+	}
+	if value, set := settings[SymbolPositionSetting]; set {
+		switch value {
+		case "before":
+			f.SymbolFirst = true
+		case "after":
+			f.SymbolFirst = false
+		default:
+			errs = append(errs, SymbolPositionSetting+` must be "before" or "after"`)
+		}
+	}
+	if value, set := settings[SymbolSpaceSetting]; set {
+		if space, ok := value.(bool); ok {
+			f.SymbolSpace = space
+		} else {
+			errs = append(errs, SymbolSpaceSetting+" must be true or false")
+		}
+	}
+	return f, errs
+}
+
+// separator returns a separator setting, which must be a string of at most one
+// character that cannot be mistaken for part of a number
+func separator(value interface{}) (string, bool) {
+	sep, ok := value.(string)
+	if !ok || utf8.RuneCountInString(sep) > 1 || strings.ContainsAny(sep, "0123456789-+") {
+		return "", false
+	}
+	return sep, true
+}
+
+// Decimal renders an amount in minor units as a plain machine-readable decimal
+// string such as "12.50" or "1200" for zero-decimal currencies
+func Decimal(amountMinor int, currency string) string {
+	return Format{DecimalSeparator: "."}.number(amountMinor, Lookup(currency).Exponent)
+}
+
+// Format renders an amount in minor units for display, e.g. "€ 1.234,50"
+func (f Format) Format(amountMinor int, currency string) string {
+	c := Lookup(currency)
+	number := f.number(amountMinor, c.Exponent)
+
+	symbol := c.Symbol
+	if f.UseCode {
+		symbol = c.Code
+	}
+	sep := ""
+	if f.SymbolSpace || f.UseCode {
+		sep = " "
+	}
+
+	if f.SymbolFirst {
+		if strings.HasPrefix(number, "-") {
+			return "-" + symbol + sep + number[1:]
+		}
+		return symbol + sep + number
+	}
+	return number + sep + symbol
+}
+
+func (f Format) number(amountMinor, exponent int) string {
+	negative := amountMinor < 0
+	abs := amountMinor
+	if negative {
+		abs = -abs
+	}
+
+	digits := strconv.Itoa(abs)
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	major := digits[:len(digits)-exponent]
+	minor := digits[len(digits)-exponent:]
+
+	if f.ThousandsSeparator != "" && len(major) > 3 {
+		var b strings.Builder
+		lead := len(major) % 3
+		if lead > 0 {
+			b.WriteString(major[:lead])
+		}
+		for i := lead; i < len(major); i += 3 {
+			if b.Len() > 0 {
+				b.WriteString(f.ThousandsSeparator)
+			}
+			b.WriteString(major[i : i+3])
+		}
+		major = b.String()
+	}
+
+	result := major
+	if exponent > 0 {
+		result += f.DecimalSeparator + minor
+	}
+	if negative {
+		result = "-" + result
+	}
+	return result
+}
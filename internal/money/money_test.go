@@ -0,0 +1,135 @@
+package money
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		locale   string
+		useCode  bool
+		amount   int
+		currency string
+		want     string
+	}{
+		{"english", "en", false, 123450, "EUR", "€1,234.50"},
+		{"dutch", "nl", false, 123450, "EUR", "€\u00a01.234,50"},
+		{"german", "de", false, 123450, "EUR", "1.234,50\u00a0€"},
+		{"french", "fr", false, 123450, "EUR", "1\u202f234,50\u00a0€"},
+		{"swiss german", "de-CH", false, 123450, "CHF", "CHF\u00a01'234.50"},
+		{"millions", "en", false, 123456789, "USD", "$1,234,567.89"},
+		{"below a thousand", "de", false, 99999, "EUR", "999,99\u00a0€"},
+		{"cents only", "en", false, 5, "EUR", "€0.05"},
+		{"zero", "nl", false, 0, "EUR", "€\u00a00,00"},
+		{"yen has no decimals", "en", false, 123456, "JPY", "¥123,456"},
+		{"won has no decimals", "nl", false, 1234567, "KRW", "₩\u00a01.234.567"},
+		{"zero yen", "en", false, 0, "JPY", "¥0"},
+		{"dinar has three decimals", "de", false, 1234567, "KWD", "1.234,567\u00a0KD"},
+		{"fils only", "en", false, 5, "KWD", "KD0.005"},
+		{"negative with symbol first", "en", false, -1250, "EUR", "-€12.50"},
+		{"negative with symbol after", "de", false, -1250, "EUR", "-12,50\u00a0€"},
+		{"negative yen", "nl", false, -500, "JPY", "-¥\u00a0500"},
+		{"code first", "en", true, 1250, "EUR", "EUR\u00a012.50"},
+		{"code after", "de", true, 1250, "EUR", "12,50\u00a0EUR"},
+		{"code of a zero-decimal currency", "fr", true, 150000, "JPY", "150\u202f000\u00a0JPY"},
+		{"lower case currency", "en", false, 1250, "gbp", "£12.50"},
+		{"currency without a symbol uses its code", "de", false, 1250, "ZAR", "12,50\u00a0ZAR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := ForLocale(tt.locale)
+			f.UseCode = tt.useCode
+			if got := f.Format(tt.amount, tt.currency); got != tt.want {
+				t.Errorf("Format(%d, %s) in %s = %q, want %q", tt.amount, tt.currency, tt.locale, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForLocale(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   Format
+	}{
+		{"nl", locales["nl"]},
+		{"NL", locales["nl"]},
+		{"de-CH", locales["de-ch"]},
+		{"de_CH", locales["de-ch"]},
+		{"de-AT", locales["de"]},
+		{"pt-BR", locales[DefaultLocale]},
+		{"", locales[DefaultLocale]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			if got := ForLocale(tt.locale); got != tt.want {
+				t.Errorf("ForLocale(%q) = %+v, want %+v", tt.locale, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		amount   int
+		currency string
+		want     string
+	}{
+		{1250, "EUR", "12.50"},
+		{1234567, "EUR", "12345.67"},
+		{5, "EUR", "0.05"},
+		{-5, "EUR", "-0.05"},
+		{1250, "JPY", "1250"},
+		{1250, "KRW", "1250"},
+		{1, "KWD", "0.001"},
+		{1234567, "KWD", "1234.567"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want+" "+tt.currency, func(t *testing.T) {
+			if got := Decimal(tt.amount, tt.currency); got != tt.want {
+				t.Errorf("Decimal(%d, %s) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		locale   string
+		settings map[string]interface{}
+		want     string
+		wantErr  string
+	}{
+		{"no settings", "en", nil, "€1,234.50", ""},
+		{"unrelated settings", "en", map[string]interface{}{"theme": "dark"}, "€1,234.50", ""},
+		{"separators", "en", map[string]interface{}{DecimalSeparatorSetting: ",", ThousandsSeparatorSetting: "."}, "€1.234,50", ""},
+		{"no grouping", "de", map[string]interface{}{ThousandsSeparatorSetting: ""}, "1234,50\u00a0€", ""},
+		{"apostrophe grouping", "de", map[string]interface{}{ThousandsSeparatorSetting: "’"}, "1’234,50\u00a0€", ""},
+		{"symbol after", "nl", map[string]interface{}{SymbolPositionSetting: "after"}, "1.234,50\u00a0€", ""},
+		{"symbol before without space", "de", map[string]interface{}{SymbolPositionSetting: "before", SymbolSpaceSetting: false}, "€1.234,50", ""},
+		{"symbol space", "en", map[string]interface{}{SymbolSpaceSetting: true}, "€\u00a01,234.50", ""},
+		{"empty decimal separator", "en", map[string]interface{}{DecimalSeparatorSetting: ""}, "€1,234.50", DecimalSeparatorSetting},
+		{"digit as separator", "en", map[string]interface{}{ThousandsSeparatorSetting: "0"}, "€1,234.50", ThousandsSeparatorSetting},
+		{"long separator", "en", map[string]interface{}{DecimalSeparatorSetting: ".."}, "€1,234.50", DecimalSeparatorSetting},
+		{"separator as a number", "en", map[string]interface{}{DecimalSeparatorSetting: 1.0}, "€1,234.50", DecimalSeparatorSetting},
+		{"same separators", "en", map[string]interface{}{DecimalSeparatorSetting: ","}, "€1234,50", "must differ"},
+		{"unknown position", "en", map[string]interface{}{SymbolPositionSetting: "left"}, "€1,234.50", SymbolPositionSetting},
+		{"space as a string", "en", map[string]interface{}{SymbolSpaceSetting: "yes"}, "€1,234.50", SymbolSpaceSetting},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, errs := ForLocale(tt.locale).WithSettings(tt.settings)
+			if got := f.Format(123450, "EUR"); got != tt.want {
+				t.Errorf("Format() = %q, want %q", got, tt.want)
+			}
+			if tt.wantErr == "" && len(errs) > 0 {
+				t.Errorf("WithSettings() errors = %v, want none", errs)
+			}
+			if tt.wantErr != "" && (len(errs) != 1 || !strings.Contains(errs[0], tt.wantErr)) {
+				t.Errorf("WithSettings() errors = %v, want one about %s", errs, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package preview
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"unicode/utf8"
+
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// maxScanBytes caps how much of an upstream body is buffered while looking for a marker
+const maxScanBytes = 1 << 20
+
+// Policy describes how much of a response unpaid users may see. When Marker is set
+// the free portion ends right before its first occurrence; otherwise the first
+// Bytes bytes are free. If the marker is not found Bytes is used as a fallback.
+type Policy struct {
+	Bytes  int
+	Marker string
+}
+
+// PolicyFor returns the metered preview policy configured in the content's access
+// rules via "preview_bytes" and "preview_marker". ok is false when no preview is
+// configured, meaning unpaid users see nothing of the content.
+func PolicyFor(content *models.Content) (Policy, bool) {
+	var p Policy
+	if n, ok := content.AccessRules["preview_bytes"].(float64); ok && n > 0 {
+		p.Bytes = int(n)
+	}
+	p.Marker = content.StringRule("preview_marker")
+	return p, p.Bytes > 0 || p.Marker != ""
+}
+
+// Previewable reports whether a response of the given content type can be split.
+// Only HTML and plain text are; binary formats are never partially served.
+func Previewable(contentType string) bool {
+	mediaType := mediaType(contentType)
+	return mediaType == "text/html" || mediaType == "text/plain"
+}
+
+func mediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// Truncate reads the free portion of body according to the policy. The cut is
+// moved back so it never splits a UTF-8 sequence or, for HTML, an open tag.
+// ok is false when the content type cannot be previewed or nothing is free.
+func Truncate(body io.Reader, contentType string, p Policy) ([]byte, bool, error) {
+	if !Previewable(contentType) {
+		return nil, false, nil
+	}
+
+	limit := p.Bytes
+	if p.Marker != "" {
+		limit = maxScanBytes
+	}
+	buf, err := io.ReadAll(io.LimitReader(body, int64(limit)))
+	if err != nil {
+		return nil, false, err
+	}
+
+	free := buf
+	cut := false
+	if p.Marker != "" {
+		if i := bytes.Index(buf, []byte(p.Marker)); i >= 0 {
+			free = buf[:i]
+			cut = true
+		}
+	}
+	if !cut {
+		if p.Bytes <= 0 {
+			return nil, false, nil
+		}
+		if len(free) > p.Bytes {
+			free = free[:p.Bytes]
+		}
+	}
+
+	free = trimPartialRune(free)
+	if mediaType(contentType) == "text/html" {
+		free = trimOpenTag(free)
+	}
+
+	return free, len(free) > 0, nil
+}
+
+// trimPartialRune drops a trailing incomplete UTF-8 sequence
+func trimPartialRune(b []byte) []byte {
+	for i := 1; i <= utf8.UTFMax && i <= len(b); i++ {
+		start := len(b) - i
+		if utf8.RuneStart(b[start]) {
+			if !utf8.FullRune(b[start:]) {
+				return b[:start]
+			}
+			return b
+		}
+	}
+	return b
+}
+
+// trimOpenTag drops a trailing "<..." that was cut before its closing ">"
+func trimOpenTag(b []byte) []byte {
+	open := bytes.LastIndexByte(b, '<')
+	if open > bytes.LastIndexByte(b, '>') {
+		return b[:open]
+	}
+	return b
+}
+
+// Prompt is the paywall prompt that replaces the rest of a previewed response
+type Prompt struct {
+	// Path is the content path to pay for
+	Path  string
+	Title string
+	// Price is the formatted price of the content
+	Price string
+}
+
+var promptHTML = template.Must(template.New("paywall").Parse(
+	`<div class="paywall" data-content-path="{{.Path}}"><p>Pay {{.Price}} to continue reading {{.Title}}.</p></div>`,
+))
+
+// Render returns the prompt for a response of the given content type: an
+// escaped HTML block for HTML, a line of text otherwise
+func (p Prompt) Render(contentType string) []byte {
+	if mediaType(contentType) != "text/html" {
+		return []byte(fmt.Sprintf("\n\n[Pay %s to continue reading %s.]\n", p.Price, p.Title))
+	}
+	var buf bytes.Buffer
+	promptHTML.Execute(&buf, p)
+	return buf.Bytes()
+}
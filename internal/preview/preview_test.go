@@ -0,0 +1,89 @@
+package preview
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+func TestPolicyFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  models.JSONMap
+		want   Policy
+		wantOK bool
+	}{
+		{"no preview", models.JSONMap{"disposition": "inline"}, Policy{}, false},
+		{"byte count", models.JSONMap{"preview_bytes": 2048.0}, Policy{Bytes: 2048}, true},
+		{"marker", models.JSONMap{"preview_marker": "<!--more-->"}, Policy{Marker: "<!--more-->"}, true},
+		{"marker with fallback", models.JSONMap{"preview_bytes": 100.0, "preview_marker": "<!--more-->"}, Policy{Bytes: 100, Marker: "<!--more-->"}, true},
+		{"zero bytes", models.JSONMap{"preview_bytes": 0.0}, Policy{}, false},
+		{"bytes as a string", models.JSONMap{"preview_bytes": "100"}, Policy{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := PolicyFor(&models.Content{AccessRules: tt.rules})
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("PolicyFor() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	const article = `<h1>Title</h1><p>Free part.</p><!--more--><p>Paid part.</p>`
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		policy      Policy
+		want        string
+		wantOK      bool
+	}{
+		{"html split", article, "text/html; charset=utf-8", Policy{Bytes: 31}, `<h1>Title</h1><p>Free part.</p>`, true},
+		{"html split inside a tag", article, "text/html", Policy{Bytes: 33}, `<h1>Title</h1><p>Free part.</p>`, true},
+		{"text split", "Free part. Paid part.", "text/plain", Policy{Bytes: 10}, "Free part.", true},
+		{"text split inside a character", "Prijs: 5 €, rest betaald", "text/plain; charset=utf-8", Policy{Bytes: 11}, "Prijs: 5 ", true},
+		{"body shorter than the preview", "Short.", "text/plain", Policy{Bytes: 100}, "Short.", true},
+		{"marker", article, "text/html", Policy{Marker: "<!--more-->"}, `<h1>Title</h1><p>Free part.</p>`, true},
+		{"marker before the byte count", article, "text/html", Policy{Bytes: 5, Marker: "<!--more-->"}, `<h1>Title</h1><p>Free part.</p>`, true},
+		{"missing marker falls back to bytes", article, "text/html", Policy{Bytes: 14, Marker: "<!--cut-->"}, `<h1>Title</h1>`, true},
+		{"missing marker without fallback", article, "text/html", Policy{Marker: "<!--cut-->"}, "", false},
+		{"marker at the start", "<!--more-->" + article, "text/html", Policy{Marker: "<!--more-->"}, "", false},
+		{"pdf", "%PDF-1.4 Free part. Paid part.", "application/pdf", Policy{Bytes: 10}, "", false},
+		{"image", "\x89PNG\r\n\x1a\n", "image/png", Policy{Bytes: 4}, "", false},
+		{"json", `{"free": true}`, "application/json", Policy{Bytes: 4}, "", false},
+		{"no content type", "Free part. Paid part.", "", Policy{Bytes: 10}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := Truncate(strings.NewReader(tt.body), tt.contentType, tt.policy)
+			if err != nil {
+				t.Fatalf("Truncate() error = %v", err)
+			}
+			if string(got) != tt.want || ok != tt.wantOK {
+				t.Errorf("Truncate() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestPromptRender(t *testing.T) {
+	prompt := Prompt{Path: "/news/a&b", Title: `<script>alert("x")</script>`, Price: "€0.50"}
+	tests := []struct {
+		name        string
+		contentType string
+		want        string
+	}{
+		{"html is escaped", "text/html; charset=utf-8", `<div class="paywall" data-content-path="/news/a&amp;b"><p>Pay €0.50 to continue reading &lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;.</p></div>`},
+		{"text", "text/plain", "\n\n[Pay €0.50 to continue reading <script>alert(\"x\")</script>.]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(prompt.Render(tt.contentType)); got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package qr
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// FormatPNG is the only image format currently rendered
+const FormatPNG = "png"
+
+// ErrUnsupportedFormat is returned for image formats the renderer cannot produce
+var ErrUnsupportedFormat = errors.New("unsupported QR format")
+
+type key struct {
+	sessionID uuid.UUID
+	format    string
+	size      int
+}
+
+type entry struct {
+	key     key
+	payload string
+	image   []byte
+}
+
+// Stats is a snapshot of the cache counters
+type Stats struct {
+	Renders   int64 `json:"renders"`
+	Hits      int64 `json:"hits"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+	MaxBytes  int64 `json:"max_bytes"`
+}
+
+// Cache keeps rendered QR images in memory, keyed by session, format and size.
+// Rendering is deterministic for a given payload, so a checkout page polling the
+// image only pays for the encoding once. The least recently used images are
+// evicted once the total image size exceeds maxBytes.
+type Cache struct {
+	maxBytes int64
+
+	mu    sync.Mutex
+	order *list.List
+	items map[key]*list.Element
+	bytes int64
+
+	renders   atomic.Int64
+	hits      atomic.Int64
+	evictions atomic.Int64
+}
+
+// NewCache creates a cache holding at most maxBytes of image data
+func NewCache(maxBytes int64) *Cache {
+	return &Cache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		items:    make(map[key]*list.Element),
+	}
+}
+
+// Image returns the rendered QR code for a session, rendering and caching it on
+// a miss. A cached image rendered from a different payload, e.g. after the
+// session's QR data was regenerated, is treated as a miss.
+func (c *Cache) Image(sessionID uuid.UUID, payload, format string, size int) ([]byte, error) {
+	if format != FormatPNG {
+		return nil, ErrUnsupportedFormat
+	}
+	k := key{sessionID: sessionID, format: format, size: size}
+
+	c.mu.Lock()
+	if el, ok := c.items[k]; ok && el.Value.(*entry).payload == payload {
+		c.order.MoveToFront(el)
+		image := el.Value.(*entry).image
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return image, nil
+	}
+	c.mu.Unlock()
+
+	image, err := qrcode.Encode(payload, qrcode.Medium, size)
+	if err != nil {
+		return nil, err
+	}
+	c.renders.Add(1)
+
+	c.store(&entry{key: k, payload: payload, image: image})
+	return image, nil
+}
+
+// Warm renders and caches an image ahead of the first request for it
+func (c *Cache) Warm(sessionID uuid.UUID, payload, format string, size int) error {
+	_, err := c.Image(sessionID, payload, format, size)
+	return err
+}
+
+// Invalidate drops every cached image of a session
+func (c *Cache) Invalidate(sessionID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, el := range c.items {
+		if k.sessionID == sessionID {
+			c.remove(el)
+		}
+	}
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	entries, bytes := len(c.items), c.bytes
+	c.mu.Unlock()
+
+	return Stats{
+		Renders:   c.renders.Load(),
+		Hits:      c.hits.Load(),
+		Evictions: c.evictions.Load(),
+		Entries:   entries,
+		Bytes:     bytes,
+		MaxBytes:  c.maxBytes,
+	}
+}
+
+func (c *Cache) store(e *entry) {
+	size := int64(len(e.image))
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[e.key]; ok {
+		c.remove(el)
+	}
+	c.items[e.key] = c.order.PushFront(e)
+	c.bytes += size
+
+	for c.bytes > c.maxBytes {
+		c.remove(c.order.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// remove must be called with mu held
+func (c *Cache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*entry)
+	delete(c.items, e.key)
+	c.bytes -= int64(len(e.image))
+}
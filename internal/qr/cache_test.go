@@ -0,0 +1,144 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCacheHit(t *testing.T) {
+	cache := NewCache(1 << 20)
+	session := uuid.New()
+
+	first, err := cache.Image(session, "payload", FormatPNG, 256)
+	if err != nil {
+		t.Fatalf("Image() error = %v", err)
+	}
+	second, err := cache.Image(session, "payload", FormatPNG, 256)
+	if err != nil {
+		t.Fatalf("Image() error = %v", err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Error("second Image() differs from the first")
+	}
+	if stats := cache.Stats(); stats.Renders != 1 || stats.Hits != 1 || stats.Entries != 1 || stats.Bytes != int64(len(first)) {
+		t.Errorf("Stats() = %+v, want 1 render, 1 hit and 1 entry of %d bytes", stats, len(first))
+	}
+}
+
+func TestCachePayloadChange(t *testing.T) {
+	cache := NewCache(1 << 20)
+	session := uuid.New()
+
+	old, err := cache.Image(session, "old payload", FormatPNG, 256)
+	if err != nil {
+		t.Fatalf("Image() error = %v", err)
+	}
+	image, err := cache.Image(session, "new payload", FormatPNG, 256)
+	if err != nil {
+		t.Fatalf("Image() error = %v", err)
+	}
+	if bytes.Equal(old, image) {
+		t.Error("Image() returned the image of the old payload")
+	}
+	if stats := cache.Stats(); stats.Renders != 2 || stats.Hits != 0 || stats.Entries != 1 || stats.Bytes != int64(len(image)) {
+		t.Errorf("Stats() = %+v, want 2 renders, no hits and only the new image", stats)
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	cache := NewCache(1 << 20)
+	session, other := uuid.New(), uuid.New()
+	for _, size := range []int{128, 256, 512} {
+		if err := cache.Warm(session, "payload", FormatPNG, size); err != nil {
+			t.Fatalf("Warm() error = %v", err)
+		}
+	}
+	kept, err := cache.Image(other, "payload", FormatPNG, 256)
+	if err != nil {
+		t.Fatalf("Image() error = %v", err)
+	}
+	if _, err := cache.Image(session, "payload", "svg", 256); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Image() of svg error = %v, want %v", err, ErrUnsupportedFormat)
+	}
+
+	cache.Invalidate(session)
+
+	if stats := cache.Stats(); stats.Entries != 1 || stats.Bytes != int64(len(kept)) {
+		t.Errorf("Stats() = %+v, want only the other session's image of %d bytes", stats, len(kept))
+	}
+	for _, size := range []int{128, 256, 512} {
+		before := cache.Stats().Renders
+		if _, err := cache.Image(session, "payload", FormatPNG, size); err != nil {
+			t.Fatalf("Image() error = %v", err)
+		}
+		if cache.Stats().Renders != before+1 {
+			t.Errorf("size %d was served from the cache after Invalidate", size)
+		}
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	probe, err := NewCache(1<<20).Image(uuid.New(), "payload-0", FormatPNG, 256)
+	if err != nil {
+		t.Fatalf("Image() error = %v", err)
+	}
+	// Room for two images of this size, not three
+	maxBytes := int64(len(probe)) * 5 / 2
+	cache := NewCache(maxBytes)
+
+	sessions := make([]uuid.UUID, 5)
+	image := func(i int) {
+		t.Helper()
+		if _, err := cache.Image(sessions[i], fmt.Sprintf("payload-%d", i), FormatPNG, 256); err != nil {
+			t.Fatalf("Image() error = %v", err)
+		}
+		if stats := cache.Stats(); stats.Bytes > maxBytes {
+			t.Fatalf("Stats().Bytes = %d, over the limit of %d", stats.Bytes, maxBytes)
+		}
+	}
+	for i := range sessions {
+		sessions[i] = uuid.New()
+	}
+
+	image(0)
+	image(1)
+	image(0) // 1 is now the least recently used
+	image(2)
+
+	stats := cache.Stats()
+	if stats.Entries != 2 || stats.Evictions != 1 {
+		t.Fatalf("Stats() = %+v, want 2 entries after 1 eviction", stats)
+	}
+	image(0)
+	if got := cache.Stats(); got.Renders != stats.Renders || got.Hits != stats.Hits+1 {
+		t.Errorf("recently used image was evicted: Stats() = %+v, before %+v", got, stats)
+	}
+	image(1)
+	if got := cache.Stats(); got.Renders != stats.Renders+1 {
+		t.Errorf("least recently used image was kept: Stats() = %+v, before %+v", got, stats)
+	}
+
+	image(3)
+	image(4)
+	if stats := cache.Stats(); stats.Entries != 2 || stats.Evictions != 4 {
+		t.Errorf("Stats() = %+v, want 2 entries after 4 evictions", stats)
+	}
+}
+
+func TestCacheSkipsOversizedImages(t *testing.T) {
+	cache := NewCache(64)
+	image, err := cache.Image(uuid.New(), "payload", FormatPNG, 256)
+	if err != nil {
+		t.Fatalf("Image() error = %v", err)
+	}
+	if len(image) == 0 {
+		t.Fatal("Image() returned no image")
+	}
+	if stats := cache.Stats(); stats.Entries != 0 || stats.Bytes != 0 || stats.Evictions != 0 {
+		t.Errorf("Stats() = %+v, want the image left uncached", stats)
+	}
+}
@@ -0,0 +1,93 @@
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mh74hf/micro-payments/internal/money"
+	"github.com/mh74hf/micro-payments/internal/validation"
+)
+
+// Limits of the EPC069-12 SEPA Credit Transfer payload
+const (
+	epcMaxNameLength       = 70
+	epcMaxRemittanceLength = 140
+	epcMaxAmountCents      = 99999999999
+)
+
+var (
+	// ErrUnsupportedCurrency is returned for transfers in anything but EUR,
+	// the only currency an EPC QR code can carry
+	ErrUnsupportedCurrency = errors.New("EPC QR codes only support EUR")
+	// ErrInvalidTransfer is returned when a transfer is missing data or out of
+	// the ranges the EPC payload allows
+	ErrInvalidTransfer = errors.New("invalid transfer for EPC QR code")
+)
+
+// Transfer holds the SEPA credit transfer a payer's banking app should prefill
+type Transfer struct {
+	BIC         string
+	Name        string
+	IBAN        string
+	AmountCents int
+	Currency    string
+	Reference   string
+}
+
+// EPCPayload builds the EPC069-12 ("GiroCode") payload for a transfer: version
+// 002, UTF-8, SCT, with the reference as unstructured remittance information.
+// The BIC is optional in version 002 and left empty when unknown. Names longer
+// than the 70 characters the format allows are shortened.
+func EPCPayload(t Transfer) (string, error) {
+	if !strings.EqualFold(t.Currency, "EUR") {
+		return "", fmt.Errorf("%w: got %s", ErrUnsupportedCurrency, strings.ToUpper(t.Currency))
+	}
+
+	iban := money.NormalizeIBAN(t.IBAN)
+	bic := strings.ToUpper(strings.TrimSpace(t.BIC))
+	name := truncateRunes(singleLine(t.Name), epcMaxNameLength)
+	reference := singleLine(t.Reference)
+	switch {
+	case !validation.IsValidIBAN(iban):
+		return "", fmt.Errorf("%w: IBAN is invalid", ErrInvalidTransfer)
+	case bic != "" && len(bic) != 8 && len(bic) != 11:
+		return "", fmt.Errorf("%w: BIC is invalid", ErrInvalidTransfer)
+	case name == "":
+		return "", fmt.Errorf("%w: beneficiary name is required", ErrInvalidTransfer)
+	case t.AmountCents < 1 || t.AmountCents > epcMaxAmountCents:
+		return "", fmt.Errorf("%w: amount out of range", ErrInvalidTransfer)
+	case utf8.RuneCountInString(reference) > epcMaxRemittanceLength:
+		return "", fmt.Errorf("%w: reference too long", ErrInvalidTransfer)
+	}
+
+	lines := []string{
+		"BCD", // service tag
+		"002", // version
+		"1",   // character set: UTF-8
+		"SCT", // identification: SEPA Credit Transfer
+		bic,
+		name,
+		iban,
+		"EUR" + money.Decimal(t.AmountCents, "EUR"),
+		"", // purpose
+		"", // structured remittance (creditor reference)
+		reference,
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// singleLine removes line breaks and trims a value so it cannot shift the
+// fixed line positions of the payload
+func singleLine(s string) string {
+	s = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(s)
+	return strings.TrimSpace(s)
+}
+
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return strings.TrimSpace(string([]rune(s)[:max]))
+}
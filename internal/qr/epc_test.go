@@ -0,0 +1,118 @@
+package qr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEPCPayloadLines(t *testing.T) {
+	payload, err := EPCPayload(Transfer{
+		BIC:         "abnanl2a",
+		Name:        "Demo Merchant",
+		IBAN:        "nl91 abna 0417 1643 00",
+		AmountCents: 250,
+		Currency:    "eur",
+		Reference:   "MP-1700000001",
+	})
+	if err != nil {
+		t.Fatalf("EPCPayload() error = %v", err)
+	}
+
+	lines := strings.Split(payload, "\n")
+	want := []struct {
+		field string
+		value string
+	}{
+		{"service tag", "BCD"},
+		{"version", "002"},
+		{"character set", "1"},
+		{"identification", "SCT"},
+		{"BIC", "ABNANL2A"},
+		{"name", "Demo Merchant"},
+		{"IBAN", "NL91ABNA0417164300"},
+		{"amount", "EUR2.50"},
+		{"purpose", ""},
+		{"structured remittance", ""},
+		{"reference", "MP-1700000001"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("payload has %d lines, want %d:\n%s", len(lines), len(want), payload)
+	}
+	for i, w := range want {
+		if lines[i] != w.value {
+			t.Errorf("line %d (%s) = %q, want %q", i+1, w.field, lines[i], w.value)
+		}
+	}
+}
+
+func TestEPCPayloadFields(t *testing.T) {
+	valid := Transfer{
+		Name:        "Demo Merchant",
+		IBAN:        "DE89370400440532013000",
+		AmountCents: 100,
+		Currency:    "EUR",
+		Reference:   "REF",
+	}
+	tests := []struct {
+		name   string
+		modify func(*Transfer)
+		line   int
+		want   string
+	}{
+		{"no BIC", func(t *Transfer) { t.BIC = "" }, 5, ""},
+		{"whole euros", func(t *Transfer) { t.AmountCents = 1200 }, 8, "EUR12.00"},
+		{"cents", func(t *Transfer) { t.AmountCents = 1 }, 8, "EUR0.01"},
+		{"line break in name", func(t *Transfer) { t.Name = "Demo\nMerchant" }, 6, "Demo Merchant"},
+		{"long name", func(t *Transfer) { t.Name = strings.Repeat("é", 80) }, 6, strings.Repeat("é", 70)},
+		{"line break in reference", func(t *Transfer) { t.Reference = "A\r\nB" }, 11, "A B"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transfer := valid
+			tt.modify(&transfer)
+			payload, err := EPCPayload(transfer)
+			if err != nil {
+				t.Fatalf("EPCPayload() error = %v", err)
+			}
+			lines := strings.Split(payload, "\n")
+			if len(lines) != 11 {
+				t.Fatalf("payload has %d lines, want 11", len(lines))
+			}
+			if got := lines[tt.line-1]; got != tt.want {
+				t.Errorf("line %d = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEPCPayloadRejects(t *testing.T) {
+	valid := Transfer{
+		Name:        "Demo Merchant",
+		IBAN:        "DE89370400440532013000",
+		AmountCents: 100,
+		Currency:    "EUR",
+	}
+	tests := []struct {
+		name   string
+		modify func(*Transfer)
+		want   error
+	}{
+		{"currency", func(t *Transfer) { t.Currency = "USD" }, ErrUnsupportedCurrency},
+		{"IBAN checksum", func(t *Transfer) { t.IBAN = "DE89370400440532013001" }, ErrInvalidTransfer},
+		{"BIC length", func(t *Transfer) { t.BIC = "ABNANL2" }, ErrInvalidTransfer},
+		{"empty name", func(t *Transfer) { t.Name = " \n " }, ErrInvalidTransfer},
+		{"zero amount", func(t *Transfer) { t.AmountCents = 0 }, ErrInvalidTransfer},
+		{"amount too large", func(t *Transfer) { t.AmountCents = epcMaxAmountCents + 1 }, ErrInvalidTransfer},
+		{"reference too long", func(t *Transfer) { t.Reference = strings.Repeat("R", epcMaxRemittanceLength+1) }, ErrInvalidTransfer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transfer := valid
+			tt.modify(&transfer)
+			if _, err := EPCPayload(transfer); !errors.Is(err, tt.want) {
+				t.Errorf("EPCPayload() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
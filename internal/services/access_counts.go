@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+// pendingAccess is the buffered use of one access grant since the last flush.
+// The IP address and user agent are those of the latest use.
+type pendingAccess struct {
+	count     int
+	last      time.Time
+	ip        string
+	userAgent string
+	// user is who a session grant's row is created for; unused for grants
+	// that already have a row
+	user string
+}
+
+// add merges a later (or, when putting a failed batch back, earlier) use
+func (p *pendingAccess) add(q pendingAccess) {
+	p.count += q.count
+	if q.last.After(p.last) {
+		p.last = q.last
+		p.ip = q.ip
+		p.userAgent = q.userAgent
+		p.user = q.user
+	}
+}
+
+// RecordAccess counts a use of an access grant by the given client. Counts are
+// kept in memory and written in batches by RunAccessCounts, so serving content
+// never waits on an UPDATE; FlushAccessCounts must run on shutdown to not lose
+// the last batch.
+//
+// Grants proven by an access token or receipt carry no row ID; their uses are
+// added to the session's row, which the flush creates if it is missing.
+func (s *ContentService) RecordAccess(grant *models.ContentAccess, ip, userAgent string) {
+	use := pendingAccess{count: 1, last: time.Now(), ip: ip, userAgent: userAgent, user: grant.UserIdentifier}
+
+	s.countsMu.Lock()
+	defer s.countsMu.Unlock()
+	switch {
+	case grant.AccessID != uuid.Nil:
+		p := s.counts[grant.AccessID]
+		p.add(use)
+		s.counts[grant.AccessID] = p
+	case grant.SessionID != nil:
+		p := s.sessionCounts[*grant.SessionID]
+		p.add(use)
+		s.sessionCounts[*grant.SessionID] = p
+	}
+}
+
+// RunAccessCounts flushes buffered access counts every
+// cfg.Access.CountFlushInterval until ctx is cancelled
+func (s *ContentService) RunAccessCounts(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Access.CountFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.FlushAccessCounts(ctx); err != nil {
+				s.logger.Warn("Failed to flush access counts", zap.Error(err))
+			}
+		}
+	}
+}
+
+// FlushAccessCounts writes the buffered access counts. Each batch is a single
+// statement that adds to the stored count, so flushes of several instances do
+// not lose each other's uses. On failure the counts are put back so a later
+// flush can retry them.
+func (s *ContentService) FlushAccessCounts(ctx context.Context) error {
+	s.countsMu.Lock()
+	batch, sessionBatch := s.counts, s.sessionCounts
+	s.counts = make(map[uuid.UUID]pendingAccess)
+	s.sessionCounts = make(map[uuid.UUID]pendingAccess)
+	s.countsMu.Unlock()
+
+	if err := s.flushGrantCounts(ctx, batch); err != nil {
+		s.putBackCounts(batch, sessionBatch)
+		return err
+	}
+	if err := s.flushSessionCounts(ctx, sessionBatch); err != nil {
+		s.putBackCounts(nil, sessionBatch)
+		return err
+	}
+	return nil
+}
+
+// flushGrantCounts adds counts to grants that have a content_access row
+func (s *ContentService) flushGrantCounts(ctx context.Context, batch map[uuid.UUID]pendingAccess) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	var b accessColumns
+	for id, p := range batch {
+		b.add(id, p)
+	}
+
+	query := `
+		UPDATE content_access a
+		SET access_count = a.access_count + b.count,
+		    last_accessed_at = GREATEST(a.last_accessed_at, b.last),
+		    ip_address = COALESCE(NULLIF(b.ip, '')::inet, a.ip_address),
+		    user_agent = COALESCE(NULLIF(b.user_agent, ''), a.user_agent)
+		FROM unnest($1::uuid[], $2::int[], $3::timestamptz[], $4::text[], $5::text[])
+		     AS b(access_id, count, last, ip, user_agent)
+		WHERE a.access_id = b.access_id`
+
+	_, err := s.db.ExecContext(ctx, query, pq.Array(b.ids), pq.Array(b.counts), pq.Array(b.lasts), pq.Array(b.ips), pq.Array(b.agents))
+	if err != nil {
+		return fmt.Errorf("failed to flush access counts: %w", err)
+	}
+	return nil
+}
+
+// flushSessionCounts creates or updates the content_access rows of grants
+// proven by a paid session. The row takes its content and expiry from the
+// session, so a session that is no longer paid gets none.
+func (s *ContentService) flushSessionCounts(ctx context.Context, batch map[uuid.UUID]pendingAccess) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	var b accessColumns
+	for id, p := range batch {
+		b.add(id, p)
+	}
+
+	query := `
+		INSERT INTO content_access (
+			session_id, merchant_id, content_id, user_identifier, granted_at, expires_at,
+			last_accessed_at, access_count, ip_address, user_agent
+		)
+		SELECT ps.session_id, ps.merchant_id, ps.content_id, b.user_identifier,
+		       COALESCE(ps.access_granted_at, ps.paid_at, NOW()), ps.access_expires_at,
+		       b.last, b.count, NULLIF(b.ip, '')::inet, NULLIF(b.user_agent, '')
+		FROM unnest($1::uuid[], $2::text[], $3::int[], $4::timestamptz[], $5::text[], $6::text[])
+		     AS b(session_id, user_identifier, count, last, ip, user_agent)
+		JOIN payment_sessions ps ON ps.session_id = b.session_id
+		WHERE ps.status = $7 AND ps.access_expires_at IS NOT NULL
+		ON CONFLICT (session_id) WHERE session_id IS NOT NULL DO UPDATE
+		SET access_count = content_access.access_count + EXCLUDED.access_count,
+		    last_accessed_at = GREATEST(content_access.last_accessed_at, EXCLUDED.last_accessed_at),
+		    ip_address = COALESCE(EXCLUDED.ip_address, content_access.ip_address),
+		    user_agent = COALESCE(EXCLUDED.user_agent, content_access.user_agent)`
+
+	_, err := s.db.ExecContext(ctx, query,
+		pq.Array(b.ids), pq.Array(b.users), pq.Array(b.counts), pq.Array(b.lasts), pq.Array(b.ips), pq.Array(b.agents),
+		models.PaymentStatusPaid,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to flush session access counts: %w", err)
+	}
+	return nil
+}
+
+// putBackCounts merges batches that failed to flush into the live buffers
+func (s *ContentService) putBackCounts(batch, sessionBatch map[uuid.UUID]pendingAccess) {
+	s.countsMu.Lock()
+	defer s.countsMu.Unlock()
+	for id, p := range batch {
+		merged := s.counts[id]
+		merged.add(p)
+		s.counts[id] = merged
+	}
+	for id, p := range sessionBatch {
+		merged := s.sessionCounts[id]
+		merged.add(p)
+		s.sessionCounts[id] = merged
+	}
+}
+
+// accessColumns holds a batch of buffered uses as arrays for unnest
+type accessColumns struct {
+	ids, users, lasts, ips, agents []string
+	counts                         []int64
+}
+
+func (b *accessColumns) add(id uuid.UUID, p pendingAccess) {
+	b.ids = append(b.ids, id.String())
+	b.users = append(b.users, p.user)
+	b.counts = append(b.counts, int64(p.count))
+	b.lasts = append(b.lasts, p.last.UTC().Format(time.RFC3339Nano))
+	b.ips = append(b.ips, p.ip)
+	b.agents = append(b.agents, p.userAgent)
+}
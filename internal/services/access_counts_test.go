@@ -0,0 +1,43 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPendingAccessAdd(t *testing.T) {
+	earlier := time.Date(2024, 3, 12, 10, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Minute)
+	tests := []struct {
+		name string
+		p, q pendingAccess
+		want pendingAccess
+	}{
+		{
+			name: "first use",
+			q:    pendingAccess{count: 1, last: earlier, ip: "192.0.2.1", userAgent: "curl", user: "user-1"},
+			want: pendingAccess{count: 1, last: earlier, ip: "192.0.2.1", userAgent: "curl", user: "user-1"},
+		},
+		{
+			name: "later use takes over the client",
+			p:    pendingAccess{count: 2, last: earlier, ip: "192.0.2.1", userAgent: "curl", user: "user-1"},
+			q:    pendingAccess{count: 1, last: later, ip: "192.0.2.2", userAgent: "Firefox", user: "user-1"},
+			want: pendingAccess{count: 3, last: later, ip: "192.0.2.2", userAgent: "Firefox", user: "user-1"},
+		},
+		{
+			name: "failed batch put back keeps the latest client",
+			p:    pendingAccess{count: 1, last: later, ip: "192.0.2.2", userAgent: "Firefox", user: "user-1"},
+			q:    pendingAccess{count: 5, last: earlier, ip: "192.0.2.1", userAgent: "curl", user: "user-1"},
+			want: pendingAccess{count: 6, last: later, ip: "192.0.2.2", userAgent: "Firefox", user: "user-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.p
+			got.add(tt.q)
+			if got != tt.want {
+				t.Errorf("add() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+// Audited actions
+const (
+	AuditMerchantCreate        = "merchant.create"
+	AuditMerchantUpdate        = "merchant.update"
+	AuditMerchantDeactivate    = "merchant.deactivate"
+	AuditAPIKeyRotate          = "merchant.api_key.rotate"
+	AuditWebhookSecretRotate   = "merchant.webhook_secret.rotate"
+	AuditPaymentRefund         = "payment.refund"
+	AuditPaymentDecline        = "payment.decline"
+	AuditTransactionReturn     = "transaction.return"
+	AuditDisputeOpen           = "dispute.open"
+	AuditDisputeTransition     = "dispute.transition"
+	AuditWebhookDeliveryReplay = "webhook.replay"
+	AuditAccessRevoke          = "content.access.revoke"
+	AuditAccessRenew           = "content.access.renew"
+)
+
+// Kinds of audit targets
+const (
+	AuditTargetMerchant        = "merchant"
+	AuditTargetContent         = "content"
+	AuditTargetPaymentSession  = "payment_session"
+	AuditTargetBankTransaction = "bank_transaction"
+	AuditTargetDispute         = "dispute"
+	AuditTargetWebhookEvent    = "webhook_event"
+)
+
+// Page sizes of ListAuditLog
+const (
+	DefaultAuditPageSize = 50
+	MaxAuditPageSize     = 200
+)
+
+// AuditActor identifies who took an audited action: "admin" or
+// "merchant:<id>", with the request it was taken in
+type AuditActor struct {
+	Name      string
+	RequestID string
+	IP        string
+}
+
+// AuditFilter restricts which entries ListAuditLog returns. Empty fields do
+// not filter.
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+}
+
+// AuditPage is one page of ListAuditLog with the total number of matches
+type AuditPage struct {
+	Entries []models.AuditEntry
+	Total   int
+	Limit   int
+	Offset  int
+}
+
+// AuditService keeps the audit log of administrative actions
+type AuditService struct {
+	db     *sql.DB
+	config *config.Config
+	logger *zap.Logger
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(db *sql.DB, cfg *config.Config, logger *zap.Logger) *AuditService {
+	return &AuditService{
+		db:     db,
+		config: cfg,
+		logger: logger,
+	}
+}
+
+// Record stores that actor took action on the target identified by
+// targetType and targetID. metadata holds details like a refund reason; it
+// must not contain secrets.
+func (s *AuditService) Record(ctx context.Context, actor AuditActor, action, targetType, targetID string, metadata map[string]interface{}) error {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	var requestID, ip *string
+	if actor.RequestID != "" {
+		requestID = &actor.RequestID
+	}
+	if parsed := net.ParseIP(actor.IP); parsed != nil {
+		addr := parsed.String()
+		ip = &addr
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO admin_audit_log (actor, action, target_type, target_id, metadata, request_id, ip_address)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		actor.Name, action, targetType, targetID, models.JSONMap(metadata), requestID, ip,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record %s audit entry: %w", action, err)
+	}
+	return nil
+}
+
+// ListAuditLog returns the audit entries matching filter newest first. limit
+// defaults to DefaultAuditPageSize and is capped at MaxAuditPageSize.
+func (s *AuditService) ListAuditLog(ctx context.Context, filter AuditFilter, limit, offset int) (*AuditPage, error) {
+	if limit <= 0 {
+		limit = DefaultAuditPageSize
+	}
+	if limit > MaxAuditPageSize {
+		limit = MaxAuditPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	page := &AuditPage{Entries: []models.AuditEntry{}, Limit: limit, Offset: offset}
+
+	where := `
+		WHERE ($1 = '' OR actor = $1)
+		  AND ($2 = '' OR action = $2)
+		  AND ($3 = '' OR target_type = $3)
+		  AND ($4 = '' OR target_id = $4)`
+	args := []interface{}{filter.Actor, filter.Action, filter.TargetType, filter.TargetID}
+
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM admin_audit_log`+where, args...).Scan(&page.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	query := `
+		SELECT audit_id, actor, action, target_type, target_id, metadata,
+		       request_id, host(ip_address), created_at
+		FROM admin_audit_log` + where + `
+		ORDER BY created_at DESC, audit_id DESC
+		LIMIT $5 OFFSET $6`
+
+	rows, err := s.db.QueryContext(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.AuditEntry
+		err := rows.Scan(
+			&entry.AuditID,
+			&entry.Actor,
+			&entry.Action,
+			&entry.TargetType,
+			&entry.TargetID,
+			&entry.Metadata,
+			&entry.RequestID,
+			&entry.IPAddress,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+
+	return page, nil
+}
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+// ErrBackfillTooLarge is returned when a backfill batch exceeds cfg.Admin.MaxBackfillBatch
+var ErrBackfillTooLarge = errors.New("backfill batch too large")
+
+// Reasons a transaction was rejected from a backfill batch
+const (
+	BackfillRejectedNoBankReference = "no_bank_reference"
+	BackfillRejectedInvalid         = "invalid"
+)
+
+// RejectedTransaction is an imported transaction that could not be stored
+type RejectedTransaction struct {
+	Index         int     `json:"index"`
+	BankReference *string `json:"bank_reference,omitempty"`
+	Reason        string  `json:"reason"`
+}
+
+// BackfillReport describes the outcome of a historical statement import
+type BackfillReport struct {
+	Received       int                   `json:"received"`
+	Inserted       int                   `json:"inserted"`
+	Duplicates     int                   `json:"duplicates"`
+	Rejected       []RejectedTransaction `json:"rejected"`
+	Reconciliation *ReconciliationReport `json:"reconciliation"`
+}
+
+// Backfill imports historical bank transactions for a merchant and matches them
+// against the merchant's pending and expired sessions.
+//
+// The import is idempotent: transactions are keyed on (merchant_id,
+// bank_reference), so re-sending a batch skips rows that were stored before.
+// Matching picks up every still-detected transaction of the batch, including
+// those stored by an earlier attempt that failed halfway, so a large import can
+// simply be retried. Each match is applied in its own database transaction.
+//
+// Matched sessions are marked paid with the historical booking date, so the
+// access window is computed from when the money arrived and has usually long
+// passed. No access is granted and no events are published, which keeps
+// webhooks for old payments from being sent again.
+func (s *ReconciliationService) Backfill(ctx context.Context, merchantID uuid.UUID, transactions []models.BankTransaction) (*BackfillReport, error) {
+	if len(transactions) > s.config.Admin.MaxBackfillBatch {
+		return nil, ErrBackfillTooLarge
+	}
+
+	report := &BackfillReport{
+		Received: len(transactions),
+		Rejected: []RejectedTransaction{},
+	}
+
+	var bankRefs []string
+	for i := range transactions {
+		tx := &transactions[i]
+		if tx.BankReference == nil || *tx.BankReference == "" {
+			report.Rejected = append(report.Rejected, RejectedTransaction{Index: i, Reason: BackfillRejectedNoBankReference})
+			continue
+		}
+		if tx.AmountCents <= 0 || tx.Currency == "" || tx.CreditorIBAN == "" || tx.BookingDate.IsZero() {
+			report.Rejected = append(report.Rejected, RejectedTransaction{Index: i, BankReference: tx.BankReference, Reason: BackfillRejectedInvalid})
+			continue
+		}
+
+		inserted, err := s.insertBankTransaction(ctx, merchantID, tx)
+		if err != nil {
+			return nil, err
+		}
+		if inserted {
+			report.Inserted++
+		} else {
+			report.Duplicates++
+		}
+		bankRefs = append(bankRefs, *tx.BankReference)
+	}
+
+	detected, err := s.detectedBackfillTransactions(ctx, merchantID, bankRefs)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := s.historicalSessions(ctx, merchantID, detected)
+	if err != nil {
+		return nil, err
+	}
+	var iban string
+	err = s.db.QueryRowContext(ctx, `SELECT bank_account_iban FROM merchants WHERE merchant_id = $1`, merchantID).Scan(&iban)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load merchant account: %w", err)
+	}
+
+	// Historical transfers may have arrived long after the session expired
+	opts := newMatchOptions(s.config)
+	opts.maxLate = anyLateness
+	report.Reconciliation = planMatches(detected, sessions, map[uuid.UUID]string{merchantID: iban}, opts)
+
+	bookingDates := make(map[uuid.UUID]time.Time, len(detected))
+	for _, tx := range detected {
+		bookingDates[tx.TransactionID] = tx.BookingDate
+	}
+	_, err = applyReport(ctx, s.db, s.logger, report.Reconciliation, func(match ProposedMatch, audit *MatchAudit) error {
+		return s.applyHistoricalMatch(ctx, match, bookingDates[match.TransactionID], audit)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Reconciliation backfill completed",
+		zap.String("merchant_id", merchantID.String()),
+		zap.Int("received", report.Received),
+		zap.Int("inserted", report.Inserted),
+		zap.Int("duplicates", report.Duplicates),
+		zap.Int("matched", len(report.Reconciliation.Matches)),
+	)
+
+	return report, nil
+}
+
+// insertBankTransaction stores a transaction unless one with the same bank
+// reference already exists for the merchant, reporting whether it was inserted.
+// It is shared by backfills and the bank sync.
+func (s *ReconciliationService) insertBankTransaction(ctx context.Context, merchantID uuid.UUID, tx *models.BankTransaction) (bool, error) {
+	query := `
+		INSERT INTO bank_transactions (
+			merchant_id, bank_reference, payment_reference, amount_cents, currency,
+			debtor_name, debtor_iban, creditor_iban, transaction_date, booking_date,
+			value_date, status
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (merchant_id, bank_reference) WHERE bank_reference IS NOT NULL DO NOTHING`
+
+	transactionDate := tx.TransactionDate
+	if transactionDate.IsZero() {
+		transactionDate = tx.BookingDate
+	}
+
+	result, err := s.db.ExecContext(ctx, query,
+		merchantID,
+		tx.BankReference,
+		tx.PaymentReference,
+		tx.AmountCents,
+		tx.Currency,
+		tx.DebtorName,
+		tx.DebtorIBAN,
+		tx.CreditorIBAN,
+		transactionDate,
+		tx.BookingDate,
+		tx.ValueDate,
+		models.TransactionStatusDetected,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to insert bank transaction: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to insert bank transaction: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (s *ReconciliationService) detectedBackfillTransactions(ctx context.Context, merchantID uuid.UUID, bankRefs []string) ([]models.BankTransaction, error) {
+	if len(bankRefs) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT` + transactionColumns + `
+		FROM bank_transactions
+		WHERE merchant_id = $1 AND bank_reference = ANY($2) AND status = $3
+		ORDER BY booking_date, transaction_id`
+
+	rows, err := s.db.QueryContext(ctx, query, merchantID, pq.Array(bankRefs), models.TransactionStatusDetected)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load backfilled transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []models.BankTransaction
+	for rows.Next() {
+		tx, err := scanBankTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		transactions = append(transactions, *tx)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load backfilled transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// historicalSessions loads the unpaid sessions the given transactions may
+// refer to, by the same reference rules as planMatches, which makes the final
+// decision. Expired sessions are included because a historical transfer may
+// well have arrived after the checkout page timed out.
+func (s *ReconciliationService) historicalSessions(ctx context.Context, merchantID uuid.UUID, transactions []models.BankTransaction) ([]models.PaymentSession, error) {
+	var refs []string
+	for _, tx := range transactions {
+		if tx.PaymentReference == nil {
+			continue
+		}
+		if ref := normalizeReference(*tx.PaymentReference); ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT session_id, merchant_id, content_id, amount_cents, currency,
+		       payment_reference, status, expires_at, created_at
+		FROM payment_sessions
+		WHERE merchant_id = $1 AND status IN ($3, $4)
+		  AND EXISTS (
+			SELECT 1 FROM unnest($2::text[]) AS r(ref)
+			WHERE r.ref = ` + normalizedReferenceSQL + `
+			   OR (length(r.ref) >= $5 AND ` + normalizedReferenceSQL + ` LIKE r.ref || '%')
+			   OR (length(` + normalizedReferenceSQL + `) >= $5 AND r.ref LIKE '%' || ` + normalizedReferenceSQL + ` || '%')
+		  )
+		ORDER BY created_at`
+
+	rows, err := s.db.QueryContext(ctx, query, merchantID, pq.Array(refs), models.PaymentStatusPending, models.PaymentStatusExpired, minFuzzyReferenceLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load historical sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []models.PaymentSession
+	for rows.Next() {
+		var session models.PaymentSession
+		err := rows.Scan(
+			&session.SessionID,
+			&session.MerchantID,
+			&session.ContentID,
+			&session.AmountCents,
+			&session.Currency,
+			&session.PaymentReference,
+			&session.Status,
+			&session.ExpiresAt,
+			&session.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan payment session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load historical sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// applyHistoricalMatch marks the session paid as of the booking date and the
+// transaction matched. Both updates are guarded on the current status so a
+// retried backfill never applies the same match twice.
+func (s *ReconciliationService) applyHistoricalMatch(ctx context.Context, match ProposedMatch, paidAt time.Time, audit *MatchAudit) error {
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin backfill match: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	sessionQuery := `
+		UPDATE payment_sessions
+		SET status = $1, paid_at = $2, access_granted_at = $2,
+		    access_expires_at = ` + accessExpiresAtSQL + `
+		WHERE session_id = $3 AND status IN ($4, $5)
+		RETURNING content_id, (SELECT price_cents FROM content WHERE content_id = payment_sessions.content_id)`
+
+	var contentID uuid.UUID
+	var currentPrice sql.NullInt64
+	err = dbTx.QueryRowContext(ctx, sessionQuery,
+		models.PaymentStatusPaid,
+		paidAt,
+		match.SessionID,
+		models.PaymentStatusPending,
+		models.PaymentStatusExpired,
+	).Scan(&contentID, &currentPrice)
+	if err == sql.ErrNoRows {
+		// Settled by someone else in the meantime; leave the transaction detected
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to mark session paid: %w", err)
+	}
+	if _, _, err := finishMatch(ctx, dbTx, match, audit); err != nil {
+		return err
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit backfill match: %w", err)
+	}
+
+	warnPriceChanged(s.logger, match.SessionID, contentID, match.AmountCents, currentPrice)
+	return nil
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+// Balance check metrics, published through expvar
+var (
+	balanceDiscrepancies = expvar.NewInt("balance_check_discrepancies")
+	balanceLastCheck     = expvar.NewInt("balance_check_last_run_unix")
+)
+
+// BalanceDiscrepancy is a merchant and currency where the paid sessions do not
+// add up to the bank transactions settling them. A positive DifferenceCents
+// means sessions were marked paid without the money arriving.
+type BalanceDiscrepancy struct {
+	MerchantID      uuid.UUID `json:"merchant_id"`
+	Currency        string    `json:"currency"`
+	LedgerCents     int64     `json:"ledger_cents"`
+	BankCents       int64     `json:"bank_cents"`
+	DifferenceCents int64     `json:"difference_cents"`
+	// Alert is set when the difference exceeds the configured threshold
+	Alert bool `json:"alert"`
+}
+
+// BalanceReport lists every merchant and currency whose books and bank
+// transactions differ
+type BalanceReport struct {
+	CheckedAt      time.Time            `json:"checked_at"`
+	ThresholdCents int64                `json:"threshold_cents"`
+	Alerts         int                  `json:"alerts"`
+	Discrepancies  []BalanceDiscrepancy `json:"discrepancies"`
+}
+
+// CheckBalances compares, per merchant and currency, the gross amount of paid
+// sessions with the settled bank transactions (matched, processed or under
+// dispute). Fees are charged on the session amount, so they cancel out and
+// the gross amounts must agree exactly. Refunded sessions count as paid: their
+// transfer did come in, and the refund is paid back outside this system.
+func (s *ReconciliationService) CheckBalances(ctx context.Context) (*BalanceReport, error) {
+	query := `
+		WITH ledger AS (
+			SELECT merchant_id, currency, SUM(amount_cents) AS cents
+			FROM payment_sessions
+			WHERE status IN ($1, $2)
+			GROUP BY merchant_id, currency
+		), bank AS (
+			SELECT merchant_id, currency, SUM(amount_cents) AS cents
+			FROM bank_transactions
+			WHERE status IN ($3, $4, $5)
+			GROUP BY merchant_id, currency
+		)
+		SELECT COALESCE(l.merchant_id, b.merchant_id), COALESCE(l.currency, b.currency),
+		       COALESCE(l.cents, 0), COALESCE(b.cents, 0)
+		FROM ledger l
+		FULL OUTER JOIN bank b ON b.merchant_id = l.merchant_id AND b.currency = l.currency
+		WHERE COALESCE(l.cents, 0) <> COALESCE(b.cents, 0)
+		ORDER BY 1, 2`
+
+	rows, err := s.db.QueryContext(ctx, query,
+		models.PaymentStatusPaid,
+		models.PaymentStatusRefunded,
+		models.TransactionStatusMatched,
+		models.TransactionStatusProcessed,
+		models.TransactionStatusDisputed,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check balances: %w", err)
+	}
+	defer rows.Close()
+
+	report := &BalanceReport{
+		CheckedAt:      time.Now(),
+		ThresholdCents: s.config.BalanceCheck.ThresholdCents,
+		Discrepancies:  []BalanceDiscrepancy{},
+	}
+	for rows.Next() {
+		var d BalanceDiscrepancy
+		if err := rows.Scan(&d.MerchantID, &d.Currency, &d.LedgerCents, &d.BankCents); err != nil {
+			return nil, fmt.Errorf("failed to scan balance: %w", err)
+		}
+		d.DifferenceCents = d.LedgerCents - d.BankCents
+		d.Alert = abs64(d.DifferenceCents) > report.ThresholdCents
+		if d.Alert {
+			report.Alerts++
+		}
+		report.Discrepancies = append(report.Discrepancies, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to check balances: %w", err)
+	}
+
+	return report, nil
+}
+
+// RunBalanceChecks checks balances every cfg.BalanceCheck.Interval until ctx is
+// cancelled, raising an alert for each discrepancy over the threshold
+func (s *ReconciliationService) RunBalanceChecks(ctx context.Context) {
+	ticker := time.NewTicker(s.config.BalanceCheck.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := s.CheckBalances(ctx)
+			if err != nil {
+				s.logger.Warn("Failed to check balances", zap.Error(err))
+				continue
+			}
+			s.alertBalances(ctx, report)
+		}
+	}
+}
+
+// alertBalances logs and counts the discrepancies of a report and posts the
+// report to cfg.BalanceCheck.AlertWebhookURL when one is configured
+func (s *ReconciliationService) alertBalances(ctx context.Context, report *BalanceReport) {
+	balanceLastCheck.Set(report.CheckedAt.Unix())
+	balanceDiscrepancies.Set(int64(report.Alerts))
+	if report.Alerts == 0 {
+		return
+	}
+
+	for _, d := range report.Discrepancies {
+		if !d.Alert {
+			continue
+		}
+		s.logger.Error("Merchant balance does not match bank transactions",
+			zap.String("merchant_id", d.MerchantID.String()),
+			zap.String("currency", d.Currency),
+			zap.Int64("ledger_cents", d.LedgerCents),
+			zap.Int64("bank_cents", d.BankCents),
+			zap.Int64("difference_cents", d.DifferenceCents),
+		)
+	}
+
+	url := s.config.BalanceCheck.AlertWebhookURL
+	if url == "" {
+		return
+	}
+	if err := postBalanceAlert(ctx, url, s.config.Webhook.DeliveryTimeout, report); err != nil {
+		s.logger.Warn("Failed to send balance alert", zap.Error(err))
+	}
+}
+
+func postBalanceAlert(ctx context.Context, url string, timeout time.Duration, report *BalanceReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode balance alert: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build balance alert: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post balance alert: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("balance alert rejected with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
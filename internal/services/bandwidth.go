@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+// bandwidthCapSetting is the merchant setting with the monthly bandwidth cap
+// in bytes, request and response bodies combined
+const bandwidthCapSetting = "bandwidth_cap_bytes"
+
+// BandwidthUsage is the proxied traffic of a merchant in a calendar month (UTC)
+type BandwidthUsage struct {
+	Month    string `json:"month"`
+	BytesIn  int64  `json:"bytes_in"`
+	BytesOut int64  `json:"bytes_out"`
+	CapBytes *int64 `json:"cap_bytes,omitempty"`
+}
+
+type bandwidthKey struct {
+	merchantID uuid.UUID
+	contentID  uuid.UUID
+	month      time.Time
+}
+
+type bandwidthCount struct {
+	in, out int64
+}
+
+type cachedBandwidth struct {
+	month    time.Time
+	total    int64
+	loadedAt time.Time
+}
+
+// BandwidthService meters the request and response body bytes the proxy moves
+// per merchant and content. Like access counts, increments are buffered in
+// memory and written in batches, so proxying never waits on the database;
+// Flush must run on shutdown.
+type BandwidthService struct {
+	db     *sql.DB
+	config *config.Config
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	pending map[bandwidthKey]bandwidthCount
+	totals  map[uuid.UUID]cachedBandwidth
+}
+
+// NewBandwidthService creates a new bandwidth service
+func NewBandwidthService(db *sql.DB, cfg *config.Config, logger *zap.Logger) *BandwidthService {
+	return &BandwidthService{
+		db:      db,
+		config:  cfg,
+		logger:  logger,
+		pending: make(map[bandwidthKey]bandwidthCount),
+		totals:  make(map[uuid.UUID]cachedBandwidth),
+	}
+}
+
+// monthStart returns the first instant of t's calendar month in UTC
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Record adds the bytes of one proxied request. contentID is uuid.Nil for
+// paths that are not registered as content.
+func (s *BandwidthService) Record(merchantID, contentID uuid.UUID, bytesIn, bytesOut int64) {
+	key := bandwidthKey{merchantID: merchantID, contentID: contentID, month: monthStart(time.Now())}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.pending[key]
+	c.in += bytesIn
+	c.out += bytesOut
+	s.pending[key] = c
+}
+
+// OverCap reports whether the merchant has used up its "bandwidth_cap_bytes"
+// for the current month. Stored totals are cached for
+// cfg.Bandwidth.UsageTTL, and each instance adds its own unflushed bytes, so
+// with several instances the cap can be overshot by about one flush interval
+// of traffic.
+func (s *BandwidthService) OverCap(ctx context.Context, merchant *models.Merchant) (bool, error) {
+	limit, ok := bandwidthCap(merchant)
+	if !ok {
+		return false, nil
+	}
+	month := monthStart(time.Now())
+
+	s.mu.Lock()
+	cached, fresh := s.totals[merchant.MerchantID]
+	fresh = fresh && cached.month.Equal(month) && time.Since(cached.loadedAt) < s.config.Bandwidth.UsageTTL
+	s.mu.Unlock()
+
+	if !fresh {
+		usage, err := s.stored(ctx, merchant.MerchantID, month)
+		if err != nil {
+			return false, err
+		}
+		cached = cachedBandwidth{month: month, total: usage.BytesIn + usage.BytesOut, loadedAt: time.Now()}
+		s.mu.Lock()
+		s.totals[merchant.MerchantID] = cached
+		s.mu.Unlock()
+	}
+
+	in, out := s.unflushed(merchant.MerchantID, month)
+	return cached.total+in+out >= limit, nil
+}
+
+// Usage returns the merchant's bandwidth for the current month, including
+// bytes this instance has not flushed yet
+func (s *BandwidthService) Usage(ctx context.Context, merchant *models.Merchant) (*BandwidthUsage, error) {
+	month := monthStart(time.Now())
+	usage, err := s.stored(ctx, merchant.MerchantID, month)
+	if err != nil {
+		return nil, err
+	}
+	in, out := s.unflushed(merchant.MerchantID, month)
+	usage.BytesIn += in
+	usage.BytesOut += out
+	if limit, ok := bandwidthCap(merchant); ok {
+		usage.CapBytes = &limit
+	}
+	return usage, nil
+}
+
+func (s *BandwidthService) stored(ctx context.Context, merchantID uuid.UUID, month time.Time) (*BandwidthUsage, error) {
+	usage := &BandwidthUsage{Month: month.Format("2006-01")}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(bytes_in), 0), COALESCE(SUM(bytes_out), 0)
+		FROM bandwidth_usage
+		WHERE merchant_id = $1 AND month = $2`,
+		merchantID, month,
+	).Scan(&usage.BytesIn, &usage.BytesOut)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bandwidth usage: %w", err)
+	}
+	return usage, nil
+}
+
+func (s *BandwidthService) unflushed(merchantID uuid.UUID, month time.Time) (int64, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var in, out int64
+	for key, c := range s.pending {
+		if key.merchantID == merchantID && key.month.Equal(month) {
+			in += c.in
+			out += c.out
+		}
+	}
+	return in, out
+}
+
+// Run flushes buffered byte counts every cfg.Bandwidth.FlushInterval until ctx
+// is cancelled
+func (s *BandwidthService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Bandwidth.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Flush(ctx); err != nil {
+				s.logger.Warn("Failed to flush bandwidth usage", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Flush adds the buffered byte counts to bandwidth_usage. On failure they are
+// put back so a later flush can retry them.
+func (s *BandwidthService) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = make(map[bandwidthKey]bandwidthCount)
+	s.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	merchantIDs := make([]string, 0, len(batch))
+	contentIDs := make([]string, 0, len(batch))
+	months := make([]string, 0, len(batch))
+	bytesIn := make([]int64, 0, len(batch))
+	bytesOut := make([]int64, 0, len(batch))
+	for key, c := range batch {
+		merchantIDs = append(merchantIDs, key.merchantID.String())
+		contentIDs = append(contentIDs, key.contentID.String())
+		months = append(months, key.month.Format("2006-01-02"))
+		bytesIn = append(bytesIn, c.in)
+		bytesOut = append(bytesOut, c.out)
+	}
+
+	query := `
+		INSERT INTO bandwidth_usage (merchant_id, content_id, month, bytes_in, bytes_out)
+		SELECT * FROM unnest($1::uuid[], $2::uuid[], $3::date[], $4::bigint[], $5::bigint[])
+		ON CONFLICT (merchant_id, content_id, month) DO UPDATE
+		SET bytes_in = bandwidth_usage.bytes_in + EXCLUDED.bytes_in,
+		    bytes_out = bandwidth_usage.bytes_out + EXCLUDED.bytes_out,
+		    updated_at = NOW()`
+
+	_, err := s.db.ExecContext(ctx, query,
+		pq.Array(merchantIDs),
+		pq.Array(contentIDs),
+		pq.Array(months),
+		pq.Array(bytesIn),
+		pq.Array(bytesOut),
+	)
+	if err != nil {
+		s.mu.Lock()
+		for key, c := range batch {
+			merged := s.pending[key]
+			merged.in += c.in
+			merged.out += c.out
+			s.pending[key] = merged
+		}
+		s.mu.Unlock()
+		return fmt.Errorf("failed to flush bandwidth usage: %w", err)
+	}
+
+	// Flushed bytes are now part of the stored totals
+	s.mu.Lock()
+	for key, c := range batch {
+		if cached, ok := s.totals[key.merchantID]; ok && cached.month.Equal(key.month) {
+			cached.total += c.in + c.out
+			s.totals[key.merchantID] = cached
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// bandwidthCap returns the merchant's monthly cap, if one is set
+func bandwidthCap(merchant *models.Merchant) (int64, bool) {
+	v, ok := merchant.Settings[bandwidthCapSetting].(float64)
+	if !ok || v <= 0 {
+		return 0, false
+	}
+	return int64(v), true
+}
+
+// NextMonth returns when the current bandwidth month ends
+func NextMonth(now time.Time) time.Time {
+	return monthStart(now).AddDate(0, 1, 0)
+}
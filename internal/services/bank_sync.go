@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/events"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/money"
+	"go.uber.org/zap"
+)
+
+// BankClient fetches the incoming transfers of the accounts merchants are paid
+// into. A PSD2 account information client and the mock in package bank both
+// satisfy it.
+type BankClient interface {
+	// Transactions returns the credit transfers booked at or after since.
+	// Returning a transaction twice is harmless.
+	Transactions(ctx context.Context, since time.Time) ([]models.BankTransaction, error)
+}
+
+// BankSyncService polls the bank for new transactions, stores them and settles
+// the pending sessions they pay for
+type BankSyncService struct {
+	db             *sql.DB
+	config         *config.Config
+	client         BankClient
+	reconciliation *ReconciliationService
+	bus            *events.Bus
+	logger         *zap.Logger
+
+	// since is where the next poll starts; only the Run goroutine touches it
+	since time.Time
+}
+
+// NewBankSyncService creates a bank sync service polling client
+func NewBankSyncService(db *sql.DB, cfg *config.Config, client BankClient, reconciliation *ReconciliationService, bus *events.Bus, logger *zap.Logger) *BankSyncService {
+	return &BankSyncService{
+		db:             db,
+		config:         cfg,
+		client:         client,
+		reconciliation: reconciliation,
+		bus:            bus,
+		logger:         logger,
+	}
+}
+
+// BankSyncResult counts what one sync did
+type BankSyncResult struct {
+	Fetched  int
+	Inserted int
+	Skipped  int
+	Matched  int
+}
+
+// Run syncs every cfg.Payment.BankSyncIntervalMins minutes until ctx is
+// cancelled
+func (s *BankSyncService) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(s.config.Payment.BankSyncIntervalMins) * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result, err := s.Sync(ctx)
+			if err != nil {
+				s.logger.Warn("Failed to sync bank transactions", zap.Error(err))
+				continue
+			}
+			s.logger.Info("Synced bank transactions",
+				zap.Int("fetched", result.Fetched),
+				zap.Int("inserted", result.Inserted),
+				zap.Int("skipped", result.Skipped),
+				zap.Int("matched", result.Matched),
+			)
+		}
+	}
+}
+
+// Sync fetches transactions booked since the previous sync, stores the new
+// ones and matches every detected transaction against pending sessions.
+//
+// Polls overlap by one interval so transactions booked late are not missed;
+// duplicates are skipped on (merchant_id, bank_reference). The first poll looks
+// back cfg.Payment.MaxSessionLifetime, since older transfers cannot pay for a
+// pending session anyway.
+func (s *BankSyncService) Sync(ctx context.Context) (*BankSyncResult, error) {
+	now := time.Now()
+	since := s.since
+	if since.IsZero() {
+		since = now.Add(-s.config.Payment.MaxSessionLifetime)
+	}
+
+	transactions, err := s.client.Transactions(ctx, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch bank transactions: %w", err)
+	}
+	result := &BankSyncResult{Fetched: len(transactions)}
+
+	if err := s.store(ctx, transactions, result); err != nil {
+		return nil, err
+	}
+	s.since = now.Add(-time.Duration(s.config.Payment.BankSyncIntervalMins) * time.Minute)
+
+	if result.Matched, err = s.match(ctx); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// store inserts fetched transactions for the merchant owning the credited
+// account. Transactions without a bank reference cannot be deduplicated and
+// those for unknown accounts are not ours; both are skipped.
+func (s *BankSyncService) store(ctx context.Context, transactions []models.BankTransaction, result *BankSyncResult) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+	merchants, err := s.merchantsByIBAN(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range transactions {
+		tx := &transactions[i]
+		merchantID, ok := merchants[money.NormalizeIBAN(tx.CreditorIBAN)]
+		if !ok || tx.BankReference == nil || *tx.BankReference == "" {
+			result.Skipped++
+			continue
+		}
+		inserted, err := s.reconciliation.insertBankTransaction(ctx, merchantID, tx)
+		if err != nil {
+			return err
+		}
+		if inserted {
+			result.Inserted++
+		}
+	}
+	return nil
+}
+
+func (s *BankSyncService) merchantsByIBAN(ctx context.Context) (map[string]uuid.UUID, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT merchant_id, bank_account_iban FROM merchants`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load merchant accounts: %w", err)
+	}
+	defer rows.Close()
+
+	merchants := make(map[string]uuid.UUID)
+	for rows.Next() {
+		var merchantID uuid.UUID
+		var iban string
+		if err := rows.Scan(&merchantID, &iban); err != nil {
+			return nil, fmt.Errorf("failed to scan merchant account: %w", err)
+		}
+		merchants[money.NormalizeIBAN(iban)] = merchantID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load merchant accounts: %w", err)
+	}
+	return merchants, nil
+}
+
+// match applies the matches planMatches finds between detected transactions
+// and pending sessions, publishing the events of each, see applyReport. It
+// returns the number of sessions settled.
+func (s *BankSyncService) match(ctx context.Context) (int, error) {
+	transactions, err := s.reconciliation.detectedTransactions(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(transactions) == 0 {
+		return 0, nil
+	}
+	sessions, ibans, err := s.reconciliation.pendingSessions(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	report := planMatches(transactions, sessions, ibans, newMatchOptions(s.config))
+	return applyReport(ctx, s.db, s.logger, report, func(match ProposedMatch, audit *MatchAudit) error {
+		published, err := s.applyMatch(ctx, match, audit)
+		if err != nil {
+			return err
+		}
+		for _, event := range published {
+			s.bus.Publish(event)
+		}
+		return nil
+	})
+}
+
+// applyMatch marks the session paid with an access window of the content's
+// access duration, grants that access and marks the transaction matched, in
+// one database transaction, and returns the events to publish. A session
+// that expired less than cfg.Payment.ExpiryGracePeriod ago is reactivated,
+// which is announced with a PaymentPaidAfterExpiry next to the PaymentPaid. It
+// returns nil when the session was settled or left the grace period in the
+// meantime, in which case the transaction stays detected.
+func (s *BankSyncService) applyMatch(ctx context.Context, match ProposedMatch, audit *MatchAudit) ([]events.Event, error) {
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin match: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	paidAt := time.Now()
+	sessionQuery := `
+		UPDATE payment_sessions
+		SET status = $1, paid_at = $2, access_granted_at = $2,
+		    access_expires_at = ` + accessExpiresAtSQL + `
+		WHERE session_id = $3 AND (status = $4 OR (status = $5 AND expires_at > $6))
+		RETURNING access_expires_at, content_id, amount_cents, currency, expires_at,
+		          (SELECT price_cents FROM content WHERE content_id = payment_sessions.content_id)`
+
+	var accessExpiresAt, expiresAt time.Time
+	var contentID uuid.UUID
+	var amountCents int
+	var currency string
+	var currentPrice sql.NullInt64
+	err = dbTx.QueryRowContext(ctx, sessionQuery,
+		models.PaymentStatusPaid,
+		paidAt,
+		match.SessionID,
+		models.PaymentStatusPending,
+		models.PaymentStatusExpired,
+		paidAt.Add(-s.config.Payment.ExpiryGracePeriod),
+	).Scan(&accessExpiresAt, &contentID, &amountCents, &currency, &expiresAt, &currentPrice)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark session paid: %w", err)
+	}
+	if renewed, ok, err := finishMatch(ctx, dbTx, match, audit); err != nil {
+		return nil, err
+	} else if ok {
+		accessExpiresAt = renewed
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit match: %w", err)
+	}
+
+	warnPriceChanged(s.logger, match.SessionID, contentID, match.AmountCents, currentPrice)
+	if match.Overpaid {
+		s.logger.Warn("Payment session overpaid",
+			zap.String("session_id", match.SessionID.String()),
+			zap.String("transaction_id", match.TransactionID.String()),
+			zap.Int("amount_cents", match.AmountCents),
+			zap.Int("paid_cents", match.PaidCents),
+		)
+	}
+	published := []events.Event{events.PaymentPaid{
+		SessionID:        match.SessionID,
+		MerchantID:       match.MerchantID,
+		PaymentReference: match.PaymentReference,
+		AmountCents:      amountCents,
+		Currency:         currency,
+		PaidAt:           paidAt,
+		AccessExpiresAt:  accessExpiresAt,
+	}}
+	// A pending session the expiry job has not reached yet counts as late too
+	if expiresAt.Before(paidAt) {
+		s.logger.Info("Settled payment session after expiry",
+			zap.String("session_id", match.SessionID.String()),
+			zap.String("transaction_id", match.TransactionID.String()),
+			zap.Duration("late_by", paidAt.Sub(expiresAt)),
+		)
+		published = append(published, events.PaymentPaidAfterExpiry{
+			SessionID:     match.SessionID,
+			MerchantID:    match.MerchantID,
+			TransactionID: match.TransactionID,
+			ExpiredAt:     expiresAt,
+			PaidAt:        paidAt,
+		})
+	}
+	return published, nil
+}
@@ -1,39 +1,456 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mh74hf/micro-payments/internal/access"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/events"
 	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/money"
+	"github.com/mh74hf/micro-payments/internal/validation"
 	"go.uber.org/zap"
 )
 
+var (
+	// ErrInvalidAccessRules is returned when a content's access rules fail validation
+	ErrInvalidAccessRules = errors.New("invalid access rules")
+	// ErrContentExists is returned when the merchant already has content at the path
+	ErrContentExists = errors.New("content already exists for path")
+	// ErrContentTypeNotAllowed is returned for content types that are unknown
+	// or not in the merchant's "content_types" setting
+	ErrContentTypeNotAllowed = errors.New("content type not allowed")
+	// ErrInvalidCurrency is returned for currencies that are not ISO 4217 codes
+	ErrInvalidCurrency = errors.New("invalid currency")
+	// ErrInvalidPrice is returned for prices outside the payment amount limits
+	ErrInvalidPrice = errors.New("invalid price")
+	// ErrInvalidAccessDuration is returned for negative access durations
+	ErrInvalidAccessDuration = errors.New("access_duration_seconds must not be negative, 0 grants permanent access")
+)
+
 // ContentService handles content-related operations
 type ContentService struct {
 	db     *sql.DB
+	config *config.Config
+	bus    *events.Bus
 	logger *zap.Logger
+
+	mu       sync.Mutex
+	patterns map[uuid.UUID]*patternSet
+	rules    *access.Cache
+
+	countsMu      sync.Mutex
+	counts        map[uuid.UUID]pendingAccess
+	sessionCounts map[uuid.UUID]pendingAccess
 }
 
 // NewContentService creates a new content service
-func NewContentService(db *sql.DB, logger *zap.Logger) *ContentService {
+func NewContentService(db *sql.DB, cfg *config.Config, bus *events.Bus, logger *zap.Logger) *ContentService {
 	return &ContentService{
-		db:     db,
-		logger: logger,
+		db:            db,
+		config:        cfg,
+		bus:           bus,
+		logger:        logger,
+		patterns:      make(map[uuid.UUID]*patternSet),
+		rules:         access.NewCache(cfg.Cache.AccessRulesEntries),
+		counts:        make(map[uuid.UUID]pendingAccess),
+		sessionCounts: make(map[uuid.UUID]pendingAccess),
 	}
 }
 
-// GetContentByPath retrieves content by merchant ID and path
+const contentColumns = `
+		content_id, merchant_id, path, title, description,
+		price_cents, currency, access_duration_seconds, content_type, access_rules, is_active,
+		created_at, updated_at`
+
+// GetContentByPath retrieves content by merchant ID and path. An exact path
+// match wins; otherwise the most specific pattern entry is used, see
+// patternSet.resolve for the precedence rules.
 func (s *ContentService) GetContentByPath(merchantID uuid.UUID, path string) (*models.Content, error) {
-	var content models.Content
 	query := `
-		SELECT content_id, merchant_id, path, title, description, 
-		       price_cents, currency, access_duration_seconds, content_type, is_active,
-		       created_at, updated_at
+		SELECT` + contentColumns + `
 		FROM content 
 		WHERE merchant_id = $1 AND path = $2 AND is_active = true`
 
-	err := s.db.QueryRow(query, merchantID, path).Scan(
+	content, err := scanContent(s.db.QueryRow(query, merchantID, path))
+	if err == nil {
+		return content, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("content not found: %w", err)
+	}
+
+	set, err := s.merchantPatterns(merchantID)
+	if err != nil {
+		return nil, err
+	}
+	if content := set.resolve(path); content != nil {
+		return content, nil
+	}
+	return nil, fmt.Errorf("content not found: %w", sql.ErrNoRows)
+}
+
+// GetContentByID retrieves active content by its ID
+func (s *ContentService) GetContentByID(contentID uuid.UUID) (*models.Content, error) {
+	return getContentByID(context.Background(), s.db, contentID)
+}
+
+// getContentByID loads active content by ID. PaymentService shares it, so
+// sessions are priced from the same column mapping as the content API.
+func getContentByID(ctx context.Context, db queryRower, contentID uuid.UUID) (*models.Content, error) {
+	query := `
+		SELECT` + contentColumns + `
+		FROM content
+		WHERE content_id = $1 AND is_active = true`
+
+	content, err := scanContent(db.QueryRowContext(ctx, query, contentID))
+	if err != nil {
+		return nil, fmt.Errorf("content not found: %w", err)
+	}
+	return content, nil
+}
+
+// merchantPatterns returns the compiled pattern entries of a merchant, reloading
+// them from the database once cfg.Cache.ContentPatternsTTL has passed
+func (s *ContentService) merchantPatterns(merchantID uuid.UUID) (*patternSet, error) {
+	s.mu.Lock()
+	set, ok := s.patterns[merchantID]
+	s.mu.Unlock()
+	if ok && time.Since(set.loadedAt) < s.config.Cache.ContentPatternsTTL {
+		return set, nil
+	}
+
+	query := `
+		SELECT` + contentColumns + `
+		FROM content
+		WHERE merchant_id = $1 AND is_active = true AND path ~ '[*?[]'`
+
+	rows, err := s.db.Query(query, merchantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load content patterns: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.Content
+	for rows.Next() {
+		content, err := scanContent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan content pattern: %w", err)
+		}
+		entries = append(entries, *content)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load content patterns: %w", err)
+	}
+
+	set = compilePatterns(entries, s.logger)
+	s.mu.Lock()
+	s.patterns[merchantID] = set
+	s.mu.Unlock()
+
+	return set, nil
+}
+
+// Page sizes of ListContent
+const (
+	DefaultContentPageSize = 50
+	MaxContentPageSize     = 200
+)
+
+// ContentPage is one page of ListContent with the total number of entries
+type ContentPage struct {
+	Content []models.Content
+	Total   int
+	Limit   int
+	Offset  int
+}
+
+// ListContent returns the active content of a merchant ordered by path. limit
+// defaults to DefaultContentPageSize and is capped at MaxContentPageSize.
+func (s *ContentService) ListContent(ctx context.Context, merchantID uuid.UUID, limit, offset int) (*ContentPage, error) {
+	if limit <= 0 {
+		limit = DefaultContentPageSize
+	}
+	if limit > MaxContentPageSize {
+		limit = MaxContentPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	page := &ContentPage{Content: []models.Content{}, Limit: limit, Offset: offset}
+
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM content WHERE merchant_id = $1 AND is_active = true`,
+		merchantID,
+	).Scan(&page.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count content: %w", err)
+	}
+
+	query := `
+		SELECT` + contentColumns + `
+		FROM content
+		WHERE merchant_id = $1 AND is_active = true
+		ORDER BY path
+		LIMIT $2 OFFSET $3`
+
+	rows, err := s.db.QueryContext(ctx, query, merchantID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list content: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		content, err := scanContent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan content: %w", err)
+		}
+		page.Content = append(page.Content, *content)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list content: %w", err)
+	}
+
+	return page, nil
+}
+
+// CreateContent stores a new content entry for a merchant. Access rules are
+// validated first, so a typo in a method list is rejected instead of silently
+// leaving the method paywalled.
+func (s *ContentService) CreateContent(ctx context.Context, content *models.Content) (*models.Content, error) {
+	path, err := NormalizeContentPath(content.Path)
+	if err != nil {
+		return nil, err
+	}
+	content.Path = path
+
+	currency, ok := validation.NormalizeCurrency(content.Currency)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q is not an ISO 4217 currency code", ErrInvalidCurrency, content.Currency)
+	}
+	content.Currency = currency
+	if err := s.checkPrice(content.PriceCents); err != nil {
+		return nil, err
+	}
+	if content.AccessDurationSeconds < 0 {
+		return nil, ErrInvalidAccessDuration
+	}
+
+	if content.AccessRules == nil {
+		content.AccessRules = models.JSONMap{}
+	}
+	if err := access.ValidateRules(content.AccessRules); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAccessRules, err)
+	}
+	if content.ContentType == "" {
+		content.ContentType = models.ContentTypeWebpage
+	}
+	if err := s.checkContentType(ctx, content.MerchantID, content.ContentType); err != nil {
+		return nil, err
+	}
+	if err := checkContentLimit(ctx, s.db, content.MerchantID, uuid.Nil); err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO content (
+			merchant_id, path, title, description, price_cents, currency,
+			access_duration_seconds, content_type, access_rules
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING` + contentColumns
+
+	created, err := scanContent(s.db.QueryRowContext(ctx, query,
+		content.MerchantID,
+		content.Path,
+		content.Title,
+		content.Description,
+		content.PriceCents,
+		content.Currency,
+		content.AccessDurationSeconds,
+		content.ContentType,
+		content.AccessRules,
+	))
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return nil, ErrContentExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create content: %w", err)
+	}
+
+	s.contentChanged(created)
+	return created, nil
+}
+
+// checkPrice verifies that a price can be paid, i.e. lies within
+// payment.min_amount_cents and payment.max_amount_cents
+func (s *ContentService) checkPrice(priceCents int) error {
+	limits := s.config.Payment
+	if priceCents < limits.MinAmountCents || priceCents > limits.MaxAmountCents {
+		return fmt.Errorf("%w: price_cents must be between %d and %d", ErrInvalidPrice, limits.MinAmountCents, limits.MaxAmountCents)
+	}
+	return nil
+}
+
+// checkContentType verifies that ct is a known content type the merchant may
+// use, see models.Merchant.AllowsContentType
+func (s *ContentService) checkContentType(ctx context.Context, merchantID uuid.UUID, ct models.ContentType) error {
+	if !ct.Valid() {
+		return fmt.Errorf("%w: unknown content type %q", ErrContentTypeNotAllowed, ct)
+	}
+
+	merchant := models.Merchant{MerchantID: merchantID}
+	err := s.db.QueryRowContext(ctx, `SELECT settings FROM merchants WHERE merchant_id = $1`, merchantID).Scan(&merchant.Settings)
+	if err != nil {
+		return fmt.Errorf("merchant not found: %w", err)
+	}
+	if !merchant.AllowsContentType(ct) {
+		return fmt.Errorf("%w: %q is not enabled for this merchant", ErrContentTypeNotAllowed, ct)
+	}
+	return nil
+}
+
+// ContentUpdate holds the content fields to change; nil fields are left as is
+type ContentUpdate struct {
+	Title                 *string             `json:"title"`
+	Description           *string             `json:"description"`
+	PriceCents            *int                `json:"price_cents"`
+	Currency              *string             `json:"currency"`
+	AccessDurationSeconds *int                `json:"access_duration_seconds"`
+	ContentType           *models.ContentType `json:"content_type"`
+	AccessRules           *models.JSONMap     `json:"access_rules"`
+	IsActive              *bool               `json:"is_active"`
+}
+
+// UpdateContent applies update to content of a merchant. Sessions already
+// created keep their locked amount; new sessions use the new price.
+func (s *ContentService) UpdateContent(ctx context.Context, merchantID, contentID uuid.UUID, update ContentUpdate) (*models.Content, error) {
+	if update.Currency != nil {
+		currency, ok := validation.NormalizeCurrency(*update.Currency)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not an ISO 4217 currency code", ErrInvalidCurrency, *update.Currency)
+		}
+		update.Currency = &currency
+	}
+	if update.PriceCents != nil {
+		if err := s.checkPrice(*update.PriceCents); err != nil {
+			return nil, err
+		}
+	}
+	if update.AccessDurationSeconds != nil && *update.AccessDurationSeconds < 0 {
+		return nil, ErrInvalidAccessDuration
+	}
+	if update.ContentType != nil {
+		if err := s.checkContentType(ctx, merchantID, *update.ContentType); err != nil {
+			return nil, err
+		}
+	}
+	if update.AccessRules != nil {
+		if err := access.ValidateRules(*update.AccessRules); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAccessRules, err)
+		}
+	}
+	if update.IsActive != nil && *update.IsActive {
+		if err := checkContentLimit(ctx, s.db, merchantID, contentID); err != nil {
+			return nil, err
+		}
+	}
+
+	query := `
+		UPDATE content
+		SET title = COALESCE($1, title),
+		    description = COALESCE($2, description),
+		    price_cents = COALESCE($3, price_cents),
+		    currency = COALESCE($4, currency),
+		    access_duration_seconds = COALESCE($5, access_duration_seconds),
+		    access_rules = COALESCE($6, access_rules),
+		    is_active = COALESCE($7, is_active),
+		    content_type = COALESCE($8, content_type),
+		    updated_at = NOW()
+		WHERE content_id = $9 AND merchant_id = $10
+		RETURNING` + contentColumns
+
+	content, err := scanContent(s.db.QueryRowContext(ctx, query,
+		update.Title,
+		update.Description,
+		update.PriceCents,
+		update.Currency,
+		update.AccessDurationSeconds,
+		update.AccessRules,
+		update.IsActive,
+		update.ContentType,
+		contentID,
+		merchantID,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update content: %w", err)
+	}
+
+	s.contentChanged(content)
+	return content, nil
+}
+
+// DeleteContent deactivates content of a merchant. The row is kept because
+// payment sessions and access grants refer to it.
+func (s *ContentService) DeleteContent(ctx context.Context, merchantID, contentID uuid.UUID) error {
+	query := `
+		UPDATE content
+		SET is_active = false, updated_at = NOW()
+		WHERE content_id = $1 AND merchant_id = $2
+		RETURNING` + contentColumns
+
+	content, err := scanContent(s.db.QueryRowContext(ctx, query, contentID, merchantID))
+	if err != nil {
+		return fmt.Errorf("failed to delete content: %w", err)
+	}
+
+	s.contentChanged(content)
+	return nil
+}
+
+// AccessRules returns the compiled access rules of content. They are compiled
+// once per content version and then evaluated from memory on every request.
+func (s *ContentService) AccessRules(content *models.Content) (*access.Rules, error) {
+	return s.rules.Rules(content)
+}
+
+// InvalidateMerchant drops the cached pattern entries of a merchant
+func (s *ContentService) InvalidateMerchant(merchantID uuid.UUID) {
+	s.mu.Lock()
+	delete(s.patterns, merchantID)
+	s.mu.Unlock()
+}
+
+// InvalidateAll drops every cached pattern set and compiled rule set
+func (s *ContentService) InvalidateAll() {
+	s.mu.Lock()
+	s.patterns = make(map[uuid.UUID]*patternSet)
+	s.mu.Unlock()
+	s.rules.Reset()
+}
+
+// contentChanged makes a content change visible right away on this instance and
+// tells the other instances through the ContentChanged event
+func (s *ContentService) contentChanged(content *models.Content) {
+	s.InvalidateMerchant(content.MerchantID)
+	s.rules.Invalidate(content.ContentID)
+	s.bus.Publish(events.ContentChanged{
+		ContentID:  content.ContentID,
+		MerchantID: content.MerchantID,
+		ChangedAt:  time.Now(),
+	})
+}
+
+func scanContent(row rowScanner) (*models.Content, error) {
+	var content models.Content
+	err := row.Scan(
 		&content.ContentID,
 		&content.MerchantID,
 		&content.Path,
@@ -43,14 +460,16 @@ func (s *ContentService) GetContentByPath(merchantID uuid.UUID, path string) (*m
 		&content.Currency,
 		&content.AccessDurationSeconds,
 		&content.ContentType,
+		&content.AccessRules,
 		&content.IsActive,
 		&content.CreatedAt,
 		&content.UpdatedAt,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("content not found: %w", err)
+		return nil, err
 	}
 
+	content.CurrencyMinorUnits = money.Lookup(content.Currency).Exponent
 	return &content, nil
 }
 
@@ -59,7 +478,7 @@ func (s *ContentService) CheckAccess(contentID uuid.UUID, userIdentifier string)
 	var access models.ContentAccess
 	query := `
 		SELECT access_id, session_id, merchant_id, content_id, user_identifier,
-		       granted_at, expires_at, last_accessed_at, access_count, is_active
+		       granted_at, expires_at, last_accessed_at, access_count, is_active, is_free_trial
 		FROM content_access 
 		WHERE content_id = $1 AND user_identifier = $2 AND is_active = true AND expires_at > NOW()`
 
@@ -74,6 +493,7 @@ func (s *ContentService) CheckAccess(contentID uuid.UUID, userIdentifier string)
 		&access.LastAccessedAt,
 		&access.AccessCount,
 		&access.IsActive,
+		&access.IsFreeTrial,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("access not found: %w", err)
@@ -81,3 +501,28 @@ func (s *ContentService) CheckAccess(contentID uuid.UUID, userIdentifier string)
 
 	return &access, nil
 }
+
+// RevokeAccess deactivates the active access grants of a user to content of a
+// merchant, for example after a chargeback. CheckAccess, access tokens and
+// receipts stop honouring them right away. It returns sql.ErrNoRows when the
+// user has no active access.
+func (s *ContentService) RevokeAccess(ctx context.Context, merchantID, contentID uuid.UUID, userIdentifier string) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE content_access
+		SET is_active = false
+		WHERE merchant_id = $1 AND content_id = $2 AND user_identifier = $3
+		  AND is_active AND expires_at > NOW()`,
+		merchantID, contentID, userIdentifier,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke access: %w", err)
+	}
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke access: %w", err)
+	}
+	if revoked == 0 {
+		return fmt.Errorf("failed to revoke access: %w", sql.ErrNoRows)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxContentPathLength is the longest content path in characters; it matches
+// the width of the content.path column
+const MaxContentPathLength = 1000
+
+var (
+	// ErrContentPathTooLong is returned when a path exceeds MaxContentPathLength
+	ErrContentPathTooLong = errors.New("content path too long")
+	// ErrInvalidContentPath is returned for paths that are not valid UTF-8 or
+	// contain control characters
+	ErrInvalidContentPath = errors.New("invalid content path")
+)
+
+// NormalizeContentPath returns the canonical form of a content path: a leading
+// slash and Unicode NFC, so a path typed with combining characters finds content
+// stored with precomposed ones and vice versa. Stored paths and lookups must both
+// go through it.
+func NormalizeContentPath(path string) (string, error) {
+	// Reject early on the raw byte length so huge inputs are never normalized
+	if len(path) > MaxContentPathLength*utf8.UTFMax {
+		return "", ErrContentPathTooLong
+	}
+	if !utf8.ValidString(path) || strings.IndexFunc(path, unicode.IsControl) >= 0 {
+		return "", ErrInvalidContentPath
+	}
+
+	path = norm.NFC.String(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if utf8.RuneCountInString(path) > MaxContentPathLength {
+		return "", ErrContentPathTooLong
+	}
+	return path, nil
+}
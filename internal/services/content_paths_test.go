@@ -0,0 +1,44 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeContentPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr error
+	}{
+		{"already canonical", "/premium/article", "/premium/article", nil},
+		{"leading slash added", "premium/article", "/premium/article", nil},
+		{"empty path is the root", "", "/", nil},
+		{"combining accent composed", "/cafe\u0301", "/caf\u00e9", nil},
+		{"precomposed kept", "/caf\u00e9", "/caf\u00e9", nil},
+		{"longest path", "/" + strings.Repeat("a", MaxContentPathLength-1), "/" + strings.Repeat("a", MaxContentPathLength-1), nil},
+		{"longest path without slash", strings.Repeat("a", MaxContentPathLength-1), "/" + strings.Repeat("a", MaxContentPathLength-1), nil},
+		{"length counts characters", "/" + strings.Repeat("\u00e9", MaxContentPathLength-1), "/" + strings.Repeat("\u00e9", MaxContentPathLength-1), nil},
+		{"length counts after composing", "/" + strings.Repeat("e\u0301", MaxContentPathLength-1), "/" + strings.Repeat("\u00e9", MaxContentPathLength-1), nil},
+		{"one character too long", "/" + strings.Repeat("a", MaxContentPathLength), "", ErrContentPathTooLong},
+		{"too long once the slash is added", strings.Repeat("a", MaxContentPathLength), "", ErrContentPathTooLong},
+		{"huge input", strings.Repeat("a", MaxContentPathLength*10), "", ErrContentPathTooLong},
+		{"invalid UTF-8", "/caf\xe9", "", ErrInvalidContentPath},
+		{"newline", "/premium\narticle", "", ErrInvalidContentPath},
+		{"NUL byte", "/premium\x00", "", ErrInvalidContentPath},
+		{"DEL", "/premium\x7f", "", ErrInvalidContentPath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeContentPath(tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NormalizeContentPath() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeContentPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+// Content paths may be patterns instead of exact paths:
+//
+//	/premium/*        prefix rule, matches everything below /premium/
+//	/videos/*/intro   wildcard rule, matched with path.Match
+//
+// A request resolves to an exact entry first, then to the longest matching
+// prefix, then to the most specific wildcard. All paths matched by one entry
+// share its content ID, so paying once unlocks the whole rule.
+
+// patternSet holds the compiled pattern entries of a single merchant
+type patternSet struct {
+	prefixes  []prefixRule
+	wildcards []models.Content
+	loadedAt  time.Time
+}
+
+type prefixRule struct {
+	prefix  string
+	content models.Content
+}
+
+// compilePatterns sorts pattern entries by precedence so resolve can return the
+// first match. Malformed globs are skipped with a warning instead of failing
+// every lookup for the merchant.
+func compilePatterns(entries []models.Content, logger *zap.Logger) *patternSet {
+	set := &patternSet{loadedAt: time.Now()}
+	for _, content := range entries {
+		if prefix, ok := prefixOf(content.Path); ok {
+			set.prefixes = append(set.prefixes, prefixRule{prefix: prefix, content: content})
+			continue
+		}
+		if _, err := path.Match(content.Path, ""); err != nil {
+			logger.Warn("Skipping malformed content pattern",
+				zap.String("merchant_id", content.MerchantID.String()),
+				zap.String("path", content.Path),
+				zap.Error(err),
+			)
+			continue
+		}
+		set.wildcards = append(set.wildcards, content)
+	}
+
+	sort.Slice(set.prefixes, func(i, j int) bool {
+		a, b := set.prefixes[i].prefix, set.prefixes[j].prefix
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return a < b
+	})
+	sort.Slice(set.wildcards, func(i, j int) bool {
+		a, b := literalLen(set.wildcards[i].Path), literalLen(set.wildcards[j].Path)
+		if a != b {
+			return a > b
+		}
+		return set.wildcards[i].Path < set.wildcards[j].Path
+	})
+
+	return set
+}
+
+// resolve returns a copy of the most specific entry matching p, or nil
+func (set *patternSet) resolve(p string) *models.Content {
+	for _, rule := range set.prefixes {
+		if strings.HasPrefix(p, rule.prefix) {
+			content := rule.content
+			return &content
+		}
+	}
+	for _, wildcard := range set.wildcards {
+		if ok, _ := path.Match(wildcard.Path, p); ok {
+			content := wildcard
+			return &content
+		}
+	}
+	return nil
+}
+
+// prefixOf reports whether pattern is a prefix rule ("/dir/*" with no other
+// metacharacters) and returns the prefix including its trailing slash
+func prefixOf(pattern string) (string, bool) {
+	prefix := strings.TrimSuffix(pattern, "*")
+	if prefix == pattern || !strings.HasSuffix(prefix, "/") || strings.ContainsAny(prefix, `*?[\`) {
+		return "", false
+	}
+	return prefix, true
+}
+
+// literalLen counts the characters of a glob that are not metacharacters, a
+// rough measure of how specific the pattern is
+func literalLen(pattern string) int {
+	n := 0
+	for _, r := range pattern {
+		if !strings.ContainsRune(`*?[]\`, r) {
+			n++
+		}
+	}
+	return n
+}
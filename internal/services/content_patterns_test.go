@@ -0,0 +1,74 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestPatternSetResolve(t *testing.T) {
+	set := compilePatterns([]models.Content{
+		{Path: "/premium/*"},
+		{Path: "/premium/videos/*"},
+		{Path: "/videos/*/intro"},
+		{Path: "/videos/*/*"},
+		{Path: "/docs/[a-c]*.pdf"},
+		{Path: "/broken/[*"},
+	}, zap.NewNop())
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"prefix rule", "/premium/article", "/premium/*"},
+		{"prefix rule spans directories", "/premium/2024/01/article", "/premium/*"},
+		{"longest prefix wins", "/premium/videos/clip.mp4", "/premium/videos/*"},
+		{"prefix needs the trailing slash", "/premium", ""},
+		{"most specific wildcard wins", "/videos/cats/intro", "/videos/*/intro"},
+		{"less specific wildcard", "/videos/cats/outro", "/videos/*/*"},
+		{"wildcard does not cross slashes", "/videos/cats/2024/intro", ""},
+		{"character class", "/docs/b-report.pdf", "/docs/[a-c]*.pdf"},
+		{"character class mismatch", "/docs/d-report.pdf", ""},
+		{"malformed pattern is skipped", "/broken/[x", ""},
+		{"no match", "/free/article", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := set.resolve(tt.path)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("resolve(%q) = %q, want no match", tt.path, got.Path)
+				}
+				return
+			}
+			if got == nil || got.Path != tt.want {
+				t.Errorf("resolve(%q) = %v, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrefixOf(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+		wantOK  bool
+	}{
+		{"/premium/*", "/premium/", true},
+		{"/*", "/", true},
+		{"/premium/article", "", false},
+		{"/premium*", "", false},
+		{"/videos/*/*", "", false},
+		{"/docs/[a-c]/*", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, ok := prefixOf(tt.pattern)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("prefixOf(%q) = %q, %v, want %q, %v", tt.pattern, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+// newValidatingContentService can only be used for calls that fail validation
+// before reaching the database
+func newValidatingContentService() *ContentService {
+	cfg := &config.Config{Payment: config.PaymentConfig{MinAmountCents: 1, MaxAmountCents: 100000}}
+	return NewContentService(nil, cfg, nil, zap.NewNop())
+}
+
+func TestCreateContentRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*models.Content)
+		want   error
+	}{
+		{"path too long", func(c *models.Content) { c.Path = "/" + strings.Repeat("a", MaxContentPathLength) }, ErrContentPathTooLong},
+		{"unknown currency", func(c *models.Content) { c.Currency = "EURO" }, ErrInvalidCurrency},
+		{"free", func(c *models.Content) { c.PriceCents = 0 }, ErrInvalidPrice},
+		{"above the maximum amount", func(c *models.Content) { c.PriceCents = 100001 }, ErrInvalidPrice},
+		{"negative access duration", func(c *models.Content) { c.AccessDurationSeconds = -1 }, ErrInvalidAccessDuration},
+	}
+	s := newValidatingContentService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := &models.Content{
+				MerchantID:            uuid.New(),
+				Path:                  "/premium/article",
+				PriceCents:            250,
+				Currency:              "EUR",
+				AccessDurationSeconds: 3600,
+			}
+			tt.change(content)
+			if _, err := s.CreateContent(context.Background(), content); !errors.Is(err, tt.want) {
+				t.Errorf("CreateContent() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateContentRejects(t *testing.T) {
+	currency, free, negative := "EURO", 0, -3600
+	tests := []struct {
+		name   string
+		update ContentUpdate
+		want   error
+	}{
+		{"unknown currency", ContentUpdate{Currency: &currency}, ErrInvalidCurrency},
+		{"free", ContentUpdate{PriceCents: &free}, ErrInvalidPrice},
+		{"negative access duration", ContentUpdate{AccessDurationSeconds: &negative}, ErrInvalidAccessDuration},
+	}
+	s := newValidatingContentService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.UpdateContent(context.Background(), uuid.New(), uuid.New(), tt.update); !errors.Is(err, tt.want) {
+				t.Errorf("UpdateContent() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mh74hf/micro-payments/internal/money"
+)
+
+// ErrNoExchangeRate is returned when no rate is known for a currency pair
+var ErrNoExchangeRate = errors.New("no exchange rate available")
+
+// CurrencyConverter converts amounts between currencies. createSession uses
+// it to turn the content price into the currency the merchant's account
+// settles in.
+type CurrencyConverter interface {
+	// Convert returns amountCents of from in the minor units of to, rounded
+	// half away from zero, together with the rate applied
+	Convert(ctx context.Context, amountCents int, from, to string) (converted int, rate float64, err error)
+}
+
+// RateSource looks up exchange rates. StaticRates serves the configured
+// rates; a client of a rates API can be plugged in instead through
+// NewCachedConverter and PaymentService.SetCurrencyConverter.
+type RateSource interface {
+	// Rate returns how many units of to one unit of from buys, or an error
+	// wrapping ErrNoExchangeRate when the pair is not quoted
+	Rate(ctx context.Context, from, to string) (float64, error)
+}
+
+// StaticRates is a RateSource of fixed rates keyed by pair, like "USD_EUR".
+// The reverse of a listed pair is derived.
+type StaticRates map[string]float64
+
+// NewStaticRates builds a StaticRates from cfg.Currency.Rates, whose keys
+// config loading lower-cases
+func NewStaticRates(rates map[string]float64) StaticRates {
+	static := make(StaticRates, len(rates))
+	for pair, rate := range rates {
+		static[strings.ToUpper(pair)] = rate
+	}
+	return static
+}
+
+// Rate implements RateSource
+func (r StaticRates) Rate(ctx context.Context, from, to string) (float64, error) {
+	if rate, ok := r[from+"_"+to]; ok && rate > 0 {
+		return rate, nil
+	}
+	if rate, ok := r[to+"_"+from]; ok && rate > 0 {
+		return 1 / rate, nil
+	}
+	return 0, fmt.Errorf("%w for %s to %s", ErrNoExchangeRate, from, to)
+}
+
+// CachedConverter is a CurrencyConverter that keeps each rate it got from its
+// source for a TTL, so sessions are not held up by a rates API
+type CachedConverter struct {
+	source RateSource
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	rates map[string]cachedRate
+}
+
+type cachedRate struct {
+	rate      float64
+	fetchedAt time.Time
+}
+
+// NewCachedConverter creates a converter over source caching rates for ttl
+func NewCachedConverter(source RateSource, ttl time.Duration) *CachedConverter {
+	return &CachedConverter{
+		source: source,
+		ttl:    ttl,
+		rates:  make(map[string]cachedRate),
+	}
+}
+
+// Convert implements CurrencyConverter
+func (c *CachedConverter) Convert(ctx context.Context, amountCents int, from, to string) (int, float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return amountCents, 1, nil
+	}
+
+	rate, err := c.rate(ctx, from, to)
+	if err != nil {
+		return 0, 0, err
+	}
+	major := float64(amountCents) / math.Pow10(money.Lookup(from).Exponent)
+	converted := math.Round(major * rate * math.Pow10(money.Lookup(to).Exponent))
+	return int(converted), rate, nil
+}
+
+func (c *CachedConverter) rate(ctx context.Context, from, to string) (float64, error) {
+	pair := from + "_" + to
+	c.mu.Lock()
+	cached, ok := c.rates[pair]
+	c.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < c.ttl {
+		return cached.rate, nil
+	}
+
+	rate, err := c.source.Rate(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	c.rates[pair] = cachedRate{rate: rate, fetchedAt: time.Now()}
+	c.mu.Unlock()
+	return rate, nil
+}
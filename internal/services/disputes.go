@@ -0,0 +1,440 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/events"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrDisputeNotFound is returned when a dispute does not exist
+	ErrDisputeNotFound = errors.New("dispute not found")
+	// ErrInvalidDisputeTransition is returned when a dispute cannot move to the requested status
+	ErrInvalidDisputeTransition = errors.New("invalid dispute transition")
+	// ErrDisputeExists is returned when the session already has a dispute in progress
+	ErrDisputeExists = errors.New("session already has an open dispute")
+	// ErrSessionNotDisputable is returned when a dispute is opened on a session that was never paid
+	ErrSessionNotDisputable = errors.New("payment session is not paid")
+)
+
+// disputeTransitions lists the statuses each dispute status may advance to.
+// An open dispute can be resolved directly, e.g. when it is withdrawn.
+var disputeTransitions = map[models.DisputeStatus][]models.DisputeStatus{
+	models.DisputeStatusOpen:        {models.DisputeStatusUnderReview, models.DisputeStatusResolved},
+	models.DisputeStatusUnderReview: {models.DisputeStatusResolved, models.DisputeStatusLost, models.DisputeStatusWon},
+}
+
+// CanTransition reports whether a dispute may move from one status to another
+func CanTransition(from, to models.DisputeStatus) bool {
+	for _, allowed := range disputeTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// DisputeService manages the dispute lifecycle of paid sessions
+type DisputeService struct {
+	db     *sql.DB
+	config *config.Config
+	bus    *events.Bus
+	logger *zap.Logger
+}
+
+// NewDisputeService creates a new dispute service
+func NewDisputeService(db *sql.DB, cfg *config.Config, bus *events.Bus, logger *zap.Logger) *DisputeService {
+	return &DisputeService{
+		db:     db,
+		config: cfg,
+		bus:    bus,
+		logger: logger,
+	}
+}
+
+// OpenDisputeRequest describes a new dispute
+type OpenDisputeRequest struct {
+	SessionID     uuid.UUID  `json:"session_id" binding:"required"`
+	TransactionID *uuid.UUID `json:"transaction_id"`
+	Reason        string     `json:"reason" binding:"required"`
+	FreezeAccess  bool       `json:"freeze_access"`
+	Author        *string    `json:"author"`
+}
+
+// DisputeTransition advances a dispute, optionally with a note and evidence
+type DisputeTransition struct {
+	Status      models.DisputeStatus `json:"status" binding:"required"`
+	Note        string               `json:"note"`
+	EvidenceURL *string              `json:"evidence_url"`
+	Author      *string              `json:"author"`
+}
+
+// DisputeFilter restricts which disputes are listed
+type DisputeFilter struct {
+	MerchantID *uuid.UUID
+	Status     *models.DisputeStatus
+	Limit      int
+}
+
+const disputeColumns = `
+		dispute_id, merchant_id, session_id, transaction_id, status, reason,
+		freeze_access, created_at, updated_at, closed_at`
+
+// Open opens a dispute on a paid session and marks the related bank
+// transaction disputed. A session can only have one dispute in progress.
+func (s *DisputeService) Open(ctx context.Context, req OpenDisputeRequest) (*models.Dispute, error) {
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin dispute: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	var merchantID uuid.UUID
+	var status models.PaymentStatus
+	err = dbTx.QueryRowContext(ctx,
+		`SELECT merchant_id, status FROM payment_sessions WHERE session_id = $1`,
+		req.SessionID,
+	).Scan(&merchantID, &status)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load payment session: %w", err)
+	}
+	if status != models.PaymentStatusPaid {
+		return nil, ErrSessionNotDisputable
+	}
+
+	query := `
+		INSERT INTO disputes (merchant_id, session_id, transaction_id, status, reason, freeze_access)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING` + disputeColumns
+
+	dispute, err := scanDispute(dbTx.QueryRowContext(ctx, query,
+		merchantID,
+		req.SessionID,
+		req.TransactionID,
+		models.DisputeStatusOpen,
+		req.Reason,
+		req.FreezeAccess,
+	))
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return nil, ErrDisputeExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dispute: %w", err)
+	}
+
+	if req.TransactionID != nil {
+		_, err = dbTx.ExecContext(ctx,
+			`UPDATE bank_transactions SET status = $1 WHERE transaction_id = $2 AND merchant_id = $3`,
+			models.TransactionStatusDisputed, *req.TransactionID, merchantID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to mark transaction disputed: %w", err)
+		}
+	}
+
+	to := models.DisputeStatusOpen
+	if err := insertDisputeNote(ctx, dbTx, dispute.DisputeID, req.Author, req.Reason, nil, nil, &to); err != nil {
+		return nil, err
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit dispute: %w", err)
+	}
+
+	s.bus.Publish(events.DisputeStatusChanged{
+		DisputeID:  dispute.DisputeID,
+		MerchantID: dispute.MerchantID,
+		SessionID:  dispute.SessionID,
+		ToStatus:   dispute.Status,
+		ChangedAt:  dispute.CreatedAt,
+	})
+
+	return dispute, nil
+}
+
+// Advance moves a dispute to the next status and records the transition.
+//
+// With FreezeAccess set, access bought with the session is suspended while the
+// dispute is under review and restored when the merchant wins or the dispute is
+// resolved. A lost dispute keeps access revoked and marks the session failed.
+func (s *DisputeService) Advance(ctx context.Context, disputeID uuid.UUID, t DisputeTransition) (*models.Dispute, error) {
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin dispute transition: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	current, err := scanDispute(dbTx.QueryRowContext(ctx,
+		`SELECT`+disputeColumns+` FROM disputes WHERE dispute_id = $1 FOR UPDATE`,
+		disputeID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, ErrDisputeNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load dispute: %w", err)
+	}
+	if !CanTransition(current.Status, t.Status) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidDisputeTransition, current.Status, t.Status)
+	}
+
+	now := time.Now()
+	var closedAt *time.Time
+	if t.Status.Closed() {
+		closedAt = &now
+	}
+
+	dispute, err := scanDispute(dbTx.QueryRowContext(ctx, `
+		UPDATE disputes
+		SET status = $1, updated_at = $2, closed_at = $3
+		WHERE dispute_id = $4
+		RETURNING`+disputeColumns,
+		t.Status, now, closedAt, disputeID,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to advance dispute: %w", err)
+	}
+
+	if err := applyDisputeOutcome(ctx, dbTx, dispute); err != nil {
+		return nil, err
+	}
+
+	note := t.Note
+	if note == "" {
+		note = fmt.Sprintf("Status changed from %s to %s", current.Status, t.Status)
+	}
+	if err := insertDisputeNote(ctx, dbTx, disputeID, t.Author, note, t.EvidenceURL, &current.Status, &dispute.Status); err != nil {
+		return nil, err
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit dispute transition: %w", err)
+	}
+
+	s.bus.Publish(events.DisputeStatusChanged{
+		DisputeID:  dispute.DisputeID,
+		MerchantID: dispute.MerchantID,
+		SessionID:  dispute.SessionID,
+		FromStatus: current.Status,
+		ToStatus:   dispute.Status,
+		ChangedAt:  now,
+	})
+
+	return dispute, nil
+}
+
+// applyDisputeOutcome updates access, session and transaction state for the
+// status a dispute just moved to
+func applyDisputeOutcome(ctx context.Context, dbTx *sql.Tx, dispute *models.Dispute) error {
+	setAccess := func(active bool) error {
+		_, err := dbTx.ExecContext(ctx,
+			`UPDATE content_access SET is_active = $1 WHERE session_id = $2`,
+			active, dispute.SessionID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update content access: %w", err)
+		}
+		return nil
+	}
+	setTransaction := func(status models.TransactionStatus) error {
+		if dispute.TransactionID == nil {
+			return nil
+		}
+		_, err := dbTx.ExecContext(ctx,
+			`UPDATE bank_transactions SET status = $1 WHERE transaction_id = $2 AND status = $3`,
+			status, *dispute.TransactionID, models.TransactionStatusDisputed,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update disputed transaction: %w", err)
+		}
+		return nil
+	}
+
+	switch dispute.Status {
+	case models.DisputeStatusUnderReview:
+		if dispute.FreezeAccess {
+			return setAccess(false)
+		}
+	case models.DisputeStatusWon, models.DisputeStatusResolved:
+		if dispute.FreezeAccess {
+			if err := setAccess(true); err != nil {
+				return err
+			}
+		}
+		return setTransaction(models.TransactionStatusProcessed)
+	case models.DisputeStatusLost:
+		if err := setAccess(false); err != nil {
+			return err
+		}
+		_, err := dbTx.ExecContext(ctx,
+			`UPDATE payment_sessions
+			 SET status = $1,
+			     metadata = COALESCE(metadata, '{}'::jsonb) || jsonb_build_object('failure_reason', $2::text, 'failed_at', NOW())
+			 WHERE session_id = $3`,
+			models.PaymentStatusFailed, FailureReasonDisputeLost, dispute.SessionID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to mark session failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// AddNote records a note or piece of evidence without changing the status
+func (s *DisputeService) AddNote(ctx context.Context, disputeID uuid.UUID, author *string, note string, evidenceURL *string) error {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM disputes WHERE dispute_id = $1)`, disputeID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to load dispute: %w", err)
+	}
+	if !exists {
+		return ErrDisputeNotFound
+	}
+
+	return insertDisputeNote(ctx, s.db, disputeID, author, note, evidenceURL, nil, nil)
+}
+
+// Get returns a dispute along with its notes, oldest first
+func (s *DisputeService) Get(ctx context.Context, disputeID uuid.UUID) (*models.Dispute, error) {
+	dispute, err := scanDispute(s.db.QueryRowContext(ctx,
+		`SELECT`+disputeColumns+` FROM disputes WHERE dispute_id = $1`,
+		disputeID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, ErrDisputeNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load dispute: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT note_id, dispute_id, author, note, evidence_url, from_status, to_status, created_at
+		FROM dispute_notes
+		WHERE dispute_id = $1
+		ORDER BY created_at, note_id`,
+		disputeID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load dispute notes: %w", err)
+	}
+	defer rows.Close()
+
+	dispute.Notes = []models.DisputeNote{}
+	for rows.Next() {
+		var note models.DisputeNote
+		err := rows.Scan(
+			&note.NoteID,
+			&note.DisputeID,
+			&note.Author,
+			&note.Note,
+			&note.EvidenceURL,
+			&note.FromStatus,
+			&note.ToStatus,
+			&note.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan dispute note: %w", err)
+		}
+		dispute.Notes = append(dispute.Notes, note)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load dispute notes: %w", err)
+	}
+
+	return dispute, nil
+}
+
+// List returns disputes newest first
+func (s *DisputeService) List(ctx context.Context, filter DisputeFilter) ([]models.Dispute, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = s.config.Admin.DefaultPageSize
+	}
+	if limit > s.config.Admin.MaxPageSize {
+		limit = s.config.Admin.MaxPageSize
+	}
+
+	var conditions []string
+	var args []interface{}
+	if filter.MerchantID != nil {
+		args = append(args, *filter.MerchantID)
+		conditions = append(conditions, fmt.Sprintf("merchant_id = $%d", len(args)))
+	}
+	if filter.Status != nil {
+		args = append(args, *filter.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+
+	query := "SELECT" + disputeColumns + "\n\t\tFROM disputes"
+	if len(conditions) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf("\n\t\tORDER BY created_at DESC, dispute_id DESC\n\t\tLIMIT $%d", len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list disputes: %w", err)
+	}
+	defer rows.Close()
+
+	disputes := []models.Dispute{}
+	for rows.Next() {
+		dispute, err := scanDispute(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan dispute: %w", err)
+		}
+		disputes = append(disputes, *dispute)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list disputes: %w", err)
+	}
+
+	return disputes, nil
+}
+
+func insertDisputeNote(ctx context.Context, db execer, disputeID uuid.UUID, author *string, note string, evidenceURL *string, from, to *models.DisputeStatus) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO dispute_notes (dispute_id, author, note, evidence_url, from_status, to_status)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		disputeID, author, note, evidenceURL, from, to,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record dispute note: %w", err)
+	}
+	return nil
+}
+
+func scanDispute(row rowScanner) (*models.Dispute, error) {
+	var dispute models.Dispute
+	err := row.Scan(
+		&dispute.DisputeID,
+		&dispute.MerchantID,
+		&dispute.SessionID,
+		&dispute.TransactionID,
+		&dispute.Status,
+		&dispute.Reason,
+		&dispute.FreezeAccess,
+		&dispute.CreatedAt,
+		&dispute.UpdatedAt,
+		&dispute.ClosedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &dispute, nil
+}
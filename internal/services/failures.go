@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/money"
+	"go.uber.org/zap"
+)
+
+// A session is failed when money was attempted but the payment did not go
+// through; the reason is stored as "failure_reason" in the session metadata.
+// A session that simply received nothing in time is expired instead, and one
+// the customer abandoned is cancelled.
+const (
+	// FailureReasonProviderDeclined: the payment provider declined the payment
+	FailureReasonProviderDeclined = "provider_declined"
+	// FailureReasonBankReturn: the transfer was returned by the bank before
+	// access was granted
+	FailureReasonBankReturn = "bank_return"
+	// FailureReasonPartialPayment: the session expired having received less
+	// than the full amount
+	FailureReasonPartialPayment = "partial_payment"
+	// FailureReasonDisputeLost: the payment was reversed after a lost dispute
+	FailureReasonDisputeLost = "dispute_lost"
+)
+
+var (
+	// ErrSessionNotFailable is returned when a session is not pending or expired
+	ErrSessionNotFailable = errors.New("payment session cannot fail in its current status")
+	// ErrSessionNotRenewable is returned when renewing a session that is neither
+	// failed nor expired
+	ErrSessionNotRenewable = errors.New("payment session cannot be renewed")
+	// ErrReturnAfterGrant is returned when a returned transfer already granted
+	// access; that case goes through a dispute instead
+	ErrReturnAfterGrant = errors.New("returned transaction already granted access")
+)
+
+// failSession marks a pending or expired session failed, recording the reason
+// in its metadata. It reports whether the session changed.
+func failSession(ctx context.Context, db execer, sessionID uuid.UUID, reason, detail string) (bool, error) {
+	query := `
+		UPDATE payment_sessions
+		SET status = $1,
+		    metadata = COALESCE(metadata, '{}'::jsonb) || jsonb_build_object(
+		        'failure_reason', $2::text, 'failure_detail', NULLIF($3::text, ''), 'failed_at', NOW())
+		WHERE session_id = $4 AND status IN ($5, $6)`
+
+	result, err := db.ExecContext(ctx, query,
+		models.PaymentStatusFailed,
+		reason,
+		detail,
+		sessionID,
+		models.PaymentStatusPending,
+		models.PaymentStatusExpired,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark session failed: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to mark session failed: %w", err)
+	}
+	return n > 0, nil
+}
+
+// DeclineSession fails a session because the payment provider declined it
+func (s *PaymentService) DeclineSession(ctx context.Context, sessionID uuid.UUID, detail string) error {
+	changed, err := failSession(ctx, s.db, sessionID, FailureReasonProviderDeclined, detail)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		session, err := s.GetPaymentSession(sessionID)
+		if err != nil {
+			return ErrSessionNotFound
+		}
+		if session.Status != models.PaymentStatusFailed {
+			return ErrSessionNotFailable
+		}
+		// Declining twice is harmless
+	}
+	return nil
+}
+
+// RenewSession starts a new pending session for the content and user of a failed
+// or expired one, for the client with userAgent and ip. The old session is left
+// as is; the new one records it as "renewed_from" in its metadata.
+func (s *PaymentService) RenewSession(ctx context.Context, sessionID uuid.UUID, userAgent, ip string) (*models.PaymentSession, error) {
+	old, err := s.GetPaymentSession(sessionID)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+	expired := old.Status == models.PaymentStatusExpired ||
+		(old.Status == models.PaymentStatusPending && old.ExpiresAt.Before(time.Now()))
+	if old.Status != models.PaymentStatusFailed && !expired {
+		return nil, ErrSessionNotRenewable
+	}
+
+	userIdentifier := ""
+	if old.UserIdentifier != nil {
+		userIdentifier = *old.UserIdentifier
+	}
+	return s.createSession(old.MerchantID, old.ContentID, userIdentifier, userAgent, ip, map[string]interface{}{
+		"renewed_from": old.SessionID,
+	})
+}
+
+// RecordBankReturn handles a transfer the bank returned. When it was not matched
+// yet, the session it pays for is failed with FailureReasonBankReturn and the
+// transaction marked returned. A return of a transfer that already granted
+// access yields ErrReturnAfterGrant and must be handled as a dispute.
+func (s *ReconciliationService) RecordBankReturn(ctx context.Context, transactionID uuid.UUID, detail string) (*uuid.UUID, error) {
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin bank return: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	tx, err := scanBankTransaction(dbTx.QueryRowContext(ctx, `
+		SELECT`+transactionColumns+`
+		FROM bank_transactions
+		WHERE transaction_id = $1
+		FOR UPDATE`, transactionID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load transaction: %w", err)
+	}
+	if tx.Status != models.TransactionStatusDetected {
+		return nil, ErrReturnAfterGrant
+	}
+
+	_, err = dbTx.ExecContext(ctx,
+		`UPDATE bank_transactions SET status = $1, processed_at = NOW() WHERE transaction_id = $2`,
+		models.TransactionStatusReturned, transactionID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark transaction returned: %w", err)
+	}
+
+	var sessionID *uuid.UUID
+	if tx.PaymentReference != nil && *tx.PaymentReference != "" {
+		var id uuid.UUID
+		err = dbTx.QueryRowContext(ctx, `
+			SELECT ps.session_id
+			FROM payment_sessions ps
+			JOIN merchants m ON m.merchant_id = ps.merchant_id
+			WHERE ps.payment_reference = $1 AND REPLACE(UPPER(m.bank_account_iban), ' ', '') = $2
+			  AND ps.status IN ($3, $4)`,
+			*tx.PaymentReference, money.NormalizeIBAN(tx.CreditorIBAN),
+			models.PaymentStatusPending, models.PaymentStatusExpired,
+		).Scan(&id)
+		switch {
+		case err == nil:
+			if _, err := failSession(ctx, dbTx, id, FailureReasonBankReturn, detail); err != nil {
+				return nil, err
+			}
+			sessionID = &id
+		case !errors.Is(err, sql.ErrNoRows):
+			return nil, fmt.Errorf("failed to find returned session: %w", err)
+		}
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit bank return: %w", err)
+	}
+	return sessionID, nil
+}
+
+// FailPartialPayments fails sessions whose expiry has passed while a detected
+// transfer for them carries less than the session amount. Their transactions
+// are left detected for manual refund. It returns the number of failed sessions.
+func (s *ReconciliationService) FailPartialPayments(ctx context.Context) (int, error) {
+	query := `
+		UPDATE payment_sessions ps
+		SET status = $1,
+		    metadata = COALESCE(ps.metadata, '{}'::jsonb) || jsonb_build_object(
+		        'failure_reason', $2::text, 'failed_at', NOW(),
+		        'received_cents', bt.amount_cents, 'transaction_id', bt.transaction_id)
+		FROM bank_transactions bt, merchants m
+		WHERE m.merchant_id = ps.merchant_id
+		  AND bt.payment_reference = ps.payment_reference
+		  AND REPLACE(UPPER(bt.creditor_iban), ' ', '') = REPLACE(UPPER(m.bank_account_iban), ' ', '')
+		  AND bt.status = $3
+		  AND bt.currency = ps.currency
+		  AND bt.amount_cents < ps.amount_cents
+		  AND ps.status IN ($4, $5)
+		  AND ps.expires_at < NOW()`
+
+	result, err := s.db.ExecContext(ctx, query,
+		models.PaymentStatusFailed,
+		FailureReasonPartialPayment,
+		models.TransactionStatusDetected,
+		models.PaymentStatusPending,
+		models.PaymentStatusExpired,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail partially paid sessions: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail partially paid sessions: %w", err)
+	}
+	if n > 0 {
+		s.logger.Info("Failed partially paid sessions", zap.Int64("sessions", n))
+	}
+	return int(n), nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// sessionStatuses is an execer for failSession's UPDATE: it fails the session
+// in args[3] when its status is one of args[4:]
+type sessionStatuses struct {
+	status map[uuid.UUID]models.PaymentStatus
+	reason string
+	err    error
+}
+
+func (s *sessionStatuses) ExecContext(_ context.Context, _ string, args ...interface{}) (sql.Result, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	id := args[3].(uuid.UUID)
+	current, ok := s.status[id]
+	if !ok {
+		return driver.RowsAffected(0), nil
+	}
+	for _, from := range args[4:] {
+		if current == from.(models.PaymentStatus) {
+			s.status[id] = args[0].(models.PaymentStatus)
+			s.reason = args[1].(string)
+			return driver.RowsAffected(1), nil
+		}
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func TestFailSession(t *testing.T) {
+	sessionID := uuid.New()
+	dbErr := errors.New("connection reset")
+	tests := []struct {
+		name        string
+		status      models.PaymentStatus
+		missing     bool
+		err         error
+		wantChanged bool
+		wantStatus  models.PaymentStatus
+	}{
+		{name: "pending", status: models.PaymentStatusPending, wantChanged: true, wantStatus: models.PaymentStatusFailed},
+		{name: "expired", status: models.PaymentStatusExpired, wantChanged: true, wantStatus: models.PaymentStatusFailed},
+		{name: "already failed", status: models.PaymentStatusFailed, wantStatus: models.PaymentStatusFailed},
+		{name: "paid", status: models.PaymentStatusPaid, wantStatus: models.PaymentStatusPaid},
+		{name: "cancelled", status: models.PaymentStatusCancelled, wantStatus: models.PaymentStatusCancelled},
+		{name: "refunded", status: models.PaymentStatusRefunded, wantStatus: models.PaymentStatusRefunded},
+		{name: "unknown session", missing: true},
+		{name: "database error", status: models.PaymentStatusPending, err: dbErr, wantStatus: models.PaymentStatusPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &sessionStatuses{status: map[uuid.UUID]models.PaymentStatus{}, err: tt.err}
+			if !tt.missing {
+				db.status[sessionID] = tt.status
+			}
+
+			changed, err := failSession(context.Background(), db, sessionID, FailureReasonBankReturn, "returned by the bank")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("failSession() error = %v, want %v", err, tt.err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("failSession() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if got := db.status[sessionID]; got != tt.wantStatus {
+				t.Errorf("status = %q, want %q", got, tt.wantStatus)
+			}
+			if tt.wantChanged && db.reason != FailureReasonBankReturn {
+				t.Errorf("failure reason = %q, want %q", db.reason, FailureReasonBankReturn)
+			}
+		})
+	}
+}
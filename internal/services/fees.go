@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/config"
+)
+
+// FeeBreakdown splits a gross amount into the platform fee, the VAT charged on
+// that fee and what the merchant keeps. All amounts are minor units and
+// GrossCents always equals PlatformFeeCents + VATCents + NetCents.
+type FeeBreakdown struct {
+	GrossCents       int    `json:"gross_cents"`
+	PlatformFeeCents int    `json:"platform_fee_cents"`
+	VATCents         int    `json:"vat_cents"`
+	NetCents         int    `json:"net_cents"`
+	Currency         string `json:"currency"`
+	PricingTier      string `json:"pricing_tier"`
+}
+
+// ComputeFees applies the fee schedule of pricingTier to grossCents. The fee is
+// a percentage in basis points plus a fixed part, capped at the gross amount;
+// VAT is charged on the fee at cfg.VATRateBps. Fractions of a cent are rounded
+// half up. Unknown tiers fall back to cfg.DefaultTier.
+func ComputeFees(cfg config.FeesConfig, pricingTier string, grossCents int, currency string) FeeBreakdown {
+	tier, ok := cfg.Tiers[pricingTier]
+	if !ok {
+		pricingTier = cfg.DefaultTier
+		tier = cfg.Tiers[pricingTier]
+	}
+
+	fee := roundedBps(grossCents, tier.PercentBps) + tier.FixedCents
+	vat := roundedBps(fee, cfg.VATRateBps)
+	if fee+vat > grossCents {
+		// Never charge more than the payment itself; keep the fee/VAT ratio
+		fee = grossCents * 10000 / (10000 + cfg.VATRateBps)
+		vat = grossCents - fee
+	}
+
+	return FeeBreakdown{
+		GrossCents:       grossCents,
+		PlatformFeeCents: fee,
+		VATCents:         vat,
+		NetCents:         grossCents - fee - vat,
+		Currency:         currency,
+		PricingTier:      pricingTier,
+	}
+}
+
+// roundedBps returns amount * bps / 10000 rounded half up
+func roundedBps(amount, bps int) int {
+	return (amount*bps + 5000) / 10000
+}
+
+// QuoteFees returns the breakdown a session for the content would get, using
+// the same lookup and checks as CreatePaymentSession
+func (s *PaymentService) QuoteFees(merchantID, contentID uuid.UUID) (*FeeBreakdown, error) {
+	content, payee, err := s.sessionContent(context.Background(), merchantID, contentID)
+	if err != nil {
+		return nil, err
+	}
+
+	amountCents, currency, _, err := s.settlementAmount(context.Background(), payee.iban, content.PriceCents, content.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	fees := ComputeFees(s.config.Fees, payee.pricingTier, amountCents, currency)
+	return &fees, nil
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrFreeTrialUsed is returned when the user already had their free access
+	ErrFreeTrialUsed = errors.New("free access already used")
+	// ErrFreeTrialLimited is returned when too many free accesses came from the
+	// same IP address within cfg.Access.FreeTrialWindow
+	ErrFreeTrialLimited = errors.New("free access limit reached for this address")
+)
+
+// GrantFreeTrial records a one-time free access to content for a user. Trials
+// are stored as content_access rows without a session, so they never count as
+// revenue, and a unique index makes sure each user gets only one per content.
+// Rotating user identifiers does not help either: at most
+// cfg.Access.FreeTrialsPerIP trials per content are granted to one IP address
+// within cfg.Access.FreeTrialWindow.
+func (s *ContentService) GrantFreeTrial(ctx context.Context, content *models.Content, userIdentifier, ip, userAgent string, duration time.Duration) (*models.ContentAccess, error) {
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin free trial: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	// Serialize trials per content and address so the limit holds under load
+	_, err = dbTx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, content.ContentID.String()+"|"+ip)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock free trial: %w", err)
+	}
+
+	var fromIP int
+	err = dbTx.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM content_access
+		WHERE content_id = $1 AND ip_address = $2 AND is_free_trial AND granted_at > $3`,
+		content.ContentID, ip, time.Now().Add(-s.config.Access.FreeTrialWindow),
+	).Scan(&fromIP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count free trials: %w", err)
+	}
+	if fromIP >= s.config.Access.FreeTrialsPerIP {
+		return nil, ErrFreeTrialLimited
+	}
+
+	now := time.Now()
+	grant := models.ContentAccess{
+		MerchantID:     content.MerchantID,
+		ContentID:      content.ContentID,
+		UserIdentifier: userIdentifier,
+		GrantedAt:      now,
+		ExpiresAt:      now.Add(duration),
+		IsActive:       true,
+		IsFreeTrial:    true,
+	}
+	if ip != "" {
+		grant.IPAddress = &ip
+	}
+	if userAgent != "" {
+		grant.UserAgent = &userAgent
+	}
+
+	err = dbTx.QueryRowContext(ctx, `
+		INSERT INTO content_access (
+			merchant_id, content_id, user_identifier, granted_at, expires_at,
+			ip_address, user_agent, is_active, is_free_trial
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, true, true)
+		RETURNING access_id`,
+		grant.MerchantID,
+		grant.ContentID,
+		grant.UserIdentifier,
+		grant.GrantedAt,
+		grant.ExpiresAt,
+		grant.IPAddress,
+		grant.UserAgent,
+	).Scan(&grant.AccessID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return nil, ErrFreeTrialUsed
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to grant free trial: %w", err)
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit free trial: %w", err)
+	}
+
+	s.logger.Info("Granted free first access",
+		zap.String("content_id", content.ContentID.String()),
+		zap.Duration("duration", duration),
+	)
+	return &grant, nil
+}
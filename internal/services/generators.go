@@ -0,0 +1,72 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IDGenerator produces identifiers for new records
+type IDGenerator interface {
+	NewID() uuid.UUID
+}
+
+// ReferenceGenerator produces payment references for new sessions. References
+// start with the merchant's namespace prefix and only need to be unique within
+// that merchant.
+type ReferenceGenerator interface {
+	NewReference(prefix string) string
+}
+
+// RandomIDGenerator generates random (version 4) UUIDs
+type RandomIDGenerator struct{}
+
+// NewID implements IDGenerator
+func (RandomIDGenerator) NewID() uuid.UUID { return uuid.New() }
+
+// TimeReferenceGenerator builds references from the current Unix time
+type TimeReferenceGenerator struct{}
+
+// NewReference implements ReferenceGenerator
+func (TimeReferenceGenerator) NewReference(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, time.Now().Unix())
+}
+
+// SequentialIDGenerator returns predictable UUIDs 00000000-0000-0000-0000-000000000001,
+// ...02 and so on. It is meant for tests that assert exact session IDs.
+type SequentialIDGenerator struct {
+	mu   sync.Mutex
+	next uint64
+}
+
+// NewID implements IDGenerator
+func (g *SequentialIDGenerator) NewID() uuid.UUID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.next++
+
+	var id uuid.UUID
+	for i, n := len(id)-1, g.next; i >= 0 && n > 0; i, n = i-1, n>>8 {
+		id[i] = byte(n)
+	}
+	return id
+}
+
+// SequentialReferenceGenerator returns prefix-1, prefix-2 and so on. It is meant
+// for tests that assert exact references; a single counter is shared by all
+// prefixes.
+type SequentialReferenceGenerator struct {
+	mu   sync.Mutex
+	next int
+}
+
+// NewReference implements ReferenceGenerator
+func (g *SequentialReferenceGenerator) NewReference(prefix string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.next++
+
+	return fmt.Sprintf("%s-%d", prefix, g.next)
+}
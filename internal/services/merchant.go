@@ -1,75 +1,247 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/events"
 	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/money"
+	"github.com/mh74hf/micro-payments/internal/validation"
 	"go.uber.org/zap"
 )
 
+var (
+	// ErrDomainTaken is returned when another merchant already uses the domain
+	ErrDomainTaken = errors.New("domain already registered")
+	// ErrEmailTaken is returned when another merchant already uses the email
+	ErrEmailTaken = errors.New("email already registered")
+	// ErrInvalidMerchant is returned when merchant fields fail validation
+	ErrInvalidMerchant = errors.New("invalid merchant")
+	// ErrInvalidIBAN is returned when a bank account IBAN has the wrong length
+	// for its country or fails the checksum
+	ErrInvalidIBAN = errors.New("bank_account_iban is not a valid IBAN")
+)
+
+// Unique constraints on merchants that map to conflict errors
+const (
+	domainConstraint = "idx_merchants_domain_normalized"
+	emailConstraint  = "merchants_email_key"
+)
+
 // MerchantService handles merchant-related operations
 type MerchantService struct {
 	db     *sql.DB
+	config *config.Config
+	bus    *events.Bus
 	logger *zap.Logger
+
+	mu       sync.Mutex
+	byDomain map[string]cachedMerchant
+}
+
+// cachedMerchant is a domain lookup result kept for cfg.Cache.MerchantTTL
+type cachedMerchant struct {
+	merchant *models.Merchant
+	loadedAt time.Time
 }
 
 // NewMerchantService creates a new merchant service
-func NewMerchantService(db *sql.DB, logger *zap.Logger) *MerchantService {
+func NewMerchantService(db *sql.DB, cfg *config.Config, bus *events.Bus, logger *zap.Logger) *MerchantService {
 	return &MerchantService{
-		db:     db,
-		logger: logger,
+		db:       db,
+		config:   cfg,
+		bus:      bus,
+		logger:   logger,
+		byDomain: make(map[string]cachedMerchant),
 	}
 }
 
-// GetMerchantByAPIKey retrieves a merchant by API key
-func (s *MerchantService) GetMerchantByAPIKey(apiKey string) (*models.Merchant, error) {
-	var merchant models.Merchant
+const merchantColumns = `
+		merchant_id, name, email, domain, bank_account_iban, bank_account_bic,
+		webhook_url, backend_url, webhook_secret, webhook_secret_previous, webhook_secret_previous_expires_at,
+		api_key, api_key_previous_expires_at, status, pricing_tier, created_at, updated_at, last_active_at,
+		settings, metadata`
+
+// GetMerchantByID retrieves an active merchant by ID
+func (s *MerchantService) GetMerchantByID(merchantID uuid.UUID) (*models.Merchant, error) {
 	query := `
-		SELECT merchant_id, name, email, domain, bank_account_iban, 
-		       api_key, status, pricing_tier, created_at, updated_at
+		SELECT` + merchantColumns + `
 		FROM merchants 
-		WHERE api_key = $1 AND status = 'active'`
+		WHERE merchant_id = $1 AND status = 'active'`
 
-	err := s.db.QueryRow(query, apiKey).Scan(
-		&merchant.MerchantID,
-		&merchant.Name,
-		&merchant.Email,
-		&merchant.Domain,
-		&merchant.BankAccountIBAN,
-		&merchant.APIKey,
-		&merchant.Status,
-		&merchant.PricingTier,
-		&merchant.CreatedAt,
-		&merchant.UpdatedAt,
-	)
+	return scanMerchant(s.db.QueryRow(query, merchantID))
+}
+
+// GetMerchant retrieves a merchant by ID whatever its status, for administration
+func (s *MerchantService) GetMerchant(ctx context.Context, merchantID uuid.UUID) (*models.Merchant, error) {
+	query := `
+		SELECT` + merchantColumns + `
+		FROM merchants
+		WHERE merchant_id = $1`
+
+	return scanMerchant(s.db.QueryRowContext(ctx, query, merchantID))
+}
+
+// Page sizes of ListMerchants
+const (
+	DefaultMerchantPageSize = 20
+	MaxMerchantPageSize     = 100
+)
+
+// MerchantPage is one page of ListMerchants with the total number of matches
+type MerchantPage struct {
+	Merchants []models.Merchant
+	Total     int
+	Limit     int
+	Offset    int
+}
+
+// ListMerchants returns merchants oldest first, optionally only those with the
+// given status and those not active since inactiveSince, which includes
+// merchants that never used their API key. limit defaults to
+// DefaultMerchantPageSize and is capped at MaxMerchantPageSize.
+func (s *MerchantService) ListMerchants(ctx context.Context, limit, offset int, status *models.MerchantStatus, inactiveSince *time.Time) (*MerchantPage, error) {
+	if limit <= 0 {
+		limit = DefaultMerchantPageSize
+	}
+	if limit > MaxMerchantPageSize {
+		limit = MaxMerchantPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	page := &MerchantPage{Merchants: []models.Merchant{}, Limit: limit, Offset: offset}
+
+	where := `
+		WHERE ($1::merchant_status IS NULL OR status = $1)
+		  AND ($2::timestamptz IS NULL OR last_active_at IS NULL OR last_active_at < $2)`
+
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM merchants`+where, status, inactiveSince).Scan(&page.Total)
 	if err != nil {
-		return nil, fmt.Errorf("merchant not found: %w", err)
+		return nil, fmt.Errorf("failed to count merchants: %w", err)
 	}
 
-	return &merchant, nil
+	query := `
+		SELECT` + merchantColumns + `
+		FROM merchants` + where + `
+		ORDER BY created_at, merchant_id
+		LIMIT $3 OFFSET $4`
+
+	rows, err := s.db.QueryContext(ctx, query, status, inactiveSince, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list merchants: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		merchant, err := scanMerchant(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Merchants = append(page.Merchants, *merchant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list merchants: %w", err)
+	}
+
+	return page, nil
+}
+
+// GetMerchantByAPIKey retrieves a merchant by API key. The key replaced by the
+// last RotateAPIKey still matches until it expires.
+func (s *MerchantService) GetMerchantByAPIKey(apiKey string) (*models.Merchant, error) {
+	query := `
+		SELECT` + merchantColumns + `
+		FROM merchants 
+		WHERE (api_key = $1 OR (api_key_previous = $1 AND api_key_previous_expires_at > NOW()))
+		  AND status = 'active'`
+
+	return scanMerchant(s.db.QueryRow(query, apiKey))
 }
 
-// GetMerchantByDomain retrieves a merchant by domain
+// GetMerchantByDomain retrieves a merchant by domain. Every request resolves its
+// merchant this way, so results are cached for cfg.Cache.MerchantTTL; updates
+// drop the entry right away through InvalidateMerchant.
 func (s *MerchantService) GetMerchantByDomain(domain string) (*models.Merchant, error) {
-	var merchant models.Merchant
+	s.mu.Lock()
+	entry, ok := s.byDomain[domain]
+	s.mu.Unlock()
+	if ok && time.Since(entry.loadedAt) < s.config.Cache.MerchantTTL {
+		merchant := *entry.merchant
+		return &merchant, nil
+	}
+
 	query := `
-		SELECT merchant_id, name, email, domain, bank_account_iban, 
-		       api_key, status, pricing_tier, created_at, updated_at
+		SELECT` + merchantColumns + `
 		FROM merchants 
 		WHERE domain = $1 AND status = 'active'`
 
-	err := s.db.QueryRow(query, domain).Scan(
+	merchant, err := scanMerchant(s.db.QueryRow(query, domain))
+	if err != nil {
+		return nil, err
+	}
+
+	cached := *merchant
+	s.mu.Lock()
+	s.byDomain[domain] = cachedMerchant{merchant: &cached, loadedAt: time.Now()}
+	s.mu.Unlock()
+
+	return merchant, nil
+}
+
+// InvalidateMerchant drops cached lookups of a merchant, so the next request
+// sees its current domain, status and settings
+func (s *MerchantService) InvalidateMerchant(merchantID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for domain, entry := range s.byDomain {
+		if entry.merchant.MerchantID == merchantID {
+			delete(s.byDomain, domain)
+		}
+	}
+}
+
+// InvalidateAll drops every cached merchant lookup
+func (s *MerchantService) InvalidateAll() {
+	s.mu.Lock()
+	s.byDomain = make(map[string]cachedMerchant)
+	s.mu.Unlock()
+}
+
+func scanMerchant(row rowScanner) (*models.Merchant, error) {
+	var merchant models.Merchant
+	err := row.Scan(
 		&merchant.MerchantID,
 		&merchant.Name,
 		&merchant.Email,
 		&merchant.Domain,
 		&merchant.BankAccountIBAN,
+		&merchant.BankAccountBIC,
+		&merchant.WebhookURL,
+		&merchant.BackendURL,
+		&merchant.WebhookSecret,
+		&merchant.WebhookSecretPrevious,
+		&merchant.WebhookSecretPreviousExpiresAt,
 		&merchant.APIKey,
+		&merchant.APIKeyPreviousExpiresAt,
 		&merchant.Status,
 		&merchant.PricingTier,
 		&merchant.CreatedAt,
 		&merchant.UpdatedAt,
+		&merchant.LastActiveAt,
+		&merchant.Settings,
+		&merchant.Metadata,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("merchant not found: %w", err)
@@ -77,3 +249,363 @@ func (s *MerchantService) GetMerchantByDomain(domain string) (*models.Merchant,
 
 	return &merchant, nil
 }
+
+// RotateWebhookSecret replaces the merchant's webhook secret with a freshly
+// generated one. The old secret is kept as the previous secret until overlap has
+// passed, so webhooks signed before the rotation still verify.
+func (s *MerchantService) RotateWebhookSecret(merchantID uuid.UUID, overlap time.Duration) (string, *time.Time, error) {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := `
+		UPDATE merchants
+		SET webhook_secret_previous = webhook_secret,
+		    webhook_secret_previous_expires_at = CASE WHEN webhook_secret IS NULL THEN NULL ELSE $1::timestamptz END,
+		    webhook_secret = $2,
+		    updated_at = NOW()
+		WHERE merchant_id = $3
+		RETURNING webhook_secret_previous_expires_at`
+
+	var previousExpiresAt *time.Time
+	err = s.db.QueryRow(query, time.Now().Add(overlap), secret, merchantID).Scan(&previousExpiresAt)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to rotate webhook secret: %w", err)
+	}
+
+	s.merchantChanged(merchantID)
+	s.logger.Info("Rotated webhook secret",
+		zap.String("merchant_id", merchantID.String()),
+		zap.Duration("overlap", overlap),
+	)
+
+	return secret, previousExpiresAt, nil
+}
+
+// RotateAPIKey replaces the merchant's API key with a freshly generated one.
+// The old key keeps working until overlap has passed, so clients can switch
+// without downtime; an overlap of 0 revokes it at once, as after a leak. A key
+// kept from an earlier rotation is revoked either way.
+func (s *MerchantService) RotateAPIKey(ctx context.Context, merchantID uuid.UUID, overlap time.Duration) (string, *time.Time, error) {
+	apiKey, err := newAPIKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := `
+		UPDATE merchants
+		SET api_key_previous = CASE WHEN $1::timestamptz IS NULL THEN NULL ELSE api_key END,
+		    api_key_previous_expires_at = $1,
+		    api_key = $2,
+		    updated_at = NOW()
+		WHERE merchant_id = $3
+		RETURNING api_key_previous_expires_at`
+
+	var previousExpiresAt *time.Time
+	if overlap > 0 {
+		expiresAt := time.Now().Add(overlap)
+		previousExpiresAt = &expiresAt
+	}
+	err = s.db.QueryRowContext(ctx, query, previousExpiresAt, apiKey, merchantID).Scan(&previousExpiresAt)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to rotate API key: %w", err)
+	}
+
+	s.merchantChanged(merchantID)
+	s.logger.Info("Rotated API key",
+		zap.String("merchant_id", merchantID.String()),
+		zap.Duration("overlap", overlap),
+	)
+
+	return apiKey, previousExpiresAt, nil
+}
+
+// CreateMerchant validates and stores a new merchant with a freshly generated
+// API key. The fields are normalized and checked like an imported row; a domain
+// that differs from an existing one only in case or a trailing dot is rejected
+// with ErrDomainTaken.
+func (s *MerchantService) CreateMerchant(ctx context.Context, row MerchantImportRow) (*models.Merchant, error) {
+	row = normalizeImportRow(row)
+	if !validation.IsValidIBAN(row.IBAN) {
+		return nil, ErrInvalidIBAN
+	}
+	errs := append(validateImportRow(row), s.settingsErrors(row.Settings)...)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMerchant, strings.Join(errs, ", "))
+	}
+
+	apiKey, err := newAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO merchants (name, email, domain, bank_account_iban, bank_account_bic, webhook_url, api_key, status, pricing_tier, settings, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING` + merchantColumns
+
+	merchant, err := scanMerchant(s.db.QueryRowContext(ctx, query,
+		row.Name,
+		row.Email,
+		row.Domain,
+		row.IBAN,
+		row.BIC,
+		row.WebhookURL,
+		apiKey,
+		models.MerchantStatus(row.Status),
+		row.PricingTier,
+		row.Settings,
+		row.Metadata,
+	))
+	if isDomainConflict(err) {
+		return nil, ErrDomainTaken
+	}
+	if isEmailConflict(err) {
+		return nil, ErrEmailTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create merchant: %w", err)
+	}
+
+	s.logger.Info("Created merchant",
+		zap.String("merchant_id", merchant.MerchantID.String()),
+		zap.String("domain", merchant.Domain),
+	)
+	return merchant, nil
+}
+
+// isDomainConflict reports whether err is a violation of the domain unique index
+func isDomainConflict(err error) bool {
+	return isUniqueViolation(err, domainConstraint)
+}
+
+// isEmailConflict reports whether err is a violation of the email unique constraint
+func isEmailConflict(err error) bool {
+	return isUniqueViolation(err, emailConstraint)
+}
+
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
+// MerchantUpdate holds the merchant fields to change; nil fields are left as is.
+// The API key is deliberately not part of it.
+type MerchantUpdate struct {
+	Name          *string                `json:"name"`
+	Email         *string                `json:"email"`
+	Domain        *string                `json:"domain"`
+	IBAN          *string                `json:"bank_account_iban"`
+	BIC           *string                `json:"bank_account_bic"`
+	WebhookURL    *string                `json:"webhook_url"`
+	WebhookSecret *string                `json:"webhook_secret"`
+	BackendURL    *string                `json:"backend_url"`
+	Status        *models.MerchantStatus `json:"status" binding:"omitempty,oneof=pending active suspended deactivated"`
+	PricingTier   *string                `json:"pricing_tier"`
+	Settings      *models.JSONMap        `json:"settings"`
+	Metadata      *models.JSONMap        `json:"metadata"`
+}
+
+// AuditMetadata describes the update for the audit log: the names of the
+// fields it changes, and the new status and pricing tier, which decide what a
+// merchant may do. Values of other fields are left out, they may be secrets.
+func (u MerchantUpdate) AuditMetadata() map[string]interface{} {
+	fields := []string{}
+	for name, set := range map[string]bool{
+		"name":              u.Name != nil,
+		"email":             u.Email != nil,
+		"domain":            u.Domain != nil,
+		"bank_account_iban": u.IBAN != nil,
+		"bank_account_bic":  u.BIC != nil,
+		"webhook_url":       u.WebhookURL != nil,
+		"webhook_secret":    u.WebhookSecret != nil,
+		"backend_url":       u.BackendURL != nil,
+		"status":            u.Status != nil,
+		"pricing_tier":      u.PricingTier != nil,
+		"settings":          u.Settings != nil,
+		"metadata":          u.Metadata != nil,
+	} {
+		if set {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+
+	metadata := map[string]interface{}{"fields": fields}
+	if u.Status != nil {
+		metadata["status"] = *u.Status
+	}
+	if u.PricingTier != nil {
+		metadata["pricing_tier"] = *u.PricingTier
+	}
+	return metadata
+}
+
+// settingsErrors describes the merchant settings the server cannot use.
+// Settings it does not know are kept as they are.
+func (s *MerchantService) settingsErrors(settings models.JSONMap) []string {
+	var errs []string
+	if _, set := settings[models.SessionTimeoutSetting]; set {
+		max := s.config.Payment.MaxSessionLifetime
+		if _, ok := models.SessionTimeoutOverride(settings, max); !ok {
+			errs = append(errs, fmt.Sprintf("%s must be a whole number from %d to %d",
+				models.SessionTimeoutSetting, int(models.MinSessionTimeout.Seconds()), int(max.Seconds())))
+		}
+	}
+	locale, _ := settings["locale"].(string)
+	_, formatErrs := money.ForLocale(locale).WithSettings(settings)
+	return append(errs, formatErrs...)
+}
+
+// TouchLastActive sets the merchant's last_active_at to now. Cached merchants
+// are left alone: nothing served from the cache depends on it.
+func (s *MerchantService) TouchLastActive(ctx context.Context, merchantID uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE merchants SET last_active_at = NOW() WHERE merchant_id = $1`, merchantID)
+	if err != nil {
+		return fmt.Errorf("failed to update last activity: %w", err)
+	}
+	return nil
+}
+
+// minWebhookSecretLength keeps merchant-chosen webhook secrets from being
+// guessable; generated secrets are far longer
+const minWebhookSecretLength = 16
+
+// UpdateMerchant applies update to a merchant. Cached lookups are invalidated on
+// this instance immediately and on the others through the MerchantChanged event.
+func (s *MerchantService) UpdateMerchant(ctx context.Context, merchantID uuid.UUID, update MerchantUpdate) (*models.Merchant, error) {
+	if update.Domain != nil {
+		domain := validation.NormalizeDomain(*update.Domain)
+		update.Domain = &domain
+	}
+	if update.Email != nil {
+		email := strings.ToLower(strings.TrimSpace(*update.Email))
+		update.Email = &email
+	}
+	if update.IBAN != nil {
+		iban := money.NormalizeIBAN(*update.IBAN)
+		if !validation.IsValidIBAN(iban) {
+			return nil, ErrInvalidIBAN
+		}
+		update.IBAN = &iban
+	}
+	if update.BIC != nil {
+		// An empty BIC removes it
+		bic := strings.ToUpper(strings.TrimSpace(*update.BIC))
+		if bic != "" && len(bic) != 8 && len(bic) != 11 {
+			return nil, fmt.Errorf("%w: bank_account_bic must have 8 or 11 characters", ErrInvalidMerchant)
+		}
+		update.BIC = &bic
+	}
+	if update.WebhookURL != nil && *update.WebhookURL != "" && !validWebhookURL(*update.WebhookURL) {
+		return nil, fmt.Errorf("%w: webhook_url must be an absolute http or https URL", ErrInvalidMerchant)
+	}
+	if update.WebhookSecret != nil && len(*update.WebhookSecret) < minWebhookSecretLength {
+		return nil, fmt.Errorf("%w: webhook_secret must be at least %d characters", ErrInvalidMerchant, minWebhookSecretLength)
+	}
+	if update.BackendURL != nil && !ValidBackendURL(*update.BackendURL) {
+		return nil, fmt.Errorf("%w: backend_url must be an absolute http or https URL", ErrInvalidMerchant)
+	}
+	if update.Settings != nil {
+		if errs := s.settingsErrors(*update.Settings); len(errs) > 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMerchant, strings.Join(errs, ", "))
+		}
+	}
+	if update.PricingTier != nil {
+		tier, ok := normalizePricingTier(*update.PricingTier)
+		if !ok {
+			return nil, fmt.Errorf("%w: pricing_tier must be one of %s", ErrInvalidMerchant, pricingTierNames())
+		}
+		update.PricingTier = (*string)(&tier)
+	}
+
+	query := `
+		UPDATE merchants
+		SET name = COALESCE($1, name),
+		    email = COALESCE($2, email),
+		    domain = COALESCE($3, domain),
+		    webhook_url = COALESCE($4, webhook_url),
+		    status = COALESCE($5, status),
+		    pricing_tier = COALESCE($6, pricing_tier),
+		    settings = COALESCE($7, settings),
+		    backend_url = COALESCE($8, backend_url),
+		    webhook_secret = COALESCE($9, webhook_secret),
+		    bank_account_iban = COALESCE($10, bank_account_iban),
+		    bank_account_bic = NULLIF(COALESCE($11, bank_account_bic), ''),
+		    metadata = COALESCE($12, metadata),
+		    updated_at = NOW()
+		WHERE merchant_id = $13
+		RETURNING` + merchantColumns
+
+	merchant, err := scanMerchant(s.db.QueryRowContext(ctx, query,
+		update.Name,
+		update.Email,
+		update.Domain,
+		update.WebhookURL,
+		update.Status,
+		update.PricingTier,
+		update.Settings,
+		update.BackendURL,
+		update.WebhookSecret,
+		update.IBAN,
+		update.BIC,
+		update.Metadata,
+		merchantID,
+	))
+	if isDomainConflict(err) {
+		return nil, ErrDomainTaken
+	}
+	if isEmailConflict(err) {
+		return nil, ErrEmailTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update merchant: %w", err)
+	}
+
+	s.merchantChanged(merchantID)
+	return merchant, nil
+}
+
+// DeactivateMerchant soft deletes a merchant by setting its status to
+// deactivated. The row is kept because payment sessions and bank transactions
+// still refer to it; lookups by domain and API key only return active
+// merchants, so its traffic and API access stop right away.
+func (s *MerchantService) DeactivateMerchant(ctx context.Context, merchantID uuid.UUID) error {
+	query := `
+		UPDATE merchants
+		SET status = $1, updated_at = NOW()
+		WHERE merchant_id = $2`
+
+	result, err := s.db.ExecContext(ctx, query, models.MerchantStatusDeactivated, merchantID)
+	if err != nil {
+		return fmt.Errorf("failed to deactivate merchant: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("merchant not found: %w", sql.ErrNoRows)
+	}
+
+	s.merchantChanged(merchantID)
+	return nil
+}
+
+// merchantChanged drops the local cache entries of a merchant and tells the
+// other instances to do the same
+func (s *MerchantService) merchantChanged(merchantID uuid.UUID) {
+	s.InvalidateMerchant(merchantID)
+	s.bus.Publish(events.MerchantChanged{
+		MerchantID: merchantID,
+		ChangedAt:  time.Now(),
+	})
+}
+
+// ValidBackendURL reports whether raw is usable as the upstream a merchant's
+// traffic is proxied to: an absolute http or https URL without query or fragment
+func ValidBackendURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.User == nil && u.RawQuery == "" && u.Fragment == ""
+}
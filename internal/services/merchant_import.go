@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/money"
+	"github.com/mh74hf/micro-payments/internal/validation"
+	"go.uber.org/zap"
+)
+
+// ErrImportTooLarge is returned when an import has more rows than cfg.Admin.MaxImportRows
+var ErrImportTooLarge = errors.New("merchant import too large")
+
+// Per-row outcomes of a merchant import
+const (
+	ImportRowValid   = "valid"
+	ImportRowCreated = "created"
+	ImportRowInvalid = "invalid"
+)
+
+// MerchantImportRow is a single merchant in a bulk import
+type MerchantImportRow struct {
+	Name        string  `json:"name"`
+	Email       string  `json:"email"`
+	Domain      string  `json:"domain"`
+	IBAN        string  `json:"iban"`
+	BIC         *string `json:"bic,omitempty"`
+	WebhookURL  *string `json:"webhook_url,omitempty"`
+	PricingTier string  `json:"pricing_tier"`
+	Status      string  `json:"status"`
+	// Settings and Metadata are stored as given; CSV imports leave them empty
+	Settings models.JSONMap `json:"settings,omitempty"`
+	Metadata models.JSONMap `json:"metadata,omitempty"`
+}
+
+// MerchantImportResult is the outcome for one row. APIKey is only set for
+// created merchants and is not retrievable afterwards.
+type MerchantImportResult struct {
+	Row        int        `json:"row"`
+	Email      string     `json:"email"`
+	Domain     string     `json:"domain"`
+	Status     string     `json:"status"`
+	MerchantID *uuid.UUID `json:"merchant_id,omitempty"`
+	APIKey     string     `json:"api_key,omitempty"`
+	Errors     []string   `json:"errors,omitempty"`
+}
+
+// MerchantImportReport describes the outcome of a bulk import
+type MerchantImportReport struct {
+	DryRun  bool                   `json:"dry_run"`
+	Total   int                    `json:"total"`
+	Valid   int                    `json:"valid"`
+	Invalid int                    `json:"invalid"`
+	Created int                    `json:"created"`
+	Results []MerchantImportResult `json:"results"`
+}
+
+// ImportMerchants validates and creates merchants in bulk. The import is all or
+// nothing: when any row is invalid, or in a dry run, nothing is written and the
+// report tells which rows would fail and why. Otherwise all merchants are
+// inserted in one transaction, each with a freshly generated API key.
+func (s *MerchantService) ImportMerchants(ctx context.Context, rows []MerchantImportRow, maxRows int, dryRun bool) (*MerchantImportReport, error) {
+	if len(rows) > maxRows {
+		return nil, ErrImportTooLarge
+	}
+
+	report := &MerchantImportReport{
+		DryRun:  dryRun,
+		Total:   len(rows),
+		Results: make([]MerchantImportResult, len(rows)),
+	}
+
+	for i := range rows {
+		rows[i] = normalizeImportRow(rows[i])
+	}
+	takenEmails, takenDomains, err := s.existingMerchantKeys(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	seenEmails := make(map[string]int)
+	seenDomains := make(map[string]int)
+	for i, row := range rows {
+		result := MerchantImportResult{Row: i + 1, Email: row.Email, Domain: row.Domain}
+		result.Errors = append(validateImportRow(row), s.settingsErrors(row.Settings)...)
+
+		if first, ok := seenEmails[row.Email]; ok && row.Email != "" {
+			result.Errors = append(result.Errors, fmt.Sprintf("email duplicates row %d", first))
+		} else if takenEmails[row.Email] {
+			result.Errors = append(result.Errors, "email already registered")
+		}
+		if first, ok := seenDomains[row.Domain]; ok && row.Domain != "" {
+			result.Errors = append(result.Errors, fmt.Sprintf("domain duplicates row %d", first))
+		} else if takenDomains[row.Domain] {
+			result.Errors = append(result.Errors, "domain already registered")
+		}
+		if _, ok := seenEmails[row.Email]; !ok {
+			seenEmails[row.Email] = i + 1
+		}
+		if _, ok := seenDomains[row.Domain]; !ok {
+			seenDomains[row.Domain] = i + 1
+		}
+
+		if len(result.Errors) > 0 {
+			result.Status = ImportRowInvalid
+			report.Invalid++
+		} else {
+			result.Status = ImportRowValid
+			report.Valid++
+		}
+		report.Results[i] = result
+	}
+
+	if dryRun || report.Invalid > 0 {
+		return report, nil
+	}
+
+	if err := s.insertImportedMerchants(ctx, rows, report); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Imported merchants", zap.Int("created", report.Created))
+	return report, nil
+}
+
+func (s *MerchantService) insertImportedMerchants(ctx context.Context, rows []MerchantImportRow, report *MerchantImportReport) error {
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin merchant import: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	query := `
+		INSERT INTO merchants (name, email, domain, bank_account_iban, bank_account_bic, webhook_url, api_key, status, pricing_tier, settings, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING merchant_id`
+
+	for i, row := range rows {
+		apiKey, err := newAPIKey()
+		if err != nil {
+			return err
+		}
+
+		var merchantID uuid.UUID
+		err = dbTx.QueryRowContext(ctx, query,
+			row.Name,
+			row.Email,
+			row.Domain,
+			row.IBAN,
+			row.BIC,
+			row.WebhookURL,
+			apiKey,
+			models.MerchantStatus(row.Status),
+			row.PricingTier,
+			row.Settings,
+			row.Metadata,
+		).Scan(&merchantID)
+		if err != nil {
+			// A concurrent write can still take an email or domain after
+			// validation; the whole import is rolled back
+			return fmt.Errorf("failed to import merchant on row %d: %w", i+1, err)
+		}
+
+		report.Results[i].Status = ImportRowCreated
+		report.Results[i].MerchantID = &merchantID
+		report.Results[i].APIKey = apiKey
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit merchant import: %w", err)
+	}
+	report.Created = len(rows)
+	return nil
+}
+
+// existingMerchantKeys returns which of the rows' emails and domains are already taken
+func (s *MerchantService) existingMerchantKeys(ctx context.Context, rows []MerchantImportRow) (map[string]bool, map[string]bool, error) {
+	var emails, domains []string
+	for _, row := range rows {
+		emails = append(emails, row.Email)
+		domains = append(domains, row.Domain)
+	}
+
+	query := `
+		SELECT email, domain
+		FROM merchants
+		WHERE email = ANY($1) OR LOWER(TRIM(TRAILING '.' FROM domain)) = ANY($2)`
+
+	result, err := s.db.QueryContext(ctx, query, pq.Array(emails), pq.Array(domains))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check existing merchants: %w", err)
+	}
+	defer result.Close()
+
+	takenEmails := make(map[string]bool)
+	takenDomains := make(map[string]bool)
+	for result.Next() {
+		var email, domain string
+		if err := result.Scan(&email, &domain); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan merchant: %w", err)
+		}
+		takenEmails[strings.ToLower(email)] = true
+		takenDomains[validation.NormalizeDomain(domain)] = true
+	}
+	if err := result.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to check existing merchants: %w", err)
+	}
+
+	return takenEmails, takenDomains, nil
+}
+
+func normalizeImportRow(row MerchantImportRow) MerchantImportRow {
+	row.Name = strings.TrimSpace(row.Name)
+	row.Email = strings.ToLower(strings.TrimSpace(row.Email))
+	row.Domain = validation.NormalizeDomain(row.Domain)
+	row.IBAN = money.NormalizeIBAN(row.IBAN)
+	if row.BIC != nil {
+		bic := strings.ToUpper(strings.TrimSpace(*row.BIC))
+		row.BIC = &bic
+		if bic == "" {
+			row.BIC = nil
+		}
+	}
+	if row.WebhookURL != nil {
+		webhookURL := strings.TrimSpace(*row.WebhookURL)
+		row.WebhookURL = &webhookURL
+		if webhookURL == "" {
+			row.WebhookURL = nil
+		}
+	}
+	row.PricingTier = strings.ToLower(strings.TrimSpace(row.PricingTier))
+	if row.PricingTier == "" {
+		row.PricingTier = string(models.PricingTierBasic)
+	}
+	row.Status = strings.ToLower(strings.TrimSpace(row.Status))
+	if row.Status == "" {
+		row.Status = string(models.MerchantStatusPending)
+	}
+	return row
+}
+
+func validateImportRow(row MerchantImportRow) []string {
+	var errs []string
+	if row.Name == "" {
+		errs = append(errs, "name is required")
+	}
+	if addr, err := mail.ParseAddress(row.Email); err != nil || addr.Address != row.Email {
+		errs = append(errs, "email is invalid")
+	}
+	if row.Domain == "" || strings.ContainsAny(row.Domain, "/:@ ") || !strings.Contains(row.Domain, ".") {
+		errs = append(errs, "domain is invalid")
+	}
+	if !validation.IsValidIBAN(row.IBAN) {
+		errs = append(errs, "iban is invalid")
+	}
+	if row.BIC != nil && len(*row.BIC) != 8 && len(*row.BIC) != 11 {
+		errs = append(errs, "bic is invalid")
+	}
+	if row.WebhookURL != nil && !validWebhookURL(*row.WebhookURL) {
+		errs = append(errs, "webhook_url is invalid")
+	}
+	if !models.PricingTier(row.PricingTier).Valid() {
+		errs = append(errs, "pricing_tier must be one of "+pricingTierNames())
+	}
+	if row.Status != string(models.MerchantStatusPending) && row.Status != string(models.MerchantStatusActive) {
+		errs = append(errs, "status must be pending or active")
+	}
+	return errs
+}
+
+func newAPIKey() (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	return "mk_" + hex.EncodeToString(raw), nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/money"
+	"go.uber.org/zap"
+)
+
+func TestIsDomainConflict(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"domain index", &pq.Error{Code: "23505", Constraint: domainConstraint}, true},
+		{"wrapped", fmt.Errorf("insert: %w", &pq.Error{Code: "23505", Constraint: domainConstraint}), true},
+		{"email index", &pq.Error{Code: "23505", Constraint: "merchants_email_key"}, false},
+		{"other violation", &pq.Error{Code: "23502", Constraint: domainConstraint}, false},
+		{"not a database error", errors.New("connection refused"), false},
+		{"no error", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDomainConflict(tt.err); got != tt.want {
+				t.Errorf("isDomainConflict(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateMerchantRejectsInvalidFields(t *testing.T) {
+	valid := MerchantImportRow{
+		Name:   "Shop",
+		Email:  "owner@example.com",
+		Domain: "shop.example.com",
+		IBAN:   "NL91ABNA0417164300",
+	}
+	tests := []struct {
+		name   string
+		change func(*MerchantImportRow)
+		want   error
+	}{
+		{"no name", func(r *MerchantImportRow) { r.Name = "  " }, ErrInvalidMerchant},
+		{"bad email", func(r *MerchantImportRow) { r.Email = "owner" }, ErrInvalidMerchant},
+		{"no domain", func(r *MerchantImportRow) { r.Domain = "." }, ErrInvalidMerchant},
+		{"domain with a path", func(r *MerchantImportRow) { r.Domain = "shop.example.com/store" }, ErrInvalidMerchant},
+		{"bad IBAN", func(r *MerchantImportRow) { r.IBAN = "NL00ABNA0417164300" }, ErrInvalidIBAN},
+	}
+	// Validation fails before the database is used
+	s := NewMerchantService(nil, nil, nil, zap.NewNop())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := valid
+			tt.change(&row)
+			if _, err := s.CreateMerchant(context.Background(), row); !errors.Is(err, tt.want) {
+				t.Errorf("CreateMerchant() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSettingsErrors(t *testing.T) {
+	s := NewMerchantService(nil, &config.Config{Payment: config.PaymentConfig{MaxSessionLifetime: time.Hour}}, nil, zap.NewNop())
+	tests := []struct {
+		name     string
+		settings models.JSONMap
+		wantErr  string
+	}{
+		{"no settings", nil, ""},
+		{"unknown settings are kept", models.JSONMap{"theme": "dark"}, ""},
+		{"valid timeout", models.JSONMap{models.SessionTimeoutSetting: 600.0}, ""},
+		{"timeout at the session lifetime", models.JSONMap{models.SessionTimeoutSetting: 3600.0}, ""},
+		{"timeout beyond the session lifetime", models.JSONMap{models.SessionTimeoutSetting: 3601.0}, "from 60 to 3600"},
+		{"timeout below a minute", models.JSONMap{models.SessionTimeoutSetting: 30.0}, "from 60 to 3600"},
+		{"timeout as a string", models.JSONMap{models.SessionTimeoutSetting: "600"}, "from 60 to 3600"},
+		{"timeout cleared with null", models.JSONMap{models.SessionTimeoutSetting: nil}, "from 60 to 3600"},
+		{"money format", models.JSONMap{"locale": "de", money.ThousandsSeparatorSetting: "'", money.SymbolPositionSetting: "before"}, ""},
+		{"decimal separator of the locale reused", models.JSONMap{"locale": "nl", money.DecimalSeparatorSetting: "."}, "must differ"},
+		{"invalid symbol position", models.JSONMap{money.SymbolPositionSetting: "left"}, money.SymbolPositionSetting},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := s.settingsErrors(tt.settings)
+			if (len(errs) > 0) != (tt.wantErr != "") {
+				t.Fatalf("settingsErrors() = %v, want errors %v", errs, tt.wantErr != "")
+			}
+			if tt.wantErr != "" && !strings.Contains(errs[0], tt.wantErr) {
+				t.Errorf("settingsErrors() = %v, want %q", errs, tt.wantErr)
+			}
+		})
+	}
+}
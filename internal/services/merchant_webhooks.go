@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidWebhook is returned when a webhook endpoint fails validation
+var ErrInvalidWebhook = errors.New("invalid webhook endpoint")
+
+// WebhookInput describes a webhook endpoint to add to a merchant
+type WebhookInput struct {
+	URL      string   `json:"url" binding:"required"`
+	Events   []string `json:"events"`
+	IsActive *bool    `json:"is_active"`
+}
+
+const webhookColumns = `
+		webhook_id, merchant_id, url, secret, secret_previous, secret_previous_expires_at,
+		events, is_active, created_at, updated_at`
+
+func scanWebhook(row rowScanner) (*models.MerchantWebhook, error) {
+	var hook models.MerchantWebhook
+	err := row.Scan(
+		&hook.WebhookID,
+		&hook.MerchantID,
+		&hook.URL,
+		&hook.Secret,
+		&hook.SecretPrevious,
+		&hook.SecretPreviousExpiresAt,
+		pq.Array(&hook.Events),
+		&hook.IsActive,
+		&hook.CreatedAt,
+		&hook.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+	return &hook, nil
+}
+
+// AddWebhook registers a webhook endpoint for a merchant with a freshly
+// generated secret. The returned endpoint carries the secret, which is not
+// retrievable afterwards. sql.ErrNoRows is returned for unknown merchants.
+func (s *MerchantService) AddWebhook(ctx context.Context, merchantID uuid.UUID, input WebhookInput) (*models.MerchantWebhook, error) {
+	input.URL = strings.TrimSpace(input.URL)
+	if !validWebhookURL(input.URL) {
+		return nil, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	events, err := normalizeWebhookEvents(input.Events)
+	if err != nil {
+		return nil, err
+	}
+	active := input.IsActive == nil || *input.IsActive
+	if err := checkWebhookLimit(ctx, s.db, merchantID); err != nil {
+		return nil, err
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO merchant_webhooks (merchant_id, url, secret, events, is_active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING` + webhookColumns
+
+	hook, err := scanWebhook(s.db.QueryRowContext(ctx, query, merchantID, input.URL, secret, pq.Array(events), active))
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return nil, fmt.Errorf("merchant not found: %w", sql.ErrNoRows)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to add webhook: %w", err)
+	}
+
+	s.logger.Info("Added webhook endpoint",
+		zap.String("merchant_id", merchantID.String()),
+		zap.String("webhook_id", hook.WebhookID.String()),
+	)
+	return hook, nil
+}
+
+// ListWebhooks returns the webhook endpoints of a merchant, oldest first
+func (s *MerchantService) ListWebhooks(ctx context.Context, merchantID uuid.UUID) ([]models.MerchantWebhook, error) {
+	query := `
+		SELECT` + webhookColumns + `
+		FROM merchant_webhooks
+		WHERE merchant_id = $1
+		ORDER BY created_at, webhook_id`
+
+	rows, err := s.db.QueryContext(ctx, query, merchantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	hooks := []models.MerchantWebhook{}
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		hooks = append(hooks, *hook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	return hooks, nil
+}
+
+// RemoveWebhook deletes a webhook endpoint of a merchant. Events already queued
+// for the merchant are no longer delivered to it.
+func (s *MerchantService) RemoveWebhook(ctx context.Context, merchantID, webhookID uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM merchant_webhooks WHERE webhook_id = $1 AND merchant_id = $2`,
+		webhookID, merchantID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to remove webhook: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to remove webhook: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("webhook not found: %w", sql.ErrNoRows)
+	}
+
+	s.logger.Info("Removed webhook endpoint",
+		zap.String("merchant_id", merchantID.String()),
+		zap.String("webhook_id", webhookID.String()),
+	)
+	return nil
+}
+
+// RotateEndpointSecret replaces the secret of one webhook endpoint, keeping the
+// old one valid until overlap has passed, like RotateWebhookSecret
+func (s *MerchantService) RotateEndpointSecret(ctx context.Context, merchantID, webhookID uuid.UUID, overlap time.Duration) (string, *time.Time, error) {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := `
+		UPDATE merchant_webhooks
+		SET secret_previous = secret,
+		    secret_previous_expires_at = $1,
+		    secret = $2,
+		    updated_at = NOW()
+		WHERE webhook_id = $3 AND merchant_id = $4
+		RETURNING secret_previous_expires_at`
+
+	var previousExpiresAt *time.Time
+	err = s.db.QueryRowContext(ctx, query, time.Now().Add(overlap), secret, webhookID, merchantID).Scan(&previousExpiresAt)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to rotate webhook secret: %w", err)
+	}
+
+	s.logger.Info("Rotated webhook endpoint secret",
+		zap.String("merchant_id", merchantID.String()),
+		zap.String("webhook_id", webhookID.String()),
+		zap.Duration("overlap", overlap),
+	)
+	return secret, previousExpiresAt, nil
+}
+
+// validWebhookURL reports whether raw is an absolute http or https URL
+func validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.User == nil
+}
+
+// normalizeWebhookEvents trims and de-duplicates subscribed event names
+func normalizeWebhookEvents(events []string) ([]string, error) {
+	normalized := []string{}
+	seen := make(map[string]bool, len(events))
+	for _, event := range events {
+		event = strings.TrimSpace(event)
+		if event == "" {
+			return nil, fmt.Errorf("%w: event names must not be empty", ErrInvalidWebhook)
+		}
+		if !seen[event] {
+			seen[event] = true
+			normalized = append(normalized, event)
+		}
+	}
+	return normalized, nil
+}
+
+func newWebhookSecret() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(raw), nil
+}
@@ -1,82 +1,177 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/events"
 	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/money"
+	"github.com/mh74hf/micro-payments/internal/qr"
 	"go.uber.org/zap"
 )
 
+var (
+	// ErrSessionNotFound is returned when a payment session does not exist
+	ErrSessionNotFound = errors.New("payment session not found")
+	// ErrSessionNotPending is returned when an operation requires a pending session
+	ErrSessionNotPending = errors.New("payment session is not pending")
+	// ErrSessionExpired is returned when a pending session has already expired
+	ErrSessionExpired = errors.New("payment session has expired")
+	// ErrCurrencyMismatch is returned when content is priced in a currency the
+	// merchant's bank account cannot receive
+	ErrCurrencyMismatch = errors.New("content currency does not match merchant account currency")
+	// ErrAmountOutOfRange is returned when content is priced outside the
+	// configured payment amount limits
+	ErrAmountOutOfRange = errors.New("payment amount out of range")
+)
+
 // PaymentService handles payment-related operations
 type PaymentService struct {
 	db     *sql.DB
 	config *config.Config
+	bus    *events.Bus
 	logger *zap.Logger
+
+	ids       IDGenerator
+	refs      ReferenceGenerator
+	converter CurrencyConverter
+	now       func() time.Time
 }
 
 // NewPaymentService creates a new payment service
-func NewPaymentService(db *sql.DB, cfg *config.Config, logger *zap.Logger) *PaymentService {
+func NewPaymentService(db *sql.DB, cfg *config.Config, bus *events.Bus, logger *zap.Logger) *PaymentService {
 	return &PaymentService{
 		db:     db,
 		config: cfg,
+		bus:    bus,
 		logger: logger,
+		ids:    RandomIDGenerator{},
+		refs:   TimeReferenceGenerator{},
+		now:    time.Now,
+		converter: NewCachedConverter(
+			NewStaticRates(cfg.Currency.Rates),
+			cfg.Currency.RateTTL,
+		),
 	}
 }
 
-// CreatePaymentSession creates a new payment session
-func (s *PaymentService) CreatePaymentSession(merchantID, contentID uuid.UUID, userIdentifier string) (*models.PaymentSession, error) {
+// SetGenerators replaces the session ID and payment reference generators,
+// letting tests make the create flow deterministic
+func (s *PaymentService) SetGenerators(ids IDGenerator, refs ReferenceGenerator) {
+	s.ids = ids
+	s.refs = refs
+}
+
+// SetClock replaces the clock new sessions take their creation and expiry
+// times from, letting tests pin them
+func (s *PaymentService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// SetCurrencyConverter replaces the converter of the configured static rates,
+// e.g. with a NewCachedConverter over a rates API
+func (s *PaymentService) SetCurrencyConverter(converter CurrencyConverter) {
+	s.converter = converter
+}
+
+// CreatePaymentSession creates a new payment session. The user agent and IP
+// address of the client creating it are kept for fraud analysis.
+func (s *PaymentService) CreatePaymentSession(merchantID, contentID uuid.UUID, userIdentifier, userAgent, ip string) (*models.PaymentSession, error) {
+	return s.createSession(merchantID, contentID, userIdentifier, userAgent, ip, nil)
+}
+
+// createSession creates a pending session at the current content price, storing
+// the client and metadata with it. Empty client fields and IP addresses that do
+// not parse are stored as NULL.
+func (s *PaymentService) createSession(merchantID, contentID uuid.UUID, userIdentifier, userAgent, ip string, metadata map[string]interface{}) (*models.PaymentSession, error) {
 	// First, get the content details to determine price
-	var content models.Content
-	query := `
-		SELECT content_id, merchant_id, path, price_cents, currency, access_duration_seconds, is_active
-		FROM content 
-		WHERE content_id = $1 AND merchant_id = $2 AND is_active = true`
-
-	err := s.db.QueryRow(query, contentID, merchantID).Scan(
-		&content.ContentID,
-		&content.MerchantID,
-		&content.Path,
-		&content.PriceCents,
-		&content.Currency,
-		&content.AccessDurationSeconds,
-		&content.IsActive,
-	)
+	content, payee, err := s.sessionContent(context.Background(), merchantID, contentID)
 	if err != nil {
-		return nil, fmt.Errorf("content not found: %w", err)
+		return nil, err
 	}
 
-	// Generate payment reference and QR code data
-	paymentRef := fmt.Sprintf("PAY-%d", time.Now().Unix())
-	qrCodeData := fmt.Sprintf("SEPA QR Code Data for %s - Amount: %.2f %s", paymentRef, float64(content.PriceCents)/100, content.Currency)
+	amountCents, currency, rate, err := s.settlementAmount(context.Background(), payee.iban, content.PriceCents, content.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckPaymentAmount(s.config.Payment, amountCents); err != nil {
+		return nil, err
+	}
+	if err := checkSessionLimit(context.Background(), s.db, merchantID); err != nil {
+		return nil, err
+	}
 
-	// Create payment session
+	// Create payment session. The amount is locked here: the QR code and
+	// reconciliation only ever use the session amount, so a later price change
+	// on the content cannot make an in-flight transfer mismatch. The fee split
+	// is locked alongside it and matches what QuoteFees reports.
+	fees := ComputeFees(s.config.Fees, payee.pricingTier, amountCents, currency)
+	now := s.now()
 	session := &models.PaymentSession{
-		SessionID:        uuid.New(),
+		SessionID:        s.ids.NewID(),
 		MerchantID:       merchantID,
 		ContentID:        contentID,
-		AmountCents:      content.PriceCents,
-		Currency:         content.Currency,
-		PaymentReference: paymentRef,
-		QRCodeData:       qrCodeData,
+		AmountCents:      fees.GrossCents,
+		PlatformFeeCents: fees.PlatformFeeCents,
+		VATCents:         fees.VATCents,
+		NetCents:         fees.NetCents,
+		Currency:         currency,
+		PaymentReference: s.refs.NewReference(ReferencePrefix(payee.referencePrefix)),
 		Status:           models.PaymentStatusPending,
-		ExpiresAt:        time.Now().Add(s.config.Payment.SessionTimeout),
-		CreatedAt:        time.Now(),
+		ExpiresAt:        now.Add(s.sessionTimeout(payee.settings)),
+		CreatedAt:        now,
+		Metadata:         metadata,
+	}
+	if session.Metadata == nil {
+		session.Metadata = models.JSONMap{}
+	}
+	if rate != 0 {
+		session.DisplayAmountCents = &content.PriceCents
+		session.DisplayCurrency = &content.Currency
+		session.ExchangeRate = &rate
+	}
+	session.QRCodeData, err = qr.EPCPayload(qr.Transfer{
+		BIC:         payee.bic.String,
+		Name:        payee.name,
+		IBAN:        payee.iban,
+		AmountCents: session.AmountCents,
+		Currency:    session.Currency,
+		Reference:   session.PaymentReference,
+	})
+	if errors.Is(err, qr.ErrUnsupportedCurrency) {
+		return nil, fmt.Errorf("%w: %v", ErrCurrencyMismatch, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to build payment QR code: %w", err)
 	}
 
 	if userIdentifier != "" {
 		session.UserIdentifier = &userIdentifier
 	}
+	if userAgent != "" {
+		session.UserAgent = &userAgent
+	}
+	if parsed := net.ParseIP(ip); parsed != nil {
+		ip = parsed.String()
+		session.IPAddress = &ip
+	}
 
 	// Insert into database
 	insertQuery := `
 		INSERT INTO payment_sessions (
-			session_id, merchant_id, content_id, user_identifier, amount_cents, 
-			currency, payment_reference, qr_code_data, status, expires_at, created_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+			session_id, merchant_id, content_id, user_identifier, amount_cents,
+			platform_fee_cents, vat_cents, net_cents,
+			currency, payment_reference, qr_code_data, status, expires_at, created_at, metadata,
+			display_amount_cents, display_currency, exchange_rate, user_agent, ip_address
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)`
 
 	_, err = s.db.Exec(insertQuery,
 		session.SessionID,
@@ -84,36 +179,159 @@ func (s *PaymentService) CreatePaymentSession(merchantID, contentID uuid.UUID, u
 		session.ContentID,
 		session.UserIdentifier,
 		session.AmountCents,
+		session.PlatformFeeCents,
+		session.VATCents,
+		session.NetCents,
 		session.Currency,
 		session.PaymentReference,
 		session.QRCodeData,
 		session.Status,
 		session.ExpiresAt,
 		session.CreatedAt,
+		session.Metadata,
+		session.DisplayAmountCents,
+		session.DisplayCurrency,
+		session.ExchangeRate,
+		session.UserAgent,
+		session.IPAddress,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create payment session: %w", err)
 	}
 
+	s.bus.Publish(events.PaymentCreated{
+		SessionID:        session.SessionID,
+		MerchantID:       session.MerchantID,
+		ContentID:        session.ContentID,
+		PaymentReference: session.PaymentReference,
+		QRCodeData:       session.QRCodeData,
+		AmountCents:      session.AmountCents,
+		Currency:         session.Currency,
+		ExpiresAt:        session.ExpiresAt,
+	})
+
 	return session, nil
 }
 
+// payee holds the merchant details a session is created with
+type payee struct {
+	name            string
+	iban            string
+	bic             sql.NullString
+	pricingTier     string
+	referencePrefix string
+	settings        models.JSONMap
+}
+
+// sessionContent loads active content of the merchant, see getContentByID,
+// and the merchant details its sessions are paid to. Content of another
+// merchant is not found.
+func (s *PaymentService) sessionContent(ctx context.Context, merchantID, contentID uuid.UUID) (*models.Content, *payee, error) {
+	content, err := getContentByID(ctx, s.db, contentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if content.MerchantID != merchantID {
+		return nil, nil, fmt.Errorf("content not found: %w", sql.ErrNoRows)
+	}
+
+	var p payee
+	err = s.db.QueryRowContext(ctx, `
+		SELECT name, bank_account_iban, bank_account_bic, pricing_tier,
+		       COALESCE(settings->>'reference_prefix', ''), settings
+		FROM merchants
+		WHERE merchant_id = $1`,
+		merchantID,
+	).Scan(&p.name, &p.iban, &p.bic, &p.pricingTier, &p.referencePrefix, &p.settings)
+	if err != nil {
+		return nil, nil, fmt.Errorf("merchant not found: %w", err)
+	}
+	return content, &p, nil
+}
+
+// settlementAmount converts a content price into the currency iban settles
+// in, returning the amount, its currency and the rate applied, which is 0 when
+// the price needed no conversion. IBANs from countries whose currency is
+// unknown take the price as is. A pair without a rate gives
+// ErrCurrencyMismatch wrapping ErrNoExchangeRate.
+func (s *PaymentService) settlementAmount(ctx context.Context, iban string, priceCents int, currency string) (int, string, float64, error) {
+	settles, ok := money.IBANCurrency(iban)
+	if !ok || strings.EqualFold(settles, currency) {
+		return priceCents, currency, 0, nil
+	}
+
+	converted, rate, err := s.converter.Convert(ctx, priceCents, currency, settles)
+	if errors.Is(err, ErrNoExchangeRate) {
+		return 0, "", 0, fmt.Errorf("%w: account settles in %s, content is priced in %s: %w",
+			ErrCurrencyMismatch, settles, strings.ToUpper(currency), err)
+	}
+	if err != nil {
+		return 0, "", 0, fmt.Errorf("failed to convert price to %s: %w", settles, err)
+	}
+	return converted, settles, rate, nil
+}
+
+// CheckPaymentAmount verifies that amountCents lies within
+// payment.min_amount_cents and payment.max_amount_cents. Content stored before
+// the limits were tightened can be priced outside them, and a session for it
+// would carry a QR code that cannot or may not be paid.
+func CheckPaymentAmount(cfg config.PaymentConfig, amountCents int) error {
+	if amountCents < cfg.MinAmountCents || amountCents > cfg.MaxAmountCents {
+		return fmt.Errorf("%w: %d cents is outside %d to %d cents", ErrAmountOutOfRange, amountCents, cfg.MinAmountCents, cfg.MaxAmountCents)
+	}
+	return nil
+}
+
+// DefaultReferencePrefix namespaces payment references of merchants without a
+// valid "reference_prefix" setting
+const DefaultReferencePrefix = "PAY"
+
+// maxReferencePrefixLength keeps prefixed references well within the 35
+// characters a SEPA remittance reference allows
+const maxReferencePrefixLength = 10
+
+// ReferencePrefix returns the reference namespace for a merchant's
+// "reference_prefix" setting: 1 to 10 upper-case letters or digits, falling back
+// to DefaultReferencePrefix. References are unique per merchant; reconciliation
+// tells merchants with equal prefixes apart by the creditor IBAN.
+func ReferencePrefix(setting string) string {
+	if setting == "" || len(setting) > maxReferencePrefixLength {
+		return DefaultReferencePrefix
+	}
+	for _, r := range setting {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return DefaultReferencePrefix
+		}
+	}
+	return setting
+}
+
 // GetPaymentSession retrieves a payment session by ID
 func (s *PaymentService) GetPaymentSession(sessionID uuid.UUID) (*models.PaymentSession, error) {
 	var session models.PaymentSession
 	query := `
 		SELECT session_id, merchant_id, content_id, user_identifier, amount_cents,
+		       platform_fee_cents, vat_cents, net_cents,
 		       currency, payment_reference, qr_code_data, status, expires_at,
-		       created_at, paid_at, access_granted_at, access_expires_at
+		       created_at, paid_at, access_granted_at, access_expires_at, refunded_at, metadata,
+		       display_amount_cents, display_currency, exchange_rate, user_agent, host(ip_address),
+		       CASE WHEN status = $2 AND (SELECT content_type FROM content WHERE content_id = payment_sessions.content_id) = $3 THEN (
+		           SELECT MAX(a.expires_at) FROM content_access a
+		           WHERE a.content_id = payment_sessions.content_id AND a.is_active AND NOT a.is_free_trial
+		             AND a.user_identifier = COALESCE(NULLIF(payment_sessions.user_identifier, ''), payment_sessions.session_id::text)
+		       ) END
 		FROM payment_sessions 
 		WHERE session_id = $1`
 
-	err := s.db.QueryRow(query, sessionID).Scan(
+	err := s.db.QueryRow(query, sessionID, models.PaymentStatusPaid, models.ContentTypeSubscription).Scan(
 		&session.SessionID,
 		&session.MerchantID,
 		&session.ContentID,
 		&session.UserIdentifier,
 		&session.AmountCents,
+		&session.PlatformFeeCents,
+		&session.VATCents,
+		&session.NetCents,
 		&session.Currency,
 		&session.PaymentReference,
 		&session.QRCodeData,
@@ -123,6 +341,14 @@ func (s *PaymentService) GetPaymentSession(sessionID uuid.UUID) (*models.Payment
 		&session.PaidAt,
 		&session.AccessGrantedAt,
 		&session.AccessExpiresAt,
+		&session.RefundedAt,
+		&session.Metadata,
+		&session.DisplayAmountCents,
+		&session.DisplayCurrency,
+		&session.ExchangeRate,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.RenewsAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("payment session not found: %w", err)
@@ -131,28 +357,264 @@ func (s *PaymentService) GetPaymentSession(sessionID uuid.UUID) (*models.Payment
 	return &session, nil
 }
 
-// VerifyPayment simulates payment verification (in real implementation, this would check bank APIs)
-func (s *PaymentService) VerifyPayment(sessionID uuid.UUID) error {
+// accessExpiresAtSQL computes the access expiry of a session marked paid at $2
+// from its content's access duration. A duration of 0 grants permanent access,
+// stored as an expiry 100 years after the payment so access_expires_at and
+// content_access.expires_at stay plain timestamps.
+const accessExpiresAtSQL = `$2 + (
+		SELECT CASE access_duration_seconds WHEN 0 THEN INTERVAL '100 years'
+		       ELSE access_duration_seconds * INTERVAL '1 second' END
+		FROM content WHERE content_id = payment_sessions.content_id)`
+
+// VerifyPayment simulates payment verification (in real implementation, this would check bank APIs).
+// The session is marked paid for the content's access duration and its
+// content_access row is created in the same database transaction; if either
+// fails neither is kept. Verifying a paid session again is a no-op, any other
+// status gives ErrSessionNotPending.
+func (s *PaymentService) VerifyPayment(ctx context.Context, sessionID uuid.UUID) error {
 	// For demonstration purposes, we'll simulate a successful payment
 	// In a real implementation, this would check the bank's API for the payment
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin payment verification: %w", err)
+	}
+	defer dbTx.Rollback()
 
 	query := `
 		UPDATE payment_sessions 
-		SET status = $1, paid_at = $2, access_granted_at = $2, access_expires_at = $3
-		WHERE session_id = $4 AND status = $5`
-
-	accessExpiresAt := time.Now().Add(time.Hour) // Default 1 hour access
+		SET status = $1, paid_at = $2, access_granted_at = $2,
+		    access_expires_at = ` + accessExpiresAtSQL + `
+		WHERE session_id = $3 AND status = $4
+		RETURNING merchant_id, content_id, amount_cents, currency, payment_reference, access_expires_at,
+		          (SELECT price_cents FROM content WHERE content_id = payment_sessions.content_id)`
 
-	_, err := s.db.Exec(query,
+	paidAt := time.Now()
+	var merchantID, contentID uuid.UUID
+	var amountCents int
+	var currency, reference string
+	var accessExpiresAt time.Time
+	var currentPrice sql.NullInt64
+	err = dbTx.QueryRowContext(ctx, query,
 		models.PaymentStatusPaid,
-		time.Now(),
-		accessExpiresAt,
+		paidAt,
 		sessionID,
 		models.PaymentStatusPending,
-	)
+	).Scan(&merchantID, &contentID, &amountCents, &currency, &reference, &accessExpiresAt, &currentPrice)
+	if err == sql.ErrNoRows {
+		session, err := s.GetPaymentSession(sessionID)
+		if err != nil {
+			return ErrSessionNotFound
+		}
+		if session.Status != models.PaymentStatusPaid {
+			return fmt.Errorf("%w: session is %s", ErrSessionNotPending, session.Status)
+		}
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to verify payment: %w", err)
 	}
+	if renewed, ok, err := renewSubscription(ctx, dbTx, sessionID); err != nil {
+		return err
+	} else if ok {
+		accessExpiresAt = renewed
+	}
+	if err := grantSessionAccess(ctx, dbTx, sessionID); err != nil {
+		return err
+	}
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit payment verification: %w", err)
+	}
 
+	warnPriceChanged(s.logger, sessionID, contentID, amountCents, currentPrice)
+
+	s.bus.Publish(events.PaymentPaid{
+		SessionID:        sessionID,
+		MerchantID:       merchantID,
+		PaymentReference: reference,
+		AmountCents:      amountCents,
+		Currency:         currency,
+		PaidAt:           paidAt,
+		AccessExpiresAt:  accessExpiresAt,
+	})
+
+	return nil
+}
+
+// grantSessionAccess creates the content_access row of a session that was just
+// marked paid, for its user identifier (the session ID for anonymous sessions)
+// and access window. It must run in the transaction that marked it paid.
+func grantSessionAccess(ctx context.Context, db execer, sessionID uuid.UUID) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO content_access (session_id, merchant_id, content_id, user_identifier, granted_at, expires_at)
+		SELECT session_id, merchant_id, content_id, COALESCE(NULLIF(user_identifier, ''), session_id::text),
+		       access_granted_at, access_expires_at
+		FROM payment_sessions
+		WHERE session_id = $1
+		ON CONFLICT (session_id) WHERE session_id IS NOT NULL DO NOTHING`,
+		sessionID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to grant content access: %w", err)
+	}
 	return nil
 }
+
+// warnPriceChanged logs when a session was paid at a locked amount that no
+// longer matches the content price, so merchants can spot price edits that
+// raced with open checkouts. The payment itself is still valid.
+func warnPriceChanged(logger *zap.Logger, sessionID, contentID uuid.UUID, amountCents int, currentPrice sql.NullInt64) {
+	if !currentPrice.Valid || int(currentPrice.Int64) == amountCents {
+		return
+	}
+	logger.Warn("Session paid at a price that differs from the current content price",
+		zap.String("session_id", sessionID.String()),
+		zap.String("content_id", contentID.String()),
+		zap.Int("amount_cents", amountCents),
+		zap.Int64("current_price_cents", currentPrice.Int64),
+	)
+}
+
+// sessionTimeout returns how long sessions of a merchant with settings stay
+// open, see models.Merchant.SessionTimeout
+func (s *PaymentService) sessionTimeout(settings models.JSONMap) time.Duration {
+	if timeout, ok := models.SessionTimeoutOverride(settings, s.config.Payment.MaxSessionLifetime); ok {
+		return timeout
+	}
+	return s.config.Payment.SessionTimeout
+}
+
+// ExtendSession pushes the expiry of a pending session forward by the session
+// timeout of its merchant while the user is still on the checkout page. The
+// payment reference is left untouched so an in-flight transfer still matches,
+// and the total lifetime never exceeds cfg.Payment.MaxSessionLifetime.
+func (s *PaymentService) ExtendSession(sessionID uuid.UUID) (*time.Time, error) {
+	var settings models.JSONMap
+	err := s.db.QueryRow(`
+		SELECT m.settings
+		FROM payment_sessions ps
+		JOIN merchants m ON m.merchant_id = ps.merchant_id
+		WHERE ps.session_id = $1`,
+		sessionID,
+	).Scan(&settings)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to extend payment session: %w", err)
+	}
+
+	query := `
+		UPDATE payment_sessions
+		SET expires_at = GREATEST(expires_at, LEAST($1, created_at + $2 * INTERVAL '1 second'))
+		WHERE session_id = $3 AND status = $4 AND expires_at > $5
+		RETURNING expires_at`
+
+	now := time.Now()
+	var expiresAt time.Time
+	err = s.db.QueryRow(query,
+		now.Add(s.sessionTimeout(settings)),
+		s.config.Payment.MaxSessionLifetime.Seconds(),
+		sessionID,
+		models.PaymentStatusPending,
+		now,
+	).Scan(&expiresAt)
+	if err == sql.ErrNoRows {
+		session, err := s.GetPaymentSession(sessionID)
+		if err != nil {
+			return nil, ErrSessionNotFound
+		}
+		if session.Status != models.PaymentStatusPending && session.Status != models.PaymentStatusExpired {
+			return nil, ErrSessionNotPending
+		}
+		return nil, ErrSessionExpired
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to extend payment session: %w", err)
+	}
+
+	return &expiresAt, nil
+}
+
+// CancelPayment marks a pending session cancelled when the customer abandons
+// the checkout, recording "cancelled_at" in its metadata. Transfers arriving
+// for it later are no longer matched. A session that is no longer pending, or
+// whose time is up, gives ErrSessionNotPending.
+func (s *PaymentService) CancelPayment(ctx context.Context, sessionID uuid.UUID) (*models.PaymentSession, error) {
+	query := `
+		UPDATE payment_sessions
+		SET status = $1,
+		    metadata = COALESCE(metadata, '{}'::jsonb) || jsonb_build_object('cancelled_at', $2::timestamptz)
+		WHERE session_id = $3 AND status = $4 AND expires_at > $2
+		RETURNING merchant_id, content_id, amount_cents, currency, payment_reference`
+
+	now := time.Now()
+	session := models.PaymentSession{SessionID: sessionID, Status: models.PaymentStatusCancelled}
+	err := s.db.QueryRowContext(ctx, query,
+		models.PaymentStatusCancelled,
+		now,
+		sessionID,
+		models.PaymentStatusPending,
+	).Scan(
+		&session.MerchantID,
+		&session.ContentID,
+		&session.AmountCents,
+		&session.Currency,
+		&session.PaymentReference,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := s.GetPaymentSession(sessionID); err != nil {
+			return nil, ErrSessionNotFound
+		}
+		return nil, ErrSessionNotPending
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel payment session: %w", err)
+	}
+
+	s.bus.Publish(events.PaymentCancelled{
+		SessionID:        sessionID,
+		MerchantID:       session.MerchantID,
+		PaymentReference: session.PaymentReference,
+		CancelledAt:      now,
+	})
+
+	return &session, nil
+}
+
+// ExpireStaleSessions marks pending sessions whose expires_at has passed as
+// expired and returns how many were changed
+func (s *PaymentService) ExpireStaleSessions(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE payment_sessions SET status = $1 WHERE status = $2 AND expires_at < NOW()`,
+		models.PaymentStatusExpired,
+		models.PaymentStatusPending,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire sessions: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire sessions: %w", err)
+	}
+	return n, nil
+}
+
+// RunSessionExpiry expires stale sessions every cfg.Payment.ExpiryInterval
+// until ctx is cancelled
+func (s *PaymentService) RunSessionExpiry(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Payment.ExpiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.ExpireStaleSessions(ctx)
+			if err != nil {
+				s.logger.Warn("Failed to expire stale sessions", zap.Error(err))
+				continue
+			}
+			s.logger.Info("Expired stale payment sessions", zap.Int64("expired", n))
+		}
+	}
+}
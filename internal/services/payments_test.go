@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/events"
+	"go.uber.org/zap"
+)
+
+func TestCheckPaymentAmount(t *testing.T) {
+	limits := config.PaymentConfig{MinAmountCents: 1, MaxAmountCents: 99999999}
+	tests := []struct {
+		name        string
+		amountCents int
+		want        error
+	}{
+		{"minimum", 1, nil},
+		{"typical", 250, nil},
+		{"maximum", 99999999, nil},
+		{"free", 0, ErrAmountOutOfRange},
+		{"negative", -100, ErrAmountOutOfRange},
+		{"above maximum", 100000000, ErrAmountOutOfRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckPaymentAmount(limits, tt.amountCents); !errors.Is(err, tt.want) {
+				t.Errorf("CheckPaymentAmount(%d) error = %v, want %v", tt.amountCents, err, tt.want)
+			}
+		})
+	}
+}
+
+// sessionTables is a database/sql connector serving the merchant and content
+// rows CreatePaymentSession reads, and recording the sessions it inserts
+type sessionTables struct {
+	mu       sync.Mutex
+	inserted [][]driver.Value
+}
+
+func (t *sessionTables) Connect(context.Context) (driver.Conn, error) { return sessionConn{t}, nil }
+func (t *sessionTables) Driver() driver.Driver                        { return nil }
+
+type sessionConn struct{ tables *sessionTables }
+
+func (c sessionConn) Prepare(query string) (driver.Stmt, error) {
+	return sessionStmt{tables: c.tables, query: query}, nil
+}
+func (sessionConn) Close() error              { return nil }
+func (sessionConn) Begin() (driver.Tx, error) { return nil, errors.New("transactions not supported") }
+
+type sessionStmt struct {
+	tables *sessionTables
+	query  string
+}
+
+func (sessionStmt) Close() error  { return nil }
+func (sessionStmt) NumInput() int { return -1 }
+
+func (s sessionStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if !strings.Contains(s.query, "INSERT INTO payment_sessions") {
+		return nil, fmt.Errorf("unexpected exec %q", s.query)
+	}
+	s.tables.mu.Lock()
+	defer s.tables.mu.Unlock()
+	s.tables.inserted = append(s.tables.inserted, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (s sessionStmt) Query(args []driver.Value) (driver.Rows, error) {
+	switch {
+	case strings.Contains(s.query, "FROM content"):
+		created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		return &sessionRows{values: []driver.Value{
+			[]byte(testContentID.String()), []byte(testMerchantID.String()), "/news/article", "Article", nil,
+			int64(250), "EUR", int64(86400), "article", []byte("{}"), true,
+			created, created,
+		}}, nil
+	case strings.Contains(s.query, "bank_account_iban"):
+		return &sessionRows{values: []driver.Value{
+			"Example Shop", "NL91ABNA0417164300", "ABNANL2A", "free",
+			"SHOP", []byte(`{"reference_prefix": "SHOP"}`),
+		}}, nil
+	case strings.Contains(s.query, "SELECT pricing_tier"):
+		return &sessionRows{values: []driver.Value{"free"}}, nil
+	case strings.HasPrefix(s.query, "SELECT COUNT(*)"):
+		return &sessionRows{values: []driver.Value{int64(0)}}, nil
+	}
+	return nil, fmt.Errorf("unexpected query %q", s.query)
+}
+
+// sessionRows is a single row of values
+type sessionRows struct {
+	values []driver.Value
+	done   bool
+}
+
+func (r *sessionRows) Columns() []string { return make([]string, len(r.values)) }
+func (*sessionRows) Close() error        { return nil }
+func (r *sessionRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.values)
+	return nil
+}
+
+var (
+	testMerchantID = uuid.MustParse("00000000-0000-4000-8000-00000000000a")
+	testContentID  = uuid.MustParse("00000000-0000-4000-8000-00000000000c")
+)
+
+func TestCreatePaymentSession(t *testing.T) {
+	tables := &sessionTables{}
+	db := sql.OpenDB(tables)
+	defer db.Close()
+	cfg := &config.Config{Payment: config.PaymentConfig{
+		MinAmountCents: 1,
+		MaxAmountCents: 99999999,
+		SessionTimeout: 15 * time.Minute,
+	}}
+	service := NewPaymentService(db, cfg, events.NewBus(zap.NewNop()), zap.NewNop())
+	service.SetGenerators(&SequentialIDGenerator{}, &SequentialReferenceGenerator{})
+	now := time.Date(2024, 3, 12, 9, 30, 0, 0, time.UTC)
+	service.SetClock(func() time.Time { return now })
+
+	tests := []struct {
+		wantSessionID string
+		wantReference string
+	}{
+		{"00000000-0000-0000-0000-000000000001", "SHOP-1"},
+		{"00000000-0000-0000-0000-000000000002", "SHOP-2"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.wantReference, func(t *testing.T) {
+			session, err := service.CreatePaymentSession(testMerchantID, testContentID, "user-1", "test-agent", "192.0.2.1")
+			if err != nil {
+				t.Fatalf("CreatePaymentSession() error = %v", err)
+			}
+			if got := session.SessionID.String(); got != tt.wantSessionID {
+				t.Errorf("SessionID = %s, want %s", got, tt.wantSessionID)
+			}
+			if session.PaymentReference != tt.wantReference {
+				t.Errorf("PaymentReference = %s, want %s", session.PaymentReference, tt.wantReference)
+			}
+			if !session.CreatedAt.Equal(now) {
+				t.Errorf("CreatedAt = %v, want %v", session.CreatedAt, now)
+			}
+			if want := now.Add(15 * time.Minute); !session.ExpiresAt.Equal(want) {
+				t.Errorf("ExpiresAt = %v, want %v", session.ExpiresAt, want)
+			}
+			if !strings.Contains(session.QRCodeData, tt.wantReference) {
+				t.Errorf("QRCodeData %q does not carry reference %s", session.QRCodeData, tt.wantReference)
+			}
+
+			tables.mu.Lock()
+			defer tables.mu.Unlock()
+			if len(tables.inserted) != i+1 {
+				t.Fatalf("inserted %d sessions, want %d", len(tables.inserted), i+1)
+			}
+			row := tables.inserted[i]
+			if row[0] != tt.wantSessionID || row[9] != tt.wantReference || row[13] != now {
+				t.Errorf("inserted session_id %v, payment_reference %v, created_at %v, want %s, %s, %v",
+					row[0], row[9], row[13], tt.wantSessionID, tt.wantReference, now)
+			}
+		})
+	}
+}
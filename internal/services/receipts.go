@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// SessionAccessActive reports whether access bought with a session still
+// holds: the session is paid, its access window is open and no dispute has
+// suspended it. Access receipts are checked against this so a receipt stops
+// working as soon as its payment is disputed or refunded.
+func (s *ContentService) SessionAccessActive(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	query := `
+		SELECT COALESCE(s.status = $2 AND s.access_expires_at > NOW(), false)
+		       AND NOT EXISTS (
+		           SELECT 1 FROM content_access a
+		           WHERE a.session_id = s.session_id AND NOT a.is_active
+		       )
+		FROM payment_sessions s
+		WHERE s.session_id = $1`
+
+	var active bool
+	err := s.db.QueryRowContext(ctx, query, sessionID, models.PaymentStatusPaid).Scan(&active)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check session access: %w", err)
+	}
+	return active, nil
+}
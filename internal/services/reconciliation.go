@@ -0,0 +1,673 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"github.com/mh74hf/micro-payments/internal/money"
+	"go.uber.org/zap"
+)
+
+// Reasons a transaction could not be matched to a session
+const (
+	UnmatchedReasonNoReference    = "no_reference"
+	UnmatchedReasonNoSession      = "no_session"
+	UnmatchedReasonAmountMismatch = "amount_mismatch"
+	// The reference belongs to another merchant's session: references are only
+	// unique per merchant, so the creditor IBAN must match as well
+	UnmatchedReasonCreditorMismatch = "creditor_mismatch"
+	// The transaction is dated outside the time the session could be paid in
+	UnmatchedReasonOutsideWindow = "outside_window"
+)
+
+// ReconciliationService matches detected bank transactions to pending payment sessions
+type ReconciliationService struct {
+	db     *sql.DB
+	config *config.Config
+	logger *zap.Logger
+}
+
+// NewReconciliationService creates a new reconciliation service
+func NewReconciliationService(db *sql.DB, cfg *config.Config, logger *zap.Logger) *ReconciliationService {
+	return &ReconciliationService{
+		db:     db,
+		config: cfg,
+		logger: logger,
+	}
+}
+
+// ProposedMatch pairs a transaction with the session it settles
+type ProposedMatch struct {
+	TransactionID    uuid.UUID `json:"transaction_id"`
+	SessionID        uuid.UUID `json:"session_id"`
+	MerchantID       uuid.UUID `json:"merchant_id"`
+	PaymentReference string    `json:"payment_reference"`
+	AmountCents      int       `json:"amount_cents"`
+	// PaidCents is the transaction amount, which may differ from AmountCents
+	// within the amount tolerance, or by any amount above it
+	PaidCents int `json:"paid_cents"`
+	// Overpaid is set when the transaction exceeds the session amount by more
+	// than the tolerance
+	Overpaid bool `json:"overpaid,omitempty"`
+	// AfterExpiry is set when the session had already expired; outside a
+	// backfill that means it is settled within the expiry grace period
+	AfterExpiry bool `json:"after_expiry,omitempty"`
+}
+
+// Ambiguity is a session that more than one transaction could settle
+type Ambiguity struct {
+	SessionID        uuid.UUID   `json:"session_id"`
+	PaymentReference string      `json:"payment_reference"`
+	TransactionIDs   []uuid.UUID `json:"transaction_ids"`
+}
+
+// DisputedTransaction is a transaction that more than one session could be
+// settled by. Rather than guessing, it is marked disputed for an operator.
+type DisputedTransaction struct {
+	TransactionID    uuid.UUID   `json:"transaction_id"`
+	PaymentReference *string     `json:"payment_reference,omitempty"`
+	AmountCents      int         `json:"amount_cents"`
+	SessionIDs       []uuid.UUID `json:"session_ids"`
+}
+
+// UnmatchedTransaction is a transaction no session could be found for
+type UnmatchedTransaction struct {
+	TransactionID    uuid.UUID `json:"transaction_id"`
+	PaymentReference *string   `json:"payment_reference,omitempty"`
+	AmountCents      int       `json:"amount_cents"`
+	Reason           string    `json:"reason"`
+}
+
+// ReconciliationReport describes the outcome of a matching run
+type ReconciliationReport struct {
+	DryRun                bool                   `json:"dry_run"`
+	Matches               []ProposedMatch        `json:"matches"`
+	Ambiguities           []Ambiguity            `json:"ambiguities"`
+	Disputed              []DisputedTransaction  `json:"disputed_transactions"`
+	UnmatchedTransactions []UnmatchedTransaction `json:"unmatched_transactions"`
+	UnmatchedSessions     []uuid.UUID            `json:"unmatched_sessions"`
+
+	// Audits explains the decision for every transaction, keyed by transaction ID
+	Audits map[uuid.UUID]*MatchAudit `json:"-"`
+}
+
+// Matching decisions recorded in a MatchAudit
+const (
+	MatchDecisionMatched   = "matched"
+	MatchDecisionAmbiguous = "ambiguous"
+	MatchDecisionDisputed  = "disputed"
+	MatchDecisionUnmatched = "unmatched"
+)
+
+// Rules that pair a transaction with a session of the same amount and currency,
+// paid into the account of the session's merchant. References are compared
+// normalized, see normalizeReference.
+const (
+	// MatchRuleExactReference matches when the references are equal
+	MatchRuleExactReference = "exact_reference"
+	// MatchRuleFuzzyReference matches a transaction reference the bank cut
+	// short to the start of the session's reference, or one that carries the
+	// session's reference amid other remittance text
+	MatchRuleFuzzyReference = "fuzzy_reference"
+)
+
+// minFuzzyReferenceLength is the shortest normalized reference a fuzzy match
+// is made on, so a stray "MP" does not match every session
+const minFuzzyReferenceLength = 8
+
+// anyLateness lifts the bound on how long after a session expired a
+// transaction may be dated, see matchOptions
+const anyLateness time.Duration = -1
+
+// matchOptions are the configurable limits planMatches applies
+type matchOptions struct {
+	// maxLate is how long after a session expired a transaction may be dated,
+	// or anyLateness
+	maxLate time.Duration
+	// A transaction may fall short of the session amount by the larger of
+	// toleranceCents and toleranceBasisPoints of the amount, for bank fees and
+	// rounding. Paying more always matches.
+	toleranceCents       int
+	toleranceBasisPoints int
+}
+
+// newMatchOptions reads the matching limits from the payment configuration
+func newMatchOptions(cfg *config.Config) matchOptions {
+	return matchOptions{
+		maxLate:              cfg.Payment.ExpiryGracePeriod,
+		toleranceCents:       cfg.Payment.AmountToleranceCents,
+		toleranceBasisPoints: cfg.Payment.AmountToleranceBasisPoints,
+	}
+}
+
+// tolerance returns the allowed difference for a session amount
+func (o matchOptions) tolerance(amountCents int) int {
+	return max(o.toleranceCents, amountCents*o.toleranceBasisPoints/10000)
+}
+
+// maxAuditCandidates caps the candidates stored per transaction so the audit of
+// a transaction colliding with many sessions stays small
+const maxAuditCandidates = 5
+
+// MatchCandidate is a session that was considered for a transaction
+type MatchCandidate struct {
+	SessionID        uuid.UUID `json:"session_id"`
+	PaymentReference string    `json:"payment_reference"`
+	AmountDeltaCents int       `json:"amount_delta_cents"`
+	CurrencyMatches  bool      `json:"currency_matches"`
+}
+
+// MatchAudit records why a transaction was or was not matched. It is stored
+// with the transaction so operators can debug a mismatch after the fact.
+type MatchAudit struct {
+	Decision              string           `json:"decision"`
+	SessionID             *uuid.UUID       `json:"session_id,omitempty"` // the session matched
+	Rule                  string           `json:"rule,omitempty"`
+	Reason                string           `json:"reason,omitempty"`
+	Score                 float64          `json:"score"` // share of the longer reference that matched, 0 when unmatched
+	Candidates            []MatchCandidate `json:"candidates"`
+	OmittedCandidates     int              `json:"omitted_candidates,omitempty"`
+	CompetingTransactions []uuid.UUID      `json:"competing_transactions,omitempty"`
+	DecidedAt             time.Time        `json:"decided_at"`
+}
+
+// addCandidate appends a candidate unless the cap is reached, counting the overflow
+func (a *MatchAudit) addCandidate(c MatchCandidate) {
+	if len(a.Candidates) >= maxAuditCandidates {
+		a.OmittedCandidates++
+		return
+	}
+	a.Candidates = append(a.Candidates, c)
+}
+
+// DryRun runs the matching logic against current pending sessions and detected
+// transactions and reports what would happen, without writing anything
+func (s *ReconciliationService) DryRun(ctx context.Context) (*ReconciliationReport, error) {
+	transactions, err := s.detectedTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sessions, ibans, err := s.pendingSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := planMatches(transactions, sessions, ibans, newMatchOptions(s.config))
+	report.DryRun = true
+	return report, nil
+}
+
+// planMatches is the single source of truth for matching decisions. It is a pure
+// function so the dry run and the applying reconciliation run always agree.
+//
+// Payment references are unique per merchant only, so a transaction matches a
+// session when the references match, see MatchRuleExactReference and
+// MatchRuleFuzzyReference, and the transaction was credited to the IBAN of the
+// session's merchant, taken from merchantIBANs. The amount must be in the
+// session's currency and at least the session amount less the tolerance of
+// opts. It must also be dated within the session's validity window: not before
+// the session was created and not more than opts.maxLate after it expired. An
+// exact match wins over fuzzy ones; a transaction left with several sessions
+// is disputed.
+func planMatches(transactions []models.BankTransaction, sessions []models.PaymentSession, merchantIBANs map[uuid.UUID]string, opts matchOptions) *ReconciliationReport {
+	report := &ReconciliationReport{
+		Matches:               []ProposedMatch{},
+		Ambiguities:           []Ambiguity{},
+		Disputed:              []DisputedTransaction{},
+		UnmatchedTransactions: []UnmatchedTransaction{},
+		UnmatchedSessions:     []uuid.UUID{},
+		Audits:                make(map[uuid.UUID]*MatchAudit, len(transactions)),
+	}
+	now := time.Now()
+
+	sessionsByRef := make(map[string][]*models.PaymentSession, len(sessions))
+	sessionsByIBAN := make(map[string][]*models.PaymentSession)
+	sessionsByID := make(map[uuid.UUID]*models.PaymentSession, len(sessions))
+	for i := range sessions {
+		session := &sessions[i]
+		ref := normalizeReference(session.PaymentReference)
+		iban := money.NormalizeIBAN(merchantIBANs[session.MerchantID])
+		sessionsByRef[ref] = append(sessionsByRef[ref], session)
+		sessionsByIBAN[iban] = append(sessionsByIBAN[iban], session)
+		sessionsByID[session.SessionID] = session
+	}
+
+	// Group candidate transactions per session so duplicates surface as ambiguities
+	candidates := make(map[uuid.UUID][]*models.BankTransaction)
+	var order []uuid.UUID
+	for i := range transactions {
+		tx := &transactions[i]
+		audit := &MatchAudit{Decision: MatchDecisionUnmatched, Candidates: []MatchCandidate{}, DecidedAt: now}
+		report.Audits[tx.TransactionID] = audit
+
+		var ref string
+		if tx.PaymentReference != nil {
+			ref = normalizeReference(*tx.PaymentReference)
+		}
+		if ref == "" {
+			audit.Reason = UnmatchedReasonNoReference
+			report.UnmatchedTransactions = append(report.UnmatchedTransactions, unmatched(tx, UnmatchedReasonNoReference))
+			continue
+		}
+
+		// Sessions of the creditor's merchant whose reference matches, then
+		// those whose amount, currency and window match as well
+		var referenced, viable []referenceMatch
+		for _, session := range sessionsByIBAN[money.NormalizeIBAN(tx.CreditorIBAN)] {
+			if rule, score, ok := matchReference(ref, normalizeReference(session.PaymentReference)); ok {
+				referenced = append(referenced, referenceMatch{session: session, rule: rule, score: score})
+			}
+		}
+		if len(referenced) == 0 {
+			reason := UnmatchedReasonNoSession
+			for _, other := range sessionsByRef[ref] {
+				reason = UnmatchedReasonCreditorMismatch
+				audit.addCandidate(candidateFor(tx, other))
+			}
+			audit.Reason = reason
+			report.UnmatchedTransactions = append(report.UnmatchedTransactions, unmatched(tx, reason))
+			continue
+		}
+
+		reason := UnmatchedReasonAmountMismatch
+		for _, m := range referenced {
+			audit.addCandidate(candidateFor(tx, m.session))
+			if tx.Currency != m.session.Currency || tx.AmountCents < m.session.AmountCents-opts.tolerance(m.session.AmountCents) {
+				continue
+			}
+			if !withinWindow(tx, m.session, opts.maxLate) {
+				reason = UnmatchedReasonOutsideWindow
+				continue
+			}
+			viable = append(viable, m)
+		}
+		viable = preferExact(viable)
+
+		switch {
+		case len(viable) == 0:
+			audit.Reason = reason
+			report.UnmatchedTransactions = append(report.UnmatchedTransactions, unmatched(tx, reason))
+			continue
+		case len(viable) > 1:
+			disputed := DisputedTransaction{
+				TransactionID:    tx.TransactionID,
+				PaymentReference: tx.PaymentReference,
+				AmountCents:      tx.AmountCents,
+			}
+			for _, m := range viable {
+				disputed.SessionIDs = append(disputed.SessionIDs, m.session.SessionID)
+			}
+			audit.Decision = MatchDecisionDisputed
+			audit.Rule = viable[0].rule
+			report.Disputed = append(report.Disputed, disputed)
+			continue
+		}
+
+		session := viable[0].session
+		audit.Rule = viable[0].rule
+		audit.Score = viable[0].score
+		if _, seen := candidates[session.SessionID]; !seen {
+			order = append(order, session.SessionID)
+		}
+		candidates[session.SessionID] = append(candidates[session.SessionID], tx)
+	}
+
+	for _, sessionID := range order {
+		txs := candidates[sessionID]
+		session := sessionsByID[sessionID]
+
+		if len(txs) > 1 {
+			ambiguity := Ambiguity{
+				SessionID:        session.SessionID,
+				PaymentReference: session.PaymentReference,
+			}
+			for _, tx := range txs {
+				ambiguity.TransactionIDs = append(ambiguity.TransactionIDs, tx.TransactionID)
+			}
+			for _, tx := range txs {
+				audit := report.Audits[tx.TransactionID]
+				audit.Decision = MatchDecisionAmbiguous
+				audit.Score = 0
+				for _, other := range ambiguity.TransactionIDs {
+					if other != tx.TransactionID && len(audit.CompetingTransactions) < maxAuditCandidates {
+						audit.CompetingTransactions = append(audit.CompetingTransactions, other)
+					}
+				}
+			}
+			report.Ambiguities = append(report.Ambiguities, ambiguity)
+			continue
+		}
+
+		audit := report.Audits[txs[0].TransactionID]
+		audit.Decision = MatchDecisionMatched
+		audit.SessionID = &session.SessionID
+
+		report.Matches = append(report.Matches, ProposedMatch{
+			TransactionID:    txs[0].TransactionID,
+			SessionID:        session.SessionID,
+			MerchantID:       session.MerchantID,
+			PaymentReference: session.PaymentReference,
+			AmountCents:      session.AmountCents,
+			PaidCents:        txs[0].AmountCents,
+			Overpaid:         txs[0].AmountCents > session.AmountCents+opts.tolerance(session.AmountCents),
+			AfterExpiry:      session.Status == models.PaymentStatusExpired,
+		})
+	}
+
+	for _, session := range sessions {
+		if _, matched := candidates[session.SessionID]; !matched {
+			report.UnmatchedSessions = append(report.UnmatchedSessions, session.SessionID)
+		}
+	}
+
+	return report
+}
+
+// referenceMatch is a session whose reference matches a transaction's
+type referenceMatch struct {
+	session *models.PaymentSession
+	rule    string
+	score   float64
+}
+
+// preferExact drops the fuzzy matches when there is an exact one
+func preferExact(matches []referenceMatch) []referenceMatch {
+	var exact []referenceMatch
+	for _, m := range matches {
+		if m.rule == MatchRuleExactReference {
+			exact = append(exact, m)
+		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+	return matches
+}
+
+// normalizeReference upper-cases a payment reference and drops everything but
+// letters and digits, undoing the spaces, dashes and case changes banks and
+// customers apply to remittance information
+func normalizeReference(ref string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(ref) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// normalizedReferenceSQL is normalizeReference in SQL, for payment_reference
+const normalizedReferenceSQL = `regexp_replace(upper(payment_reference), '[^A-Z0-9]', '', 'g')`
+
+// matchReference compares a transaction's normalized reference with a
+// session's. Its score is the share of the longer reference that matched.
+func matchReference(txRef, sessionRef string) (rule string, score float64, ok bool) {
+	switch {
+	case sessionRef == "":
+		return "", 0, false
+	case txRef == sessionRef:
+		return MatchRuleExactReference, 1, true
+	case len(txRef) >= minFuzzyReferenceLength && strings.HasPrefix(sessionRef, txRef):
+		return MatchRuleFuzzyReference, float64(len(txRef)) / float64(len(sessionRef)), true
+	case len(sessionRef) >= minFuzzyReferenceLength && strings.Contains(txRef, sessionRef):
+		return MatchRuleFuzzyReference, float64(len(sessionRef)) / float64(len(txRef)), true
+	}
+	return "", 0, false
+}
+
+// withinWindow reports whether the transaction is dated while the session
+// could be paid, see planMatches. Banks date transfers by the day, often in
+// local time, so the window is widened to whole days with a day to spare.
+func withinWindow(tx *models.BankTransaction, session *models.PaymentSession, maxLate time.Duration) bool {
+	date := tx.TransactionDate
+	if date.IsZero() {
+		date = tx.BookingDate
+	}
+	from := session.CreatedAt.UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	if date.Before(from) {
+		return false
+	}
+	if maxLate == anyLateness {
+		return true
+	}
+	until := session.ExpiresAt.Add(maxLate).UTC().Truncate(24*time.Hour).AddDate(0, 0, 2)
+	return date.Before(until)
+}
+
+// candidateFor describes a session considered for a transaction
+func candidateFor(tx *models.BankTransaction, session *models.PaymentSession) MatchCandidate {
+	return MatchCandidate{
+		SessionID:        session.SessionID,
+		PaymentReference: session.PaymentReference,
+		AmountDeltaCents: tx.AmountCents - session.AmountCents,
+		CurrencyMatches:  tx.Currency == session.Currency,
+	}
+}
+
+func unmatched(tx *models.BankTransaction, reason string) UnmatchedTransaction {
+	return UnmatchedTransaction{
+		TransactionID:    tx.TransactionID,
+		PaymentReference: tx.PaymentReference,
+		AmountCents:      tx.AmountCents,
+		Reason:           reason,
+	}
+}
+
+func (s *ReconciliationService) detectedTransactions(ctx context.Context) ([]models.BankTransaction, error) {
+	query := `
+		SELECT` + transactionColumns + `
+		FROM bank_transactions
+		WHERE status = $1
+		ORDER BY booking_date, transaction_id
+		LIMIT $2`
+
+	rows, err := s.db.QueryContext(ctx, query, models.TransactionStatusDetected, s.config.Admin.MaxScanLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load detected transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []models.BankTransaction
+	for rows.Next() {
+		tx, err := scanBankTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		transactions = append(transactions, *tx)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load detected transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// pendingSessions loads the sessions a transaction can still settle: pending
+// ones, and expired ones whose expiry lies within cfg.Payment.ExpiryGracePeriod
+// so a transfer the bank reports late still gives the customer access.
+func (s *ReconciliationService) pendingSessions(ctx context.Context) ([]models.PaymentSession, map[uuid.UUID]string, error) {
+	query := `
+		SELECT ps.session_id, ps.merchant_id, ps.content_id, ps.amount_cents, ps.currency,
+		       ps.payment_reference, ps.status, ps.expires_at, ps.created_at, m.bank_account_iban
+		FROM payment_sessions ps
+		JOIN merchants m ON m.merchant_id = ps.merchant_id
+		WHERE ps.status = $1 OR (ps.status = $2 AND ps.expires_at > $3)
+		ORDER BY ps.created_at
+		LIMIT $4`
+
+	rows, err := s.db.QueryContext(ctx, query,
+		models.PaymentStatusPending,
+		models.PaymentStatusExpired,
+		time.Now().Add(-s.config.Payment.ExpiryGracePeriod),
+		s.config.Admin.MaxScanLimit,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load pending sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []models.PaymentSession
+	ibans := make(map[uuid.UUID]string)
+	for rows.Next() {
+		var session models.PaymentSession
+		var iban string
+		err := rows.Scan(
+			&session.SessionID,
+			&session.MerchantID,
+			&session.ContentID,
+			&session.AmountCents,
+			&session.Currency,
+			&session.PaymentReference,
+			&session.Status,
+			&session.ExpiresAt,
+			&session.CreatedAt,
+			&iban,
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan payment session: %w", err)
+		}
+		ibans[session.MerchantID] = iban
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to load pending sessions: %w", err)
+	}
+
+	return sessions, ibans, nil
+}
+
+// recordAmountDiscrepancy notes in the metadata of a matched session how much
+// the transaction differed from the session amount, if at all, as
+// "amount_discrepancy_cents" (paid minus due) and "paid_cents", plus
+// "overpaid" when the difference exceeds the tolerance
+func recordAmountDiscrepancy(ctx context.Context, db execer, match ProposedMatch) error {
+	if match.PaidCents == match.AmountCents {
+		return nil
+	}
+	_, err := db.ExecContext(ctx, `
+		UPDATE payment_sessions
+		SET metadata = COALESCE(metadata, '{}'::jsonb) || jsonb_build_object(
+			'amount_discrepancy_cents', $1::int, 'paid_cents', $2::int, 'overpaid', $3::boolean)
+		WHERE session_id = $4`,
+		match.PaidCents-match.AmountCents,
+		match.PaidCents,
+		match.Overpaid,
+		match.SessionID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record amount discrepancy: %w", err)
+	}
+	return nil
+}
+
+// applyReport carries out a matching plan: apply settles each proposed match,
+// transactions that match several sessions are marked disputed, and the audit
+// of every other transaction is saved. The bank sync and backfills differ only
+// in how they apply a match. It returns the number of matches applied.
+func applyReport(ctx context.Context, db execer, logger *zap.Logger, report *ReconciliationReport, apply func(ProposedMatch, *MatchAudit) error) (int, error) {
+	decided := make(map[uuid.UUID]bool, len(report.Matches)+len(report.Disputed))
+	for _, match := range report.Matches {
+		if err := apply(match, report.Audits[match.TransactionID]); err != nil {
+			return len(decided), err
+		}
+		decided[match.TransactionID] = true
+	}
+	applied := len(decided)
+
+	for _, d := range report.Disputed {
+		if err := markTransactionDisputed(ctx, db, d.TransactionID, report.Audits[d.TransactionID]); err != nil {
+			return applied, err
+		}
+		decided[d.TransactionID] = true
+		logger.Warn("Transaction matches several payment sessions, marked disputed",
+			zap.String("transaction_id", d.TransactionID.String()),
+			zap.Int("sessions", len(d.SessionIDs)),
+		)
+	}
+	for transactionID, audit := range report.Audits {
+		if decided[transactionID] {
+			continue
+		}
+		if err := saveMatchAudit(ctx, db, transactionID, audit); err != nil {
+			return applied, err
+		}
+	}
+	return applied, nil
+}
+
+// finishMatch completes a match in the database transaction that marked its
+// session paid: it renews the user's subscription, grants the session's
+// access, records any amount discrepancy and marks the bank transaction
+// matched with its audit. It returns the renewed access expiry, or false when
+// the session renews nothing, see renewSubscription.
+func finishMatch(ctx context.Context, dbTx *sql.Tx, match ProposedMatch, audit *MatchAudit) (time.Time, bool, error) {
+	renewed, ok, err := renewSubscription(ctx, dbTx, match.SessionID)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if err := grantSessionAccess(ctx, dbTx, match.SessionID); err != nil {
+		return time.Time{}, false, err
+	}
+	if err := recordAmountDiscrepancy(ctx, dbTx, match); err != nil {
+		return time.Time{}, false, err
+	}
+
+	_, err = dbTx.ExecContext(ctx,
+		`UPDATE bank_transactions SET status = $1, processed_at = NOW() WHERE transaction_id = $2 AND status = $3`,
+		models.TransactionStatusMatched,
+		match.TransactionID,
+		models.TransactionStatusDetected,
+	)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to mark transaction matched: %w", err)
+	}
+	if err := saveMatchAudit(ctx, dbTx, match.TransactionID, audit); err != nil {
+		return time.Time{}, false, err
+	}
+	return renewed, ok, nil
+}
+
+// markTransactionDisputed marks a detected transaction that matched several
+// sessions disputed and stores the audit naming them
+func markTransactionDisputed(ctx context.Context, db execer, transactionID uuid.UUID, audit *MatchAudit) error {
+	_, err := db.ExecContext(ctx,
+		`UPDATE bank_transactions SET status = $1, processed_at = NOW() WHERE transaction_id = $2 AND status = $3`,
+		models.TransactionStatusDisputed,
+		transactionID,
+		models.TransactionStatusDetected,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark transaction disputed: %w", err)
+	}
+	return saveMatchAudit(ctx, db, transactionID, audit)
+}
+
+// saveMatchAudit stores the matching decision on the transaction. A
+// transaction that stays unmatched is planned again on every bank sync; when
+// nothing but decided_at differs from the stored audit the row is left alone,
+// so it is not rewritten each tick and decided_at keeps the time the decision
+// was first made.
+func saveMatchAudit(ctx context.Context, db execer, transactionID uuid.UUID, audit *MatchAudit) error {
+	raw, err := json.Marshal(audit)
+	if err != nil {
+		return fmt.Errorf("failed to encode match audit: %w", err)
+	}
+	_, err = db.ExecContext(ctx, `
+		UPDATE bank_transactions SET match_audit = $1
+		WHERE transaction_id = $2
+		  AND (match_audit IS NULL OR match_audit - 'decided_at' <> $1::jsonb - 'decided_at')`,
+		raw, transactionID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save match audit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,443 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+var (
+	testMerchantA = uuid.MustParse("00000000-0000-4000-8000-00000000000a")
+	testMerchantB = uuid.MustParse("00000000-0000-4000-8000-00000000000b")
+	testIBANs     = map[uuid.UUID]string{
+		testMerchantA: "NL91ABNA0417164300",
+		testMerchantB: "DE89370400440532013000",
+	}
+	// testCreated is when test sessions are created; they expire 15 minutes later
+	testCreated = time.Date(2024, 3, 12, 10, 0, 0, 0, time.UTC)
+)
+
+// testSessionID names a test session so cases can refer to it
+func testSessionID(name string) uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(name))
+}
+
+// testSession is a pending EUR session of merchant A, changed by opts
+func testSession(name, ref string, amountCents int, opts ...func(*models.PaymentSession)) models.PaymentSession {
+	session := models.PaymentSession{
+		SessionID:        testSessionID(name),
+		MerchantID:       testMerchantA,
+		PaymentReference: ref,
+		AmountCents:      amountCents,
+		Currency:         "EUR",
+		Status:           models.PaymentStatusPending,
+		CreatedAt:        testCreated,
+		ExpiresAt:        testCreated.Add(15 * time.Minute),
+	}
+	for _, opt := range opts {
+		opt(&session)
+	}
+	return session
+}
+
+// testTransaction is a EUR transfer to merchant A on the day sessions are
+// created, changed by opts
+func testTransaction(ref string, amountCents int, opts ...func(*models.BankTransaction)) models.BankTransaction {
+	tx := models.BankTransaction{
+		TransactionID:    uuid.New(),
+		PaymentReference: &ref,
+		AmountCents:      amountCents,
+		Currency:         "EUR",
+		CreditorIBAN:     testIBANs[testMerchantA],
+		TransactionDate:  testCreated.Truncate(24 * time.Hour),
+	}
+	for _, opt := range opts {
+		opt(&tx)
+	}
+	return tx
+}
+
+func ofMerchantB(s *models.PaymentSession) { s.MerchantID = testMerchantB }
+
+func toMerchantB(tx *models.BankTransaction) { tx.CreditorIBAN = testIBANs[testMerchantB] }
+
+func datedDays(days int) func(*models.BankTransaction) {
+	return func(tx *models.BankTransaction) {
+		tx.TransactionDate = testCreated.Truncate(24*time.Hour).AddDate(0, 0, days)
+	}
+}
+
+func TestPlanMatches(t *testing.T) {
+	grace := matchOptions{maxLate: 15 * time.Minute}
+	tests := []struct {
+		name         string
+		sessions     []models.PaymentSession
+		transactions []models.BankTransaction
+		opts         matchOptions
+		// The decision on the first transaction
+		wantDecision    string
+		wantReason      string
+		wantRule        string
+		wantSession     string
+		wantOverpaid    bool
+		wantAfterExpiry bool
+	}{
+		{
+			name:         "exact reference",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 1000)},
+			opts:         grace,
+			wantDecision: MatchDecisionMatched, wantRule: MatchRuleExactReference, wantSession: "a",
+		},
+		{
+			name:         "reference typed with spaces and lower case",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("mp 1700 0000 01", 1000)},
+			opts:         grace,
+			wantDecision: MatchDecisionMatched, wantRule: MatchRuleExactReference, wantSession: "a",
+		},
+		{
+			name:         "no reference",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction(" - ", 1000)},
+			opts:         grace,
+			wantDecision: MatchDecisionUnmatched, wantReason: UnmatchedReasonNoReference,
+		},
+		{
+			name:         "unknown reference",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000002", 1000)},
+			opts:         grace,
+			wantDecision: MatchDecisionUnmatched, wantReason: UnmatchedReasonNoSession,
+		},
+		{
+			name:         "reference of another merchant",
+			sessions:     []models.PaymentSession{testSession("b", "MP-1700000001", 1000, ofMerchantB)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 1000)},
+			opts:         grace,
+			wantDecision: MatchDecisionUnmatched, wantReason: UnmatchedReasonCreditorMismatch,
+		},
+		{
+			name: "same reference at two merchants",
+			sessions: []models.PaymentSession{
+				testSession("a", "MP-1700000001", 1000),
+				testSession("b", "MP-1700000001", 1000, ofMerchantB),
+			},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 1000, toMerchantB)},
+			opts:         grace,
+			wantDecision: MatchDecisionMatched, wantRule: MatchRuleExactReference, wantSession: "b",
+		},
+		{
+			name:     "creditor IBAN with spaces",
+			sessions: []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 1000, func(tx *models.BankTransaction) {
+				tx.CreditorIBAN = "nl91 abna 0417 1643 00"
+			})},
+			opts:         grace,
+			wantDecision: MatchDecisionMatched, wantRule: MatchRuleExactReference, wantSession: "a",
+		},
+		{
+			name:     "other currency",
+			sessions: []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 1000, func(tx *models.BankTransaction) {
+				tx.Currency = "USD"
+			})},
+			opts:         grace,
+			wantDecision: MatchDecisionUnmatched, wantReason: UnmatchedReasonAmountMismatch,
+		},
+		{
+			name:         "short by a cent without tolerance",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 999)},
+			opts:         grace,
+			wantDecision: MatchDecisionUnmatched, wantReason: UnmatchedReasonAmountMismatch,
+		},
+		{
+			name:         "short within the cents tolerance",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 950)},
+			opts:         matchOptions{maxLate: 15 * time.Minute, toleranceCents: 50},
+			wantDecision: MatchDecisionMatched, wantRule: MatchRuleExactReference, wantSession: "a",
+		},
+		{
+			name:         "short beyond the cents tolerance",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 949)},
+			opts:         matchOptions{maxLate: 15 * time.Minute, toleranceCents: 50},
+			wantDecision: MatchDecisionUnmatched, wantReason: UnmatchedReasonAmountMismatch,
+		},
+		{
+			name:         "basis points allow more than the cents",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 100000)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 99500)},
+			opts:         matchOptions{maxLate: 15 * time.Minute, toleranceCents: 50, toleranceBasisPoints: 50},
+			wantDecision: MatchDecisionMatched, wantRule: MatchRuleExactReference, wantSession: "a",
+		},
+		{
+			name:         "cents allow more than the basis points",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 950)},
+			opts:         matchOptions{maxLate: 15 * time.Minute, toleranceCents: 50, toleranceBasisPoints: 50},
+			wantDecision: MatchDecisionMatched, wantRule: MatchRuleExactReference, wantSession: "a",
+		},
+		{
+			name:         "overpaid within the tolerance",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 1050)},
+			opts:         matchOptions{maxLate: 15 * time.Minute, toleranceCents: 50},
+			wantDecision: MatchDecisionMatched, wantRule: MatchRuleExactReference, wantSession: "a",
+		},
+		{
+			name:         "overpaid beyond the tolerance",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 1051)},
+			opts:         matchOptions{maxLate: 15 * time.Minute, toleranceCents: 50},
+			wantDecision: MatchDecisionMatched, wantRule: MatchRuleExactReference, wantSession: "a", wantOverpaid: true,
+		},
+		{
+			name:         "dated the day before the session",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 1000, datedDays(-1))},
+			opts:         grace,
+			wantDecision: MatchDecisionMatched, wantRule: MatchRuleExactReference, wantSession: "a",
+		},
+		{
+			name:         "dated two days before the session",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 1000, datedDays(-2))},
+			opts:         grace,
+			wantDecision: MatchDecisionUnmatched, wantReason: UnmatchedReasonOutsideWindow,
+		},
+		{
+			name: "expired session paid within the grace period",
+			sessions: []models.PaymentSession{testSession("a", "MP-1700000001", 1000, func(s *models.PaymentSession) {
+				s.Status = models.PaymentStatusExpired
+			})},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 1000, datedDays(1))},
+			opts:         grace,
+			wantDecision: MatchDecisionMatched, wantRule: MatchRuleExactReference, wantSession: "a", wantAfterExpiry: true,
+		},
+		{
+			name:         "dated after the grace period",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 1000, datedDays(2))},
+			opts:         grace,
+			wantDecision: MatchDecisionUnmatched, wantReason: UnmatchedReasonOutsideWindow,
+		},
+		{
+			name:         "long grace period",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 1000, datedDays(4))},
+			opts:         matchOptions{maxLate: 72 * time.Hour},
+			wantDecision: MatchDecisionMatched, wantRule: MatchRuleExactReference, wantSession: "a",
+		},
+		{
+			name:         "any lateness for backfills",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 1000, datedDays(90))},
+			opts:         matchOptions{maxLate: anyLateness},
+			wantDecision: MatchDecisionMatched, wantRule: MatchRuleExactReference, wantSession: "a",
+		},
+		{
+			name:     "booking date when the transaction date is missing",
+			sessions: []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 1000, func(tx *models.BankTransaction) {
+				tx.BookingDate = tx.TransactionDate.AddDate(0, 0, 5)
+				tx.TransactionDate = time.Time{}
+			})},
+			opts:         grace,
+			wantDecision: MatchDecisionUnmatched, wantReason: UnmatchedReasonOutsideWindow,
+		},
+		{
+			name:         "reference cut short by the bank",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-17000000", 1000)},
+			opts:         grace,
+			wantDecision: MatchDecisionMatched, wantRule: MatchRuleFuzzyReference, wantSession: "a",
+		},
+		{
+			name:         "reference amid other remittance text",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("Order 42 MP-1700000001 thanks", 1000)},
+			opts:         grace,
+			wantDecision: MatchDecisionMatched, wantRule: MatchRuleFuzzyReference, wantSession: "a",
+		},
+		{
+			name:         "cut too short to match",
+			sessions:     []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{testTransaction("MP-17000", 1000)},
+			opts:         grace,
+			wantDecision: MatchDecisionUnmatched, wantReason: UnmatchedReasonNoSession,
+		},
+		{
+			name: "exact reference preferred over a truncated one",
+			sessions: []models.PaymentSession{
+				testSession("a", "MP-17000000", 1000),
+				testSession("a2", "MP-1700000001", 1000),
+			},
+			transactions: []models.BankTransaction{testTransaction("MP-17000000", 1000)},
+			opts:         grace,
+			wantDecision: MatchDecisionMatched, wantRule: MatchRuleExactReference, wantSession: "a",
+		},
+		{
+			name: "truncated reference fitting two sessions",
+			sessions: []models.PaymentSession{
+				testSession("a", "MP-1700000001", 1000),
+				testSession("a2", "MP-1700000002", 1000),
+			},
+			transactions: []models.BankTransaction{testTransaction("MP-170000000", 1000)},
+			opts:         grace,
+			wantDecision: MatchDecisionDisputed, wantRule: MatchRuleFuzzyReference,
+		},
+		{
+			name: "truncated reference fitting one session by amount",
+			sessions: []models.PaymentSession{
+				testSession("a", "MP-1700000001", 1000),
+				testSession("a2", "MP-1700000002", 2000),
+			},
+			transactions: []models.BankTransaction{testTransaction("MP-170000000", 1000)},
+			opts:         grace,
+			wantDecision: MatchDecisionMatched, wantRule: MatchRuleFuzzyReference, wantSession: "a",
+		},
+		{
+			name: "two sessions with the reference",
+			sessions: []models.PaymentSession{
+				testSession("a", "MP-1700000001", 1000),
+				testSession("a2", "MP-1700000001", 1000),
+			},
+			transactions: []models.BankTransaction{testTransaction("MP-1700000001", 1000)},
+			opts:         grace,
+			wantDecision: MatchDecisionDisputed, wantRule: MatchRuleExactReference,
+		},
+		{
+			name:     "two transactions for a session",
+			sessions: []models.PaymentSession{testSession("a", "MP-1700000001", 1000)},
+			transactions: []models.BankTransaction{
+				testTransaction("MP-1700000001", 1000),
+				testTransaction("MP 1700000001", 1000),
+			},
+			opts:         grace,
+			wantDecision: MatchDecisionAmbiguous, wantRule: MatchRuleExactReference,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := planMatches(tt.transactions, tt.sessions, testIBANs, tt.opts)
+
+			tx := tt.transactions[0]
+			audit := report.Audits[tx.TransactionID]
+			if audit == nil {
+				t.Fatalf("no audit for the transaction")
+			}
+			if audit.Decision != tt.wantDecision || audit.Reason != tt.wantReason || audit.Rule != tt.wantRule {
+				t.Errorf("decision, reason, rule = %q, %q, %q, want %q, %q, %q",
+					audit.Decision, audit.Reason, audit.Rule, tt.wantDecision, tt.wantReason, tt.wantRule)
+			}
+
+			var match *ProposedMatch
+			for i := range report.Matches {
+				if report.Matches[i].TransactionID == tx.TransactionID {
+					match = &report.Matches[i]
+				}
+			}
+			if tt.wantSession == "" {
+				if match != nil {
+					t.Errorf("matched session %s, want no match", match.SessionID)
+				}
+				return
+			}
+			if match == nil {
+				t.Fatalf("no match, want session %q", tt.wantSession)
+			}
+			if match.SessionID != testSessionID(tt.wantSession) || audit.SessionID == nil || *audit.SessionID != match.SessionID {
+				t.Errorf("matched session %s, want %q", match.SessionID, tt.wantSession)
+			}
+			if match.PaidCents != tx.AmountCents || match.Overpaid != tt.wantOverpaid || match.AfterExpiry != tt.wantAfterExpiry {
+				t.Errorf("paid, overpaid, after expiry = %d, %v, %v, want %d, %v, %v",
+					match.PaidCents, match.Overpaid, match.AfterExpiry, tx.AmountCents, tt.wantOverpaid, tt.wantAfterExpiry)
+			}
+			if len(report.UnmatchedSessions) != len(tt.sessions)-1 {
+				t.Errorf("unmatched sessions %v, want all but the match", report.UnmatchedSessions)
+			}
+		})
+	}
+}
+
+func TestNormalizeReference(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"MP-1700000001", "MP1700000001"},
+		{"mp 1700 0000 01", "MP1700000001"},
+		{"  MP/1700.0000_01  ", "MP1700000001"},
+		{"Zahlung: MP-1700000001!", "ZAHLUNGMP1700000001"},
+		{"ÄÖÜ-42", "42"},
+		{"---", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			if got := normalizeReference(tt.ref); got != tt.want {
+				t.Errorf("normalizeReference(%q) = %q, want %q", tt.ref, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchReference(t *testing.T) {
+	tests := []struct {
+		name       string
+		txRef      string
+		sessionRef string
+		wantRule   string
+		wantScore  float64
+		wantOK     bool
+	}{
+		{"exact", "MP1700000001", "MP1700000001", MatchRuleExactReference, 1, true},
+		{"truncated", "MP170000", "MP1700000001", MatchRuleFuzzyReference, 8.0 / 12, true},
+		{"truncated below the minimum", "MP17000", "MP1700000001", "", 0, false},
+		{"embedded", "ORDER42MP1700000001", "MP1700000001", MatchRuleFuzzyReference, 12.0 / 19, true},
+		{"embedded short session reference", "ORDER42MP17000", "MP17000", "", 0, false},
+		{"truncated in the middle", "MP1700001", "MP1700000001", "", 0, false},
+		{"longer than the session reference", "MP17000000012", "MP1700000001", MatchRuleFuzzyReference, 12.0 / 13, true},
+		{"different", "MP1700000002", "MP1700000001", "", 0, false},
+		{"session without reference", "MP1700000001", "", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, score, ok := matchReference(tt.txRef, tt.sessionRef)
+			if rule != tt.wantRule || score != tt.wantScore || ok != tt.wantOK {
+				t.Errorf("matchReference(%q, %q) = %q, %g, %v, want %q, %g, %v",
+					tt.txRef, tt.sessionRef, rule, score, ok, tt.wantRule, tt.wantScore, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestPlanMatchesCapsAuditCandidates(t *testing.T) {
+	var sessions []models.PaymentSession
+	for i := 0; i < maxAuditCandidates+3; i++ {
+		name := fmt.Sprintf("s%d", i)
+		sessions = append(sessions, testSession(name, fmt.Sprintf("MP-17000000%02d", i), 5000))
+	}
+	tx := testTransaction("MP-17000000", 1000)
+
+	report := planMatches([]models.BankTransaction{tx}, sessions, testIBANs, matchOptions{maxLate: 15 * time.Minute})
+
+	audit := report.Audits[tx.TransactionID]
+	if audit.Decision != MatchDecisionUnmatched || audit.Reason != UnmatchedReasonAmountMismatch {
+		t.Errorf("decision, reason = %q, %q, want %q, %q", audit.Decision, audit.Reason, MatchDecisionUnmatched, UnmatchedReasonAmountMismatch)
+	}
+	if len(audit.Candidates) != maxAuditCandidates || audit.OmittedCandidates != 3 {
+		t.Errorf("%d candidates, %d omitted, want %d and 3", len(audit.Candidates), audit.OmittedCandidates, maxAuditCandidates)
+	}
+	for _, c := range audit.Candidates {
+		if c.AmountDeltaCents != -4000 || !c.CurrencyMatches {
+			t.Errorf("candidate %+v, want an amount delta of -4000 in the same currency", c)
+		}
+	}
+}
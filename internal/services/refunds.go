@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/events"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+// ErrSessionNotRefundable is returned when refunding a session that is not paid
+var ErrSessionNotRefundable = errors.New("payment session is not paid")
+
+// RefundPayment marks a paid session refunded and revokes the access it
+// granted, so receipts and access tokens issued for it stop working at once.
+// The reason, if any, is stored as "refund_reason" in the session metadata.
+// Sending the money back is up to the merchant; this only records it.
+func (s *PaymentService) RefundPayment(ctx context.Context, sessionID uuid.UUID, reason string) (*models.PaymentSession, error) {
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin refund: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	refundedAt := time.Now()
+	session := models.PaymentSession{SessionID: sessionID, Status: models.PaymentStatusRefunded, RefundedAt: &refundedAt}
+	err = dbTx.QueryRowContext(ctx, `
+		UPDATE payment_sessions
+		SET status = $1, refunded_at = $2,
+		    metadata = COALESCE(metadata, '{}'::jsonb) || jsonb_strip_nulls(jsonb_build_object('refund_reason', NULLIF($3::text, '')))
+		WHERE session_id = $4 AND status = $5
+		RETURNING merchant_id, content_id, amount_cents, currency, payment_reference,
+		          paid_at, access_expires_at`,
+		models.PaymentStatusRefunded,
+		refundedAt,
+		reason,
+		sessionID,
+		models.PaymentStatusPaid,
+	).Scan(
+		&session.MerchantID,
+		&session.ContentID,
+		&session.AmountCents,
+		&session.Currency,
+		&session.PaymentReference,
+		&session.PaidAt,
+		&session.AccessExpiresAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		var exists bool
+		if err := dbTx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM payment_sessions WHERE session_id = $1)`, sessionID).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("failed to load payment session: %w", err)
+		}
+		if !exists {
+			return nil, ErrSessionNotFound
+		}
+		return nil, ErrSessionNotRefundable
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to refund payment: %w", err)
+	}
+
+	result, err := dbTx.ExecContext(ctx,
+		`UPDATE content_access SET is_active = false WHERE session_id = $1 AND is_active`,
+		sessionID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke content access: %w", err)
+	}
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke content access: %w", err)
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit refund: %w", err)
+	}
+
+	s.logger.Info("Refunded payment",
+		zap.String("session_id", sessionID.String()),
+		zap.Int("amount_cents", session.AmountCents),
+		zap.Int64("revoked_accesses", revoked),
+	)
+	s.bus.Publish(events.PaymentRefunded{
+		SessionID:        sessionID,
+		MerchantID:       session.MerchantID,
+		PaymentReference: session.PaymentReference,
+		AmountCents:      session.AmountCents,
+		Currency:         session.Currency,
+		Reason:           reason,
+		RefundedAt:       refundedAt,
+	})
+
+	return &session, nil
+}
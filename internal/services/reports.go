@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// ErrInvalidReportRange is returned when a report's from/to dates cannot be used
+var ErrInvalidReportRange = errors.New("invalid report range")
+
+// reportDateLayout is the layout of report from/to dates and daily buckets
+const reportDateLayout = "2006-01-02"
+
+// defaultReportDays is the length of the report period when no from date is given
+const defaultReportDays = 30
+
+// ReportRange is a half-open [Start, End) period covering whole days in a
+// reporting time zone. Start and End are absolute instants, so they can be
+// compared directly against the UTC timestamps stored in the database.
+type ReportRange struct {
+	Location *time.Location
+	Start    time.Time
+	End      time.Time
+}
+
+// NewReportRange resolves inclusive from/to dates ("2006-01-02", either may be
+// empty) to the instants where those days begin and end in loc. An empty to
+// means today in loc; an empty from covers the defaultReportDays up to to.
+func NewReportRange(from, to string, loc *time.Location, now time.Time) (ReportRange, error) {
+	var last time.Time
+	if to == "" {
+		y, m, d := now.In(loc).Date()
+		last = time.Date(y, m, d, 0, 0, 0, 0, loc)
+	} else {
+		t, err := time.ParseInLocation(reportDateLayout, to, loc)
+		if err != nil {
+			return ReportRange{}, ErrInvalidReportRange
+		}
+		last = t
+	}
+
+	var first time.Time
+	if from == "" {
+		first = last.AddDate(0, 0, 1-defaultReportDays)
+	} else {
+		t, err := time.ParseInLocation(reportDateLayout, from, loc)
+		if err != nil {
+			return ReportRange{}, ErrInvalidReportRange
+		}
+		first = t
+	}
+	if first.After(last) {
+		return ReportRange{}, ErrInvalidReportRange
+	}
+
+	// AddDate works on the wall clock, so days that are 23 or 25 hours long
+	// around DST changes still end at local midnight
+	return ReportRange{Location: loc, Start: first, End: last.AddDate(0, 0, 1)}, nil
+}
+
+// DailyRevenue is the paid total of one currency on one day in the reporting zone
+type DailyRevenue struct {
+	Date        string `json:"date"`
+	Currency    string `json:"currency"`
+	AmountCents int64  `json:"amount_cents"`
+	Payments    int    `json:"payments"`
+}
+
+// RevenueReport lists paid sessions per day for a merchant
+type RevenueReport struct {
+	MerchantID uuid.UUID      `json:"merchant_id"`
+	Timezone   string         `json:"timezone"`
+	From       string         `json:"from"`
+	To         string         `json:"to"`
+	Days       []DailyRevenue `json:"days"`
+	// Bandwidth is the proxied traffic of the current month, whatever the range
+	Bandwidth *BandwidthUsage `json:"bandwidth,omitempty"`
+}
+
+// RevenueByDay sums paid sessions per day and currency. Days are bucketed in
+// the range's time zone inside the query, so a payment at 23:30 UTC lands on
+// the next day for a merchant in Europe/Amsterdam.
+func (s *PaymentService) RevenueByDay(ctx context.Context, merchantID uuid.UUID, r ReportRange) (*RevenueReport, error) {
+	query := `
+		SELECT to_char(paid_at AT TIME ZONE $2, 'YYYY-MM-DD') AS day, currency,
+		       SUM(amount_cents), COUNT(*)
+		FROM payment_sessions
+		WHERE merchant_id = $1 AND status = $3 AND paid_at >= $4 AND paid_at < $5
+		GROUP BY day, currency
+		ORDER BY day, currency`
+
+	rows, err := s.db.QueryContext(ctx, query,
+		merchantID,
+		r.Location.String(),
+		models.PaymentStatusPaid,
+		r.Start,
+		r.End,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load revenue: %w", err)
+	}
+	defer rows.Close()
+
+	report := &RevenueReport{
+		MerchantID: merchantID,
+		Timezone:   r.Location.String(),
+		From:       r.Start.Format(reportDateLayout),
+		To:         r.End.AddDate(0, 0, -1).Format(reportDateLayout),
+		Days:       []DailyRevenue{},
+	}
+	for rows.Next() {
+		var day DailyRevenue
+		if err := rows.Scan(&day.Date, &day.Currency, &day.AmountCents, &day.Payments); err != nil {
+			return nil, fmt.Errorf("failed to scan revenue: %w", err)
+		}
+		report.Days = append(report.Days, day)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load revenue: %w", err)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewReportRange(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	// 23:30 UTC on March 30 is already March 31 in Amsterdam
+	now := time.Date(2024, 3, 30, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		from, to  string
+		loc       *time.Location
+		wantStart time.Time
+		wantEnd   time.Time
+		wantErr   error
+	}{
+		{
+			name: "single day in UTC", from: "2024-03-01", to: "2024-03-01", loc: time.UTC,
+			wantStart: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "days start at local midnight", from: "2024-03-01", to: "2024-03-02", loc: amsterdam,
+			wantStart: time.Date(2024, 2, 29, 23, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 3, 2, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "23 hour day at the DST change", from: "2024-03-31", to: "2024-03-31", loc: amsterdam,
+			wantStart: time.Date(2024, 3, 30, 23, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 3, 31, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "to defaults to today in the zone", from: "2024-03-31", loc: amsterdam,
+			wantStart: time.Date(2024, 3, 30, 23, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 3, 31, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "from defaults to the last 30 days", to: "2024-03-30", loc: time.UTC,
+			wantStart: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC),
+		},
+		{name: "from after to", from: "2024-03-02", to: "2024-03-01", loc: time.UTC, wantErr: ErrInvalidReportRange},
+		{name: "malformed from", from: "03/01/2024", to: "2024-03-01", loc: time.UTC, wantErr: ErrInvalidReportRange},
+		{name: "malformed to", from: "2024-03-01", to: "2024-3-1", loc: time.UTC, wantErr: ErrInvalidReportRange},
+		{name: "impossible date", from: "2024-02-30", loc: time.UTC, wantErr: ErrInvalidReportRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewReportRange(tt.from, tt.to, tt.loc, now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("NewReportRange() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewReportRange() error = %v", err)
+			}
+			if !got.Start.Equal(tt.wantStart) || !got.End.Equal(tt.wantEnd) {
+				t.Errorf("NewReportRange() = [%s, %s), want [%s, %s)", got.Start.UTC(), got.End.UTC(), tt.wantStart, tt.wantEnd)
+			}
+			if got.Location != tt.loc {
+				t.Errorf("NewReportRange() location = %s, want %s", got.Location, tt.loc)
+			}
+		})
+	}
+}
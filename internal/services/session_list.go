@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// Page sizes of ListSessions
+const (
+	DefaultSessionPageSize = 50
+	MaxSessionPageSize     = 200
+)
+
+// SessionFilter restricts which sessions ListSessions returns. From and To
+// bound created_at as a half-open [From, To) range. Nil fields do not filter.
+type SessionFilter struct {
+	MerchantID     *uuid.UUID
+	Status         *models.PaymentStatus
+	ContentID      *uuid.UUID
+	UserIdentifier *string
+	From           *time.Time
+	To             *time.Time
+}
+
+// SessionPage is one page of ListSessions with the total number of matches
+type SessionPage struct {
+	Sessions []models.PaymentSession
+	Total    int
+	Limit    int
+	Offset   int
+}
+
+const sessionColumns = `
+		session_id, merchant_id, content_id, user_identifier, amount_cents,
+		platform_fee_cents, vat_cents, net_cents,
+		currency, payment_reference, qr_code_data, status, expires_at,
+		created_at, paid_at, access_granted_at, access_expires_at, refunded_at, metadata,
+		display_amount_cents, display_currency, exchange_rate, user_agent, host(ip_address)`
+
+// sessionFilterSQL applies a SessionFilter, taking its fields as $1 to $6
+const sessionFilterSQL = `
+		WHERE ($1::uuid IS NULL OR merchant_id = $1)
+		  AND ($2::payment_status IS NULL OR status = $2)
+		  AND ($3::uuid IS NULL OR content_id = $3)
+		  AND ($4::text IS NULL OR user_identifier = $4)
+		  AND ($5::timestamptz IS NULL OR created_at >= $5)
+		  AND ($6::timestamptz IS NULL OR created_at < $6)`
+
+// ListSessions returns the sessions matching filter newest first. limit
+// defaults to DefaultSessionPageSize and is capped at MaxSessionPageSize.
+func (s *PaymentService) ListSessions(ctx context.Context, filter SessionFilter, limit, offset int) (*SessionPage, error) {
+	if limit <= 0 {
+		limit = DefaultSessionPageSize
+	}
+	if limit > MaxSessionPageSize {
+		limit = MaxSessionPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	page := &SessionPage{Sessions: []models.PaymentSession{}, Limit: limit, Offset: offset}
+
+	args := []interface{}{filter.MerchantID, filter.Status, filter.ContentID, filter.UserIdentifier, filter.From, filter.To}
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM payment_sessions`+sessionFilterSQL, args...).Scan(&page.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count payment sessions: %w", err)
+	}
+
+	query := `
+		SELECT` + sessionColumns + `
+		FROM payment_sessions` + sessionFilterSQL + `
+		ORDER BY created_at DESC, session_id DESC
+		LIMIT $7 OFFSET $8`
+
+	rows, err := s.db.QueryContext(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list payment sessions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan payment session: %w", err)
+		}
+		page.Sessions = append(page.Sessions, *session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list payment sessions: %w", err)
+	}
+
+	return page, nil
+}
+
+// scanSession reads a row of sessionColumns
+func scanSession(row rowScanner) (*models.PaymentSession, error) {
+	var session models.PaymentSession
+	err := row.Scan(
+		&session.SessionID,
+		&session.MerchantID,
+		&session.ContentID,
+		&session.UserIdentifier,
+		&session.AmountCents,
+		&session.PlatformFeeCents,
+		&session.VATCents,
+		&session.NetCents,
+		&session.Currency,
+		&session.PaymentReference,
+		&session.QRCodeData,
+		&session.Status,
+		&session.ExpiresAt,
+		&session.CreatedAt,
+		&session.PaidAt,
+		&session.AccessGrantedAt,
+		&session.AccessExpiresAt,
+		&session.RefundedAt,
+		&session.Metadata,
+		&session.DisplayAmountCents,
+		&session.DisplayCurrency,
+		&session.ExchangeRate,
+		&session.UserAgent,
+		&session.IPAddress,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// StatsFilter narrows platform stats to one merchant and/or a period. Nil
+// fields do not filter.
+type StatsFilter struct {
+	MerchantID *uuid.UUID
+	Range      *ReportRange
+}
+
+// RevenueTotal is the paid total of one currency
+type RevenueTotal struct {
+	Currency    string `json:"currency"`
+	AmountCents int64  `json:"amount_cents"`
+	Payments    int    `json:"payments"`
+}
+
+// SessionCounts counts payment sessions by status
+type SessionCounts struct {
+	Paid    int `json:"paid"`
+	Pending int `json:"pending"`
+	Expired int `json:"expired"`
+}
+
+// topClientsLimit caps Stats.TopClients
+const topClientsLimit = 10
+
+// ClientCount counts the sessions created from one IP address. Many sessions
+// with few of them paid point at scraping or card testing.
+type ClientCount struct {
+	IPAddress string `json:"ip_address"`
+	Sessions  int    `json:"sessions"`
+	Paid      int    `json:"paid"`
+}
+
+// Stats is the platform overview for admins. Revenue is split by currency
+// since amounts in different currencies cannot be added up.
+type Stats struct {
+	MerchantID      *uuid.UUID     `json:"merchant_id,omitempty"`
+	From            string         `json:"from,omitempty"`
+	To              string         `json:"to,omitempty"`
+	Revenue         []RevenueTotal `json:"revenue"`
+	Sessions        SessionCounts  `json:"sessions"`
+	ActiveMerchants int            `json:"active_merchants"`
+	ActiveAccesses  int            `json:"active_accesses"`
+	TopClients      []ClientCount  `json:"top_clients"`
+}
+
+// Stats aggregates revenue, session counts, active merchants and active content
+// accesses. With a range, revenue counts sessions paid in it and session counts
+// sessions created in it; active merchants and accesses are always as of now.
+// TopClients lists the IP addresses that created the most sessions in the
+// range.
+func (s *PaymentService) Stats(ctx context.Context, filter StatsFilter) (*Stats, error) {
+	var start, end *time.Time
+	stats := &Stats{
+		MerchantID: filter.MerchantID,
+		Revenue:    []RevenueTotal{},
+		TopClients: []ClientCount{},
+	}
+	if filter.Range != nil {
+		start, end = &filter.Range.Start, &filter.Range.End
+		stats.From = filter.Range.Start.Format(reportDateLayout)
+		stats.To = filter.Range.End.AddDate(0, 0, -1).Format(reportDateLayout)
+	}
+
+	revenueQuery := `
+		SELECT currency, SUM(amount_cents), COUNT(*)
+		FROM payment_sessions
+		WHERE status = $1
+		  AND ($2::uuid IS NULL OR merchant_id = $2)
+		  AND ($3::timestamptz IS NULL OR paid_at >= $3)
+		  AND ($4::timestamptz IS NULL OR paid_at < $4)
+		GROUP BY currency
+		ORDER BY currency`
+
+	rows, err := s.db.QueryContext(ctx, revenueQuery, models.PaymentStatusPaid, filter.MerchantID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load revenue: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var total RevenueTotal
+		if err := rows.Scan(&total.Currency, &total.AmountCents, &total.Payments); err != nil {
+			return nil, fmt.Errorf("failed to scan revenue: %w", err)
+		}
+		stats.Revenue = append(stats.Revenue, total)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load revenue: %w", err)
+	}
+
+	sessionsQuery := `
+		SELECT COUNT(*) FILTER (WHERE status = $1),
+		       COUNT(*) FILTER (WHERE status = $2),
+		       COUNT(*) FILTER (WHERE status = $3)
+		FROM payment_sessions
+		WHERE ($4::uuid IS NULL OR merchant_id = $4)
+		  AND ($5::timestamptz IS NULL OR created_at >= $5)
+		  AND ($6::timestamptz IS NULL OR created_at < $6)`
+
+	err = s.db.QueryRowContext(ctx, sessionsQuery,
+		models.PaymentStatusPaid,
+		models.PaymentStatusPending,
+		models.PaymentStatusExpired,
+		filter.MerchantID,
+		start,
+		end,
+	).Scan(&stats.Sessions.Paid, &stats.Sessions.Pending, &stats.Sessions.Expired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count sessions: %w", err)
+	}
+
+	err = s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM merchants WHERE status = $1 AND ($2::uuid IS NULL OR merchant_id = $2)`,
+		models.MerchantStatusActive, filter.MerchantID,
+	).Scan(&stats.ActiveMerchants)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count active merchants: %w", err)
+	}
+
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM content_access
+		WHERE is_active AND expires_at > NOW() AND ($1::uuid IS NULL OR merchant_id = $1)`,
+		filter.MerchantID,
+	).Scan(&stats.ActiveAccesses)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count active accesses: %w", err)
+	}
+
+	clientsQuery := `
+		SELECT host(ip_address), COUNT(*), COUNT(*) FILTER (WHERE status = $1)
+		FROM payment_sessions
+		WHERE ip_address IS NOT NULL
+		  AND ($2::uuid IS NULL OR merchant_id = $2)
+		  AND ($3::timestamptz IS NULL OR created_at >= $3)
+		  AND ($4::timestamptz IS NULL OR created_at < $4)
+		GROUP BY ip_address
+		ORDER BY COUNT(*) DESC, ip_address
+		LIMIT $5`
+
+	rows, err = s.db.QueryContext(ctx, clientsQuery, models.PaymentStatusPaid, filter.MerchantID, start, end, topClientsLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load top clients: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var client ClientCount
+		if err := rows.Scan(&client.IPAddress, &client.Sessions, &client.Paid); err != nil {
+			return nil, fmt.Errorf("failed to scan top clients: %w", err)
+		}
+		stats.TopClients = append(stats.TopClients, client)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load top clients: %w", err)
+	}
+
+	return stats, nil
+}
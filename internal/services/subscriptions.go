@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// ErrNotSubscription is returned when renewing content that is not
+// subscription content with a limited access duration
+var ErrNotSubscription = errors.New("content is not a renewable subscription")
+
+// renewalExpiry returns when access renewed for period at start ends. While
+// the current access runs past start the period continues from its expiry, so
+// a renewal paid early keeps the time already paid for; otherwise it runs from
+// start. renewed reports whether the current access was continued.
+func renewalExpiry(current, start time.Time, period time.Duration) (expiresAt time.Time, renewed bool) {
+	if current.After(start) {
+		return current.Add(period), true
+	}
+	return start.Add(period), false
+}
+
+// renewSubscription moves the access window of a session that was just marked
+// paid for subscription content so it continues where the user's current
+// access ends, rather than starting at the payment, see renewalExpiry. It must
+// run in the transaction that marked the session paid, before
+// grantSessionAccess, and returns the new access expiry, or false when the
+// session renews nothing: other content types, anonymous sessions, and users
+// whose access already ended start afresh. Free trials never count as access
+// to renew from.
+func renewSubscription(ctx context.Context, dbTx *sql.Tx, sessionID uuid.UUID) (time.Time, bool, error) {
+	query := `
+		SELECT ps.access_granted_at, ps.access_expires_at, MAX(a.expires_at)
+		FROM payment_sessions ps
+		JOIN content c ON c.content_id = ps.content_id AND c.content_type = $2
+		JOIN content_access a ON a.content_id = ps.content_id AND a.user_identifier = ps.user_identifier
+		WHERE ps.session_id = $1 AND ps.user_identifier <> ''
+		  AND a.is_active AND NOT a.is_free_trial
+		  AND a.session_id IS DISTINCT FROM ps.session_id
+		GROUP BY ps.session_id`
+
+	var grantedAt, expiresAt, current time.Time
+	err := dbTx.QueryRowContext(ctx, query, sessionID, models.ContentTypeSubscription).Scan(&grantedAt, &expiresAt, &current)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to renew subscription: %w", err)
+	}
+	renewedAt, renewed := renewalExpiry(current, grantedAt, expiresAt.Sub(grantedAt))
+	if !renewed {
+		return time.Time{}, false, nil
+	}
+
+	if _, err := dbTx.ExecContext(ctx, `UPDATE payment_sessions SET access_expires_at = $2 WHERE session_id = $1`, sessionID, renewedAt); err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to renew subscription: %w", err)
+	}
+	return renewedAt, true, nil
+}
+
+// RenewSubscription extends a user's paid access to subscription content of a
+// merchant by the content's access duration, for renewals billed outside a
+// payment session. Like a session renewal the period continues from the
+// current expiry while the access runs, see renewalExpiry. It returns
+// ErrNotSubscription for other content and content with permanent access, and
+// sql.ErrNoRows when the user has no paid access to renew; revoked access and
+// free trials do not count.
+func (s *ContentService) RenewSubscription(ctx context.Context, merchantID, contentID uuid.UUID, userIdentifier string) (*models.ContentAccess, error) {
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	var contentType models.ContentType
+	var durationSeconds int
+	err = dbTx.QueryRowContext(ctx, `
+		SELECT content_type, access_duration_seconds
+		FROM content
+		WHERE content_id = $1 AND merchant_id = $2`,
+		contentID, merchantID,
+	).Scan(&contentType, &durationSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load content: %w", err)
+	}
+	if contentType != models.ContentTypeSubscription || durationSeconds <= 0 {
+		return nil, ErrNotSubscription
+	}
+
+	var accessID uuid.UUID
+	var current time.Time
+	err = dbTx.QueryRowContext(ctx, `
+		SELECT access_id, expires_at
+		FROM content_access
+		WHERE merchant_id = $1 AND content_id = $2 AND user_identifier = $3
+		  AND is_active AND NOT is_free_trial
+		ORDER BY expires_at DESC
+		LIMIT 1
+		FOR UPDATE`,
+		merchantID, contentID, userIdentifier,
+	).Scan(&accessID, &current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find access to renew: %w", err)
+	}
+
+	expiresAt, _ := renewalExpiry(current, time.Now(), time.Duration(durationSeconds)*time.Second)
+	var access models.ContentAccess
+	err = dbTx.QueryRowContext(ctx, `
+		UPDATE content_access
+		SET expires_at = $2
+		WHERE access_id = $1
+		RETURNING access_id, session_id, merchant_id, content_id, user_identifier,
+		          granted_at, expires_at, last_accessed_at, access_count, is_active, is_free_trial`,
+		accessID, expiresAt,
+	).Scan(
+		&access.AccessID,
+		&access.SessionID,
+		&access.MerchantID,
+		&access.ContentID,
+		&access.UserIdentifier,
+		&access.GrantedAt,
+		&access.ExpiresAt,
+		&access.LastAccessedAt,
+		&access.AccessCount,
+		&access.IsActive,
+		&access.IsFreeTrial,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to renew subscription: %w", err)
+	}
+	if err := dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit subscription renewal: %w", err)
+	}
+	return &access, nil
+}
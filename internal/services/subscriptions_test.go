@@ -0,0 +1,34 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRenewalExpiry(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	month := 30 * 24 * time.Hour
+	tests := []struct {
+		name        string
+		current     time.Time
+		want        time.Time
+		wantRenewed bool
+	}{
+		{"renewed early keeps the remaining days", start.Add(5 * 24 * time.Hour), start.Add(5*24*time.Hour + month), true},
+		{"renewed a second before the end", start.Add(time.Second), start.Add(time.Second + month), true},
+		{"renewed as access ends", start, start.Add(month), false},
+		{"lapsed access starts afresh", start.Add(-24 * time.Hour), start.Add(month), false},
+		{"no earlier access", time.Time{}, start.Add(month), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, renewed := renewalExpiry(tt.current, start, month)
+			if !got.Equal(tt.want) || renewed != tt.wantRenewed {
+				t.Errorf("renewalExpiry() = %s, %v, want %s, %v", got, renewed, tt.want, tt.wantRenewed)
+			}
+			if !got.After(tt.current) {
+				t.Errorf("renewalExpiry() = %s does not extend the current expiry %s", got, tt.current)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// ErrTierLimitReached is returned when an action would take a merchant over a
+// limit of its pricing tier, see models.TierLimits
+var ErrTierLimitReached = errors.New("pricing tier limit reached")
+
+// queryRower is the part of *sql.DB and *sql.Tx the limit checks need
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// checkTierLimit counts what the merchant already uses with countQuery, which
+// takes the merchant ID as $1 and args after it, and fails with
+// ErrTierLimitReached when one more would exceed the limit picked by limit.
+// sql.ErrNoRows is returned for unknown merchants.
+func checkTierLimit(ctx context.Context, db queryRower, merchantID uuid.UUID, what string, limit func(models.TierLimits) int, countQuery string, args ...interface{}) error {
+	var tier models.PricingTier
+	err := db.QueryRowContext(ctx, `SELECT pricing_tier FROM merchants WHERE merchant_id = $1`, merchantID).Scan(&tier)
+	if err != nil {
+		return fmt.Errorf("merchant not found: %w", err)
+	}
+	allowed := limit(tier.Limits())
+	if allowed == 0 {
+		return nil
+	}
+
+	var used int
+	if err := db.QueryRowContext(ctx, countQuery, append([]interface{}{merchantID}, args...)...).Scan(&used); err != nil {
+		return fmt.Errorf("failed to count %s: %w", what, err)
+	}
+	if used >= allowed {
+		return fmt.Errorf("%w: the %s tier allows %d %s", ErrTierLimitReached, tier, allowed, what)
+	}
+	return nil
+}
+
+// checkContentLimit verifies the merchant may have another active content item
+// besides the content being activated, which is uuid.Nil for new content
+func checkContentLimit(ctx context.Context, db queryRower, merchantID, contentID uuid.UUID) error {
+	return checkTierLimit(ctx, db, merchantID, "content items",
+		func(l models.TierLimits) int { return l.MaxContent },
+		`SELECT COUNT(*) FROM content WHERE merchant_id = $1 AND is_active = true AND content_id <> $2`,
+		contentID,
+	)
+}
+
+// checkSessionLimit verifies the merchant may open another payment session this
+// calendar month
+func checkSessionLimit(ctx context.Context, db queryRower, merchantID uuid.UUID) error {
+	return checkTierLimit(ctx, db, merchantID, "payment sessions per month",
+		func(l models.TierLimits) int { return l.MonthlySessions },
+		`SELECT COUNT(*) FROM payment_sessions WHERE merchant_id = $1 AND created_at >= $2`,
+		monthStart(time.Now()),
+	)
+}
+
+// checkWebhookLimit verifies the merchant may add another webhook endpoint
+func checkWebhookLimit(ctx context.Context, db queryRower, merchantID uuid.UUID) error {
+	return checkTierLimit(ctx, db, merchantID, "webhook endpoints",
+		func(l models.TierLimits) int { return l.MaxWebhooks },
+		`SELECT COUNT(*) FROM merchant_webhooks WHERE merchant_id = $1`,
+	)
+}
+
+// normalizePricingTier lowercases a tier name and checks it is known
+func normalizePricingTier(tier string) (models.PricingTier, bool) {
+	pt := models.PricingTier(strings.ToLower(strings.TrimSpace(tier)))
+	return pt, pt.Valid()
+}
+
+// pricingTierNames lists the tiers for error messages
+func pricingTierNames() string {
+	names := make([]string, len(models.PricingTiers))
+	for i, t := range models.PricingTiers {
+		names[i] = string(t)
+	}
+	return strings.Join(names, ", ")
+}
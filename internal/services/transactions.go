@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrTransactionNotFound is returned when a bank transaction does not exist
+	ErrTransactionNotFound = errors.New("transaction not found")
+)
+
+// TransactionService handles bank transaction queries
+type TransactionService struct {
+	db     *sql.DB
+	config *config.Config
+	logger *zap.Logger
+}
+
+// NewTransactionService creates a new transaction service
+func NewTransactionService(db *sql.DB, cfg *config.Config, logger *zap.Logger) *TransactionService {
+	return &TransactionService{
+		db:     db,
+		config: cfg,
+		logger: logger,
+	}
+}
+
+// TransactionCursor marks a position in the booking_date DESC, transaction_id DESC ordering
+type TransactionCursor struct {
+	BookingDate   time.Time
+	TransactionID uuid.UUID
+}
+
+// Encode returns the opaque string form of the cursor
+func (c TransactionCursor) Encode() string {
+	raw := c.BookingDate.UTC().Format(time.RFC3339Nano) + "|" + c.TransactionID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeTransactionCursor parses a cursor previously produced by Encode
+func DecodeTransactionCursor(s string) (*TransactionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+	bookingDate, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	transactionID, err := uuid.Parse(parts[1])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &TransactionCursor{BookingDate: bookingDate, TransactionID: transactionID}, nil
+}
+
+// TransactionFilter restricts which transactions are returned. From and To
+// bound transaction_date as a half-open [From, To) range.
+type TransactionFilter struct {
+	MerchantID *uuid.UUID
+	Status     *models.TransactionStatus
+	From       *time.Time
+	To         *time.Time
+	After      *TransactionCursor
+	Limit      int
+	Offset     int
+	// IncludeTotal counts all matching transactions on cursor pages too,
+	// which costs a scan of every match
+	IncludeTotal bool
+}
+
+// TransactionPage is a single page of transactions. Pages can be walked with
+// Offset like the merchant listing or, cheaper on large tables, by passing
+// NextCursor back. Total counts all matching transactions; cursor pages leave
+// it out unless the filter asks for it.
+type TransactionPage struct {
+	Data       []models.BankTransaction `json:"data"`
+	Total      *int                     `json:"total,omitempty"`
+	Limit      int                      `json:"limit"`
+	Offset     int                      `json:"offset"`
+	NextCursor *string                  `json:"next_cursor"`
+}
+
+const transactionColumns = `
+		transaction_id, merchant_id, bank_reference, payment_reference, amount_cents,
+		currency, debtor_name, debtor_iban, creditor_iban, transaction_date,
+		booking_date, value_date, status, processed_at, created_at`
+
+// ListTransactions returns a page of transactions ordered newest-first by booking date
+func (s *TransactionService) ListTransactions(ctx context.Context, filter TransactionFilter) (*TransactionPage, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = s.config.Admin.DefaultPageSize
+	}
+	if limit > s.config.Admin.MaxPageSize {
+		limit = s.config.Admin.MaxPageSize
+	}
+
+	// Fetch one extra row to find out whether another page exists
+	query, args := s.buildQuery(filter, limit+1)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transactions: %w", err)
+	}
+	defer rows.Close()
+
+	page := &TransactionPage{
+		Data:   make([]models.BankTransaction, 0, limit),
+		Limit:  limit,
+		Offset: filter.Offset,
+	}
+	for rows.Next() {
+		tx, err := scanBankTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		page.Data = append(page.Data, *tx)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list transactions: %w", err)
+	}
+
+	if len(page.Data) > limit {
+		page.Data = page.Data[:limit]
+		last := page.Data[limit-1]
+		next := TransactionCursor{BookingDate: last.BookingDate, TransactionID: last.TransactionID}.Encode()
+		page.NextCursor = &next
+	}
+
+	if filter.After != nil && !filter.IncludeTotal {
+		return page, nil
+	}
+	conditions, args := filterConditions(filter)
+	countQuery := "SELECT COUNT(*) FROM bank_transactions"
+	if len(conditions) > 0 {
+		countQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	var total int
+	if err := s.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("failed to count transactions: %w", err)
+	}
+	page.Total = &total
+
+	return page, nil
+}
+
+// StreamTransactions walks matching transactions row by row, calling fn for each one.
+// At most cfg.Admin.MaxScanLimit rows are visited so an export can never turn into
+// an unbounded full-table scan. It reports whether the limit cut the result short.
+func (s *TransactionService) StreamTransactions(ctx context.Context, filter TransactionFilter, fn func(*models.BankTransaction) error) (bool, error) {
+	maxRows := s.config.Admin.MaxScanLimit
+	query, args := s.buildQuery(filter, maxRows+1)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to stream transactions: %w", err)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		if count == maxRows {
+			return true, nil
+		}
+		tx, err := scanBankTransaction(rows)
+		if err != nil {
+			return false, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		if err := fn(tx); err != nil {
+			return false, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to stream transactions: %w", err)
+	}
+
+	return false, nil
+}
+
+// GetTransaction returns a single transaction including its raw bank data, the
+// audit of the last matching decision and the client of the session it matched
+func (s *TransactionService) GetTransaction(ctx context.Context, transactionID uuid.UUID) (*models.BankTransaction, error) {
+	query := `
+		SELECT` + transactionColumns + `, raw_data, match_audit,
+		       payer_session_id, payer_user_agent, payer_ip_address
+		FROM bank_transactions
+		LEFT JOIN (
+		    SELECT session_id AS payer_session_id, user_agent AS payer_user_agent,
+		           host(ip_address) AS payer_ip_address
+		    FROM payment_sessions
+		) payer ON payer_session_id = (match_audit->>'session_id')::uuid
+		WHERE transaction_id = $1`
+
+	var tx models.BankTransaction
+	var payer models.SessionClient
+	var payerSessionID *uuid.UUID
+	err := s.db.QueryRowContext(ctx, query, transactionID).Scan(
+		&tx.TransactionID,
+		&tx.MerchantID,
+		&tx.BankReference,
+		&tx.PaymentReference,
+		&tx.AmountCents,
+		&tx.Currency,
+		&tx.DebtorName,
+		&tx.DebtorIBAN,
+		&tx.CreditorIBAN,
+		&tx.TransactionDate,
+		&tx.BookingDate,
+		&tx.ValueDate,
+		&tx.Status,
+		&tx.ProcessedAt,
+		&tx.CreatedAt,
+		&tx.RawData,
+		&tx.MatchAudit,
+		&payerSessionID,
+		&payer.UserAgent,
+		&payer.IPAddress,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction: %w", err)
+	}
+	if payerSessionID != nil {
+		payer.SessionID = *payerSessionID
+		tx.PayerClient = &payer
+	}
+
+	return &tx, nil
+}
+
+func (s *TransactionService) buildQuery(filter TransactionFilter, limit int) (string, []interface{}) {
+	conditions, args := filterConditions(filter)
+	if filter.After != nil {
+		args = append(args, filter.After.BookingDate, filter.After.TransactionID)
+		conditions = append(conditions, fmt.Sprintf("(booking_date, transaction_id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	query := "SELECT" + transactionColumns + "\n\t\tFROM bank_transactions"
+	if len(conditions) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf("\n\t\tORDER BY booking_date DESC, transaction_id DESC\n\t\tLIMIT $%d", len(args))
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	return query, args
+}
+
+// filterConditions returns the WHERE conditions of a filter apart from its
+// cursor, so they can be shared by the page and count queries
+func filterConditions(filter TransactionFilter) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.MerchantID != nil {
+		args = append(args, *filter.MerchantID)
+		conditions = append(conditions, fmt.Sprintf("merchant_id = $%d", len(args)))
+	}
+	if filter.Status != nil {
+		args = append(args, *filter.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		conditions = append(conditions, fmt.Sprintf("transaction_date >= $%d", len(args)))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		conditions = append(conditions, fmt.Sprintf("transaction_date < $%d", len(args)))
+	}
+
+	return conditions, args
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func scanBankTransaction(row rowScanner) (*models.BankTransaction, error) {
+	var tx models.BankTransaction
+	err := row.Scan(
+		&tx.TransactionID,
+		&tx.MerchantID,
+		&tx.BankReference,
+		&tx.PaymentReference,
+		&tx.AmountCents,
+		&tx.Currency,
+		&tx.DebtorName,
+		&tx.DebtorIBAN,
+		&tx.CreditorIBAN,
+		&tx.TransactionDate,
+		&tx.BookingDate,
+		&tx.ValueDate,
+		&tx.Status,
+		&tx.ProcessedAt,
+		&tx.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
@@ -0,0 +1,338 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"github.com/mh74hf/micro-payments/internal/models"
+	"go.uber.org/zap"
+)
+
+// seededTransactions is a database/sql driver serving a bank_transactions
+// table of n generated rows, for the queries of TransactionService. Row i is
+// booked i minutes before seededEpoch, so the table is in keyset order. Rows
+// skipped by an OFFSET are still generated, as a database reads them too.
+type seededTransactions struct{}
+
+var seededEpoch = time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC)
+
+func init() { sql.Register("services-seeded-transactions", seededTransactions{}) }
+
+func (seededTransactions) Open(dsn string) (driver.Conn, error) {
+	n, err := strconv.Atoi(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return seededConn(n), nil
+}
+
+type seededConn int
+
+func (c seededConn) Prepare(query string) (driver.Stmt, error) {
+	return seededStmt{n: int(c), query: query}, nil
+}
+func (seededConn) Close() error              { return nil }
+func (seededConn) Begin() (driver.Tx, error) { return nil, errors.New("transactions not supported") }
+
+type seededStmt struct {
+	n     int
+	query string
+}
+
+func (seededStmt) Close() error  { return nil }
+func (seededStmt) NumInput() int { return -1 }
+func (seededStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("exec not supported")
+}
+
+func (s seededStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if strings.HasPrefix(s.query, "SELECT COUNT(*)") {
+		return &countRows{count: int64(s.n)}, nil
+	}
+	// Arguments end with [cursor date, cursor ID,] limit [, offset]
+	offset := 0
+	if strings.Contains(s.query, "OFFSET") {
+		offset = int(args[len(args)-1].(int64))
+		args = args[:len(args)-1]
+	}
+	limit := int(args[len(args)-1].(int64))
+	start := 0
+	if strings.Contains(s.query, "(booking_date, transaction_id) <") {
+		after := args[len(args)-3].(time.Time)
+		start = int(seededEpoch.Sub(after)/time.Minute) + 1
+	}
+	return &seededRows{next: start, skip: offset, end: min(s.n, start+offset+limit)}, nil
+}
+
+type countRows struct {
+	count int64
+	done  bool
+}
+
+func (*countRows) Columns() []string { return []string{"count"} }
+func (*countRows) Close() error      { return nil }
+func (r *countRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.count
+	return nil
+}
+
+type seededRows struct {
+	next, skip, end int
+}
+
+func (*seededRows) Columns() []string {
+	return strings.Split(strings.Join(strings.Fields(transactionColumns), ""), ",")
+}
+func (*seededRows) Close() error { return nil }
+
+func (r *seededRows) Next(dest []driver.Value) error {
+	for {
+		if r.next >= r.end {
+			return io.EOF
+		}
+		seededRow(r.next, dest)
+		r.next++
+		if r.skip == 0 {
+			return nil
+		}
+		r.skip--
+	}
+}
+
+// seededRow fills dest with row i in transactionColumns order, typed as
+// lib/pq returns them: UUIDs as bytes and text as strings
+func seededRow(i int, dest []driver.Value) {
+	var id uuid.UUID
+	binary.BigEndian.PutUint64(id[8:], uint64(i))
+	booked := seededEpoch.Add(-time.Duration(i) * time.Minute)
+	dest[0] = []byte(id.String())
+	dest[1] = []byte("00000000-0000-4000-8000-00000000000a")
+	dest[2] = fmt.Sprintf("BANK-%08d", i)
+	dest[3] = fmt.Sprintf("MP-%010d", i)
+	dest[4] = int64(100 + i%10000)
+	dest[5] = "EUR"
+	dest[6] = "J. Jansen"
+	dest[7] = "NL02ABNA0123456789"
+	dest[8] = "NL91ABNA0417164300"
+	dest[9] = booked
+	dest[10] = booked
+	dest[11] = nil
+	dest[12] = string(models.TransactionStatusMatched)
+	dest[13] = booked
+	dest[14] = booked
+}
+
+func newSeededTransactionService(tb testing.TB, rows, maxScan int) *TransactionService {
+	tb.Helper()
+	db, err := sql.Open("services-seeded-transactions", strconv.Itoa(rows))
+	if err != nil {
+		tb.Fatalf("sql.Open() error = %v", err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	cfg := &config.Config{Admin: config.AdminConfig{DefaultPageSize: 50, MaxPageSize: 500, MaxScanLimit: maxScan}}
+	return NewTransactionService(db, cfg, zap.NewNop())
+}
+
+// walkPages lists every transaction page by page, by cursor or by offset
+func walkPages(tb testing.TB, s *TransactionService, pageSize int, byCursor bool) []uuid.UUID {
+	var ids []uuid.UUID
+	filter := TransactionFilter{Limit: pageSize}
+	for {
+		page, err := s.ListTransactions(context.Background(), filter)
+		if err != nil {
+			tb.Fatalf("ListTransactions() error = %v", err)
+		}
+		for _, tx := range page.Data {
+			ids = append(ids, tx.TransactionID)
+		}
+		if page.NextCursor == nil {
+			return ids
+		}
+		if byCursor {
+			cursor, err := DecodeTransactionCursor(*page.NextCursor)
+			if err != nil {
+				tb.Fatalf("DecodeTransactionCursor() error = %v", err)
+			}
+			filter.After = cursor
+		} else {
+			filter.Offset += len(page.Data)
+		}
+	}
+}
+
+func TestTransactionCursorRoundTrip(t *testing.T) {
+	want := TransactionCursor{
+		BookingDate:   time.Date(2024, 3, 12, 10, 30, 0, 123456789, time.FixedZone("CET", 3600)),
+		TransactionID: uuid.New(),
+	}
+	got, err := DecodeTransactionCursor(want.Encode())
+	if err != nil {
+		t.Fatalf("DecodeTransactionCursor() error = %v", err)
+	}
+	if !got.BookingDate.Equal(want.BookingDate) || got.TransactionID != want.TransactionID {
+		t.Errorf("DecodeTransactionCursor() = %+v, want %+v", *got, want)
+	}
+
+	for _, cursor := range []string{"", "!!", "bm90IGEgY3Vyc29y", TransactionCursor{}.Encode()[:10]} {
+		if _, err := DecodeTransactionCursor(cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("DecodeTransactionCursor(%q) error = %v, want %v", cursor, err, ErrInvalidCursor)
+		}
+	}
+}
+
+func TestListTransactionsPages(t *testing.T) {
+	tests := []struct {
+		name     string
+		rows     int
+		pageSize int
+	}{
+		{"empty", 0, 10},
+		{"single page", 7, 10},
+		{"exact pages", 30, 10},
+		{"partial last page", 31, 10},
+		{"page size capped", 1200, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSeededTransactionService(t, tt.rows, 100)
+			byCursor := walkPages(t, s, tt.pageSize, true)
+			byOffset := walkPages(t, s, tt.pageSize, false)
+			if len(byCursor) != tt.rows || len(byOffset) != tt.rows {
+				t.Fatalf("walked %d rows by cursor and %d by offset, want %d", len(byCursor), len(byOffset), tt.rows)
+			}
+			for i := range byCursor {
+				if byCursor[i] != byOffset[i] {
+					t.Fatalf("row %d is %s by cursor and %s by offset", i, byCursor[i], byOffset[i])
+				}
+			}
+		})
+	}
+}
+
+func TestListTransactionsTotal(t *testing.T) {
+	s := newSeededTransactionService(t, 25, 100)
+	first, err := s.ListTransactions(context.Background(), TransactionFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListTransactions() error = %v", err)
+	}
+	cursor, err := DecodeTransactionCursor(*first.NextCursor)
+	if err != nil {
+		t.Fatalf("DecodeTransactionCursor() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		filter    TransactionFilter
+		wantTotal bool
+	}{
+		{"first page", TransactionFilter{Limit: 10}, true},
+		{"offset page", TransactionFilter{Limit: 10, Offset: 10}, true},
+		{"cursor page", TransactionFilter{Limit: 10, After: cursor}, false},
+		{"cursor page with total", TransactionFilter{Limit: 10, After: cursor, IncludeTotal: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := s.ListTransactions(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("ListTransactions() error = %v", err)
+			}
+			switch {
+			case !tt.wantTotal && page.Total != nil:
+				t.Errorf("Total = %d, want it left out", *page.Total)
+			case tt.wantTotal && (page.Total == nil || *page.Total != 25):
+				t.Errorf("Total = %v, want 25", page.Total)
+			}
+		})
+	}
+}
+
+func TestStreamTransactionsScanLimit(t *testing.T) {
+	tests := []struct {
+		name          string
+		rows          int
+		maxScan       int
+		wantRows      int
+		wantTruncated bool
+	}{
+		{"below the limit", 99, 100, 99, false},
+		{"at the limit", 100, 100, 100, false},
+		{"above the limit", 101, 100, 100, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSeededTransactionService(t, tt.rows, tt.maxScan)
+			n := 0
+			truncated, err := s.StreamTransactions(context.Background(), TransactionFilter{}, func(*models.BankTransaction) error {
+				n++
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("StreamTransactions() error = %v", err)
+			}
+			if n != tt.wantRows || truncated != tt.wantTruncated {
+				t.Errorf("StreamTransactions() visited %d rows, truncated %v, want %d, %v", n, truncated, tt.wantRows, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+// BenchmarkListTransactionsWalk walks a large table page by page. With offsets
+// every page reads the rows before it again; the cursor starts where the last
+// page ended, so the walk stays linear in the table size.
+func BenchmarkListTransactionsWalk(b *testing.B) {
+	for _, rows := range []int{5000, 20000} {
+		for _, mode := range []struct {
+			name     string
+			byCursor bool
+		}{{"offset", false}, {"cursor", true}} {
+			b.Run(fmt.Sprintf("%s/%d", mode.name, rows), func(b *testing.B) {
+				s := newSeededTransactionService(b, rows, rows)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					walkPages(b, s, 500, mode.byCursor)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkStreamTransactionsCSV exports a large table as CSV. Rows are written
+// as they are read, so the bytes allocated per row stay the same however many
+// rows there are.
+func BenchmarkStreamTransactionsCSV(b *testing.B) {
+	for _, rows := range []int{10000, 100000} {
+		b.Run(strconv.Itoa(rows), func(b *testing.B) {
+			s := newSeededTransactionService(b, rows, rows)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := csv.NewWriter(io.Discard)
+				_, err := s.StreamTransactions(context.Background(), TransactionFilter{}, func(tx *models.BankTransaction) error {
+					return w.Write([]string{tx.TransactionID.String(), *tx.PaymentReference, strconv.Itoa(tx.AmountCents), tx.Currency})
+				})
+				if err != nil {
+					b.Fatalf("StreamTransactions() error = %v", err)
+				}
+				w.Flush()
+			}
+			b.ReportMetric(float64(rows), "rows/op")
+		})
+	}
+}
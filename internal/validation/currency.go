@@ -0,0 +1,17 @@
+package validation
+
+import (
+	"strings"
+
+	"github.com/mh74hf/micro-payments/internal/money"
+)
+
+// NormalizeCurrency trims and upper-cases a currency code and reports whether
+// it is an active ISO 4217 currency, so "eur" becomes "EUR" and "US$" is rejected
+func NormalizeCurrency(code string) (string, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if _, ok := money.MinorUnits(code); !ok {
+		return "", false
+	}
+	return code, true
+}
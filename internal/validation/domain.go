@@ -0,0 +1,9 @@
+package validation
+
+import "strings"
+
+// NormalizeDomain returns the canonical form merchant domains are stored and
+// looked up in: trimmed, lower-cased and without a trailing dot
+func NormalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+}
@@ -0,0 +1,24 @@
+package validation
+
+import "testing"
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"shop.example.com", "shop.example.com"},
+		{"Shop.Example.COM", "shop.example.com"},
+		{"shop.example.com.", "shop.example.com"},
+		{"  shop.example.com.  ", "shop.example.com"},
+		{"www.shop.example.com", "www.shop.example.com"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			if got := NormalizeDomain(tt.domain); got != tt.want {
+				t.Errorf("NormalizeDomain(%q) = %q, want %q", tt.domain, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package validation
+
+import "testing"
+
+func TestIsValidIBAN(t *testing.T) {
+	tests := []struct {
+		name string
+		iban string
+		want bool
+	}{
+		{"NL", "NL91ABNA0417164300", true},
+		{"DE", "DE89370400440532013000", true},
+		{"FR with letters in the BBAN", "FR1420041010050500013M02606", true},
+		{"GB", "GB82WEST12345698765432", true},
+		{"spaces and lower case", "nl91 abna 0417 1643 00", true},
+		{"surrounding whitespace", "  DE89 3704 0044 0532 0130 00 ", true},
+		{"NL checksum failure", "NL91ABNA0417164301", false},
+		{"DE checksum failure", "DE89370400440532013001", false},
+		{"FR swapped digits", "FR1420041010050500013M02660", false},
+		{"too short for NL", "NL91ABNA041716430", false},
+		{"too long for DE", "DE893704004405320130000", false},
+		{"unknown country", "XX91ABNA0417164300", false},
+		{"letters as check digits", "NLAAABNA0417164300", false},
+		{"punctuation", "NL91-ABNA-0417-1643", false},
+		{"empty", "", false},
+		{"country only", "NL", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsValidIBAN(tt.iban); got != tt.want {
+				t.Errorf("IsValidIBAN(%q) = %v, want %v", tt.iban, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,665 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrQueueFull is returned when an event finds no room in the queues and
+	// cannot be parked either
+	ErrQueueFull = errors.New("webhook queue full")
+	// ErrDispatcherClosed is returned when enqueueing after Close has been called
+	ErrDispatcherClosed = errors.New("webhook dispatcher closed")
+	// ErrDeliveryNotFound is returned when replaying an event that is not
+	// dead-lettered
+	ErrDeliveryNotFound = errors.New("failed webhook delivery not found")
+)
+
+// Statuses of stored events
+const (
+	// DeliveryParked events wait for room in the queues
+	DeliveryParked = "parked"
+	// DeliveryFailed events failed every attempt and are retried at their
+	// next retry time
+	DeliveryFailed = "failed"
+	// DeliveryDead events ran out of retries; only a replay sends them again
+	DeliveryDead = "dead"
+)
+
+// Event is a payment lifecycle event destined for a merchant's webhook endpoint
+type Event struct {
+	EventID    uuid.UUID              `json:"event_id"`
+	MerchantID uuid.UUID              `json:"merchant_id"`
+	Type       string                 `json:"type"`
+	CreatedAt  time.Time              `json:"created_at"`
+	Data       map[string]interface{} `json:"data"`
+
+	// attempts counts the delivery attempts made before, across restarts
+	attempts int
+	// delivered lists the endpoints an earlier attempt reached
+	delivered []uuid.UUID
+}
+
+// DeliveredTo reports whether an earlier attempt delivered the event to the
+// endpoint, so retries skip it
+func (e Event) DeliveredTo(endpointID uuid.UUID) bool {
+	for _, id := range e.delivered {
+		if id == endpointID {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery describes a dead-lettered event: one whose attempts all failed.
+// Retries skip the DeliveredEndpoints, which did receive it.
+type Delivery struct {
+	EventID            uuid.UUID   `json:"event_id"`
+	MerchantID         uuid.UUID   `json:"merchant_id"`
+	EventType          string      `json:"event_type"`
+	Status             string      `json:"status"`
+	Attempts           int         `json:"attempts"`
+	DeliveredEndpoints []uuid.UUID `json:"delivered_endpoints"`
+	LastError          *string     `json:"last_error,omitempty"`
+	NextRetryAt        *time.Time  `json:"next_retry_at,omitempty"`
+	CreatedAt          time.Time   `json:"created_at"`
+	FailedAt           *time.Time  `json:"failed_at,omitempty"`
+}
+
+// Deliverer sends a single event to the merchant's endpoints
+type Deliverer interface {
+	// Deliver sends the event to every endpoint of the merchant it was not
+	// delivered to before, see Event.DeliveredTo, and returns the IDs of the
+	// endpoints that accepted it, also when others failed
+	Deliver(ctx context.Context, event Event) ([]uuid.UUID, error)
+}
+
+// Store keeps the events that did not fit in the queues until the dispatcher
+// has room for them again, and the events whose delivery failed until they
+// are retried
+type Store interface {
+	Save(ctx context.Context, event Event) error
+	// Parked returns up to limit parked events, oldest first
+	Parked(ctx context.Context, limit int) ([]Event, error)
+	Delete(ctx context.Context, eventID uuid.UUID) error
+
+	// Fail stores an event whose delivery failed with lastErr, to be retried
+	// at retryAt, or as dead when retryAt is nil
+	Fail(ctx context.Context, event Event, lastErr error, retryAt *time.Time) error
+	// Due returns up to limit failed events whose retry time has come
+	Due(ctx context.Context, limit int) ([]Event, error)
+	// Waiting counts the parked and failed events of each merchant
+	Waiting(ctx context.Context) (map[uuid.UUID]int, error)
+	// Failures lists failed and dead events, or those of one status, most
+	// recently failed first, with their total count
+	Failures(ctx context.Context, status string, limit, offset int) ([]Delivery, int, error)
+	// Replay schedules a failed or dead event to be retried right away and
+	// returns it as it was before, or returns ErrDeliveryNotFound
+	Replay(ctx context.Context, eventID uuid.UUID) (*Delivery, error)
+}
+
+// Stats is a snapshot of the dispatcher counters. Pending is the queue depth;
+// BusyWorkers of Workers are delivering right now.
+type Stats struct {
+	Enqueued     int64   `json:"enqueued"`
+	Delivered    int64   `json:"delivered"`
+	Failed       int64   `json:"failed"`
+	Dropped      int64   `json:"dropped"`
+	Parked       int64   `json:"parked"`
+	Pending      int     `json:"pending"`
+	ActiveQueues int     `json:"active_queues"`
+	Workers      int     `json:"workers"`
+	BusyWorkers  int64   `json:"busy_workers"`
+	Utilization  float64 `json:"utilization"`
+}
+
+// merchantQueue holds the undelivered events of one merchant. A scheduled
+// queue is on the ready list or being delivered by a worker; only one worker
+// serves a merchant at a time, which keeps its events in order. A held queue
+// stays scheduled but off the ready list until its failed event is retried.
+type merchantQueue struct {
+	events    []Event
+	scheduled bool
+	held      bool
+}
+
+// Dispatcher delivers events through one FIFO queue per merchant, served by a
+// fixed pool of workers. Events for the same merchant are delivered strictly in
+// the order they were enqueued, while workers take turns between merchants so
+// a slow endpoint only delays its own events.
+//
+// Queues are bounded per merchant and in total. Events that do not fit are
+// parked in the store and re-enqueued by RunRetries once there is room; while a
+// merchant has parked events its new events are parked behind them. Events
+// whose attempts all fail are dead-lettered in the store too, see deadLetter,
+// and hold the merchant's later events back the same way until they are
+// retried. Only an event out of retries lets later events pass; when it is
+// replayed it arrives after them.
+type Dispatcher struct {
+	deliverer Deliverer
+	store     Store
+	config    config.WebhookConfig
+	logger    *zap.Logger
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queues  map[uuid.UUID]*merchantQueue
+	ready   []uuid.UUID
+	pending int
+	// parked counts the events of each merchant waiting in the store, parked
+	// or failed
+	parked map[uuid.UUID]int
+	closed bool
+	wg     sync.WaitGroup
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	enqueued    atomic.Int64
+	delivered   atomic.Int64
+	failed      atomic.Int64
+	dropped     atomic.Int64
+	parkedTotal atomic.Int64
+	busy        atomic.Int64
+}
+
+// NewDispatcher creates a dispatcher and starts cfg.Concurrency workers.
+// cfg.QueueSize bounds the pending events per merchant and cfg.MaxPending those
+// of all merchants together. Without a store, events over the bounds are shed.
+// Events the store holds from before a restart are counted first, so new
+// events of their merchants wait behind them.
+func NewDispatcher(deliverer Deliverer, store Store, cfg config.WebhookConfig, logger *zap.Logger) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		deliverer: deliverer,
+		store:     store,
+		config:    cfg,
+		logger:    logger,
+		queues:    make(map[uuid.UUID]*merchantQueue),
+		parked:    make(map[uuid.UUID]int),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	d.cond = sync.NewCond(&d.mu)
+	if store != nil {
+		d.countWaiting()
+	}
+
+	workers := cfg.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	d.config.Concurrency = workers
+	d.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+	return d
+}
+
+// Enqueue appends an event to its merchant's queue. When the queues are full
+// the event is parked in the store; ErrQueueFull is only returned when that is
+// not possible either, so the caller knows the event was shed.
+func (d *Dispatcher) Enqueue(event Event) error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return ErrDispatcherClosed
+	}
+	if d.parked[event.MerchantID] == 0 && d.hasRoom(event.MerchantID) {
+		d.push(event)
+		d.mu.Unlock()
+		d.enqueued.Add(1)
+		return nil
+	}
+	if d.store == nil {
+		d.mu.Unlock()
+		return d.shed(event, nil)
+	}
+	// Counted before saving so later events of the merchant park behind it
+	d.parked[event.MerchantID]++
+	d.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(d.ctx, d.config.DeliveryTimeout)
+	defer cancel()
+	if err := d.store.Save(ctx, event); err != nil {
+		d.mu.Lock()
+		d.unpark(event.MerchantID)
+		d.mu.Unlock()
+		return d.shed(event, err)
+	}
+	d.parkedTotal.Add(1)
+	d.logger.Debug("Webhook queue full, parked event",
+		zap.String("merchant_id", event.MerchantID.String()),
+		zap.String("event_id", event.EventID.String()),
+	)
+	return nil
+}
+
+// countWaiting loads the number of stored events of each merchant into
+// d.parked. Without it a merchant's new events could overtake the ones stored
+// before a restart; if it fails they may.
+func (d *Dispatcher) countWaiting() {
+	ctx, cancel := context.WithTimeout(d.ctx, d.config.DeliveryTimeout)
+	defer cancel()
+	waiting, err := d.store.Waiting(ctx)
+	if err != nil {
+		d.logger.Warn("Failed to count stored webhooks, new events may overtake them", zap.Error(err))
+		return
+	}
+	for merchantID, n := range waiting {
+		d.parked[merchantID] = n
+	}
+}
+
+func (d *Dispatcher) shed(event Event, err error) error {
+	d.dropped.Add(1)
+	d.logger.Warn("Webhook queue full, shedding event",
+		zap.Error(err),
+		zap.String("merchant_id", event.MerchantID.String()),
+		zap.String("event_type", event.Type),
+		zap.String("event_id", event.EventID.String()),
+	)
+	return ErrQueueFull
+}
+
+// hasRoom reports whether the merchant's queue and the dispatcher as a whole can
+// take another event. Callers hold d.mu.
+func (d *Dispatcher) hasRoom(merchantID uuid.UUID) bool {
+	if d.pending >= d.config.MaxPending {
+		return false
+	}
+	queue, ok := d.queues[merchantID]
+	return !ok || len(queue.events) < d.config.QueueSize
+}
+
+// push appends an event and schedules its merchant. Callers hold d.mu.
+func (d *Dispatcher) push(event Event) {
+	queue, ok := d.queues[event.MerchantID]
+	if !ok {
+		queue = &merchantQueue{}
+		d.queues[event.MerchantID] = queue
+	}
+	queue.events = append(queue.events, event)
+	d.pending++
+	if !queue.scheduled {
+		queue.scheduled = true
+		d.ready = append(d.ready, event.MerchantID)
+		d.cond.Signal()
+	}
+}
+
+// resume puts a retried event back at the front of its merchant's held queue
+// and schedules the queue again. Callers hold d.mu.
+func (d *Dispatcher) resume(queue *merchantQueue, event Event) {
+	queue.events = append([]Event{event}, queue.events...)
+	queue.held = false
+	d.pending++
+	d.ready = append(d.ready, event.MerchantID)
+	d.cond.Signal()
+}
+
+// unpark forgets one parked event of the merchant. Callers hold d.mu.
+func (d *Dispatcher) unpark(merchantID uuid.UUID) {
+	if d.parked[merchantID] <= 1 {
+		delete(d.parked, merchantID)
+		return
+	}
+	d.parked[merchantID]--
+}
+
+// work delivers the next event of the first ready merchant, then puts the
+// merchant at the back of the ready list if it has more. When the event is
+// waiting for a retry the merchant's queue is held instead. It returns once
+// the dispatcher is closed and nothing is left to deliver.
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+
+	for {
+		d.mu.Lock()
+		for len(d.ready) == 0 && !d.closed {
+			d.cond.Wait()
+		}
+		if len(d.ready) == 0 {
+			d.mu.Unlock()
+			return
+		}
+		merchantID := d.ready[0]
+		d.ready = d.ready[1:]
+		queue := d.queues[merchantID]
+		event := queue.events[0]
+		queue.events[0] = Event{}
+		queue.events = queue.events[1:]
+		d.pending--
+		d.mu.Unlock()
+
+		d.busy.Add(1)
+		retrying := d.deliver(event)
+		d.busy.Add(-1)
+
+		d.mu.Lock()
+		switch {
+		case len(queue.events) == 0:
+			delete(d.queues, merchantID)
+		case retrying:
+			queue.held = true
+		default:
+			d.ready = append(d.ready, merchantID)
+			d.cond.Signal()
+		}
+		d.mu.Unlock()
+	}
+}
+
+// deliver makes up to cfg.MaxAttempts attempts, each limited to
+// cfg.DeliveryTimeout, waiting cfg.AttemptBackoff before the second and twice
+// as long before every next one. Every attempt only goes to the endpoints the
+// event has not reached yet, so one failing endpoint does not make the others
+// receive it twice. It reports whether the event failed and waits in the
+// store for a retry.
+func (d *Dispatcher) deliver(event Event) bool {
+	backoff := d.config.AttemptBackoff
+	for attempt := 1; ; attempt++ {
+		reached, err := d.attempt(event)
+		event.delivered = append(event.delivered, reached...)
+		if err == nil {
+			d.delivered.Add(1)
+			return false
+		}
+		if attempt >= d.config.MaxAttempts || d.ctx.Err() != nil {
+			d.failed.Add(1)
+			d.logger.Error("Failed to deliver webhook",
+				zap.Error(err),
+				zap.Int("attempts", attempt),
+				zap.Int("delivered_endpoints", len(event.delivered)),
+				zap.String("merchant_id", event.MerchantID.String()),
+				zap.String("event_type", event.Type),
+				zap.String("event_id", event.EventID.String()),
+			)
+			event.attempts += attempt
+			return d.deadLetter(event, err)
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-d.ctx.Done():
+		}
+	}
+}
+
+// deadLetter stores an event whose attempts all failed, with the endpoints it
+// did reach, so it survives the merchant's outage and a restart. RunRetries
+// delivers it to the remaining endpoints after
+// cfg.RedeliveryBackoff, doubling after every further failed round; after
+// cfg.MaxRedeliveries rounds it is kept as dead until replayed. Events cut
+// off by Close are stored the same way. While an event waits for a retry it
+// counts as parked, so the merchant's later events stay behind it; deadLetter
+// reports whether it does.
+func (d *Dispatcher) deadLetter(event Event, lastErr error) bool {
+	if d.store == nil {
+		return false
+	}
+
+	// Rounds of cfg.MaxAttempts attempts that failed, this one included
+	rounds := (event.attempts + d.config.MaxAttempts - 1) / d.config.MaxAttempts
+	var retryAt *time.Time
+	if rounds <= d.config.MaxRedeliveries {
+		at := time.Now().Add(d.config.RedeliveryBackoff << min(rounds-1, 20))
+		retryAt = &at
+	}
+
+	// d.ctx is already cancelled when Close cut the delivery off
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.DeliveryTimeout)
+	defer cancel()
+	if err := d.store.Fail(ctx, event, lastErr, retryAt); err != nil {
+		d.logger.Error("Failed to dead-letter webhook, event lost",
+			zap.Error(err),
+			zap.String("merchant_id", event.MerchantID.String()),
+			zap.String("event_id", event.EventID.String()),
+		)
+		return false
+	}
+	if retryAt == nil {
+		d.logger.Error("Webhook out of retries, kept as dead",
+			zap.Int("attempts", event.attempts),
+			zap.String("merchant_id", event.MerchantID.String()),
+			zap.String("event_id", event.EventID.String()),
+		)
+		return false
+	}
+
+	d.mu.Lock()
+	d.parked[event.MerchantID]++
+	d.mu.Unlock()
+	return true
+}
+
+func (d *Dispatcher) attempt(event Event) ([]uuid.UUID, error) {
+	ctx, cancel := context.WithTimeout(d.ctx, d.config.DeliveryTimeout)
+	defer cancel()
+	return d.deliverer.Deliver(ctx, event)
+}
+
+// RunRetries moves parked events, and failed events that are due, back into
+// the queues every cfg.RetryInterval until ctx is cancelled or the dispatcher
+// is closed. Events stored before a restart are retried too.
+func (d *Dispatcher) RunRetries(ctx context.Context) {
+	if d.store == nil {
+		return
+	}
+	ticker := time.NewTicker(d.config.RetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.retryParked(ctx); err != nil {
+				if errors.Is(err, ErrDispatcherClosed) {
+					return
+				}
+				d.logger.Warn("Failed to retry parked webhooks", zap.Error(err))
+			}
+			if err := d.retryFailed(ctx); err != nil {
+				if errors.Is(err, ErrDispatcherClosed) {
+					return
+				}
+				d.logger.Warn("Failed to retry failed webhooks", zap.Error(err))
+			}
+		}
+	}
+}
+
+// retryParked enqueues parked events, oldest first, for as long as there is
+// room. Once an event of a merchant does not fit, the merchant's later events
+// wait for the next round so they stay in order; they also wait while the
+// merchant has a failed event to retry. An event is removed from the
+// store after it is queued, so a failed removal delivers it twice rather than
+// not at all.
+func (d *Dispatcher) retryParked(ctx context.Context) error {
+	d.mu.Lock()
+	room := d.config.MaxPending - d.pending
+	d.mu.Unlock()
+	if room <= 0 {
+		return nil
+	}
+
+	parked, err := d.store.Parked(ctx, room)
+	if err != nil {
+		return err
+	}
+	return d.requeue(ctx, parked)
+}
+
+// retryFailed enqueues failed events whose retry time has come, like
+// retryParked. Failing again stores them with the next retry time.
+func (d *Dispatcher) retryFailed(ctx context.Context) error {
+	d.mu.Lock()
+	room := d.config.MaxPending - d.pending
+	d.mu.Unlock()
+	if room <= 0 {
+		return nil
+	}
+
+	due, err := d.store.Due(ctx, room)
+	if err != nil {
+		return err
+	}
+	return d.requeue(ctx, due)
+}
+
+// requeue moves stored events into the queues for as long as they have room,
+// see retryParked. A failed event goes back to the front of its merchant's
+// held queue, which always takes it.
+func (d *Dispatcher) requeue(ctx context.Context, stored []Event) error {
+	full := make(map[uuid.UUID]bool)
+	for _, event := range stored {
+		if full[event.MerchantID] {
+			continue
+		}
+
+		d.mu.Lock()
+		if d.closed {
+			d.mu.Unlock()
+			return ErrDispatcherClosed
+		}
+		if queue, ok := d.queues[event.MerchantID]; ok && queue.held {
+			d.resume(queue, event)
+		} else if d.hasRoom(event.MerchantID) {
+			d.push(event)
+		} else {
+			full[event.MerchantID] = true
+			d.mu.Unlock()
+			continue
+		}
+		d.unpark(event.MerchantID)
+		d.mu.Unlock()
+		d.enqueued.Add(1)
+
+		if err := d.store.Delete(ctx, event.EventID); err != nil {
+			d.logger.Warn("Failed to remove retried webhook",
+				zap.Error(err),
+				zap.String("event_id", event.EventID.String()),
+			)
+		}
+	}
+	return nil
+}
+
+// Failures lists dead-lettered events, see Store.Failures
+func (d *Dispatcher) Failures(ctx context.Context, status string, limit, offset int) ([]Delivery, int, error) {
+	if d.store == nil {
+		return []Delivery{}, 0, nil
+	}
+	return d.store.Failures(ctx, status, limit, offset)
+}
+
+// Replay schedules a dead-lettered event for delivery on the next retry round,
+// with one more round of attempts if it was dead. Endpoints that received the
+// event already do not get it again. A dead event holds back the merchant's
+// later events again, like a failed one.
+func (d *Dispatcher) Replay(ctx context.Context, eventID uuid.UUID) error {
+	if d.store == nil {
+		return ErrDeliveryNotFound
+	}
+	replayed, err := d.store.Replay(ctx, eventID)
+	if err != nil {
+		return err
+	}
+	if replayed.Status == DeliveryDead {
+		d.mu.Lock()
+		d.parked[replayed.MerchantID]++
+		d.mu.Unlock()
+	}
+	return nil
+}
+
+// Stats returns a snapshot of the dispatcher counters
+func (d *Dispatcher) Stats() Stats {
+	d.mu.Lock()
+	active := len(d.queues)
+	pending := d.pending
+	d.mu.Unlock()
+
+	busy := d.busy.Load()
+	return Stats{
+		Enqueued:     d.enqueued.Load(),
+		Delivered:    d.delivered.Load(),
+		Failed:       d.failed.Load(),
+		Dropped:      d.dropped.Load(),
+		Parked:       d.parkedTotal.Load(),
+		Pending:      pending,
+		ActiveQueues: active,
+		Workers:      d.config.Concurrency,
+		BusyWorkers:  busy,
+		Utilization:  float64(busy) / float64(d.config.Concurrency),
+	}
+}
+
+// Close stops accepting events and waits for queued events to be delivered.
+// Parked events stay in the store for the next start, and so do the events
+// held behind a failed one. If ctx expires first, in-flight deliveries are
+// cancelled.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	d.cond.Broadcast()
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		d.parkHeld()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		return ctx.Err()
+	}
+}
+
+// parkHeld stores the events of held queues as parked once the workers have
+// stopped, behind the failed event that holds them
+func (d *Dispatcher) parkHeld() {
+	d.mu.Lock()
+	var held []Event
+	for merchantID, queue := range d.queues {
+		if queue.held {
+			held = append(held, queue.events...)
+			d.pending -= len(queue.events)
+			delete(d.queues, merchantID)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, event := range held {
+		ctx, cancel := context.WithTimeout(context.Background(), d.config.DeliveryTimeout)
+		err := d.store.Save(ctx, event)
+		cancel()
+		if err != nil {
+			d.logger.Error("Failed to park held webhook on shutdown, event lost",
+				zap.Error(err),
+				zap.String("merchant_id", event.MerchantID.String()),
+				zap.String("event_id", event.EventID.String()),
+			)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/config"
+	"go.uber.org/zap"
+)
+
+// memStore is a Store in memory that behaves like SQLStore
+type memStore struct {
+	mu      sync.Mutex
+	seq     int
+	records map[uuid.UUID]*memRecord
+}
+
+type memRecord struct {
+	event   Event
+	seq     int
+	status  string
+	retryAt *time.Time
+}
+
+func newMemStore() *memStore {
+	return &memStore{records: make(map[uuid.UUID]*memRecord)}
+}
+
+func (s *memStore) Save(_ context.Context, event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[event.EventID]; !ok {
+		s.seq++
+		s.records[event.EventID] = &memRecord{event: event, seq: s.seq, status: DeliveryParked}
+	}
+	return nil
+}
+
+// sorted returns the records matching keep in delivery order. Callers hold s.mu.
+func (s *memStore) sorted(keep func(*memRecord) bool) []*memRecord {
+	var records []*memRecord
+	for _, r := range s.records {
+		if keep(r) {
+			records = append(records, r)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].seq < records[j].seq })
+	return records
+}
+
+func (s *memStore) Parked(_ context.Context, limit int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failing := make(map[uuid.UUID]bool)
+	for _, r := range s.records {
+		if r.status == DeliveryFailed {
+			failing[r.event.MerchantID] = true
+		}
+	}
+	var events []Event
+	for _, r := range s.sorted(func(r *memRecord) bool { return r.status == DeliveryParked && !failing[r.event.MerchantID] }) {
+		if len(events) == limit {
+			break
+		}
+		events = append(events, r.event)
+	}
+	return events, nil
+}
+
+func (s *memStore) Delete(_ context.Context, eventID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, eventID)
+	return nil
+}
+
+func (s *memStore) Fail(_ context.Context, event Event, _ error, retryAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := DeliveryFailed
+	if retryAt == nil {
+		status = DeliveryDead
+	}
+	r, ok := s.records[event.EventID]
+	if !ok {
+		s.seq++
+		r = &memRecord{seq: s.seq}
+		s.records[event.EventID] = r
+	}
+	r.event, r.status, r.retryAt = event, status, retryAt
+	return nil
+}
+
+func (s *memStore) Due(_ context.Context, limit int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var events []Event
+	for _, r := range s.sorted(func(r *memRecord) bool { return r.status == DeliveryFailed && !r.retryAt.After(now) }) {
+		if len(events) == limit {
+			break
+		}
+		events = append(events, r.event)
+	}
+	return events, nil
+}
+
+func (s *memStore) Waiting(context.Context) (map[uuid.UUID]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	waiting := make(map[uuid.UUID]int)
+	for _, r := range s.records {
+		if r.status == DeliveryParked || r.status == DeliveryFailed {
+			waiting[r.event.MerchantID]++
+		}
+	}
+	return waiting, nil
+}
+
+func (s *memStore) Failures(context.Context, string, int, int) ([]Delivery, int, error) {
+	return nil, 0, errors.New("not implemented")
+}
+
+func (s *memStore) Replay(_ context.Context, eventID uuid.UUID) (*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[eventID]
+	if !ok || r.status == DeliveryParked {
+		return nil, ErrDeliveryNotFound
+	}
+	replayed := &Delivery{EventID: eventID, MerchantID: r.event.MerchantID, Status: r.status}
+	now := time.Now()
+	r.status, r.retryAt = DeliveryFailed, &now
+	return replayed, nil
+}
+
+// count returns the number of stored events with status
+func (s *memStore) count(status string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, r := range s.records {
+		if r.status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// recordingDeliverer records the events it delivers per merchant. fail decides
+// whether an attempt fails; it may block to hold up a delivery.
+type recordingDeliverer struct {
+	mu        sync.Mutex
+	delivered map[uuid.UUID][]int
+	total     int
+	attempts  map[uuid.UUID]int
+	fail      func(event Event, attempt int) bool
+}
+
+func newRecordingDeliverer(fail func(Event, int) bool) *recordingDeliverer {
+	return &recordingDeliverer{
+		delivered: make(map[uuid.UUID][]int),
+		attempts:  make(map[uuid.UUID]int),
+		fail:      fail,
+	}
+}
+
+func (r *recordingDeliverer) Deliver(_ context.Context, event Event) ([]uuid.UUID, error) {
+	r.mu.Lock()
+	r.attempts[event.EventID]++
+	attempt := r.attempts[event.EventID]
+	r.mu.Unlock()
+
+	if r.fail != nil && r.fail(event, attempt) {
+		return nil, errors.New("endpoint unavailable")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.delivered[event.MerchantID] = append(r.delivered[event.MerchantID], event.Data["seq"].(int))
+	r.total++
+	return []uuid.UUID{uuid.Nil}, nil
+}
+
+// sequence returns the sequence numbers delivered to a merchant, in order
+func (r *recordingDeliverer) sequence(merchantID uuid.UUID) []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int(nil), r.delivered[merchantID]...)
+}
+
+func (r *recordingDeliverer) deliveredCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.total
+}
+
+func testWebhookConfig() config.WebhookConfig {
+	return config.WebhookConfig{
+		Concurrency:       4,
+		QueueSize:         100,
+		MaxPending:        1000,
+		RetryInterval:     2 * time.Millisecond,
+		MaxAttempts:       1,
+		AttemptBackoff:    time.Millisecond,
+		RedeliveryBackoff: time.Millisecond,
+		MaxRedeliveries:   5,
+		DeliveryTimeout:   time.Second,
+	}
+}
+
+func testEvent(merchantID uuid.UUID, seq int) Event {
+	return Event{
+		EventID:    uuid.New(),
+		MerchantID: merchantID,
+		Type:       "payment.paid",
+		CreatedAt:  time.Now(),
+		Data:       map[string]interface{}{"seq": seq},
+	}
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func assertSequence(t *testing.T, got []int, n int) {
+	t.Helper()
+	if len(got) != n {
+		t.Fatalf("delivered %d events %v, want %d", len(got), got, n)
+	}
+	for i, seq := range got {
+		if seq != i {
+			t.Fatalf("delivered out of order: %v", got)
+		}
+	}
+}
+
+func closeDispatcher(t *testing.T, d *Dispatcher) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+}
+
+func TestDispatcherHoldsEventsBehindFailedEvent(t *testing.T) {
+	merchantID := uuid.New()
+	release := make(chan struct{})
+	deliverer := newRecordingDeliverer(func(event Event, attempt int) bool {
+		if event.Data["seq"] != 0 || attempt > 1 {
+			return false
+		}
+		<-release
+		return true
+	})
+	store := newMemStore()
+	cfg := testWebhookConfig()
+	cfg.RedeliveryBackoff = 50 * time.Millisecond
+	d := NewDispatcher(deliverer, store, cfg, zap.NewNop())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.RunRetries(ctx)
+
+	// 1 and 2 are queued behind 0 while it is being delivered, 3 and 4 come
+	// after it failed and is waiting in the store
+	for seq := 0; seq < 3; seq++ {
+		if err := d.Enqueue(testEvent(merchantID, seq)); err != nil {
+			t.Fatalf("Enqueue(%d) error = %v", seq, err)
+		}
+	}
+	close(release)
+	waitFor(t, "the first failure", func() bool { return store.count(DeliveryFailed) == 1 })
+	for seq := 3; seq < 5; seq++ {
+		if err := d.Enqueue(testEvent(merchantID, seq)); err != nil {
+			t.Fatalf("Enqueue(%d) error = %v", seq, err)
+		}
+	}
+
+	waitFor(t, "all events", func() bool { return deliverer.deliveredCount() == 5 })
+	assertSequence(t, deliverer.sequence(merchantID), 5)
+	closeDispatcher(t, d)
+}
+
+func TestDispatcherParksHeldEventsOnClose(t *testing.T) {
+	merchantID := uuid.New()
+	release := make(chan struct{})
+	deliverer := newRecordingDeliverer(func(event Event, attempt int) bool {
+		if event.Data["seq"] == 0 {
+			<-release
+			return true
+		}
+		return false
+	})
+	store := newMemStore()
+	d := NewDispatcher(deliverer, store, testWebhookConfig(), zap.NewNop())
+
+	for seq := 0; seq < 3; seq++ {
+		if err := d.Enqueue(testEvent(merchantID, seq)); err != nil {
+			t.Fatalf("Enqueue(%d) error = %v", seq, err)
+		}
+	}
+	close(release)
+	closeDispatcher(t, d)
+
+	if got := deliverer.deliveredCount(); got != 0 {
+		t.Errorf("delivered %d events past the failed one", got)
+	}
+	if got := store.count(DeliveryFailed); got != 1 {
+		t.Errorf("stored %d failed events, want 1", got)
+	}
+	if got := store.count(DeliveryParked); got != 2 {
+		t.Errorf("stored %d parked events, want 2", got)
+	}
+
+	// After a restart the failed event still goes first
+	deliverer = newRecordingDeliverer(nil)
+	d = NewDispatcher(deliverer, store, testWebhookConfig(), zap.NewNop())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.RunRetries(ctx)
+	if err := d.Enqueue(testEvent(merchantID, 3)); err != nil {
+		t.Fatalf("Enqueue(3) error = %v", err)
+	}
+
+	waitFor(t, "all events", func() bool { return deliverer.deliveredCount() == 4 })
+	assertSequence(t, deliverer.sequence(merchantID), 4)
+	closeDispatcher(t, d)
+}
+
+// serialDeliverer counts the deliveries that started while another event of
+// the same merchant was in flight
+type serialDeliverer struct {
+	*recordingDeliverer
+	mu       sync.Mutex
+	inFlight map[uuid.UUID]bool
+	overlaps int
+}
+
+func (s *serialDeliverer) Deliver(ctx context.Context, event Event) ([]uuid.UUID, error) {
+	s.mu.Lock()
+	if s.inFlight[event.MerchantID] {
+		s.overlaps++
+	}
+	s.inFlight[event.MerchantID] = true
+	s.mu.Unlock()
+
+	// Give other workers the chance to overtake
+	time.Sleep(time.Duration(event.Data["seq"].(int)%3) * 100 * time.Microsecond)
+	delivered, err := s.recordingDeliverer.Deliver(ctx, event)
+
+	s.mu.Lock()
+	s.inFlight[event.MerchantID] = false
+	s.mu.Unlock()
+	return delivered, err
+}
+
+func TestDispatcherKeepsMerchantOrderUnderConcurrency(t *testing.T) {
+	tests := []struct {
+		name      string
+		queueSize int
+		failEvery int
+	}{
+		{"queued", 1000, 0},
+		{"parked when queues are full", 2, 0},
+		{"with failing deliveries", 4, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const merchants, events = 8, 40
+			deliverer := &serialDeliverer{
+				recordingDeliverer: newRecordingDeliverer(func(event Event, attempt int) bool {
+					return tt.failEvery > 0 && attempt == 1 && event.Data["seq"].(int)%tt.failEvery == 0
+				}),
+				inFlight: make(map[uuid.UUID]bool),
+			}
+			cfg := testWebhookConfig()
+			cfg.QueueSize = tt.queueSize
+			d := NewDispatcher(deliverer, newMemStore(), cfg, zap.NewNop())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go d.RunRetries(ctx)
+
+			merchantIDs := make([]uuid.UUID, merchants)
+			var wg sync.WaitGroup
+			for i := range merchantIDs {
+				merchantIDs[i] = uuid.New()
+				wg.Add(1)
+				go func(merchantID uuid.UUID) {
+					defer wg.Done()
+					for seq := 0; seq < events; seq++ {
+						if err := d.Enqueue(testEvent(merchantID, seq)); err != nil {
+							t.Errorf("Enqueue(%d) error = %v", seq, err)
+						}
+					}
+				}(merchantIDs[i])
+			}
+			wg.Wait()
+
+			waitFor(t, "all events", func() bool { return deliverer.deliveredCount() == merchants*events })
+			for _, merchantID := range merchantIDs {
+				assertSequence(t, deliverer.sequence(merchantID), events)
+			}
+			deliverer.mu.Lock()
+			overlaps := deliverer.overlaps
+			deliverer.mu.Unlock()
+			if overlaps > 0 {
+				t.Errorf("delivered %d events while another event of the merchant was in flight", overlaps)
+			}
+			closeDispatcher(t, d)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package webhooks
+
+import (
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// Endpoint is one URL a merchant receives webhooks on
+type Endpoint struct {
+	// ID is uuid.Nil for the merchant's own webhook_url
+	ID      uuid.UUID
+	URL     string
+	Secrets Secrets
+	// Events limits the endpoint to these event types; empty means all
+	Events []string
+}
+
+// Subscribed reports whether the endpoint wants events of the given type
+func (e Endpoint) Subscribed(eventType string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, event := range e.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// EndpointsFor returns the endpoints of a merchant that can be delivered to:
+// the legacy webhook_url, which receives every event, followed by the active
+// entries of merchant_webhooks. Endpoints without a URL or secret are left out.
+func EndpointsFor(merchant *models.Merchant, hooks []models.MerchantWebhook) []Endpoint {
+	var endpoints []Endpoint
+	if merchant.WebhookURL != nil && *merchant.WebhookURL != "" {
+		if secrets := SecretsFor(merchant); secrets.Current != "" {
+			endpoints = append(endpoints, Endpoint{URL: *merchant.WebhookURL, Secrets: secrets})
+		}
+	}
+	for _, hook := range hooks {
+		if !hook.IsActive || hook.URL == "" || hook.Secret == "" {
+			continue
+		}
+		secrets := Secrets{Current: hook.Secret}
+		if hook.SecretPrevious != nil {
+			secrets.Previous = *hook.SecretPrevious
+			secrets.PreviousExpiresAt = hook.SecretPreviousExpiresAt
+		}
+		endpoints = append(endpoints, Endpoint{
+			ID:      hook.WebhookID,
+			URL:     hook.URL,
+			Secrets: secrets,
+			Events:  hook.Events,
+		})
+	}
+	return endpoints
+}
@@ -0,0 +1,74 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/events"
+)
+
+// Subscribe enqueues a merchant webhook for each payment and dispute event
+// published on bus. The events reach Enqueue one at a time in the order they
+// were published, so the per-merchant order of the queues starts at the
+// publisher: a session's payment.paid goes out before its payment.refunded.
+func (d *Dispatcher) Subscribe(bus *events.Bus) {
+	bus.SubscribeOrdered(func(ctx context.Context, event events.Event) error {
+		webhook, ok := webhookEvent(event)
+		if !ok {
+			return fmt.Errorf("no webhook for event %s", event.EventName())
+		}
+		return d.Enqueue(webhook)
+	}, events.NamePaymentPaid, events.NamePaymentRefunded, events.NameDisputeStatusChanged)
+}
+
+// webhookEvent returns the webhook sent for a domain event, or false for
+// events without one
+func webhookEvent(event events.Event) (Event, bool) {
+	switch e := event.(type) {
+	case events.PaymentPaid:
+		return Event{
+			EventID:    uuid.New(),
+			MerchantID: e.MerchantID,
+			Type:       e.EventName(),
+			CreatedAt:  e.PaidAt,
+			Data: map[string]interface{}{
+				"session_id":        e.SessionID,
+				"payment_reference": e.PaymentReference,
+				"amount_cents":      e.AmountCents,
+				"currency":          e.Currency,
+				"paid_at":           e.PaidAt,
+				"access_expires_at": e.AccessExpiresAt,
+			},
+		}, true
+	case events.PaymentRefunded:
+		return Event{
+			EventID:    uuid.New(),
+			MerchantID: e.MerchantID,
+			Type:       e.EventName(),
+			CreatedAt:  e.RefundedAt,
+			Data: map[string]interface{}{
+				"session_id":        e.SessionID,
+				"payment_reference": e.PaymentReference,
+				"amount_cents":      e.AmountCents,
+				"currency":          e.Currency,
+				"reason":            e.Reason,
+				"refunded_at":       e.RefundedAt,
+			},
+		}, true
+	case events.DisputeStatusChanged:
+		return Event{
+			EventID:    uuid.New(),
+			MerchantID: e.MerchantID,
+			Type:       e.EventName(),
+			CreatedAt:  e.ChangedAt,
+			Data: map[string]interface{}{
+				"dispute_id":  e.DisputeID,
+				"session_id":  e.SessionID,
+				"from_status": e.FromStatus,
+				"to_status":   e.ToStatus,
+			},
+		}, true
+	}
+	return Event{}, false
+}
@@ -0,0 +1,80 @@
+package webhooks
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/events"
+	"go.uber.org/zap"
+)
+
+// typeRecorder records the type and session of the webhooks it delivers per
+// merchant
+type typeRecorder struct {
+	mu        sync.Mutex
+	delivered map[uuid.UUID][]string
+	total     int
+}
+
+func (r *typeRecorder) Deliver(_ context.Context, event Event) ([]uuid.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.delivered[event.MerchantID] = append(r.delivered[event.MerchantID], event.Type+" "+event.Data["session_id"].(uuid.UUID).String())
+	r.total++
+	return []uuid.UUID{uuid.Nil}, nil
+}
+
+func TestSubscribeKeepsPublishOrder(t *testing.T) {
+	const merchants, sessions = 3, 300
+	recorder := &typeRecorder{delivered: make(map[uuid.UUID][]string)}
+	cfg := testWebhookConfig()
+	cfg.QueueSize = 2 * sessions
+	d := NewDispatcher(recorder, newMemStore(), cfg, zap.NewNop())
+	bus := events.NewBus(zap.NewNop())
+	d.Subscribe(bus)
+
+	merchantIDs := make([]uuid.UUID, merchants)
+	for i := range merchantIDs {
+		merchantIDs[i] = uuid.New()
+	}
+	want := make(map[uuid.UUID][]string)
+	now := time.Now()
+	for i := 0; i < sessions; i++ {
+		merchantID := merchantIDs[i%merchants]
+		sessionID := uuid.New()
+		// Refunded right after it was paid, as an admin refund can be
+		bus.Publish(events.PaymentPaid{SessionID: sessionID, MerchantID: merchantID, PaidAt: now})
+		bus.Publish(events.PaymentRefunded{SessionID: sessionID, MerchantID: merchantID, RefundedAt: now})
+		want[merchantID] = append(want[merchantID],
+			events.NamePaymentPaid+" "+sessionID.String(),
+			events.NamePaymentRefunded+" "+sessionID.String(),
+		)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := bus.Wait(ctx); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	waitFor(t, "all webhooks", func() bool {
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		return recorder.total == 2*sessions
+	})
+	closeDispatcher(t, d)
+
+	for _, merchantID := range merchantIDs {
+		got := recorder.delivered[merchantID]
+		if len(got) != len(want[merchantID]) {
+			t.Fatalf("merchant got %d webhooks, want %d", len(got), len(want[merchantID]))
+		}
+		for i := range got {
+			if got[i] != want[merchantID][i] {
+				t.Fatalf("merchant got webhooks out of publish order:\n%v\nwant\n%v", got, want[merchantID])
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// MerchantLookup loads the merchant an event is delivered to and its
+// additional webhook endpoints
+type MerchantLookup interface {
+	GetMerchantByID(merchantID uuid.UUID) (*models.Merchant, error)
+	ListWebhooks(ctx context.Context, merchantID uuid.UUID) ([]models.MerchantWebhook, error)
+}
+
+// HTTPDeliverer posts events as signed JSON to every webhook endpoint of the
+// merchant that subscribes to the event
+type HTTPDeliverer struct {
+	client    *http.Client
+	merchants MerchantLookup
+}
+
+// NewHTTPDeliverer creates a deliverer. Timeouts come from the context the
+// dispatcher passes to Deliver, so the client itself has none.
+func NewHTTPDeliverer(merchants MerchantLookup) *HTTPDeliverer {
+	return &HTTPDeliverer{
+		client:    &http.Client{},
+		merchants: merchants,
+	}
+}
+
+// Deliver implements Deliverer. The event is posted to all matching endpoints
+// it has not reached yet at once, each signed with its own secret, so a slow
+// endpoint does not use up the time of the others. Because the dispatcher only
+// moves on once Deliver returns, every endpoint still receives the merchant's
+// events in order. Merchants without endpoints are skipped silently; any
+// non-2xx response counts as a failed delivery for that endpoint.
+func (d *HTTPDeliverer) Deliver(ctx context.Context, event Event) ([]uuid.UUID, error) {
+	merchant, err := d.merchants.GetMerchantByID(event.MerchantID)
+	if err != nil {
+		return nil, err
+	}
+	hooks, err := d.merchants.ListWebhooks(ctx, event.MerchantID)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode webhook: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var delivered []uuid.UUID
+	var errs []error
+	for _, endpoint := range EndpointsFor(merchant, hooks) {
+		if !endpoint.Subscribed(event.Type) || event.DeliveredTo(endpoint.ID) {
+			continue
+		}
+		wg.Add(1)
+		go func(endpoint Endpoint) {
+			defer wg.Done()
+			err := d.post(ctx, endpoint, body)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", endpoint.URL, err))
+				return
+			}
+			delivered = append(delivered, endpoint.ID)
+		}(endpoint)
+	}
+	wg.Wait()
+
+	return delivered, errors.Join(errs...)
+}
+
+func (d *HTTPDeliverer) post(ctx context.Context, endpoint Endpoint, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(endpoint.Secrets.Current, time.Now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook endpoint returned %s", resp.Status)
+	}
+	return nil
+}
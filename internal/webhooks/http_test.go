@@ -0,0 +1,81 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// staticMerchants serves one merchant and its webhooks
+type staticMerchants struct {
+	merchant *models.Merchant
+	hooks    []models.MerchantWebhook
+}
+
+func (m staticMerchants) GetMerchantByID(uuid.UUID) (*models.Merchant, error) {
+	return m.merchant, nil
+}
+
+func (m staticMerchants) ListWebhooks(context.Context, uuid.UUID) ([]models.MerchantWebhook, error) {
+	return m.hooks, nil
+}
+
+// countingEndpoint answers with status and counts the requests it gets
+func countingEndpoint(t *testing.T, status *atomic.Int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestHTTPDelivererRetriesOnlyFailedEndpoints(t *testing.T) {
+	var okStatus, failingStatus atomic.Int32
+	okStatus.Store(http.StatusOK)
+	failingStatus.Store(http.StatusServiceUnavailable)
+	okServer, okRequests := countingEndpoint(t, &okStatus)
+	failingServer, failingRequests := countingEndpoint(t, &failingStatus)
+
+	url, secret := okServer.URL, "merchant-secret"
+	hookID := uuid.New()
+	deliverer := NewHTTPDeliverer(staticMerchants{
+		merchant: &models.Merchant{WebhookURL: &url, WebhookSecret: &secret},
+		hooks: []models.MerchantWebhook{
+			{WebhookID: hookID, URL: failingServer.URL, Secret: "hook-secret", IsActive: true},
+		},
+	})
+	event := Event{EventID: uuid.New(), MerchantID: uuid.New(), Type: "payment.paid"}
+
+	delivered, err := deliverer.Deliver(context.Background(), event)
+	if err == nil {
+		t.Fatal("Deliver() succeeded with a failing endpoint")
+	}
+	if len(delivered) != 1 || delivered[0] != uuid.Nil {
+		t.Fatalf("Deliver() delivered to %v, want only the webhook_url", delivered)
+	}
+	event.delivered = append(event.delivered, delivered...)
+
+	// The retry skips the endpoint that already has the event
+	failingStatus.Store(http.StatusNoContent)
+	delivered, err = deliverer.Deliver(context.Background(), event)
+	if err != nil {
+		t.Fatalf("retried Deliver() error = %v", err)
+	}
+	if len(delivered) != 1 || delivered[0] != hookID {
+		t.Fatalf("retried Deliver() delivered to %v, want only %s", delivered, hookID)
+	}
+	if got := okRequests.Load(); got != 1 {
+		t.Errorf("working endpoint got %d requests, want 1", got)
+	}
+	if got := failingRequests.Load(); got != 2 {
+		t.Errorf("failing endpoint got %d requests, want 2", got)
+	}
+}
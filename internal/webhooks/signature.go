@@ -0,0 +1,131 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mh74hf/micro-payments/internal/models"
+)
+
+// SignatureHeader carries the signature of a webhook request body. It is not
+// a bare X-Signature: the value is timestamped (t=...,v1=...) so receivers can
+// reject replays, and the name says which scheme they are verifying.
+const SignatureHeader = "X-Webhook-Signature"
+
+// SignatureTolerance is how far a signature's timestamp may be from now before
+// Verify rejects it as a replay
+const SignatureTolerance = 5 * time.Minute
+
+var (
+	// ErrMissingSignature is returned when the signature header is empty or malformed
+	ErrMissingSignature = errors.New("missing webhook signature")
+	// ErrInvalidSignature is returned when no accepted secret produced the signature
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrStaleSignature is returned when the signature timestamp is outside SignatureTolerance
+	ErrStaleSignature = errors.New("stale webhook signature")
+)
+
+// Secrets are the webhook secrets of a merchant. During a rotation the previous
+// secret keeps verifying until PreviousExpiresAt, so deliveries signed just
+// before the rotation are not rejected by the merchant.
+type Secrets struct {
+	Current           string
+	Previous          string
+	PreviousExpiresAt *time.Time
+}
+
+// SecretsFor returns the webhook secrets stored on a merchant
+func SecretsFor(merchant *models.Merchant) Secrets {
+	var s Secrets
+	if merchant.WebhookSecret != nil {
+		s.Current = *merchant.WebhookSecret
+	}
+	if merchant.WebhookSecretPrevious != nil {
+		s.Previous = *merchant.WebhookSecretPrevious
+		s.PreviousExpiresAt = merchant.WebhookSecretPreviousExpiresAt
+	}
+	return s
+}
+
+// accepted returns the secrets a signature may be made with at now
+func (s Secrets) accepted(now time.Time) []string {
+	var secrets []string
+	if s.Current != "" {
+		secrets = append(secrets, s.Current)
+	}
+	if s.Previous != "" && s.PreviousExpiresAt != nil && now.Before(*s.PreviousExpiresAt) {
+		secrets = append(secrets, s.Previous)
+	}
+	return secrets
+}
+
+// Sign returns the signature header value for body, in the form
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">". Deliveries are
+// always signed with the current secret.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac(secret, t, body))
+}
+
+// Verify checks a signature header against body using the current secret or,
+// while the overlap window is open, the previous one. Signatures timestamped
+// more than SignatureTolerance from now are rejected so a captured delivery
+// cannot be replayed later.
+func Verify(header string, body []byte, secrets Secrets, now time.Time) error {
+	t, signature, err := parseSignature(header)
+	if err != nil {
+		return err
+	}
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMissingSignature, err)
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > SignatureTolerance || age < -SignatureTolerance {
+		return ErrStaleSignature
+	}
+
+	for _, secret := range secrets.accepted(now) {
+		if hmac.Equal(signature, mac(secret, t, body)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func mac(secret, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+func parseSignature(header string) (string, []byte, error) {
+	var t, v1 string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			v1 = value
+		}
+	}
+	if t == "" || v1 == "" {
+		return "", nil, ErrMissingSignature
+	}
+	signature, err := hex.DecodeString(v1)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrMissingSignature, err)
+	}
+	return t, signature, nil
+}
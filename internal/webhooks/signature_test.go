@@ -0,0 +1,58 @@
+package webhooks
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"type":"payment.paid"}`)
+	overlapEnds := now.Add(time.Hour)
+	rotated := Secrets{Current: "new-secret", Previous: "old-secret", PreviousExpiresAt: &overlapEnds}
+
+	tests := []struct {
+		name    string
+		header  string
+		body    []byte
+		secrets Secrets
+		at      time.Time
+		want    error
+	}{
+		{"current secret", Sign("new-secret", now, body), body, rotated, now, nil},
+		{"previous secret during the overlap", Sign("old-secret", now.Add(59*time.Minute), body), body, rotated, now.Add(59 * time.Minute), nil},
+		{"previous secret after the overlap", Sign("old-secret", overlapEnds, body), body, rotated, overlapEnds, ErrInvalidSignature},
+		{"previous secret without an expiry", Sign("old-secret", now, body), body, Secrets{Current: "new-secret", Previous: "old-secret"}, now, ErrInvalidSignature},
+		{"unknown secret", Sign("other-secret", now, body), body, rotated, now, ErrInvalidSignature},
+		{"no secrets", Sign("new-secret", now, body), body, Secrets{}, now, ErrInvalidSignature},
+		{"tampered body", Sign("new-secret", now, body), []byte(`{"type":"payment.refunded"}`), rotated, now, ErrInvalidSignature},
+		{"timestamp changed", "t=" + strconv.FormatInt(now.Unix()+1, 10) + Sign("new-secret", now, body)[len("t=1700000000"):], body, rotated, now, ErrInvalidSignature},
+		{"within the replay window", Sign("new-secret", now, body), body, rotated, now.Add(SignatureTolerance), nil},
+		{"replayed after the window", Sign("new-secret", now, body), body, rotated, now.Add(SignatureTolerance + time.Second), ErrStaleSignature},
+		{"timestamp in the future", Sign("new-secret", now.Add(SignatureTolerance+time.Second), body), body, rotated, now, ErrStaleSignature},
+		{"empty header", "", body, rotated, now, ErrMissingSignature},
+		{"no timestamp", "v1=abcd", body, rotated, now, ErrMissingSignature},
+		{"timestamp not a number", "t=yesterday,v1=abcd", body, rotated, now, ErrMissingSignature},
+		{"signature not hex", "t=1700000000,v1=xyz", body, rotated, now, ErrMissingSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.header, tt.body, tt.secrets, tt.at); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignFormat(t *testing.T) {
+	got := Sign("secret", time.Unix(1700000000, 0), []byte("{}"))
+	t0, signature, err := parseSignature(got)
+	if err != nil {
+		t.Fatalf("parseSignature(%q) error = %v", got, err)
+	}
+	if t0 != "1700000000" || len(signature) != 32 {
+		t.Errorf("Sign() = %q, want a t=1700000000 header with a 32 byte HMAC-SHA256", got)
+	}
+}
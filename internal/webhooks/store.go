@@ -0,0 +1,265 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// SQLStore parks and dead-letters events in the webhook_deliveries table
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store on db
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// deliveryColumns are the event columns scanned by scanEvent
+const deliveryColumns = `event_id, merchant_id, event_type, data, created_at, attempts, delivered_endpoints`
+
+func scanEvent(rows *sql.Rows) (Event, error) {
+	var event Event
+	var data []byte
+	var delivered []string
+	err := rows.Scan(&event.EventID, &event.MerchantID, &event.Type, &data, &event.CreatedAt, &event.attempts, pq.Array(&delivered))
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to scan stored webhook: %w", err)
+	}
+	if err := json.Unmarshal(data, &event.Data); err != nil {
+		return Event{}, fmt.Errorf("failed to decode stored webhook %s: %w", event.EventID, err)
+	}
+	if event.delivered, err = parseEndpointIDs(delivered); err != nil {
+		return Event{}, fmt.Errorf("failed to decode stored webhook %s: %w", event.EventID, err)
+	}
+	return event, nil
+}
+
+// endpointIDs and parseEndpointIDs convert the delivered_endpoints column,
+// which lib/pq handles as text
+func endpointIDs(ids []uuid.UUID) []string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = id.String()
+	}
+	return strs
+}
+
+func parseEndpointIDs(strs []string) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, len(strs))
+	for i, s := range strs {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// Save implements Store. Saving an event twice keeps the first copy.
+func (s *SQLStore) Save(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encode parked webhook: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (event_id, merchant_id, event_type, data, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (event_id) DO NOTHING`,
+		event.EventID, event.MerchantID, event.Type, data, event.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to park webhook: %w", err)
+	}
+	return nil
+}
+
+// Parked implements Store. Events of merchants with a failed event are left
+// out: they are delivered after it.
+func (s *SQLStore) Parked(ctx context.Context, limit int) ([]Event, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries w
+		WHERE status = $1
+		  AND NOT EXISTS (
+			SELECT 1 FROM webhook_deliveries f
+			WHERE f.merchant_id = w.merchant_id AND f.status = $3
+		  )
+		ORDER BY delivery_id
+		LIMIT $2`, DeliveryParked, limit, DeliveryFailed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load parked webhooks: %w", err)
+	}
+	return collectEvents(rows)
+}
+
+// Fail implements Store. An event failing again overwrites its earlier record,
+// including the endpoints it reached.
+func (s *SQLStore) Fail(ctx context.Context, event Event, lastErr error, retryAt *time.Time) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encode failed webhook: %w", err)
+	}
+	status := DeliveryFailed
+	if retryAt == nil {
+		status = DeliveryDead
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (
+			event_id, merchant_id, event_type, data, created_at,
+			status, attempts, last_error, next_retry_at, failed_at, delivered_endpoints
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), $10::uuid[])
+		ON CONFLICT (event_id) DO UPDATE
+		SET status = EXCLUDED.status, attempts = EXCLUDED.attempts, last_error = EXCLUDED.last_error,
+		    next_retry_at = EXCLUDED.next_retry_at, failed_at = EXCLUDED.failed_at,
+		    delivered_endpoints = EXCLUDED.delivered_endpoints`,
+		event.EventID, event.MerchantID, event.Type, data, event.CreatedAt,
+		status, event.attempts, lastErr.Error(), retryAt, pq.Array(endpointIDs(event.delivered)),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store failed webhook: %w", err)
+	}
+	return nil
+}
+
+// Due implements Store
+func (s *SQLStore) Due(ctx context.Context, limit int) ([]Event, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries
+		WHERE status = $1 AND next_retry_at <= NOW()
+		ORDER BY next_retry_at, delivery_id
+		LIMIT $2`, DeliveryFailed, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load failed webhooks: %w", err)
+	}
+	return collectEvents(rows)
+}
+
+// Waiting implements Store
+func (s *SQLStore) Waiting(ctx context.Context) (map[uuid.UUID]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT merchant_id, COUNT(*)
+		FROM webhook_deliveries
+		WHERE status IN ($1, $2)
+		GROUP BY merchant_id`, DeliveryParked, DeliveryFailed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count stored webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	waiting := make(map[uuid.UUID]int)
+	for rows.Next() {
+		var merchantID uuid.UUID
+		var n int
+		if err := rows.Scan(&merchantID, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan stored webhook count: %w", err)
+		}
+		waiting[merchantID] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count stored webhooks: %w", err)
+	}
+	return waiting, nil
+}
+
+// collectEvents scans and closes rows of deliveryColumns
+func collectEvents(rows *sql.Rows) ([]Event, error) {
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load stored webhooks: %w", err)
+	}
+	return events, nil
+}
+
+// Failures implements Store
+func (s *SQLStore) Failures(ctx context.Context, status string, limit, offset int) ([]Delivery, int, error) {
+	statuses := []string{DeliveryFailed, DeliveryDead}
+	if status != "" {
+		statuses = []string{status}
+	}
+
+	var total int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM webhook_deliveries WHERE status = ANY($1)`, pq.Array(statuses),
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count failed webhooks: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT event_id, merchant_id, event_type, status, attempts, delivered_endpoints,
+		       last_error, next_retry_at, created_at, failed_at
+		FROM webhook_deliveries
+		WHERE status = ANY($1)
+		ORDER BY failed_at DESC, delivery_id DESC
+		LIMIT $2 OFFSET $3`, pq.Array(statuses), limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list failed webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var d Delivery
+		var delivered []string
+		err := rows.Scan(&d.EventID, &d.MerchantID, &d.EventType, &d.Status, &d.Attempts, pq.Array(&delivered),
+			&d.LastError, &d.NextRetryAt, &d.CreatedAt, &d.FailedAt)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan failed webhook: %w", err)
+		}
+		if d.DeliveredEndpoints, err = parseEndpointIDs(delivered); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan failed webhook: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list failed webhooks: %w", err)
+	}
+	return deliveries, total, nil
+}
+
+// Replay implements Store. The self-join reads the row as it was before the
+// update.
+func (s *SQLStore) Replay(ctx context.Context, eventID uuid.UUID) (*Delivery, error) {
+	var d Delivery
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE webhook_deliveries w
+		SET status = $1, next_retry_at = NOW()
+		FROM webhook_deliveries old
+		WHERE old.delivery_id = w.delivery_id AND w.event_id = $2 AND w.status IN ($1, $3)
+		RETURNING w.event_id, w.merchant_id, w.event_type, old.status, w.attempts`,
+		DeliveryFailed, eventID, DeliveryDead,
+	).Scan(&d.EventID, &d.MerchantID, &d.EventType, &d.Status, &d.Attempts)
+	if err == sql.ErrNoRows {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay webhook: %w", err)
+	}
+	return &d, nil
+}
+
+// Delete implements Store
+func (s *SQLStore) Delete(ctx context.Context, eventID uuid.UUID) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE event_id = $1`, eventID); err != nil {
+		return fmt.Errorf("failed to remove stored webhook: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+-- Drop the tables in reverse dependency order; indexes and constraints go
+-- with them. The extensions stay, other database objects may use them.
+DROP TABLE IF EXISTS system_config;
+DROP TABLE IF EXISTS audit_logs;
+DROP TABLE IF EXISTS bandwidth_usage;
+DROP TABLE IF EXISTS bank_connections;
+DROP TABLE IF EXISTS dispute_notes;
+DROP TABLE IF EXISTS disputes;
+DROP TABLE IF EXISTS content_access;
+DROP TABLE IF EXISTS bank_transactions;
+DROP TABLE IF EXISTS payment_sessions;
+DROP TABLE IF EXISTS content;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS merchant_webhooks;
+DROP TABLE IF EXISTS merchants;
+
+DROP TYPE IF EXISTS log_severity;
+DROP TYPE IF EXISTS dispute_status;
+DROP TYPE IF EXISTS sync_status_enum;
+DROP TYPE IF EXISTS transaction_status;
+DROP TYPE IF EXISTS payment_status;
+DROP TYPE IF EXISTS content_type_enum;
+DROP TYPE IF EXISTS merchant_status;
@@ -1,6 +1,6 @@
 -- Create database and extensions
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
-CREATE EXTENSION IF NOT EXISTS "pg_crypto";
+CREATE EXTENSION IF NOT EXISTS "pgcrypto";
 
 -- Create custom types
 CREATE TYPE merchant_status AS ENUM (
@@ -32,7 +32,8 @@ CREATE TYPE transaction_status AS ENUM (
     'matched',
     'processed',
     'ignored',
-    'disputed'
+    'disputed',
+    'returned'
 );
 
 CREATE TYPE sync_status_enum AS ENUM (
@@ -42,6 +43,14 @@ CREATE TYPE sync_status_enum AS ENUM (
     'rate_limited'
 );
 
+CREATE TYPE dispute_status AS ENUM (
+    'open',
+    'under_review',
+    'resolved',
+    'lost',
+    'won'
+);
+
 CREATE TYPE log_severity AS ENUM ('debug', 'info', 'warning', 'error', 'critical');
 
 -- Create tables
@@ -53,8 +62,14 @@ CREATE TABLE merchants (
     bank_account_iban VARCHAR(34) NOT NULL,
     bank_account_bic VARCHAR(11),
     webhook_url VARCHAR(500),
+    backend_url VARCHAR(500),
     webhook_secret VARCHAR(255),
+    webhook_secret_previous VARCHAR(255),
+    webhook_secret_previous_expires_at TIMESTAMPTZ,
     api_key VARCHAR(255) UNIQUE NOT NULL,
+    -- The key replaced by the last rotation, valid until its expiry
+    api_key_previous VARCHAR(255) UNIQUE,
+    api_key_previous_expires_at TIMESTAMPTZ,
     status merchant_status DEFAULT 'pending',
     pricing_tier VARCHAR(50) DEFAULT 'basic',
     created_at TIMESTAMPTZ DEFAULT NOW(),
@@ -64,6 +79,39 @@ CREATE TABLE merchants (
     metadata JSONB DEFAULT '{}'
 );
 
+-- Webhook endpoints beyond the merchant's own webhook_url; an empty events
+-- list subscribes to every event
+CREATE TABLE merchant_webhooks (
+    webhook_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID NOT NULL REFERENCES merchants(merchant_id) ON DELETE CASCADE,
+    url VARCHAR(500) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    secret_previous VARCHAR(255),
+    secret_previous_expires_at TIMESTAMPTZ,
+    events TEXT[] NOT NULL DEFAULT '{}',
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Webhook events parked while the dispatcher queues are full, and events
+-- whose delivery failed: "failed" ones are retried at next_retry_at, "dead"
+-- ones ran out of retries and wait for an admin to replay them
+CREATE TABLE webhook_deliveries (
+    delivery_id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL UNIQUE,
+    merchant_id UUID NOT NULL REFERENCES merchants(merchant_id) ON DELETE CASCADE,
+    event_type VARCHAR(100) NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL,
+    parked_at TIMESTAMPTZ DEFAULT NOW(),
+    status VARCHAR(20) NOT NULL DEFAULT 'parked',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_retry_at TIMESTAMPTZ,
+    failed_at TIMESTAMPTZ
+);
+
 CREATE TABLE content (
     content_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     merchant_id UUID REFERENCES merchants(merchant_id) ON DELETE CASCADE,
@@ -88,8 +136,11 @@ CREATE TABLE payment_sessions (
     content_id UUID REFERENCES content(content_id) ON DELETE CASCADE,
     user_identifier VARCHAR(255),
     amount_cents INTEGER NOT NULL,
+    platform_fee_cents INTEGER NOT NULL DEFAULT 0,
+    vat_cents INTEGER NOT NULL DEFAULT 0,
+    net_cents INTEGER NOT NULL DEFAULT 0,
     currency VARCHAR(3) DEFAULT 'EUR',
-    payment_reference VARCHAR(35) UNIQUE NOT NULL,
+    payment_reference VARCHAR(35) NOT NULL,
     qr_code_data TEXT NOT NULL,
     status payment_status DEFAULT 'pending',
     expires_at TIMESTAMPTZ NOT NULL,
@@ -97,9 +148,14 @@ CREATE TABLE payment_sessions (
     paid_at TIMESTAMPTZ,
     access_granted_at TIMESTAMPTZ,
     access_expires_at TIMESTAMPTZ,
+    refunded_at TIMESTAMPTZ,
     user_agent TEXT,
     ip_address INET,
-    metadata JSONB DEFAULT '{}'
+    metadata JSONB DEFAULT '{}',
+    -- The content price when it was converted into the account's currency
+    display_amount_cents INTEGER,
+    display_currency VARCHAR(3),
+    exchange_rate NUMERIC(20, 10)
 );
 
 CREATE TABLE bank_transactions (
@@ -118,6 +174,7 @@ CREATE TABLE bank_transactions (
     status transaction_status DEFAULT 'detected',
     processed_at TIMESTAMPTZ,
     raw_data JSONB,
+    match_audit JSONB,
     created_at TIMESTAMPTZ DEFAULT NOW()
 );
 
@@ -133,7 +190,33 @@ CREATE TABLE content_access (
     access_count INTEGER DEFAULT 0,
     ip_address INET,
     user_agent TEXT,
-    is_active BOOLEAN DEFAULT TRUE
+    is_active BOOLEAN DEFAULT TRUE,
+    -- Free first access: no session, never counted as revenue
+    is_free_trial BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE disputes (
+    dispute_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    merchant_id UUID REFERENCES merchants(merchant_id) ON DELETE CASCADE,
+    session_id UUID REFERENCES payment_sessions(session_id) ON DELETE CASCADE,
+    transaction_id UUID REFERENCES bank_transactions(transaction_id),
+    status dispute_status DEFAULT 'open',
+    reason TEXT NOT NULL,
+    freeze_access BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    closed_at TIMESTAMPTZ
+);
+
+CREATE TABLE dispute_notes (
+    note_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    dispute_id UUID REFERENCES disputes(dispute_id) ON DELETE CASCADE,
+    author VARCHAR(255),
+    note TEXT NOT NULL,
+    evidence_url VARCHAR(1000),
+    from_status dispute_status,
+    to_status dispute_status,
+    created_at TIMESTAMPTZ DEFAULT NOW()
 );
 
 CREATE TABLE bank_connections (
@@ -156,6 +239,18 @@ CREATE TABLE bank_connections (
     updated_at TIMESTAMPTZ DEFAULT NOW()
 );
 
+-- Proxied body bytes per merchant, content and month; content_id is the nil
+-- UUID for paths that are not registered as content
+CREATE TABLE bandwidth_usage (
+    merchant_id UUID NOT NULL REFERENCES merchants(merchant_id) ON DELETE CASCADE,
+    content_id UUID NOT NULL,
+    month DATE NOT NULL,
+    bytes_in BIGINT NOT NULL DEFAULT 0,
+    bytes_out BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (merchant_id, content_id, month)
+);
+
 CREATE TABLE audit_logs (
     log_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     merchant_id UUID REFERENCES merchants(merchant_id),
@@ -178,14 +273,31 @@ CREATE TABLE system_config (
 );
 
 -- Create indexes for performance
+-- References are namespaced per merchant; reconciliation also matches the creditor IBAN
+CREATE UNIQUE INDEX idx_payment_sessions_merchant_reference ON payment_sessions(merchant_id, payment_reference);
 CREATE INDEX idx_payment_sessions_reference ON payment_sessions(payment_reference);
 CREATE INDEX idx_payment_sessions_status_expires ON payment_sessions(status, expires_at);
+-- Domains resolve merchants, so they are unique regardless of case or a trailing dot
+CREATE INDEX idx_merchants_domain ON merchants(domain);
+CREATE UNIQUE INDEX idx_merchants_domain_normalized ON merchants(LOWER(TRIM(TRAILING '.' FROM domain)));
+CREATE INDEX idx_merchant_webhooks_merchant ON merchant_webhooks(merchant_id);
+CREATE INDEX idx_webhook_deliveries_retry ON webhook_deliveries(status, next_retry_at);
 CREATE INDEX idx_content_merchant_path ON content(merchant_id, path);
 CREATE INDEX idx_content_access_user_expires ON content_access(user_identifier, expires_at);
+CREATE UNIQUE INDEX idx_content_access_free_trial ON content_access(content_id, user_identifier) WHERE is_free_trial;
+CREATE INDEX idx_content_access_free_trial_ip ON content_access(ip_address, granted_at) WHERE is_free_trial;
 CREATE INDEX idx_bank_transactions_reference ON bank_transactions(payment_reference);
 CREATE INDEX idx_bank_transactions_merchant_date ON bank_transactions(merchant_id, transaction_date);
+CREATE UNIQUE INDEX idx_bank_transactions_merchant_bank_reference ON bank_transactions(merchant_id, bank_reference) WHERE bank_reference IS NOT NULL;
+CREATE INDEX idx_bank_transactions_booking_keyset ON bank_transactions(booking_date DESC, transaction_id DESC);
 CREATE INDEX idx_payment_sessions_merchant_status ON payment_sessions(merchant_id, status);
+-- One row per session, created when its content is first served
+CREATE UNIQUE INDEX idx_content_access_session ON content_access(session_id) WHERE session_id IS NOT NULL;
 CREATE INDEX idx_content_access_active ON content_access(is_active, expires_at) WHERE is_active = true;
+CREATE INDEX idx_disputes_status_created ON disputes(status, created_at DESC);
+CREATE INDEX idx_disputes_session_id ON disputes(session_id);
+CREATE UNIQUE INDEX idx_disputes_session_active ON disputes(session_id) WHERE status IN ('open', 'under_review');
+CREATE INDEX idx_dispute_notes_dispute_id ON dispute_notes(dispute_id, created_at);
 CREATE INDEX idx_audit_logs_merchant_timestamp ON audit_logs(merchant_id, timestamp);
 CREATE INDEX idx_audit_logs_event_type ON audit_logs(event_type);
 CREATE INDEX idx_audit_logs_session_id ON audit_logs(session_id);
@@ -196,11 +308,3 @@ ALTER TABLE payment_sessions ADD CONSTRAINT check_amount_positive CHECK (amount_
 ALTER TABLE merchants ADD CONSTRAINT check_iban_format CHECK (bank_account_iban ~ '^[A-Z]{2}[0-9]{2}[A-Z0-9]{4}[0-9]{7}([A-Z0-9]?){0,16}$');
 ALTER TABLE payment_sessions ADD CONSTRAINT check_expires_future CHECK (expires_at > created_at);
 ALTER TABLE content_access ADD CONSTRAINT check_access_expires_future CHECK (expires_at > granted_at);
-
--- Insert sample data
-INSERT INTO merchants (name, email, domain, bank_account_iban, api_key, status) VALUES
-('Demo Merchant', 'demo@example.com', 'demo.example.com', 'DE89370400440532013000', 'demo_api_key_12345', 'active');
-
-INSERT INTO content (merchant_id, path, title, price_cents, access_duration_seconds) VALUES
-((SELECT merchant_id FROM merchants WHERE email = 'demo@example.com'), '/premium/article', 'Premium Article', 250, 3600),
-((SELECT merchant_id FROM merchants WHERE email = 'demo@example.com'), '/premium/video', 'Premium Video', 500, 7200);
\ No newline at end of file
@@ -0,0 +1,17 @@
+-- Trail of administrative actions such as refunds, merchant deactivation and
+-- key rotation. audit_logs holds payment events; this table records who did
+-- what through the API.
+CREATE TABLE admin_audit_log (
+    audit_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    actor VARCHAR(100) NOT NULL,
+    action VARCHAR(100) NOT NULL,
+    target_type VARCHAR(50) NOT NULL,
+    target_id VARCHAR(100) NOT NULL,
+    metadata JSONB NOT NULL DEFAULT '{}',
+    request_id VARCHAR(100),
+    ip_address INET,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_admin_audit_log_created ON admin_audit_log(created_at DESC);
+CREATE INDEX idx_admin_audit_log_target ON admin_audit_log(target_type, target_id, created_at DESC);
@@ -0,0 +1,3 @@
+-- Endpoints a stored event already reached. Retries and replays only go to the
+-- merchant's other endpoints; uuid nil stands for the merchant's webhook_url.
+ALTER TABLE webhook_deliveries ADD COLUMN delivered_endpoints UUID[] NOT NULL DEFAULT '{}';
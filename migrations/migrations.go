@@ -0,0 +1,11 @@
+// Package migrations embeds the SQL migrations of the database schema. Each
+// version has a NNNN_name.up.sql file and a NNNN_name.down.sql file undoing
+// it; database.Migrate applies them.
+package migrations
+
+import "embed"
+
+// FS holds the migration files
+//
+//go:embed [0-9]*.sql
+var FS embed.FS